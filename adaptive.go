@@ -0,0 +1,114 @@
+package perigee
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultAdaptiveDecrease is the factor an AdaptiveLimiter cuts its limit by on congestion, when it names none.
+const DefaultAdaptiveDecrease = 0.9
+
+// AdaptiveLimiter bounds a Client's requests in flight by a limit it adjusts to what the upstream can bear,
+// as a smarter alternative to the static limits of SetMaxInFlight and Bulkhead; see Client.SetAdaptiveLimiter.
+// It follows AIMD (additive increase, multiplicative decrease), as TCP does:
+// every request completing without congestion raises the limit by 1/limit, so by about one per limit's worth of requests,
+// while each sign of congestion multiplies it by Decrease (DefaultAdaptiveDecrease, if zero).
+//
+// Congestion is signaled by responses with code 429 or 5xx, by failures to complete the exchange with the server,
+// and by responses whose headers took longer than Latency to arrive, if Latency is set.
+// Requests failing before they are sent, or canceled by the caller, say nothing about the upstream, and leave the limit be.
+//
+// The limit starts at MinLimit, and stays between MinLimit (at least 1) and MaxLimit (unbounded, if zero).
+// Requests beyond it fail fast with an *OverloadedError.
+// An AdaptiveLimiter may be shared among Clients calling the same upstream.
+type AdaptiveLimiter struct {
+	MinLimit int
+	MaxLimit int
+	Latency  time.Duration
+	Decrease float64
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+}
+
+// NewAdaptiveLimiter creates an AdaptiveLimiter keeping its limit between minLimit and maxLimit,
+// treating responses slower than latency as congestion.
+func NewAdaptiveLimiter(minLimit, maxLimit int, latency time.Duration) *AdaptiveLimiter {
+	return &AdaptiveLimiter{MinLimit: minLimit, MaxLimit: maxLimit, Latency: latency}
+}
+
+// Limit reports the number of requests currently allowed in flight.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.current())
+}
+
+// InFlight reports the number of requests currently in flight under the limiter.
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
+
+// current returns the limit, clamped to its bounds; l.mu must be held.
+func (l *AdaptiveLimiter) current() float64 {
+	floor := float64(l.MinLimit)
+	if floor < 1 {
+		floor = 1
+	}
+	if l.limit < floor {
+		l.limit = floor
+	}
+	if l.MaxLimit > 0 && l.limit > float64(l.MaxLimit) {
+		l.limit = float64(l.MaxLimit)
+	}
+	return l.limit
+}
+
+// acquire admits a request if the limit allows, returning an OverloadedError, lacking only its Url, if not.
+func (l *AdaptiveLimiter) acquire() *OverloadedError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := int(l.current())
+	if l.inflight >= limit {
+		return &OverloadedError{Limit: limit, InFlight: l.inflight}
+	}
+	l.inflight++
+	return nil
+}
+
+// release records the outcome of an admitted request, adjusting the limit.
+func (l *AdaptiveLimiter) release(resp *Response, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	if resp == nil || resp.Attempts == 0 || errors.Is(err, context.Canceled) {
+		// Never sent, or abandoned by the caller.
+		return
+	}
+	congested := resp.StatusCode == 0 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 ||
+		(l.Latency > 0 && resp.Timing.Headers > l.Latency)
+	if congested {
+		decrease := l.Decrease
+		if decrease <= 0 || decrease >= 1 {
+			decrease = DefaultAdaptiveDecrease
+		}
+		l.limit = l.current() * decrease
+	} else {
+		l.limit = l.current() + 1/l.current()
+	}
+	l.current()
+}
+
+// SetAdaptiveLimiter bounds the client's requests in flight with an AdaptiveLimiter, or lifts the bound, given nil.
+// It applies alongside any ceiling set with SetMaxInFlight.
+func (c *Client) SetAdaptiveLimiter(l *AdaptiveLimiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limiter = l
+}
@@ -0,0 +1,104 @@
+package perigee
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiterAIMD(t *testing.T) {
+	l := NewAdaptiveLimiter(2, 10, 50*time.Millisecond)
+	if l.Limit() != 2 {
+		t.Fatalf("Expected to start at the minimum; got %d", l.Limit())
+	}
+	fast := &Response{StatusCode: 200, Attempts: 1, Timing: Timing{Headers: time.Millisecond}}
+	for i := 0; i < 100; i++ {
+		if err := l.acquire(); err != nil {
+			t.Fatal(err)
+		}
+		l.release(fast, nil)
+	}
+	if l.Limit() != 10 {
+		t.Fatalf("Expected healthy responses to raise the limit to the maximum; got %d", l.Limit())
+	}
+
+	for _, congested := range []*Response{
+		{StatusCode: 503, Attempts: 1},
+		{StatusCode: 429, Attempts: 1},
+		{StatusCode: 200, Attempts: 1, Timing: Timing{Headers: time.Second}},
+		{Attempts: 1},
+	} {
+		before := l.Limit()
+		l.acquire()
+		l.release(congested, nil)
+		if l.Limit() >= before {
+			t.Fatalf("Expected %+v to lower the limit from %d; got %d", congested, before, l.Limit())
+		}
+	}
+
+	before := l.Limit()
+	l.acquire()
+	l.release(nil, errors.New("marshal failure"))
+	l.acquire()
+	l.release(&Response{}, errors.New("auth failure"))
+	if l.Limit() != before || l.InFlight() != 0 {
+		t.Fatalf("Expected a request never sent to leave the limit be; got %d, with %d in flight", l.Limit(), l.InFlight())
+	}
+
+	for i := 0; i < 100; i++ {
+		l.acquire()
+		l.release(&Response{StatusCode: 500, Attempts: 1}, nil)
+	}
+	if l.Limit() != 2 {
+		t.Fatalf("Expected the limit to bottom out at the minimum; got %d", l.Limit())
+	}
+}
+
+func TestClientAdaptiveLimiter(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer ts.Close()
+
+	client := NewClient(Options{})
+	client.SetAdaptiveLimiter(NewAdaptiveLimiter(1, 4, 0))
+	result := make(chan error, 1)
+	go func() {
+		_, err := client.Request("GET", ts.URL, Options{})
+		result <- err
+	}()
+	<-started
+
+	_, err := client.Request("GET", ts.URL, Options{})
+	var overloaded *OverloadedError
+	if !errors.As(err, &overloaded) || overloaded.Limit != 1 || overloaded.Url != ts.URL {
+		t.Fatalf("Expected an OverloadedError; got %#v", err)
+	}
+	close(release)
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientAdaptiveLimiterIgnoresLocalFailures(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	l := NewAdaptiveLimiter(1, 100, 0)
+	l.limit = 50
+	client := NewClient(Options{})
+	client.SetAdaptiveLimiter(l)
+	failing := Options{SetHeaders: func(*http.Request) error { return errors.New("no credentials") }}
+	for i := 0; i < 10; i++ {
+		if _, err := client.Request("GET", ts.URL, failing); err == nil {
+			t.Fatal("Expected SetHeaders to fail the request")
+		}
+	}
+	if l.Limit() != 50 {
+		t.Fatalf("Expected failures before sending to leave the limit at 50; got %d", l.Limit())
+	}
+}
@@ -3,59 +3,227 @@
 package perigee
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // The UnexpectedResponseCodeError structure represents a mismatch in understanding between server and client in terms of response codes.
 // Most often, this is due to an actual error condition (e.g., getting a 404 for a resource when you expect a 200).
 // However, it needn't always be the case (e.g., getting a 204 (No Content) response back when a 200 is expected).
+// Rejected is set instead of Expected when the code was refused by Options.RejectCodes, and neither is set when it was refused by Options.OkPredicate.
+// RetryAfter holds the wait the server asked for in a Retry-After header, if any (typically with a 429 or 503).
+// Details holds the body decoded into Options.ErrorResults, if given and the body could be decoded.
+// Method and Header give the request's method and the response's headers, for the request IDs and rate limits servers report there.
+// Body holds the whole response body, but the error's message quotes no more than its first MaxErrorBodySnippet bytes.
 type UnexpectedResponseCodeError struct {
-	Url      string
-	Expected []int
-	Actual   int
-	Body     []byte
+	Url        string
+	Method     string
+	Expected   []int
+	Rejected   []int
+	Actual     int
+	Header     http.Header
+	Body       []byte
+	RetryAfter time.Duration
+	Details    interface{}
+
+	// quoted holds the body as the message quotes it: with Options.RedactFields masked, then scrubbed.
+	quoted []byte
 }
 
+// MaxErrorBodySnippet caps the length of the response body quoted by an UnexpectedResponseCodeError's message.
+var MaxErrorBodySnippet = 1024
+
 func (err *UnexpectedResponseCodeError) Error() string {
-	return fmt.Sprintf("Expected HTTP response code %d when accessing URL(%s); got %d instead with the following body:\n%s", err.Expected, err.Url, err.Actual, string(err.Body))
+	target := "URL(" + err.Url + ")"
+	if err.Method != "" {
+		target = err.Method + " " + target
+	}
+	quoted := err.quoted
+	if quoted == nil {
+		quoted = err.Body
+	}
+	body := snippet(quoted, MaxErrorBodySnippet)
+	if err.Expected == nil && err.Rejected == nil {
+		return fmt.Sprintf("Unacceptable HTTP response code %d when accessing %s, with the following body:\n%s", err.Actual, target, body)
+	}
+	if err.Expected == nil {
+		return fmt.Sprintf("Rejected HTTP response code %d when accessing %s, with the following body:\n%s", err.Actual, target, body)
+	}
+	return fmt.Sprintf("Expected HTTP response code %d when accessing %s; got %d instead with the following body:\n%s", err.Expected, target, err.Actual, body)
+}
+
+// snippet returns the first max bytes of a body, without splitting a UTF-8 sequence, noting how much was left out.
+func snippet(body []byte, max int) string {
+	if max <= 0 || len(body) <= max {
+		return string(body)
+	}
+	cut := max
+	for cut > 0 && cut > max-utf8.UTFMax && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", body[:cut], len(body)-cut)
+}
+
+// The UpstreamHTMLError structure is returned when a response body which should have decoded as JSON turns out to be an HTML page.
+// Most often, this is an error page served by a load balancer or proxy sitting in front of the API, not by the API itself.
+// Title holds the page's title, if it has one, and Snippet the start of its text, with markup removed.
+type UpstreamHTMLError struct {
+	Url        string
+	StatusCode int
+	Title      string
+	Snippet    string
+}
+
+func (err *UpstreamHTMLError) Error() string {
+	return fmt.Sprintf("Expected a JSON response when accessing URL(%s); got an HTML page with status %d instead: %s", err.Url, err.StatusCode, err.summary())
+}
+
+func (err *UpstreamHTMLError) summary() string {
+	if err.Title != "" {
+		return err.Title
+	}
+	return err.Snippet
 }
 
+// The ContentTypeMismatchError structure is returned when a response's Content-Type does not match Options.ExpectContentType.
+// Actual is empty if the response carried no Content-Type at all.
+type ContentTypeMismatchError struct {
+	Url      string
+	Expected string
+	Actual   string
+}
+
+func (err *ContentTypeMismatchError) Error() string {
+	return fmt.Sprintf("Expected a response of type %s when accessing URL(%s); got %q instead", err.Expected, err.Url, err.Actual)
+}
+
+// Chunking selects how request bodies use chunked transfer encoding; see Options.Chunking.
+type Chunking int
+
+const (
+	ChunkingAuto   Chunking = iota // chunk only bodies of unknown length
+	ChunkingForce                  // chunk every body
+	ChunkingForbid                 // never chunk; the body's length must be known
+)
+
+var (
+	// ErrNoBodyToChunk is returned when Options.Chunking forces chunked encoding on a request without a body.
+	ErrNoBodyToChunk = errors.New("perigee: chunked encoding forced on a request without a body")
+
+	// ErrUnknownLength is returned when Options.Chunking forbids chunked encoding, but the request body's length is unknown.
+	ErrUnknownLength = errors.New("perigee: chunked encoding forbidden, but the request body's length is unknown; set Options.ContentLength")
+)
+
+// ErrorConstructor converts an UnexpectedResponseCodeError into an application-specific error.
+// See Options.StatusErrors.
+type ErrorConstructor func(err *UnexpectedResponseCodeError) error
+
+// defaultClient carries requests made without Options.CustomClient.
+// Its zero configuration is never modified, so it may be shared.
+var defaultClient = new(http.Client)
+
 // Request issues an HTTP request, marshaling parameters, and unmarshaling results, as configured in the provided Options parameter.
 // The Response structure returned, if any, will include accumulated results recovered from the HTTP server.
 // See the Response structure for more details.
+//
+// Requests with neither a ReqBody (or RawBody) nor any use for the response body (no Results, ResponseBuffer, or TeeBody) take a cheap path,
+// suited to high-volume loops of deletions or health checks:
+// nothing is marshaled or buffered, and the response body is merely drained, so that its connection can carry the next request.
+//
+// If the request fails after the response headers arrived, as when it times out while the body is being read,
+// the Response is returned alongside the error, carrying the status, headers, the body read so far, and timings, for diagnosis.
 func Request(method string, url string, opts Options) (*Response, error) {
 	var body io.Reader
+	var bodyText []byte
 	var response Response
 
+	start := time.Now()
+	defer func() { response.Timing.Total = time.Since(start) }()
+
+	if opts.QueryParams != nil {
+		var err error
+		url, err = appendQuery(url, opts.QueryParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	client := opts.CustomClient
 	if client == nil {
-		client = new(http.Client)
+		client = defaultClient
+	}
+	if opts.Transport != nil || opts.Jar != nil {
+		c := *client
+		if opts.Transport != nil {
+			c.Transport = opts.Transport
+		}
+		if opts.Jar != nil {
+			c.Jar = opts.Jar
+		}
+		client = &c
 	}
 
-	contentType := opts.ContentType
+	// Requests without a body carry no Content-Type, whatever the defaults.
+	var contentType string
 
 	body = nil
-	if opts.ReqBody != nil {
+	if opts.RawBody != nil {
+		contentType = opts.ContentType
+		if contentType == "" && !opts.OmitContentType {
+			contentType = "application/octet-stream"
+		}
+		body = opts.RawBody
+	} else if opts.FormBody != nil {
+		form, err := encodeQuery(opts.FormBody)
+		if err != nil {
+			return nil, err
+		}
+		contentType = opts.ContentType
+		if contentType == "" && !opts.OmitContentType {
+			contentType = "application/x-www-form-urlencoded"
+		}
+		body = strings.NewReader(form.Encode())
+	} else if opts.ReqBody != nil {
+		contentType = opts.ContentType
 		// if the content-type header is empty, but the user expicitly asked for it
 		// to be unset, then don't set contentType to application/json.
 		if contentType == "" && !opts.OmitContentType {
 			contentType = "application/json"
+			if opts.Codec != nil {
+				contentType = opts.Codec.ContentType()
+			}
 		}
 
-		if contentType == "application/json" {
-			bodyText, err := json.Marshal(opts.ReqBody)
+		if r, ok := opts.ReqBody.(io.Reader); ok && opts.Codec != nil {
+			body = r
+		} else if opts.Codec != nil {
+			var err error
+			bodyText, err = opts.Codec.Marshal(opts.ReqBody)
 			if err != nil {
 				return nil, err
 			}
-			body = strings.NewReader(string(bodyText))
+			body = bytes.NewReader(bodyText)
+		} else if contentType == "application/json" {
+			var err error
+			bodyText, err = marshalJSON(opts)
+			if err != nil {
+				return nil, err
+			}
+			body = bytes.NewReader(bodyText)
 			if opts.DumpReqJson {
-				log.Printf("Making request:\n%#v\n", string(bodyText))
+				log.Printf("Making request:\n%#v\n", string(opts.Scrubber.scrub(redactJSON(bodyText, opts.RedactFields))))
 			}
 		} else {
 			// assume opts.ReqBody implements the correct interface
@@ -63,23 +231,312 @@ func Request(method string, url string, opts Options) (*Response, error) {
 		}
 	}
 
-	req, err := http.NewRequest(method, url, body)
+	payload := bodyText
+	if opts.Encryption != nil && body != nil {
+		var err error
+		payload, err = opts.Encryption.encrypt(body, contentType)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payload)
+		contentType = "application/jose"
+		opts.ContentLength = 0
+	}
+	if opts.CompressRequest != "" && body != nil {
+		var err error
+		payload, err = compressBody(opts.CompressRequest, body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(payload)
+		opts.ContentLength = 0
+	}
+	if body != nil && payload == nil && opts.ContentLength <= 0 {
+		if n, ok := readerLength(body); ok && n > 0 {
+			opts.ContentLength = n
+		}
+	}
+	switch opts.Chunking {
+	case ChunkingForce:
+		if body == nil {
+			return nil, ErrNoBodyToChunk
+		}
+	case ChunkingForbid:
+		if body != nil && payload == nil && opts.ContentLength <= 0 {
+			if n, ok := readerLength(body); !ok || n != 0 {
+				return nil, ErrUnknownLength
+			}
+			body = http.NoBody
+		}
+	}
+
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	opts.Context = withTrace(opts.Context, opts, &response.Conn)
+
+	nextBody, replayable := func() (io.Reader, error) { return body, nil }, false
+	if opts.Retry != nil {
+		nextBody, replayable = rewindable(body, payload)
+	}
+	send := client.Do
+	if len(opts.Middleware) > 0 {
+		send = chain(send, opts.Middleware)
+	}
+	httpResponse, attempts, err := opts.Retry.do(opts.Context, send, acceptance(opts), replayable, func() (*http.Request, error) {
+		body, err := nextBody()
+		if err != nil {
+			return nil, err
+		}
+		return buildRequest(method, url, body, bodyText, contentType, opts)
+	})
+	response.Attempts = attempts
+	response.Timing.Headers = time.Since(start)
+	if err == nil && opts.ThrottleDownload != nil {
+		httpResponse.Body = throttleBody(opts.Context, opts.ThrottleDownload, httpResponse.Body)
+	}
+	if err == nil {
+		response.ContentEncoding = httpResponse.Header.Get("Content-Encoding")
+	}
+	if err == nil && !opts.KeepCompressed {
+		err = decodeContent(httpResponse)
+		if err != nil {
+			httpResponse.Body.Close()
+		}
+	}
+	if httpResponse != nil {
+		response.HttpResponse = *httpResponse
+		response.StatusCode = httpResponse.StatusCode
+		response.ContentType = mediaType(httpResponse.Header.Get("Content-Type"))
+		response.Deprecation = parseDeprecation(url, httpResponse.Header)
+		if response.Deprecation != nil && opts.OnDeprecation != nil {
+			opts.OnDeprecation(response.Deprecation)
+		}
+	}
+
 	if err != nil {
-		return nil, err
+		return &response, classifyTimeout(url, err)
+	}
+	defer httpResponse.Body.Close()
+
+	// This if-statement is legacy code, preserved for backward compatibility.
+	if opts.StatusCode != nil {
+		*opts.StatusCode = httpResponse.StatusCode
+	}
+
+	// A 304 to a conditional request simply confirms that the caller's copy is current; there's nothing to decode.
+	// Any other 304 is judged by OkCodes like any other status.
+	if httpResponse.StatusCode == http.StatusNotModified && !opts.NotModifiedIsError && conditional(httpResponse.Request) {
+		response.NotModified = true
+		if opts.HeaderResults != nil {
+			return &response, decodeHeaders(httpResponse.Header, opts.HeaderResults)
+		}
+		return &response, nil
+	}
+
+	acceptableResponseCodes := opts.OkCodes
+	accepted, rejected := accepts(opts, httpResponse), rejects(opts, httpResponse)
+	if !accepted || rejected {
+		b, _ := ioutil.ReadAll(httpResponse.Body)
+		unexpected := &UnexpectedResponseCodeError{
+			Url:    url,
+			Method: method,
+			Actual: httpResponse.StatusCode,
+			Header: httpResponse.Header,
+			Body:   opts.Scrubber.scrub(b),
+			quoted: opts.Scrubber.scrub(redactJSON(b, opts.RedactFields)),
+		}
+		unexpected.RetryAfter, _ = retryAfter(httpResponse.Header)
+		if opts.ErrorResults != nil && len(b) > 0 && bodyDecoder(response.ContentType, opts)(b, opts.ErrorResults) == nil {
+			unexpected.Details = opts.ErrorResults
+		}
+		if !accepted && opts.OkPredicate == nil {
+			unexpected.Expected = acceptableResponseCodes
+		} else if accepted {
+			unexpected.Rejected = opts.RejectCodes
+		}
+		if construct, ok := opts.StatusErrors[httpResponse.StatusCode]; ok {
+			if err := construct(unexpected); err != nil {
+				return &response, err
+			}
+		}
+		if httpResponse.StatusCode == http.StatusPreconditionFailed {
+			return &response, newPreconditionFailedError(unexpected, httpResponse.Header)
+		}
+		if response.ContentType == ProblemMediaType {
+			if problem, ok := newProblemDetails(unexpected); ok {
+				return &response, problem
+			}
+		}
+		return &response, unexpected
 	}
+	if opts.HeaderResults != nil {
+		err = decodeHeaders(httpResponse.Header, opts.HeaderResults)
+		if err != nil {
+			return &response, err
+		}
+	}
+
+	if opts.ExpectContentType != "" && httpResponse.StatusCode != http.StatusNoContent {
+		if !matchMediaType(opts.ExpectContentType, response.ContentType) {
+			return &response, &ContentTypeMismatchError{
+				Url:      url,
+				Expected: opts.ExpectContentType,
+				Actual:   response.ContentType,
+			}
+		}
+	}
+
+	// Responses to HEAD carry headers alone, whatever their Content-Type and Content-Length say; there's nothing to decode.
+	if method == http.MethodHead {
+		return &response, nil
+	}
+
+	var responseBody io.Reader = httpResponse.Body
+	if opts.TeeBody != nil {
+		responseBody = io.TeeReader(responseBody, opts.TeeBody)
+	}
+
+	if opts.StreamBody != nil {
+		return &response, classifyTimeout(url, opts.StreamBody(responseBody))
+	}
+	if opts.Results != nil || opts.ResponseBuffer != nil || opts.Verifier != nil {
+		var jsonResult []byte
+		jsonResult, err = readBody(responseBody, httpResponse.ContentLength, opts.ResponseBuffer)
+		response.JsonResult = jsonResult
+		err = classifyTimeout(url, err)
+		if err == nil && opts.Verifier != nil {
+			err = opts.Verifier.VerifyResponse(httpResponse, jsonResult)
+			if err != nil {
+				err = &VerificationError{Url: url, Err: err}
+			}
+		}
+		if err != nil || opts.Results == nil {
+			return &response, err
+		}
+		// This if-statement is legacy code, preserved for backward compatibility.
+		if opts.ResponseJson != nil {
+			*opts.ResponseJson = jsonResult
+		}
+		if opts.KeepCompressed && !identity(response.ContentEncoding) {
+			return &response, nil
+		}
+
+		text, contentType := jsonResult, httpResponse.Header.Get("Content-Type")
+		if opts.Encryption != nil && len(jsonResult) > 0 {
+			text, contentType, err = opts.Encryption.decrypt(jsonResult)
+			if err != nil {
+				return &response, err
+			}
+		}
+		if raw, ok := opts.Results.(*[]byte); ok {
+			*raw = text
+			response.Results = opts.Results
+			return &response, nil
+		}
+		text, err = transcodeToUTF8(text, contentType)
+		if err != nil {
+			return &response, err
+		}
+		mt := mediaType(contentType)
+		if s, ok := opts.Results.(*string); ok && decodesAsText(mt, text) {
+			*s = string(text)
+			response.Results = opts.Results
+			return &response, nil
+		}
+		if opts.LenientJson {
+			text = stripJSONPreamble(text)
+		}
+		if opts.SnakeCaseKeys && decodesAsJSON(mt) {
+			text, err = unsnakeKeys(text, reflect.TypeOf(opts.Results))
+		}
+		if err == nil {
+			err = bodyDecoder(mt, opts)(text, opts.Results)
+		}
+		if err == nil {
+			response.Results = opts.Results
+		} else if looksLikeHTML(text) {
+			err = newUpstreamHTMLError(url, response.StatusCode, opts.Scrubber.scrub(text))
+		}
+	} else if opts.TeeBody != nil {
+		// responseBody copies to TeeBody as it is read.
+		_, err = io.Copy(ioutil.Discard, responseBody)
+		err = classifyTimeout(url, err)
+	} else {
+		discardBody(httpResponse.Body)
+	}
+	return &response, err
+}
+
+// maxDrain bounds how much of an unwanted response body is read so that its connection can be reused;
+// past that, closing the connection is cheaper than reading on.
+const maxDrain = 64 << 10
 
+// discardBody drains and closes a response body nobody wants to read.
+func discardBody(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, maxDrain))
+	body.Close()
+}
+
+// buildRequest prepares a single attempt at an HTTP request, headers and all, as configured in opts.
+func buildRequest(method, url string, body io.Reader, bodyText []byte, contentType string, opts Options) (*http.Request, error) {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts.Priority != PriorityNormal {
+		ctx = WithPriority(ctx, opts.Priority)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ThrottleUpload != nil && req.Body != nil && req.Body != http.NoBody {
+		req.Body = throttleBody(ctx, opts.ThrottleUpload, req.Body)
+	}
 	if contentType != "" {
-		req.Header.Add("Content-Type", contentType)
+		req.Header.Set("Content-Type", contentType)
+	}
+	if opts.CompressRequest != "" && body != nil {
+		req.Header.Set("Content-Encoding", strings.ToLower(opts.CompressRequest))
 	}
 
-	if opts.ContentLength > 0 {
+	if opts.Chunking == ChunkingForce {
+		req.ContentLength = -1
+		req.TransferEncoding = []string{"chunked"}
+	} else if opts.ContentLength > 0 {
 		req.ContentLength = opts.ContentLength
-		req.Header.Add("Content-Length", string(opts.ContentLength))
+		req.Header.Set("Content-Length", strconv.FormatInt(opts.ContentLength, 10))
 	}
 
 	if opts.MoreHeaders != nil {
+		// Set, rather than add, so that Content-Type or Accept given here replaces the default instead of joining it.
 		for k, v := range opts.MoreHeaders {
-			req.Header.Add(k, v)
+			req.Header.Set(k, v)
+		}
+	}
+
+	if opts.ReqHeaders != nil {
+		headers, err := encodeHeaders(opts.ReqHeaders)
+		if err != nil {
+			return nil, err
+		}
+		for k, values := range headers {
+			req.Header[k] = values
+		}
+	}
+
+	if req.Header.Get("Accept-Encoding") == "" {
+		accept := opts.AcceptEncoding
+		if accept == "" {
+			accept = acceptEncoding()
+		}
+		// Asking for gzip ourselves keeps Go's transport from decompressing it behind our back.
+		if accept == "" && opts.KeepCompressed {
+			accept = "gzip"
+		}
+		if accept != "" {
+			req.Header.Set("Accept-Encoding", accept)
 		}
 	}
 
@@ -87,61 +544,147 @@ func Request(method string, url string, opts Options) (*Response, error) {
 	// to be unset, then don't set accept to application/json.
 	if accept := req.Header.Get("Accept"); accept == "" && !opts.OmitAccept {
 		accept = opts.Accept
+		if len(opts.AcceptTypes) > 0 {
+			accept = formatAccept(opts.AcceptTypes)
+		}
 		if accept == "" {
 			accept = "application/json"
+			if opts.Codec != nil {
+				accept = opts.Codec.ContentType()
+			}
+		}
+		req.Header.Set("Accept", accept)
+	}
+
+	if opts.DeadlineHeader != "" {
+		if deadline, ok := ctx.Deadline(); ok {
+			remaining := time.Until(deadline).Milliseconds()
+			if remaining < 0 {
+				remaining = 0
+			}
+			req.Header.Set(opts.DeadlineHeader, strconv.FormatInt(remaining, 10))
+		}
+	}
+
+	if !opts.IfUnmodifiedSince.IsZero() {
+		req.Header.Set("If-Unmodified-Since", opts.IfUnmodifiedSince.UTC().Format(http.TimeFormat))
+	}
+
+	if opts.ReplayGuard != nil {
+		err = opts.ReplayGuard.stamp(req)
+		if err != nil {
+			return nil, err
 		}
-		req.Header.Add("Accept", accept)
 	}
 
 	if opts.SetHeaders != nil {
 		err = opts.SetHeaders(req)
 		if err != nil {
-			return &response, err
+			return nil, err
 		}
 	}
 
-	httpResponse, err := client.Do(req)
-	if httpResponse != nil {
-		response.HttpResponse = *httpResponse
-		response.StatusCode = httpResponse.StatusCode
+	if opts.Auth != nil {
+		err = opts.Auth.Authenticate(req)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if err != nil {
-		return &response, err
-	}
-	// This if-statement is legacy code, preserved for backward compatibility.
-	if opts.StatusCode != nil {
-		*opts.StatusCode = httpResponse.StatusCode
+	if opts.Validator != nil {
+		err = opts.Validator.ValidateRequest(req, bodyText)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	acceptableResponseCodes := opts.OkCodes
-	if len(acceptableResponseCodes) != 0 {
-		if not_in(httpResponse.StatusCode, acceptableResponseCodes) {
-			b, _ := ioutil.ReadAll(httpResponse.Body)
-			httpResponse.Body.Close()
-			return &response, &UnexpectedResponseCodeError{
-				Url:      url,
-				Expected: acceptableResponseCodes,
-				Actual:   httpResponse.StatusCode,
-				Body:     b,
-			}
+	return req, nil
+}
+
+// readerLength determines how many bytes remain in a request body, where that is possible without reading it,
+// so that the body can be sent with a Content-Length rather than chunked.
+func readerLength(r io.Reader) (int64, bool) {
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	case *os.File:
+		fi, err := r.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return 0, false
 		}
-	}
-	if opts.Results != nil {
-		defer httpResponse.Body.Close()
-		jsonResult, err := ioutil.ReadAll(httpResponse.Body)
-		response.JsonResult = jsonResult
+		offset, err := r.Seek(0, io.SeekCurrent)
 		if err != nil {
-			return &response, err
+			return 0, false
 		}
+		return fi.Size() - offset, true
+	}
+	return 0, false
+}
 
-		err = json.Unmarshal(jsonResult, opts.Results)
-		// This if-statement is legacy code, preserved for backward compatibility.
-		if opts.ResponseJson != nil {
-			*opts.ResponseJson = jsonResult
+// readBody reads the entire response body.
+// If the caller supplied a buffer, it is reset and reused, and the returned slice aliases its contents.
+// A known length lets the buffer be sized once, rather than grown as the body arrives.
+func readBody(r io.Reader, length int64, buf *bytes.Buffer) ([]byte, error) {
+	if buf == nil {
+		if length < 0 || length > maxPresize {
+			return ioutil.ReadAll(r)
 		}
+		buf = bytes.NewBuffer(make([]byte, 0, length+bytes.MinRead))
+	} else {
+		buf.Reset()
+	}
+	_, err := buf.ReadFrom(r)
+	return buf.Bytes(), err
+}
+
+// maxPresize caps the buffer readBody allocates up front on the strength of a Content-Length, which a server may overstate.
+const maxPresize = 16 << 20
+
+// accepts reports whether opts' OkCodes, or their OkPredicate if set, take resp as a success.
+func accepts(opts Options, resp *http.Response) bool {
+	if opts.OkPredicate != nil {
+		return opts.OkPredicate(resp)
+	}
+	return len(opts.OkCodes) == 0 || !not_in(resp.StatusCode, opts.OkCodes)
+}
+
+// rejects reports whether resp's code is among opts' RejectCodes.
+func rejects(opts Options, resp *http.Response) bool {
+	return len(opts.RejectCodes) != 0 && !not_in(resp.StatusCode, opts.RejectCodes)
+}
+
+// acceptance returns a function reporting whether opts accept a response, for the retry policy to leave alone,
+// or nil if opts set none of OkCodes, OkPredicate and RejectCodes, leaving every code to the policy.
+func acceptance(opts Options) func(*http.Response) bool {
+	if len(opts.OkCodes) == 0 && opts.OkPredicate == nil && len(opts.RejectCodes) == 0 {
+		return nil
+	}
+	return func(resp *http.Response) bool {
+		return accepts(opts, resp) && !rejects(opts, resp)
 	}
-	return &response, err
+}
+
+// conditional reports whether req asks for a body only if it changed, so that a 304 is a fitting answer.
+func conditional(req *http.Request) bool {
+	return req != nil && (req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "")
+}
+
+// StatusRange lists the status codes from first to last, inclusive, for use in OkCodes or RejectCodes.
+func StatusRange(first, last int) []int {
+	if last < first {
+		return nil
+	}
+	codes := make([]int, 0, last-first+1)
+	for code := first; code <= last; code++ {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// isJSONString reports whether a body holds a JSON string, rather than plain text.
+func isJSONString(text []byte) bool {
+	text = bytes.TrimSpace(text)
+	return len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"'
 }
 
 // not_in returns false if, and only if, the provided needle is _not_
@@ -155,6 +698,32 @@ func not_in(needle int, haystack []int) bool {
 	return true
 }
 
+// RequestWithContext issues an HTTP request as Request does, governed by ctx in place of Options.Context:
+// canceling ctx, or reaching its deadline, aborts the request.
+func RequestWithContext(ctx context.Context, method string, url string, opts Options) (*Response, error) {
+	opts.Context = ctx
+	return Request(method, url, opts)
+}
+
+// Patch makes a PATCH request, as for a partial update, against a server; see Request.
+// The url must be a fully-formed URL string.
+func Patch(url string, opts Options) (*Response, error) {
+	return Request("PATCH", url, opts)
+}
+
+// Head makes a HEAD request against a server, as for checking a resource's existence or metadata; see Request.
+// The url must be a fully-formed URL string.
+// The response has no body, so Results is left untouched; use HeaderResults, or the headers of the Response returned, instead.
+func Head(url string, opts Options) (*Response, error) {
+	return Request("HEAD", url, opts)
+}
+
+// OptionsRequest makes an OPTIONS request against a server, as for discovering the methods a resource allows; see Request.
+// The url must be a fully-formed URL string.
+func OptionsRequest(url string, opts Options) (*Response, error) {
+	return Request("OPTIONS", url, opts)
+}
+
 // Post makes a POST request against a server using the provided HTTP client.
 // The url must be a fully-formed URL string.
 // DEPRECATED.  Use Request() instead.
@@ -207,17 +776,38 @@ func Put(url string, opts Options) error {
 // If the ReqBody field is provided, it will be embedded as a JSON object.
 // Otherwise, provide nil.
 //
+// QueryParams, if set, adds parameters to the URL's query, after any it already has, escaped consistently.
+// It may hold url.Values, a map[string]string, or a structure (or pointer to one) whose fields are tagged with parameter names,
+// as in `url:"limit,omitempty"`.
+// Untagged exported fields use the field's name, and `url:"-"` skips a field.
+// With omitempty, zero values are left out; nil pointers always are.
+// Slices send one parameter per element, and times are sent in RFC 3339 form.
+//
+// RawBody, if set, is sent as the request body just as it is, in place of ReqBody, for binary objects or pre-serialized payloads;
+// wrap a []byte with bytes.NewReader.
+// It is streamed to the server without being buffered, unless CompressRequest or Encryption needs it whole.
+// Its Content-Type is ContentType, or application/octet-stream if that's unset.
+//
 // If JSON output is to be expected from the response,
 // provide either a pointer to the container structure in Results,
 // or a pointer to a nil-initialized pointer variable.
 // The latter method will cause the unmarshaller to allocate the container type for you.
 // If no response is expected, provide a nil Results value.
+// To capture a body which is not JSON, such as a token, a PEM block, or a binary object, point Results at a []byte, which receives the body as it arrived,
+// or at a string, which receives the body as text (transcoded to UTF-8),
+// unless the body is a JSON string in a JSON response, or of a type with a decoder registered with RegisterDecoder.
 //
 // The MoreHeaders map, if non-nil or empty, provides a set of headers to add to those
-// already present in the request.  At present, only Accepted and Content-Type are set
-// by default.
+// already present in the request.  At present, only Accept and Content-Type are set
+// by default; naming either here replaces the default, rather than sending both values.
 //
 // OkCodes provides a set of acceptable, positive responses.
+// Use StatusRange to accept a whole class of codes, e.g., StatusRange(200, 299) for every 2xx code.
+//
+// OkPredicate, if set, decides which responses are acceptable in place of OkCodes, for decisions a list of codes can't express,
+// such as accepting a 404 only when a header says the resource was deliberately removed.
+// It receives the response before its body is read, and must not read the body itself.
+// RejectCodes still refuses the codes it lists.
 //
 // If provided, StatusCode specifies a pointer to an integer, which will receive the
 // returned HTTP status code, successful or not.  DEPRECATED; use the Response.StatusCode field instead for new software.
@@ -238,25 +828,239 @@ func Put(url string, opts Options) error {
 // Any error generated will terminate the request and will propegate back to the caller.
 //
 // OmitContentType allows the caller to explicitly omit the content-type header, even if a request
-// body is provided.
+// body is provided.  Requests without a body never carry one; ContentType applies only to request bodies.
 //
 // OmitAccept allows the caller to explicitly omit the accept header. This is needed to appease some 204 response codes.
+//
+// TeeBody, if set, receives a copy of the response body as it is read, for instance to stream a download to a file or a hash.
+// When Results is also set, the body is copied and decoded in a single pass, without reading it twice.
+// Only successful responses are copied; error bodies are reported through UnexpectedResponseCodeError instead.
+//
+// OnInformational, if set, is called with each interim 1xx response received before the final one, such as 103 (Early Hints),
+// so that callers can start preloading the resources it links to, or log the server's hints.
+// 100 (Continue) is included when the request carries Expect: 100-continue.
+//
+// StreamBody, if set, is handed the body of a successful response to read as it arrives, in place of decoding it into Results,
+// so that bodies of any size can be processed in bounded memory; see StreamArray.
+// Whatever it leaves unread is discarded.
+//
+// NotModifiedIsError restores strict handling of 304 (Not Modified) responses.
+// By default, a 304 received in response to a conditional request (e.g., one carrying If-None-Match) sets Response.NotModified,
+// skips decoding entirely, and is not reported as an UnexpectedResponseCodeError even if OkCodes omits it.
+// A 304 to a request carrying neither If-None-Match nor If-Modified-Since, or any 304 with NotModifiedIsError set,
+// is subject to OkCodes like any other status.
+//
+// Validator, if set, checks the fully-built request just before it is sent; see OpenAPIValidator for a spec-driven implementation.
+// Any error generated will terminate the request without contacting the server, and will propagate back to the caller.
+//
+// StatusErrors maps response codes outside of OkCodes to caller-supplied error constructors.
+// When a mapped code arrives, its constructor receives the UnexpectedResponseCodeError that would otherwise be returned,
+// and whatever it returns (e.g., myapi.ErrImageNotFound for a 404) is returned instead.
+// A constructor returning nil falls back to the UnexpectedResponseCodeError.
+// Absent a constructor, a response with an RFC 7807 body (application/problem+json) yields a ProblemDetails, which wraps that error.
+//
+// ResponseBuffer, if set, is reset and filled with the raw response body instead of allocating a fresh slice on every call.
+// Response.JsonResult then aliases the buffer's contents, and is only valid until the buffer is next reused.
+// High-frequency pollers can use this to avoid a per-call allocation.
+// The body is captured even if Results is nil.
+//
+// AcceptTypes, if provided, lists the media types acceptable in the response, most preferred first, each with an optional quality weight.
+// It takes precedence over Accept.
+// Whichever type the server picks, Results is decoded accordingly: XML types (including +xml suffixes) with encoding/xml,
+// text/csv with UnmarshalCSV, types registered with RegisterDecoder with their decoder, and everything else as JSON.
+// Response.ContentType reports the type actually received.
+// Bodies labeled with a charset other than UTF-8 (ISO-8859-1, Windows-1252, UTF-16, or any registered with RegisterCharset)
+// are transcoded to UTF-8 before being decoded; JsonResult still holds the bytes as received.
+//
+// LenientJson, if set, strips a leading UTF-8 byte order mark and any well-known XSSI protection prefix
+// (")]}'", "while(1);", or "for(;;);") from the response body before decoding it.
+// Several real-world APIs prepend these, which otherwise produces opaque decoding errors.
+//
+// Context, if set, governs the request: canceling it, or reaching its deadline, aborts the request.
+// A deadline reached, like any other timeout, yields a *TimeoutError; see also IsTimeout and IsTemporary.
+//
+// Retry, if set, retries transient failures as described by the RetryPolicy; Response.Attempts reports how many attempts were made.
+// Marshaled request bodies are marshaled once and the same bytes sent with each attempt, and io.Seeker bodies are rewound;
+// a request whose body is some other io.Reader is attempted only once, since its body cannot be replayed.
+//
+// Priority ranks the request against others queued for the same host when a concurrency limit, such as a Bulkhead's, is saturated.
+// See the Priority type.
+//
+// HeaderResults, if set, points to a structure filled from the headers of a successful response, as directed by its fields' header tags.
+// For example, a field tagged `header:"X-Container-Object-Count"` of type int64 receives that header's value, converted.
+// Strings, numbers, booleans, times, durations, pointers to these, and []string are supported;
+// a map[string]string tagged with a trailing * (e.g., `header:"X-Object-Meta-*"`) collects every header bearing the prefix.
+// Object storage APIs, such as OpenStack Swift, return most of their metadata this way.
+//
+// RejectCodes, if provided, lists response codes to treat as failures, yielding an UnexpectedResponseCodeError; any other code is accepted,
+// unless OkCodes is also given, in which case a code must appear in OkCodes and not in RejectCodes.
+// Tools wanting every response short of a server error can use RejectCodes: StatusRange(500, 599).
+//
+// Transport, if set, carries this request in place of CustomClient's transport, keeping the client's other settings (timeout, redirect policy, cookie jar).
+// It suits the odd request needing a different route, such as one through a SOCKS proxy,
+// or one to a known device with a self-signed certificate, without building a second client.
+//
+// Jar, if set, stores the cookies this request receives and supplies those it should send, in place of CustomClient's cookie jar.
+// Requests made without a Jar, through an http.Client without one, neither send nor keep cookies.
+// Clients hold cookies only if given a jar of their own (see Client.EnableCookies).
+//
+// Auth, if set, adds credentials to each attempt of the request, after SetHeaders has run.
+// TokenAuth suits services issuing tokens which expire, refreshing them ahead of time.
+//
+// ReplayGuard, if set, stamps each attempt of the request with a timestamp and a nonce, for APIs with replay protection.
+// The headers are set before SetHeaders and Auth run, so that hooks signing the request can include them in the string they sign.
+//
+// Verifier, if set, checks the signature of a successful response over its body, before anything is decoded,
+// failing the request with a VerificationError if the response is unsigned or the signature does not match.
+// HMACVerifier and PublicKeyVerifier cover signatures made with a shared secret or with the server's private key.
+// The body is verified as perigee reads it, after decompression; responses handled by StreamBody, decoded as they arrive, are not verified.
+//
+// Encryption, if set, encrypts the request body with JWE, sending it as application/jose, and decrypts the body of a successful response before decoding it.
+// A response body which is not a JWE payload fails the request, lest a plaintext response pass unnoticed.
+// The decrypted body is decoded according to the content type recorded in the payload's header ("cty"), as JSON if there is none.
+// ResponseBuffer and JsonResult hold the body as it arrived, encrypted; Verifier, if also set, checks that form.
+//
+// RedactFields lists JSON fields whose values are masked (replaced with Redacted) wherever perigee logs or displays a body:
+// request bodies dumped by DumpReqJson, and response bodies quoted by UnexpectedResponseCodeError's message.
+// A field is named by its key ("password"), matching at any depth, or by a dotted path of keys ("authentication.apiKey"),
+// matching wherever that nesting appears; keys are matched regardless of case.
+// The bodies sent, and the Body field of errors, are left as they are.
+//
+// Scrubber, if set, is applied to every body perigee logs or attaches to an error, after RedactFields,
+// so that organizations can plug in masking aware of their own data classification:
+// request bodies dumped by DumpReqJson, the Body of an UnexpectedResponseCodeError, and the page summarized by an UpstreamHTMLError.
+//
+// IfUnmodifiedSince, if set, makes a write conditional on the resource not having been modified since then (If-Unmodified-Since),
+// typically the time from Response.LastModified when the resource was fetched, for optimistic concurrency.
+// Should someone else have modified it meanwhile, the server answers 412, and the request fails with a PreconditionFailedError.
+//
+// ThrottleUpload and ThrottleDownload, if set, limit the rate at which the request and response bodies are transferred,
+// so that bulk transfers leave room on the link for interactive traffic.
+// Responses are throttled as they arrive, before any decompression.
+// Requests sharing a Throttle share its rate; put one in a Client's defaults to limit the client as a whole.
+//
+// FormBody, if set, is sent as an application/x-www-form-urlencoded request body, in place of ReqBody, as OAuth token endpoints and many older APIs require.
+// It holds the same kinds of values as QueryParams, encoded the same way.
+// RawBody takes precedence over it.
+//
+// DeadlineHeader, if set, names a header (e.g., X-Request-Timeout-Ms) carrying the milliseconds left before Options.Context's deadline,
+// so that well-behaved servers can abandon work the client will no longer wait for.
+// It is computed afresh for every attempt, and omitted if the context has no deadline.
+//
+// OnDeprecation, if set, is called with any warning a response carries that its endpoint is deprecated or due for removal
+// (Deprecation, Sunset, or Warning 299 headers), so SDK users learn of it before the endpoint disappears;
+// LogDeprecation, for one, logs them.
+// Response.Deprecation holds the warning either way.
+//
+// Middleware, if set, intercepts every request on its way to the server, and its response on the way back; see Middleware.
+// The first is outermost: it sees the request first, and the response last.
+// Merged Options chain their middleware, the defaults' first, so that per-call middleware sees, and may override, what a Client's middleware did.
+//
+// Codec, if set, selects the format of request and response bodies in place of JSON: JSONCodec, XMLCodec, MsgPackCodec, CBORCodec, or one of your own.
+// ReqBody is marshaled with it (unless it is an io.Reader, sent as is), and its media type becomes the default Content-Type and Accept headers.
+// Responses of its media type, or with no Content-Type at all, are decoded into Results with it;
+// responses of other types still go to the Decoder registered for them.
+//
+// ErrorResults, if set, receives the body of a response whose code is not acceptable, decoded as Results would be,
+// so that callers can surface the error messages, codes, and request IDs servers provide.
+// The UnexpectedResponseCodeError returned carries it as Details; a body which fails to decode (e.g., a proxy's HTML error page) leaves Details nil.
+//
+// ContentLength, if positive, gives the length of a request body supplied as an io.Reader,
+// so that it is sent with a Content-Length header rather than chunked, as some storage endpoints (e.g., OpenStack Swift) require.
+// The reader must yield exactly that many bytes.
+// It needn't be given for bytes.Reader, strings.Reader, bytes.Buffer, or regular files, whose lengths perigee determines itself.
+//
+// Chunking selects whether a request body may be sent with chunked transfer encoding.
+// By default, bodies of known length are sent whole, and others chunked.
+// ChunkingForce chunks every body, failing with ErrNoBodyToChunk if there is none;
+// ChunkingForbid requires the body's length to be known, failing with ErrUnknownLength before anything is sent if it is not.
+// HTTP/2 and later have no chunked encoding, and frame bodies of unknown length their own way.
+//
+// CompressRequest, if set, names the content coding (e.g., "gzip", or "zstd" where compiled in) in which to compress the request body;
+// see RegisterContentCoding.
+// Response bodies in any registered coding are decompressed before decoding, whatever this field holds.
+//
+// AcceptEncoding, if set, is sent as the Accept-Encoding header, overriding perigee's own negotiation (and Go's automatic gzip):
+// "identity" asks for an uncompressed body, while a list such as "zstd, gzip" asks for those codings alone.
+// Responses in registered codings are still decompressed before decoding.
+//
+// KeepCompressed, if true, hands back the response body exactly as received, still compressed, with its Content-Encoding header intact,
+// for proxies which must pass payloads along unaltered.
+// Results are not decoded from a compressed body; Response.JsonResult holds the compressed bytes, and Response.ContentEncoding their coding.
+// Such requests typically use TeeBody or ResponseBuffer instead.
+//
+// SnakeCaseKeys, if true, maps between the snake_case keys of JSON documents and the CamelCase names of untagged structure fields,
+// sparing SDKs the tags they would otherwise need on every field of APIs keyed in snake_case.
+// Request bodies are sent with keys such as server_id for a field named ServerID, and such keys in responses fill the like-named fields of Results.
+// Fields with json tags keep the keys their tags name, and types with their own MarshalJSON or UnmarshalJSON methods are left to them.
+//
+// ReqHeaders, if set, is a structure (or a pointer to one) whose fields' header tags direct which request headers they supply,
+// symmetrically with HeaderResults, so header-heavy APIs can be modeled with typed structures rather than string maps.
+// Fields holding zero values are omitted, so optional headers are best modeled as pointers.
+// Headers supplied this way take precedence over MoreHeaders.
+//
+// ExpectContentType, if set, requires successful responses to carry a matching Content-Type; any other yields a ContentTypeMismatchError
+// before any attempt to decode the body.
+// It holds either a media type (e.g., "application/json") or a pattern in which * matches any run of characters other than "/"
+// (e.g., "application/*" or "application/*+json"); parameters such as charset are ignored.
+// A 204 (No Content) response, having no body, is exempt.
 type Options struct {
-	CustomClient    *http.Client
-	ReqBody         interface{}
-	Results         interface{}
-	MoreHeaders     map[string]string
-	OkCodes         []int
-	StatusCode      *int    `DEPRECATED`
-	DumpReqJson     bool    `UNSUPPORTED`
-	ResponseJson    *[]byte `DEPRECATED`
-	Response        **Response
-	ContentType     string `json:"Content-Type,omitempty"`
-	ContentLength   int64  `json:"Content-Length,omitempty"`
-	Accept          string `json:"Accept,omitempty"`
-	SetHeaders      func(r *http.Request) error
-	OmitContentType bool
-	OmitAccept      bool
+	CustomClient       *http.Client
+	ReqBody            interface{}
+	Results            interface{}
+	MoreHeaders        map[string]string
+	OkCodes            []int
+	StatusCode         *int    `perigee:"deprecated"`
+	DumpReqJson        bool    `perigee:"unsupported"`
+	ResponseJson       *[]byte `perigee:"deprecated"`
+	Response           **Response
+	ContentType        string `json:"Content-Type,omitempty"`
+	ContentLength      int64  `json:"Content-Length,omitempty"`
+	Accept             string `json:"Accept,omitempty"`
+	SetHeaders         func(r *http.Request) error
+	OmitContentType    bool
+	OmitAccept         bool
+	Validator          RequestValidator
+	TeeBody            io.Writer
+	NotModifiedIsError bool
+	StatusErrors       map[int]ErrorConstructor
+	ResponseBuffer     *bytes.Buffer
+	AcceptTypes        []AcceptType
+	LenientJson        bool
+	ExpectContentType  string
+	Context            context.Context
+	Retry              *RetryPolicy
+	Priority           Priority
+	HeaderResults      interface{}
+	ReqHeaders         interface{}
+	SnakeCaseKeys      bool
+	CompressRequest    string
+	AcceptEncoding     string
+	KeepCompressed     bool
+	Chunking           Chunking
+	Transport          http.RoundTripper
+	RejectCodes        []int
+	StreamBody         func(body io.Reader) error
+	OnInformational    func(code int, header http.Header)
+	Jar                http.CookieJar
+	Auth               AuthProvider
+	ReplayGuard        *ReplayGuard
+	Verifier           ResponseVerifier
+	Encryption         *JWE
+	RedactFields       []string
+	Scrubber           Scrubber
+	IfUnmodifiedSince  time.Time
+	ThrottleUpload     *Throttle
+	ThrottleDownload   *Throttle
+	DeadlineHeader     string
+	OnDeprecation      func(*Deprecation)
+	Middleware         []Middleware
+	RawBody            io.Reader
+	QueryParams        interface{}
+	Codec              Codec
+	FormBody           interface{}
+	ErrorResults       interface{}
+	OkPredicate        func(*http.Response) bool
 }
 
 // Response contains return values from the various request calls.
@@ -269,12 +1073,43 @@ type Options struct {
 // If Results is specified in the Options:
 // - JsonResult will contain the raw return from the request call
 //   This is most useful for diagnostics.
-// - Result will contain the unmarshalled json either in the Result passed in
-//   or the unmarshaller will allocate the container type for you.
+// - Results will refer to the container the json was unmarshalled into; that is, the very value passed in Options.Results.
+//   Code holding only the Response can recover a typed value with ResultsAs.
+//
+// ContentType holds the media type of the response body, without parameters (e.g., "application/json").
+//
+// ContentEncoding holds the Content-Encoding the response arrived with, if any, even if perigee has since decompressed the body;
+// see Options.KeepCompressed.
+//
+// Conn describes the connection which carried the request: whether it was reused from the pool, and the address of the server.
+//
+// Timing records how long the request took, up to the arrival of the response headers and in total.
+//
+// Attempts counts the attempts made to complete the request, including the first; see Options.Retry.
+//
+// NotModified is true when the server answered a conditional request with 304 (Not Modified).
+// In that case no results were decoded; the caller's cached copy remains current.
+//
+// Deprecation, if set, relays the server's warning that the endpoint is deprecated or due for removal; see Options.OnDeprecation.
 
 type Response struct {
-	HttpResponse http.Response
-	JsonResult   []byte
-	Results      interface{}
-	StatusCode   int
+	HttpResponse    http.Response
+	JsonResult      []byte
+	Results         interface{}
+	StatusCode      int
+	NotModified     bool
+	ContentType     string
+	ContentEncoding string
+	Attempts        int
+	Conn            ConnInfo
+	Timing          Timing
+	Deprecation     *Deprecation
+}
+
+// ResultsAs returns the decoded results held by a Response as type T.
+// T must be the type passed in Options.Results (typically a pointer to a structure).
+// The boolean result is false if the response carries no results, or if they are of some other type.
+func ResultsAs[T any](r *Response) (T, bool) {
+	v, ok := r.Results.(T)
+	return v, ok
 }
@@ -2,9 +2,15 @@ package perigee
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -117,7 +123,7 @@ func TestCustomHeaders(t *testing.T) {
 		ReqBody:       strings.NewReader("Hello"),
 	})
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 
 	if contentType != "x-application/vb" {
@@ -163,6 +169,17 @@ func TestJson(t *testing.T) {
 	if data.Foo.Bar != "baz" {
 		t.Fatalf("Results returned %v", data)
 	}
+
+	if response.Results != &data {
+		t.Fatalf("Expected Response.Results to refer to the decoded container; got %#v", response.Results)
+	}
+	typed, ok := ResultsAs[*Data](response)
+	if !ok || typed.Foo.Bar != "baz" {
+		t.Fatalf("ResultsAs returned %v, %v", typed, ok)
+	}
+	if _, ok := ResultsAs[*string](response); ok {
+		t.Fatal("Expected ResultsAs to reject the wrong type")
+	}
 }
 
 func TestSetHeaders(t *testing.T) {
@@ -213,7 +230,7 @@ func TestBodilessMethodsAreSentWithoutContentHeaders(t *testing.T) {
 
 	_, err := Request("GET", ts.URL, Options{})
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 
 	if len(h["Content-Type"]) != 0 {
@@ -239,7 +256,7 @@ func TestInferContentType(t *testing.T) {
 		ReqBody: map[string]string{"key": "value"},
 	})
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 	if contentType := h.Get("Content-Type"); contentType != "application/json" {
 		t.Errorf("Expected application/json, but was [%s]", contentType)
@@ -251,7 +268,7 @@ func TestInferContentType(t *testing.T) {
 		ContentType: "text/plain",
 	})
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 	if contentType := h.Get("Content-Type"); contentType != "text/plain" {
 		t.Errorf("Expected text/plain, but was [%s]", contentType)
@@ -263,9 +280,670 @@ func TestInferContentType(t *testing.T) {
 		OmitContentType: true,
 	})
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 	if contentType := h.Get("Content-Type"); contentType != "" {
 		t.Errorf("Expected blank content type, but was [%s]", contentType)
 	}
+
+	// Without a body, there is nothing for a content type to describe.
+	_, err = Request("GET", ts.URL, Options{ContentType: "text/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType := h.Get("Content-Type"); contentType != "" {
+		t.Errorf("Expected no content type without a body, but was [%s]", contentType)
+	}
+}
+
+func TestHeaderOverridesReplaceDefaults(t *testing.T) {
+	var h http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h = r.Header
+	}))
+	defer ts.Close()
+
+	_, err := Request("POST", ts.URL, Options{
+		ReqBody:     map[string]string{"key": "value"},
+		MoreHeaders: map[string]string{"Content-Type": "application/merge-patch+json", "Accept": "application/xml"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := h.Values("Content-Type"); len(values) != 1 || values[0] != "application/merge-patch+json" {
+		t.Fatalf("Expected a single, overridden Content-Type; got %q", values)
+	}
+	if values := h.Values("Accept"); len(values) != 1 || values[0] != "application/xml" {
+		t.Fatalf("Expected a single, overridden Accept; got %q", values)
+	}
+}
+
+func TestTeeBody(t *testing.T) {
+	jsonBytes := []byte(`{"name": "image.qcow2", "size": 42}`)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jsonBytes)
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	var data struct {
+		Name string `json:"name"`
+		Size int    `json:"size"`
+	}
+	var copied bytes.Buffer
+	_, err := Request("GET", ts.URL, Options{Results: &data, TeeBody: &copied})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(copied.Bytes(), jsonBytes) {
+		t.Fatalf("Expected the body to be copied verbatim; got %q", copied.Bytes())
+	}
+	if data.Name != "image.qcow2" || data.Size != 42 {
+		t.Fatalf("Results returned %v", data)
+	}
+
+	// Without Results, the body is simply streamed to the writer.
+	copied.Reset()
+	_, err = Request("GET", ts.URL, Options{TeeBody: &copied})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(copied.Bytes(), jsonBytes) {
+		t.Fatalf("Expected the body to be copied verbatim; got %q", copied.Bytes())
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(304)
+			return
+		}
+		w.Write([]byte(`{"foo": "bar"}`))
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	data := map[string]string{"foo": "cached"}
+	response, err := Request("GET", ts.URL, Options{
+		Results:     &data,
+		OkCodes:     []int{200},
+		MoreHeaders: map[string]string{"If-None-Match": `"v1"`},
+	})
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if !response.NotModified {
+		t.Fatal("Expected NotModified to be set")
+	}
+	if data["foo"] != "cached" {
+		t.Fatalf("Expected Results to be left untouched; got %v", data)
+	}
+
+	_, err = Request("GET", ts.URL, Options{
+		OkCodes:            []int{200},
+		MoreHeaders:        map[string]string{"If-None-Match": `"v1"`},
+		NotModifiedIsError: true,
+	})
+	if e, ok := err.(*UnexpectedResponseCodeError); !ok || e.Actual != 304 {
+		t.Fatalf("Expected an UnexpectedResponseCodeError for 304; got %#v", err)
+	}
+
+	response, err = Request("GET", ts.URL, Options{Results: &data, OkCodes: []int{200}})
+	if err != nil {
+		t.Fatalf("should not have error: %s", err)
+	}
+	if response.NotModified || data["foo"] != "bar" {
+		t.Fatalf("Expected a fresh response; got NotModified=%v, Results %v", response.NotModified, data)
+	}
+
+	// A 304 to a request that asked for no such thing is unexpected.
+	unconditional := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(304)
+	}))
+	defer unconditional.Close()
+	response, err = Request("GET", unconditional.URL, Options{OkCodes: []int{200}})
+	if e, ok := err.(*UnexpectedResponseCodeError); !ok || e.Actual != 304 || response.NotModified {
+		t.Fatalf("Expected an UnexpectedResponseCodeError for an unconditional 304; got %#v", err)
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(404)
+			return
+		}
+		w.WriteHeader(500)
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	errImageNotFound := fmt.Errorf("image not found")
+	var seen *UnexpectedResponseCodeError
+	opts := Options{
+		OkCodes: []int{200},
+		StatusErrors: map[int]ErrorConstructor{
+			404: func(err *UnexpectedResponseCodeError) error {
+				seen = err
+				return errImageNotFound
+			},
+		},
+	}
+
+	_, err := Request("GET", ts.URL+"/missing", opts)
+	if err != errImageNotFound {
+		t.Fatalf("Expected the mapped error; got %#v", err)
+	}
+	if seen == nil || seen.Actual != 404 {
+		t.Fatalf("Expected the constructor to receive the original error; got %#v", seen)
+	}
+
+	_, err = Request("GET", ts.URL+"/broken", opts)
+	if e, ok := err.(*UnexpectedResponseCodeError); !ok || e.Actual != 500 {
+		t.Fatalf("Expected unmapped codes to produce UnexpectedResponseCodeError; got %#v", err)
+	}
+}
+
+func TestErrorResults(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/proxy" {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(502)
+			w.Write([]byte("<html><title>Bad Gateway</title></html>"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(409)
+		w.Write([]byte(`{"code": "conflict", "message": "name in use", "request_id": "req-1"}`))
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	type apiError struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	}
+	var details apiError
+	_, err := Request("POST", ts.URL, Options{OkCodes: []int{201}, ErrorResults: &details})
+	e, ok := err.(*UnexpectedResponseCodeError)
+	if !ok || e.Actual != 409 {
+		t.Fatalf("Expected an UnexpectedResponseCodeError; got %#v", err)
+	}
+	if e.Details != &details || details.Code != "conflict" || details.RequestID != "req-1" {
+		t.Fatalf("Expected the error body decoded into ErrorResults; got %#v", e.Details)
+	}
+
+	_, err = Request("POST", ts.URL+"/proxy", Options{OkCodes: []int{201}, ErrorResults: &apiError{}})
+	if e, ok := err.(*UnexpectedResponseCodeError); !ok || e.Actual != 502 || e.Details != nil {
+		t.Fatalf("Expected an undecodable body to leave Details nil; got %#v", err)
+	}
+}
+
+func TestUnexpectedResponseCodeErrorContext(t *testing.T) {
+	body := strings.Repeat("x", 1023) + "é" + strings.Repeat("y", 500)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-7")
+		w.WriteHeader(409)
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	_, err := Request("DELETE", ts.URL+"/servers/1", Options{OkCodes: []int{204}})
+	e, ok := err.(*UnexpectedResponseCodeError)
+	if !ok {
+		t.Fatalf("Expected an UnexpectedResponseCodeError; got %#v", err)
+	}
+	if e.Method != "DELETE" || e.Header.Get("X-Request-Id") != "req-7" || string(e.Body) != body {
+		t.Fatalf("Expected the method, headers, and whole body; got %q, %v, and %d bytes", e.Method, e.Header, len(e.Body))
+	}
+	msg := e.Error()
+	if !strings.Contains(msg, "when accessing DELETE URL("+ts.URL+"/servers/1)") {
+		t.Fatalf("Expected the message to name the method and URL; got %q", msg)
+	}
+	if !strings.HasSuffix(msg, "\n"+strings.Repeat("x", 1023)+"... (502 more bytes)") {
+		t.Fatalf("Expected the message to quote a snippet of the body, whole runes only; got %q", msg[len(msg)-40:])
+	}
+}
+
+func TestResponseBuffer(t *testing.T) {
+	count := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		fmt.Fprintf(w, `{"count": %d}`, count)
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	buf.WriteString("stale contents")
+	for i := 1; i <= 2; i++ {
+		var data struct {
+			Count int `json:"count"`
+		}
+		response, err := Request("GET", ts.URL, Options{Results: &data, ResponseBuffer: &buf})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.Count != i {
+			t.Fatalf("Expected count %d; got %d", i, data.Count)
+		}
+		want := fmt.Sprintf(`{"count": %d}`, i)
+		if buf.String() != want || string(response.JsonResult) != want {
+			t.Fatalf("Expected buffer and JsonResult to hold %s; got %q and %q", want, buf.String(), response.JsonResult)
+		}
+	}
+
+	_, err := Request("GET", ts.URL, Options{ResponseBuffer: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != `{"count": 3}` {
+		t.Fatalf("Expected the body to be captured without Results; got %q", buf.String())
+	}
+}
+
+func TestContentLengthAvoidsChunking(t *testing.T) {
+	var transferEncoding []string
+	var contentLength int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		transferEncoding = r.TransferEncoding
+		contentLength = r.ContentLength
+	}))
+	defer ts.Close()
+
+	// A reader of unknown length is sent with the length given.
+	_, err := Request("PUT", ts.URL, Options{
+		ContentType:   "application/octet-stream",
+		ContentLength: 5,
+		ReqBody:       ioutil.NopCloser(strings.NewReader("Hello")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentLength != 5 || len(transferEncoding) != 0 {
+		t.Fatalf("Expected a 5 byte body, unchunked; got %d bytes, %v", contentLength, transferEncoding)
+	}
+
+	// A file's length is found without help, even when retries hide the file from net/http.
+	f, err := ioutil.TempFile("", "perigee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.WriteString("Hello, world")
+	f.Seek(7, io.SeekStart)
+	_, err = Request("PUT", ts.URL, Options{
+		ContentType: "application/octet-stream",
+		ReqBody:     f,
+		Retry:       &RetryPolicy{MaxAttempts: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentLength != 5 || len(transferEncoding) != 0 {
+		t.Fatalf("Expected a 5 byte body, unchunked; got %d bytes, %v", contentLength, transferEncoding)
+	}
+}
+
+func TestChunking(t *testing.T) {
+	var transferEncoding []string
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		transferEncoding = r.TransferEncoding
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer ts.Close()
+
+	_, err := Request("PUT", ts.URL, Options{
+		ContentType: "text/plain",
+		ReqBody:     strings.NewReader("Hello"),
+		Chunking:    ChunkingForce,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transferEncoding) != 1 || transferEncoding[0] != "chunked" || body != "Hello" {
+		t.Fatalf("Expected Hello, chunked; got %q, %v", body, transferEncoding)
+	}
+
+	_, err = Request("GET", ts.URL, Options{Chunking: ChunkingForce})
+	if err != ErrNoBodyToChunk {
+		t.Fatalf("Expected ErrNoBodyToChunk; got %v", err)
+	}
+
+	requests := 0
+	counter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer counter.Close()
+	_, err = Request("PUT", counter.URL, Options{
+		ContentType: "text/plain",
+		ReqBody:     ioutil.NopCloser(strings.NewReader("Hello")),
+		Chunking:    ChunkingForbid,
+	})
+	if err != ErrUnknownLength {
+		t.Fatalf("Expected ErrUnknownLength; got %v", err)
+	}
+	if requests != 0 {
+		t.Fatal("Expected nothing to be sent")
+	}
+}
+
+func benchmarkServer() *httptest.Server {
+	body := []byte(`{"server":{"id":"abc","name":"web01","status":"ACTIVE","addresses":{"private":[{"addr":"10.0.0.1"}]}}}`)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+}
+
+type benchmarkResult struct {
+	Server struct {
+		ID        string
+		Name      string
+		Status    string
+		Addresses map[string][]struct{ Addr string }
+	}
+}
+
+func BenchmarkRequestGetJSON(b *testing.B) {
+	ts := benchmarkServer()
+	defer ts.Close()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result benchmarkResult
+		_, err := Request("GET", ts.URL, Options{Results: &result})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRequestPostJSON(b *testing.B) {
+	ts := benchmarkServer()
+	defer ts.Close()
+	body := map[string]interface{}{"server": map[string]string{"name": "web01", "flavorRef": "1", "imageRef": "2"}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var result benchmarkResult
+		_, err := Request("POST", ts.URL, Options{ReqBody: body, Results: &result, MoreHeaders: map[string]string{"X-Auth-Token": "secret"}})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRequestNoResults(b *testing.B) {
+	ts := benchmarkServer()
+	defer ts.Close()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, err := Request("DELETE", ts.URL, Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkNetHTTPGetJSON measures the equivalent of BenchmarkRequestGetJSON using net/http and encoding/json directly, for comparison.
+func BenchmarkNetHTTPGetJSON(b *testing.B) {
+	ts := benchmarkServer()
+	defer ts.Close()
+	client := new(http.Client)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		req.Header.Set("Accept", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var result benchmarkResult
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRequestLargeBody(b *testing.B) {
+	body := []byte(`[` + strings.Repeat(`{"id":"abc","name":"web01","status":"ACTIVE"},`, 2000) + `{}]`)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.Write(body)
+	}))
+	defer ts.Close()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	for i := 0; i < b.N; i++ {
+		var result json.RawMessage
+		_, err := Request("GET", ts.URL, Options{Results: &result})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBodylessRequestsReuseConnections(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"deleted":` + strings.Repeat(" ", 32<<10) + `true}`))
+	}))
+	connections := 0
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections++
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	for i := 0; i < 10; i++ {
+		_, err := Request("DELETE", ts.URL, Options{CustomClient: client})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if connections != 1 {
+		t.Fatalf("Expected one connection to serve every request; got %d", connections)
+	}
+}
+
+func TestRejectCodes(t *testing.T) {
+	status := 404
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(`{"status":"x"}`))
+	}))
+	defer ts.Close()
+
+	var result map[string]string
+	resp, err := Request("GET", ts.URL, Options{Results: &result, RejectCodes: StatusRange(500, 599)})
+	if err != nil {
+		t.Fatalf("Expected a 404 to be accepted; got %v", err)
+	}
+	if resp.StatusCode != 404 || result["status"] != "x" {
+		t.Fatalf("Expected the 404's body to be decoded; got %v", result)
+	}
+
+	status = 503
+	_, err = Request("GET", ts.URL, Options{Results: &result, RejectCodes: StatusRange(500, 599)})
+	unexpected, ok := err.(*UnexpectedResponseCodeError)
+	if !ok || unexpected.Actual != 503 || unexpected.Rejected == nil {
+		t.Fatalf("Expected a 503 to be rejected; got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "Rejected HTTP response code 503") {
+		t.Fatalf("Expected the error to say the code was rejected; got %q", err)
+	}
+
+	status = 201
+	_, err = Request("GET", ts.URL, Options{OkCodes: []int{200}, RejectCodes: []int{500}})
+	if unexpected, ok := err.(*UnexpectedResponseCodeError); !ok || unexpected.Expected == nil {
+		t.Fatalf("Expected OkCodes to apply alongside RejectCodes; got %v", err)
+	}
+}
+
+func TestOkPredicate(t *testing.T) {
+	status, removed := 203, ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if removed != "" {
+			w.Header().Set("X-Removed", removed)
+		}
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	ok := func(resp *http.Response) bool {
+		return resp.StatusCode/100 == 2 || resp.StatusCode == 404 && resp.Header.Get("X-Removed") == "true"
+	}
+	for _, test := range []struct {
+		status  int
+		removed string
+		want    bool
+	}{
+		{203, "", true},
+		{206, "", true},
+		{404, "true", true},
+		{404, "", false},
+		{503, "", false},
+	} {
+		status, removed = test.status, test.removed
+		_, err := Request("GET", ts.URL, Options{OkCodes: []int{200}, OkPredicate: ok})
+		if (err == nil) != test.want {
+			t.Fatalf("Expected acceptance of %d (X-Removed %q) to be %v; got %v", test.status, test.removed, test.want, err)
+		}
+		if err != nil && !strings.HasPrefix(err.Error(), fmt.Sprintf("Unacceptable HTTP response code %d", test.status)) {
+			t.Fatalf("Expected the error to say the code was unacceptable; got %q", err)
+		}
+	}
+
+	status, removed = 503, ""
+	_, err := Request("GET", ts.URL, Options{OkPredicate: func(*http.Response) bool { return true }, RejectCodes: []int{503}})
+	if unexpected, ok := err.(*UnexpectedResponseCodeError); !ok || unexpected.Rejected == nil {
+		t.Fatalf("Expected RejectCodes to apply alongside OkPredicate; got %v", err)
+	}
+}
+
+func TestRawResults(t *testing.T) {
+	pem := "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	binary := []byte{0x00, 0xff, 0x10, '"'}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pem":
+			w.Header().Set("Content-Type", "application/x-pem-file")
+			w.Write([]byte(pem))
+		case "/token":
+			w.Header().Set("Content-Type", "text/plain; charset=iso-8859-1")
+			w.Write([]byte("caf\xe9"))
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`"quoted"`))
+		default:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(binary)
+		}
+	}))
+	defer ts.Close()
+
+	for path, want := range map[string]string{"/pem": pem, "/token": "café", "/json": "quoted"} {
+		var s string
+		resp, err := Request("GET", ts.URL+path, Options{Results: &s})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != want || resp.Results != &s {
+			t.Fatalf("Expected %q from %s; got %q", want, path, s)
+		}
+	}
+
+	var b []byte
+	if _, err := Request("GET", ts.URL+"/blob", Options{Results: &b}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, binary) {
+		t.Fatalf("Expected the raw bytes %v; got %v", binary, b)
+	}
+}
+
+func TestPatchHeadOptions(t *testing.T) {
+	var methods []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Allow", "GET, HEAD, PATCH, OPTIONS")
+		w.Header().Set("X-Object-Size", "42")
+		w.Write([]byte(`{"name":"updated"}`))
+	}))
+	defer ts.Close()
+
+	var patched struct{ Name string }
+	_, err := Patch(ts.URL, Options{ReqBody: map[string]string{"name": "updated"}, Results: &patched})
+	if err != nil || patched.Name != "updated" {
+		t.Fatalf("Expected the PATCH to decode its result; got %v, %+v", err, patched)
+	}
+
+	// HEAD responses have no body, whatever their headers say, so there is nothing to decode.
+	var untouched struct{ Name string }
+	var meta struct {
+		Size int `header:"X-Object-Size"`
+	}
+	resp, err := Head(ts.URL, Options{Results: &untouched, HeaderResults: &meta})
+	if err != nil {
+		t.Fatalf("Expected HEAD to succeed without a body; got %v", err)
+	}
+	if untouched.Name != "" || meta.Size != 42 || resp.StatusCode != 200 {
+		t.Fatalf("Expected only headers from HEAD; got %+v, %+v", untouched, meta)
+	}
+
+	resp, err = NewClient(Options{}).Options(ts.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.HttpResponse.Header.Get("Allow") == "" {
+		t.Fatal("Expected the Allow header from OPTIONS")
+	}
+	if want := []string{"PATCH", "HEAD", "OPTIONS"}; !reflect.DeepEqual(methods, want) {
+		t.Fatalf("Expected %v; got %v", want, methods)
+	}
+}
+
+func TestRawBody(t *testing.T) {
+	var contentType string
+	var received []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	blob := []byte{0x00, 0xff, '{', 0x10}
+	_, err := Request("PUT", ts.URL, Options{RawBody: bytes.NewReader(blob), ReqBody: map[string]string{"ignored": "yes"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, blob) || contentType != "application/octet-stream" {
+		t.Fatalf("Expected the blob as octet-stream; got %q as %q", received, contentType)
+	}
+
+	// A pipe can only be streamed, never buffered up front.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte(`{"already":"serialized"}`))
+		pw.Close()
+	}()
+	_, err = Request("PUT", ts.URL, Options{RawBody: pr, ContentType: "application/json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(received) != `{"already":"serialized"}` || contentType != "application/json" {
+		t.Fatalf("Expected the pre-serialized JSON as given; got %q as %q", received, contentType)
+	}
 }
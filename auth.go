@@ -0,0 +1,122 @@
+package perigee
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// An AuthProvider adds credentials to outgoing requests; see Options.Auth.
+// Authenticate is called for each attempt of a request, once its other headers are set,
+// and may fail the request by returning an error.
+type AuthProvider interface {
+	Authenticate(req *http.Request) error
+}
+
+// DefaultRefreshBefore is how long before its expiry a TokenAuth refreshes its token, unless told otherwise.
+const DefaultRefreshBefore = time.Minute
+
+// TokenAuth is an AuthProvider sending a token which expires, such as an OpenStack Keystone token or an OAuth access token.
+// It caches the token Fetch obtains until shortly before its expiry, then fetches the next one in the background,
+// so that requests never wait for re-authentication while the current token remains valid.
+// Only requests finding no valid token wait, and however many do, only one fetch is made at a time.
+// A token fetched with a zero expiry is kept until Invalidate is called.
+//
+// Header names the header carrying the token, X-Auth-Token if empty; Prefix, if set, precedes the token (e.g., "Bearer ").
+// RefreshBefore sets how long before the expiry to fetch the next token, DefaultRefreshBefore if zero.
+//
+// A TokenAuth is safe for concurrent use, provided its fields are not modified once in use.
+type TokenAuth struct {
+	Fetch         func(ctx context.Context) (token string, expiry time.Time, err error)
+	Header        string
+	Prefix        string
+	RefreshBefore time.Duration
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+	flight *tokenFetch
+}
+
+// tokenFetch is a fetch in progress, shared by every request awaiting it.
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// Authenticate implements the AuthProvider interface.
+func (a *TokenAuth) Authenticate(req *http.Request) error {
+	token, err := a.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	header := a.Header
+	if header == "" {
+		header = "X-Auth-Token"
+	}
+	req.Header.Set(header, a.Prefix+token)
+	return nil
+}
+
+// Token returns a valid token, fetching one if none is cached.
+// A failed fetch is not cached, so the next call tries again.
+// If ctx is done before the fetch completes, Token returns ctx's error; the fetch itself carries on for other callers.
+func (a *TokenAuth) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	now := time.Now()
+	if a.token != "" && (a.expiry.IsZero() || now.Before(a.expiry)) {
+		token := a.token
+		if !a.expiry.IsZero() && !now.Before(a.expiry.Add(-a.refreshBefore())) {
+			a.refresh()
+		}
+		a.mu.Unlock()
+		return token, nil
+	}
+	f := a.refresh()
+	a.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Invalidate discards the cached token, as when the server rejects it, so that the next request fetches another.
+func (a *TokenAuth) Invalidate() {
+	a.mu.Lock()
+	a.token, a.expiry = "", time.Time{}
+	a.mu.Unlock()
+}
+
+func (a *TokenAuth) refreshBefore() time.Duration {
+	if a.RefreshBefore > 0 {
+		return a.RefreshBefore
+	}
+	return DefaultRefreshBefore
+}
+
+// refresh starts fetching a token, unless a fetch is already in progress, and returns the fetch.
+// The caller must hold a.mu.
+func (a *TokenAuth) refresh() *tokenFetch {
+	if a.flight != nil {
+		return a.flight
+	}
+	f := &tokenFetch{done: make(chan struct{})}
+	a.flight = f
+	go func() {
+		token, expiry, err := a.Fetch(context.Background())
+		a.mu.Lock()
+		if err == nil {
+			a.token, a.expiry = token, expiry
+		}
+		a.flight = nil
+		a.mu.Unlock()
+		f.token, f.err = token, err
+		close(f.done)
+	}()
+	return f
+}
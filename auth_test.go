@@ -0,0 +1,123 @@
+package perigee
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenAuthSingleFlight(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	auth := &TokenAuth{
+		Prefix: "Bearer ",
+		Header: "Authorization",
+		Fetch: func(ctx context.Context) (string, time.Time, error) {
+			atomic.AddInt32(&fetches, 1)
+			<-release
+			return "t1", time.Now().Add(time.Hour), nil
+		},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t1" {
+			w.WriteHeader(401)
+		}
+	}))
+	defer ts.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := Request("GET", ts.URL, Options{Auth: auth})
+			errs <- err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("Expected a single fetch; got %d", n)
+	}
+}
+
+func TestTokenAuthRefreshesAhead(t *testing.T) {
+	tokens := make(chan string, 1)
+	fetched := make(chan struct{}, 2)
+	auth := &TokenAuth{
+		RefreshBefore: time.Minute,
+		Fetch: func(ctx context.Context) (string, time.Time, error) {
+			token := <-tokens
+			fetched <- struct{}{}
+			return token, time.Now().Add(30 * time.Second), nil
+		},
+	}
+
+	tokens <- "t1"
+	if token, err := auth.Token(context.Background()); err != nil || token != "t1" {
+		t.Fatalf("Expected t1; got %q, %v", token, err)
+	}
+	<-fetched
+
+	// The token expires within RefreshBefore, so using it starts a refresh without waiting for it.
+	if token, err := auth.Token(context.Background()); err != nil || token != "t1" {
+		t.Fatalf("Expected t1 while the refresh is in progress; got %q, %v", token, err)
+	}
+	tokens <- "t2"
+	<-fetched
+	deadline := time.Now().Add(time.Second)
+	for {
+		token, err := auth.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token == "t2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the refreshed token; got %q", token)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTokenAuthFailures(t *testing.T) {
+	boom := errors.New("boom")
+	fail := true
+	auth := &TokenAuth{
+		Fetch: func(ctx context.Context) (string, time.Time, error) {
+			if fail {
+				return "", time.Time{}, boom
+			}
+			return "t1", time.Time{}, nil
+		},
+	}
+	if _, err := Request("GET", "http://127.0.0.1:0", Options{Auth: auth}); err != boom {
+		t.Fatalf("Expected the fetch error to fail the request; got %v", err)
+	}
+	fail = false
+	if token, err := auth.Token(context.Background()); err != nil || token != "t1" {
+		t.Fatalf("Expected a failed fetch not to be cached; got %q, %v", token, err)
+	}
+	fail = true
+	if token, err := auth.Token(context.Background()); err != nil || token != "t1" {
+		t.Fatalf("Expected a token without expiry to be kept; got %q, %v", token, err)
+	}
+	auth.Invalidate()
+	if _, err := auth.Token(context.Background()); err != boom {
+		t.Fatalf("Expected Invalidate to force a fetch; got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package perigee
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// The BulkheadFullError structure is returned when a host already has as many requests in flight as a Bulkhead permits,
+// and no room remains in its queue.
+type BulkheadFullError struct {
+	Host  string
+	Limit int
+}
+
+func (err *BulkheadFullError) Error() string {
+	return fmt.Sprintf("Too many concurrent requests to %s (limit %d); request rejected", err.Host, err.Limit)
+}
+
+// Bulkhead is an http.RoundTripper which limits the number of concurrent in-flight requests per host,
+// so that one slow upstream cannot exhaust the goroutines and connections of everything else sharing an http.Client.
+// Install it as the Transport of the http.Client given in Options.CustomClient.
+//
+// A request counts as in flight until its response body is closed, or until the underlying transport fails.
+//
+// MaxPerHost sets the limit; zero means no limit.
+//
+// MaxQueued sets how many requests per host may wait for a free slot once the limit is reached.
+// Zero rejects excess requests immediately with a *BulkheadFullError; a negative value queues without bound.
+// Queued requests are dispatched in order of priority (see Options.Priority), then in order of arrival,
+// so interactive operations overtake background work queued behind a saturated host.
+// Queued requests give up if their context is canceled while waiting.
+type Bulkhead struct {
+	Transport  http.RoundTripper
+	MaxPerHost int
+	MaxQueued  int
+
+	mu    sync.Mutex
+	hosts map[string]*bulkheadHost
+}
+
+type bulkheadHost struct {
+	active  int
+	waiters []bulkheadWaiter
+}
+
+type bulkheadWaiter struct {
+	ready    chan struct{}
+	priority Priority
+}
+
+// enqueue adds a waiter behind every other of the same or higher priority.
+func (h *bulkheadHost) enqueue(w bulkheadWaiter) {
+	i := len(h.waiters)
+	for i > 0 && h.waiters[i-1].priority < w.priority {
+		i--
+	}
+	h.waiters = append(h.waiters, bulkheadWaiter{})
+	copy(h.waiters[i+1:], h.waiters[i:])
+	h.waiters[i] = w
+}
+
+// NewBulkhead creates a Bulkhead wrapping the given transport.
+func NewBulkhead(transport http.RoundTripper, maxPerHost, maxQueued int) *Bulkhead {
+	return &Bulkhead{
+		Transport:  transport,
+		MaxPerHost: maxPerHost,
+		MaxQueued:  maxQueued,
+	}
+}
+
+// InFlight reports the number of requests currently in flight to the given host (as in URL.Host).
+func (b *Bulkhead) InFlight(host string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if h, ok := b.hosts[host]; ok {
+		return h.active
+	}
+	return 0
+}
+
+// acquire claims a slot for the request's host, waiting in the queue if necessary.
+func (b *Bulkhead) acquire(req *http.Request) error {
+	host := req.URL.Host
+
+	b.mu.Lock()
+	if b.hosts == nil {
+		b.hosts = make(map[string]*bulkheadHost)
+	}
+	h, ok := b.hosts[host]
+	if !ok {
+		h = new(bulkheadHost)
+		b.hosts[host] = h
+	}
+	if b.MaxPerHost <= 0 || h.active < b.MaxPerHost {
+		h.active++
+		b.mu.Unlock()
+		return nil
+	}
+	if b.MaxQueued >= 0 && len(h.waiters) >= b.MaxQueued {
+		b.mu.Unlock()
+		return &BulkheadFullError{Host: host, Limit: b.MaxPerHost}
+	}
+	ready := make(chan struct{})
+	h.enqueue(bulkheadWaiter{ready: ready, priority: PriorityFrom(req.Context())})
+	b.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-req.Context().Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, w := range h.waiters {
+			if w.ready == ready {
+				h.waiters = append(h.waiters[:i], h.waiters[i+1:]...)
+				return req.Context().Err()
+			}
+		}
+		// The slot was handed to us while we were giving up; pass it along.
+		b.releaseLocked(host)
+		return req.Context().Err()
+	}
+}
+
+// release frees the slot held for the given host, handing it to the next queued request if there is one.
+func (b *Bulkhead) release(host string) {
+	b.mu.Lock()
+	b.releaseLocked(host)
+	b.mu.Unlock()
+}
+
+func (b *Bulkhead) releaseLocked(host string) {
+	h := b.hosts[host]
+	if len(h.waiters) > 0 {
+		next := h.waiters[0]
+		h.waiters = h.waiters[1:]
+		close(next.ready)
+		return
+	}
+	h.active--
+	if h.active == 0 {
+		delete(b.hosts, host)
+	}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (b *Bulkhead) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := b.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	err := b.acquire(req)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		b.release(req.URL.Host)
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { b.release(req.URL.Host) }}
+	return resp, nil
+}
+
+// releasingBody invokes its release function exactly once, when the body is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releasingBody) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
@@ -0,0 +1,176 @@
+package perigee
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// blockingServer returns a server whose handler blocks until the returned channel is closed.
+func blockingServer() (*httptest.Server, chan struct{}, chan struct{}) {
+	entered := make(chan struct{}, 10)
+	unblock := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+	}))
+	return ts, entered, unblock
+}
+
+func TestBulkheadRejectsBeyondLimit(t *testing.T) {
+	ts, entered, unblock := blockingServer()
+	defer ts.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	bulkhead := NewBulkhead(nil, 1, 0)
+	opts := Options{CustomClient: &http.Client{Transport: bulkhead}}
+
+	done := make(chan error)
+	go func() {
+		_, err := Request("GET", ts.URL, opts)
+		done <- err
+	}()
+	<-entered
+
+	_, err := Request("GET", ts.URL, opts)
+	full, ok := err.(*url.Error)
+	if !ok {
+		t.Fatalf("Expected a *url.Error wrapping *BulkheadFullError; got %#v", err)
+	}
+	if _, ok := full.Err.(*BulkheadFullError); !ok {
+		t.Fatalf("Expected *BulkheadFullError; got %#v", full.Err)
+	}
+
+	// Other hosts remain unaffected.
+	_, err = Request("GET", other.URL, opts)
+	if err != nil {
+		t.Fatalf("Expected requests to other hosts to succeed; got %s", err)
+	}
+
+	close(unblock)
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := bulkhead.InFlight(ts.URL[len("http://"):]); n != 0 {
+		t.Fatalf("Expected no requests in flight; got %d", n)
+	}
+}
+
+func TestBulkheadQueues(t *testing.T) {
+	ts, entered, unblock := blockingServer()
+	defer ts.Close()
+
+	bulkhead := NewBulkhead(nil, 1, -1)
+	opts := Options{CustomClient: &http.Client{Transport: bulkhead}}
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := Request("GET", ts.URL, opts)
+			done <- err
+		}()
+	}
+	<-entered
+
+	select {
+	case <-entered:
+		t.Fatal("Expected the second request to wait for the first")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(unblock)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBulkheadQueueHonorsCancellation(t *testing.T) {
+	ts, entered, unblock := blockingServer()
+	defer ts.Close()
+	defer close(unblock)
+
+	bulkhead := NewBulkhead(nil, 1, 1)
+	client := &http.Client{Transport: bulkhead}
+	go client.Get(ts.URL)
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	_, err := bulkhead.RoundTrip(req.WithContext(ctx))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded; got %v", err)
+	}
+}
+
+func TestBulkheadServesHigherPrioritiesFirst(t *testing.T) {
+	var order []string
+	unblock := make(chan struct{})
+	entered := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get("X-Name")
+		if name == "first" {
+			entered <- struct{}{}
+			<-unblock
+			return
+		}
+		order = append(order, name)
+	}))
+	defer ts.Close()
+
+	bulkhead := NewBulkhead(nil, 1, -1)
+	queued := func() int {
+		bulkhead.mu.Lock()
+		defer bulkhead.mu.Unlock()
+		if h, ok := bulkhead.hosts[ts.URL[len("http://"):]]; ok {
+			return len(h.waiters)
+		}
+		return 0
+	}
+	send := func(name string, priority Priority, done chan error) {
+		_, err := Request("GET", ts.URL, Options{
+			CustomClient: &http.Client{Transport: bulkhead},
+			MoreHeaders:  map[string]string{"X-Name": name},
+			Priority:     priority,
+		})
+		done <- err
+	}
+
+	done := make(chan error)
+	go send("first", PriorityNormal, done)
+	<-entered
+	requests := []struct {
+		name     string
+		priority Priority
+	}{
+		{"low", PriorityLow},
+		{"normal-1", PriorityNormal},
+		{"high", PriorityHigh},
+		{"normal-2", PriorityNormal},
+	}
+	for i, r := range requests {
+		go send(r.name, r.priority, done)
+		for queued() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	close(unblock)
+	for i := 0; i <= len(requests); i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"high", "normal-1", "normal-2", "low"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Expected requests to be served in order %v; got %v", want, order)
+		}
+	}
+}
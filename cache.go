@@ -0,0 +1,311 @@
+package perigee
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedResponse is the unit of storage for a CacheStore.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	StoredAt   time.Time
+}
+
+// CacheStore persists responses for a CachingTransport, keyed by request URL.
+// Implementations must be safe for concurrent use.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, resp *CachedResponse) error
+	Delete(key string) error
+}
+
+// MemoryCache is a CacheStore which keeps responses in memory for the lifetime of the process.
+type MemoryCache struct {
+	mu      sync.RWMutex
+	entries map[string]*CachedResponse
+}
+
+// NewMemoryCache creates an empty in-memory cache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]*CachedResponse)}
+}
+
+// Get implements the CacheStore interface.
+func (c *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	resp, ok := c.entries[key]
+	return resp, ok
+}
+
+// Set implements the CacheStore interface.
+func (c *MemoryCache) Set(key string, resp *CachedResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = resp
+	return nil
+}
+
+// Delete implements the CacheStore interface.
+func (c *MemoryCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+// DiskCache is a CacheStore backed by a directory, so that caches stay warm across process restarts.
+//
+// Bodies are stored content-addressed, named by their SHA-256 digest, so identical bodies cached under several keys occupy space only once.
+// Status codes, headers, and body digests are kept in a JSON index alongside them.
+// Every file is written to a temporary name and renamed into place, so a crash never leaves a torn entry behind.
+//
+// A DiskCache is safe for concurrent use within a process; sharing a directory between concurrently running processes is not supported.
+type DiskCache struct {
+	dir   string
+	mu    sync.Mutex
+	index map[string]diskCacheEntry
+}
+
+type diskCacheEntry struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Digest     string      `json:"digest"`
+	StoredAt   time.Time   `json:"stored_at"`
+}
+
+const diskCacheIndex = "index.json"
+
+// OpenDiskCache opens the cache stored in dir, creating the directory if needed.
+func OpenDiskCache(dir string) (*DiskCache, error) {
+	err := os.MkdirAll(filepath.Join(dir, "bodies"), 0700)
+	if err != nil {
+		return nil, err
+	}
+	c := &DiskCache{dir: dir, index: make(map[string]diskCacheEntry)}
+	data, err := ioutil.ReadFile(filepath.Join(dir, diskCacheIndex))
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &c.index)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *DiskCache) bodyPath(digest string) string {
+	return filepath.Join(c.dir, "bodies", digest)
+}
+
+// writeFile atomically replaces the named file's contents.
+func writeFile(name string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// saveIndex persists the index; the caller must hold c.mu.
+func (c *DiskCache) saveIndex() error {
+	data, err := json.Marshal(c.index)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(c.dir, diskCacheIndex), data)
+}
+
+// releaseBody removes a body file once no index entry refers to it; the caller must hold c.mu.
+func (c *DiskCache) releaseBody(digest string) {
+	for _, e := range c.index {
+		if e.Digest == digest {
+			return
+		}
+	}
+	os.Remove(c.bodyPath(digest))
+}
+
+// Get implements the CacheStore interface.
+func (c *DiskCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	entry, ok := c.index[key]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	body, err := ioutil.ReadFile(c.bodyPath(entry.Digest))
+	if err != nil {
+		return nil, false
+	}
+	return &CachedResponse{
+		StatusCode: entry.StatusCode,
+		Header:     entry.Header,
+		Body:       body,
+		StoredAt:   entry.StoredAt,
+	}, true
+}
+
+// Set implements the CacheStore interface.
+func (c *DiskCache) Set(key string, resp *CachedResponse) error {
+	sum := sha256.Sum256(resp.Body)
+	digest := hex.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := os.Stat(c.bodyPath(digest)); os.IsNotExist(err) {
+		err = writeFile(c.bodyPath(digest), resp.Body)
+		if err != nil {
+			return err
+		}
+	}
+	previous, replacing := c.index[key]
+	c.index[key] = diskCacheEntry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Digest:     digest,
+		StoredAt:   resp.StoredAt,
+	}
+	err := c.saveIndex()
+	if err != nil {
+		return err
+	}
+	if replacing && previous.Digest != digest {
+		c.releaseBody(previous.Digest)
+	}
+	return nil
+}
+
+// Delete implements the CacheStore interface.
+func (c *DiskCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.index[key]
+	if !ok {
+		return nil
+	}
+	delete(c.index, key)
+	err := c.saveIndex()
+	if err != nil {
+		return err
+	}
+	c.releaseBody(entry.Digest)
+	return nil
+}
+
+// CachingTransport is an http.RoundTripper which caches GET responses carrying an ETag or Last-Modified validator,
+// and revalidates them with conditional requests.
+// When the server confirms a cached copy with 304 (Not Modified), the cached response is returned in its place,
+// with the X-Perigee-Cache response header set to "hit".
+//
+// Requests which already carry their own conditional headers pass straight through, as do responses marked Cache-Control: no-store.
+type CachingTransport struct {
+	Transport http.RoundTripper
+	Store     CacheStore
+}
+
+// NewCachingTransport creates a CachingTransport keeping responses in the given store.
+func NewCachingTransport(transport http.RoundTripper, store CacheStore) *CachingTransport {
+	return &CachingTransport{Transport: transport, Store: store}
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := t.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if req.Method != "GET" || req.Header.Get("Range") != "" || conditional(req) {
+		return transport.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	cached, ok := t.Store.Get(key)
+	if ok {
+		conditional := req.Clone(req.Context())
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			conditional.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			conditional.Header.Set("If-Modified-Since", modified)
+		}
+		req = conditional
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		header := cached.Header.Clone()
+		for k, v := range resp.Header {
+			header[k] = v
+		}
+		header.Set("X-Perigee-Cache", "hit")
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", cached.StatusCode, http.StatusText(cached.StatusCode)),
+			StatusCode:    cached.StatusCode,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(cached.Body)),
+			ContentLength: int64(len(cached.Body)),
+			Request:       req,
+			TLS:           resp.TLS,
+		}, nil
+	}
+
+	cacheable := resp.StatusCode == http.StatusOK &&
+		(resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "") &&
+		!strings.Contains(strings.ToLower(resp.Header.Get("Cache-Control")), "no-store")
+	if !cacheable {
+		if ok && resp.StatusCode == http.StatusOK {
+			t.Store.Delete(key)
+		}
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	t.Store.Set(key, &CachedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+		StoredAt:   time.Now(),
+	})
+	return resp, nil
+}
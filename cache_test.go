@@ -0,0 +1,151 @@
+package perigee
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// etagServer serves a fixed document with an ETag, counting full and conditional responses.
+type etagServer struct {
+	body    string
+	full    int
+	notMod  int
+	noStore bool
+}
+
+func (s *etagServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("ETag", `"abc"`)
+	if s.noStore {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	if r.Header.Get("If-None-Match") == `"abc"` {
+		s.notMod++
+		w.WriteHeader(304)
+		return
+	}
+	s.full++
+	w.Write([]byte(s.body))
+}
+
+func TestCachingTransportRevalidates(t *testing.T) {
+	server := &etagServer{body: `{"name": "cached"}`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	store := NewMemoryCache()
+	opts := Options{CustomClient: &http.Client{Transport: NewCachingTransport(nil, store)}}
+
+	for i := 0; i < 3; i++ {
+		var data struct {
+			Name string `json:"name"`
+		}
+		opts.Results = &data
+		response, err := Request("GET", ts.URL, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != 200 || data.Name != "cached" {
+			t.Fatalf("Attempt %d: expected a 200 with the document; got %d and %v", i, response.StatusCode, data)
+		}
+		hit := response.HttpResponse.Header.Get("X-Perigee-Cache") == "hit"
+		if hit != (i > 0) {
+			t.Fatalf("Attempt %d: unexpected cache hit status %v", i, hit)
+		}
+		if status := response.HttpResponse.Status; status != "200 OK" {
+			t.Fatalf("Attempt %d: expected the status line 200 OK; got %q", i, status)
+		}
+	}
+	if server.full != 1 || server.notMod != 2 {
+		t.Fatalf("Expected 1 full and 2 conditional responses; got %d and %d", server.full, server.notMod)
+	}
+}
+
+func TestCachingTransportHonorsNoStore(t *testing.T) {
+	server := &etagServer{body: "{}", noStore: true}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	store := NewMemoryCache()
+	opts := Options{CustomClient: &http.Client{Transport: NewCachingTransport(nil, store)}}
+	for i := 0; i < 2; i++ {
+		_, err := Request("GET", ts.URL, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if server.full != 2 {
+		t.Fatalf("Expected both requests to be served in full; got %d", server.full)
+	}
+}
+
+func TestDiskCachePersists(t *testing.T) {
+	dir := t.TempDir()
+	server := &etagServer{body: `{"name": "persisted"}`}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	cache, err := OpenDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{CustomClient: &http.Client{Transport: NewCachingTransport(nil, cache)}}
+	_, err = Request("GET", ts.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening the directory, as a new process would, finds the entry already warm.
+	reopened, err := OpenDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data struct {
+		Name string `json:"name"`
+	}
+	opts = Options{
+		CustomClient: &http.Client{Transport: NewCachingTransport(nil, reopened)},
+		Results:      &data,
+	}
+	response, err := Request("GET", ts.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.HttpResponse.Header.Get("X-Perigee-Cache") != "hit" || data.Name != "persisted" {
+		t.Fatalf("Expected a cache hit with the persisted document; got %v", data)
+	}
+	if server.full != 1 {
+		t.Fatalf("Expected only one full response; got %d", server.full)
+	}
+}
+
+func TestDiskCacheContentAddressing(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := OpenDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	same := &CachedResponse{StatusCode: 200, Header: http.Header{}, Body: []byte("shared")}
+	cache.Set("a", same)
+	cache.Set("b", same)
+	bodies, _ := ioutil.ReadDir(filepath.Join(dir, "bodies"))
+	if len(bodies) != 1 {
+		t.Fatalf("Expected identical bodies to be stored once; found %d files", len(bodies))
+	}
+
+	cache.Delete("a")
+	if resp, ok := cache.Get("b"); !ok || string(resp.Body) != "shared" {
+		t.Fatal("Expected b to survive the deletion of a")
+	}
+	cache.Delete("b")
+	bodies, _ = ioutil.ReadDir(filepath.Join(dir, "bodies"))
+	if len(bodies) != 0 {
+		t.Fatalf("Expected unreferenced bodies to be removed; found %d files", len(bodies))
+	}
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("Expected b to be gone")
+	}
+}
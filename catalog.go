@@ -0,0 +1,211 @@
+package perigee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The EndpointNotFoundError structure is returned when a service catalog holds no endpoint matching a lookup,
+// or, if Matches exceeds one, more endpoints than one without any way to choose among them.
+type EndpointNotFoundError struct {
+	Opts    EndpointOpts
+	Matches int
+}
+
+func (err *EndpointNotFoundError) Error() string {
+	if err.Matches > 1 {
+		return fmt.Sprintf("Found %d endpoints for %s; please narrow the lookup by name or region", err.Matches, err.Opts)
+	}
+	return fmt.Sprintf("No endpoint found for %s", err.Opts)
+}
+
+// CatalogEndpoint describes one endpoint of a service in a Keystone service catalog.
+// Interface is one of "public", "internal", or "admin".
+type CatalogEndpoint struct {
+	ID        string
+	Interface string
+	Region    string
+	URL       string
+}
+
+// CatalogService describes a service, and its endpoints, in a Keystone service catalog.
+type CatalogService struct {
+	ID        string
+	Type      string
+	Name      string
+	Endpoints []CatalogEndpoint
+}
+
+// ServiceCatalog lists the services available to an authenticated OpenStack user, as Keystone returns it along with a token.
+type ServiceCatalog struct {
+	Services []CatalogService
+}
+
+// EndpointOpts selects an endpoint from a ServiceCatalog.
+// Type (e.g., "compute" or "object-store") is required.
+// Name, if set, selects among several services of the same type.
+// Region, if set, restricts the lookup to that region.
+// Interface selects among the public, internal, and admin endpoints of a service; it defaults to "public".
+type EndpointOpts struct {
+	Type      string
+	Name      string
+	Region    string
+	Interface string
+}
+
+func (opts EndpointOpts) String() string {
+	s := fmt.Sprintf("type %q", opts.Type)
+	if opts.Name != "" {
+		s += fmt.Sprintf(", name %q", opts.Name)
+	}
+	if opts.Region != "" {
+		s += fmt.Sprintf(", region %q", opts.Region)
+	}
+	return s + fmt.Sprintf(", interface %q", opts.iface())
+}
+
+func (opts EndpointOpts) iface() string {
+	if opts.Interface == "" {
+		return "public"
+	}
+	return strings.TrimSuffix(strings.ToLower(opts.Interface), "url")
+}
+
+// keystoneV3 models the parts of a Keystone v3 token response describing the catalog.
+type keystoneV3 struct {
+	Token *struct {
+		Catalog []struct {
+			ID        string `json:"id"`
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Endpoints []struct {
+				ID        string `json:"id"`
+				Interface string `json:"interface"`
+				Region    string `json:"region"`
+				RegionID  string `json:"region_id"`
+				URL       string `json:"url"`
+			} `json:"endpoints"`
+		} `json:"catalog"`
+	} `json:"token"`
+}
+
+// keystoneV2 models the parts of a Keystone v2 token response describing the catalog.
+type keystoneV2 struct {
+	Access *struct {
+		ServiceCatalog []struct {
+			Type      string `json:"type"`
+			Name      string `json:"name"`
+			Endpoints []struct {
+				ID          string `json:"id"`
+				Region      string `json:"region"`
+				PublicURL   string `json:"publicURL"`
+				InternalURL string `json:"internalURL"`
+				AdminURL    string `json:"adminURL"`
+			} `json:"endpoints"`
+		} `json:"serviceCatalog"`
+	} `json:"access"`
+}
+
+// ParseServiceCatalog extracts the service catalog from the body of a Keystone token response, in either the v3 or the v2 format.
+func ParseServiceCatalog(body []byte) (*ServiceCatalog, error) {
+	var v3 keystoneV3
+	err := json.Unmarshal(body, &v3)
+	if err != nil {
+		return nil, err
+	}
+	catalog := new(ServiceCatalog)
+	if v3.Token != nil {
+		for _, s := range v3.Token.Catalog {
+			service := CatalogService{ID: s.ID, Type: s.Type, Name: s.Name}
+			for _, e := range s.Endpoints {
+				region := e.RegionID
+				if region == "" {
+					region = e.Region
+				}
+				service.Endpoints = append(service.Endpoints, CatalogEndpoint{ID: e.ID, Interface: e.Interface, Region: region, URL: e.URL})
+			}
+			catalog.Services = append(catalog.Services, service)
+		}
+		return catalog, nil
+	}
+
+	var v2 keystoneV2
+	err = json.Unmarshal(body, &v2)
+	if err != nil {
+		return nil, err
+	}
+	if v2.Access == nil {
+		return nil, errors.New("perigee: response holds no Keystone service catalog")
+	}
+	for _, s := range v2.Access.ServiceCatalog {
+		service := CatalogService{Type: s.Type, Name: s.Name}
+		for _, e := range s.Endpoints {
+			urls := []struct{ iface, url string }{{"public", e.PublicURL}, {"internal", e.InternalURL}, {"admin", e.AdminURL}}
+			for _, u := range urls {
+				if u.url != "" {
+					service.Endpoints = append(service.Endpoints, CatalogEndpoint{ID: e.ID, Interface: u.iface, Region: e.Region, URL: u.url})
+				}
+			}
+		}
+		catalog.Services = append(catalog.Services, service)
+	}
+	return catalog, nil
+}
+
+// Endpoints returns every endpoint matching the lookup.
+func (c *ServiceCatalog) Endpoints(opts EndpointOpts) []CatalogEndpoint {
+	var found []CatalogEndpoint
+	for _, s := range c.Services {
+		if s.Type != opts.Type || (opts.Name != "" && s.Name != opts.Name) {
+			continue
+		}
+		for _, e := range s.Endpoints {
+			if e.Interface == opts.iface() && (opts.Region == "" || e.Region == opts.Region) {
+				found = append(found, e)
+			}
+		}
+	}
+	return found
+}
+
+// EndpointURL resolves the lookup to a single endpoint URL.
+// It fails with an *EndpointNotFoundError if no endpoint matches, or if several do.
+func (c *ServiceCatalog) EndpointURL(opts EndpointOpts) (string, error) {
+	found := c.Endpoints(opts)
+	if len(found) != 1 {
+		return "", &EndpointNotFoundError{Opts: opts, Matches: len(found)}
+	}
+	return found[0].URL, nil
+}
+
+// NewClient creates a Client for the service endpoint matching the lookup, applying the given defaults to each request.
+// Request URLs relative to the endpoint, such as "servers/detail", are resolved against it.
+func (c *ServiceCatalog) NewClient(opts EndpointOpts, defaults Options) (*Client, error) {
+	url, err := c.EndpointURL(opts)
+	if err != nil {
+		return nil, err
+	}
+	client := NewClient(defaults)
+	client.SetBaseURL(url)
+	return client, nil
+}
+
+// Clients creates a Client for each type of service in the catalog, keyed by type, applying the given defaults to each request.
+// Endpoints are selected by the lookup's Region and Interface; its Type and Name are ignored.
+// Service types without exactly one matching endpoint are left out.
+func (c *ServiceCatalog) Clients(opts EndpointOpts, defaults Options) map[string]*Client {
+	clients := make(map[string]*Client)
+	for _, s := range c.Services {
+		if _, ok := clients[s.Type]; ok {
+			continue
+		}
+		opts.Type, opts.Name = s.Type, ""
+		client, err := c.NewClient(opts, defaults)
+		if err == nil {
+			clients[s.Type] = client
+		}
+	}
+	return clients
+}
@@ -0,0 +1,84 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const keystoneV3Token = `{"token": {"catalog": [
+	{"id": "1", "type": "compute", "name": "nova", "endpoints": [
+		{"id": "a", "interface": "public", "region_id": "DFW", "url": "https://dfw.compute.example.com/v2/t"},
+		{"id": "b", "interface": "internal", "region_id": "DFW", "url": "https://dfw.internal.example.com/v2/t"},
+		{"id": "c", "interface": "public", "region_id": "ORD", "url": "https://ord.compute.example.com/v2/t"}
+	]},
+	{"id": "2", "type": "object-store", "name": "swift", "endpoints": [
+		{"id": "d", "interface": "public", "region": "DFW", "url": "https://dfw.storage.example.com/v1/t"}
+	]}
+]}}`
+
+const keystoneV2Token = `{"access": {"serviceCatalog": [
+	{"type": "compute", "name": "nova", "endpoints": [
+		{"region": "DFW", "publicURL": "https://dfw.compute.example.com/v2/t", "internalURL": "https://dfw.internal.example.com/v2/t"}
+	]}
+]}}`
+
+func TestServiceCatalogLookups(t *testing.T) {
+	for name, body := range map[string]string{"v3": keystoneV3Token, "v2": keystoneV2Token} {
+		catalog, err := ParseServiceCatalog([]byte(body))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		url, err := catalog.EndpointURL(EndpointOpts{Type: "compute", Region: "DFW"})
+		if err != nil || url != "https://dfw.compute.example.com/v2/t" {
+			t.Fatalf("%s: expected the public DFW compute endpoint; got %q, %v", name, url, err)
+		}
+		url, err = catalog.EndpointURL(EndpointOpts{Type: "compute", Region: "DFW", Interface: "internalURL"})
+		if err != nil || url != "https://dfw.internal.example.com/v2/t" {
+			t.Fatalf("%s: expected the internal DFW compute endpoint; got %q, %v", name, url, err)
+		}
+		_, err = catalog.EndpointURL(EndpointOpts{Type: "dns"})
+		if e, ok := err.(*EndpointNotFoundError); !ok || e.Matches != 0 {
+			t.Fatalf("%s: expected an EndpointNotFoundError; got %#v", name, err)
+		}
+	}
+
+	catalog, _ := ParseServiceCatalog([]byte(keystoneV3Token))
+	_, err := catalog.EndpointURL(EndpointOpts{Type: "compute"})
+	if e, ok := err.(*EndpointNotFoundError); !ok || e.Matches != 2 || !strings.Contains(e.Error(), "narrow") {
+		t.Fatalf("Expected an ambiguous lookup to be reported; got %#v", err)
+	}
+
+	_, err = ParseServiceCatalog([]byte(`{"servers": []}`))
+	if err == nil {
+		t.Fatal("Expected a body without a catalog to be rejected")
+	}
+}
+
+func TestServiceCatalogClients(t *testing.T) {
+	var path, token string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, token = r.URL.Path, r.Header.Get("X-Auth-Token")
+	}))
+	defer ts.Close()
+
+	catalog, _ := ParseServiceCatalog([]byte(strings.Replace(keystoneV3Token, "https://dfw.compute.example.com", ts.URL, 1)))
+	defaults := Options{MoreHeaders: map[string]string{"X-Auth-Token": "secret"}}
+	compute, err := catalog.NewClient(EndpointOpts{Type: "compute", Region: "DFW"}, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = compute.Request("GET", "servers/detail", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v2/t/servers/detail" || token != "secret" {
+		t.Fatalf("Expected a request to the compute endpoint with the default headers; got %s with token %q", path, token)
+	}
+
+	clients := catalog.Clients(EndpointOpts{Region: "DFW"}, defaults)
+	if len(clients) != 2 || clients["object-store"].BaseURL() != "https://dfw.storage.example.com/v1/t" {
+		t.Fatalf("Expected a client per service type; got %v", clients)
+	}
+}
@@ -0,0 +1,349 @@
+package perigee
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+)
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendCBOR(nil, generic)
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	d := &cborDecoder{data: data}
+	generic, err := d.value(0)
+	if err != nil {
+		return err
+	}
+	if generic == cborBreak {
+		return d.fail("unexpected break")
+	}
+	if d.pos != len(data) {
+		return d.fail("trailing data")
+	}
+	return fromGeneric(generic, v)
+}
+
+// The CBOR major types (RFC 8949, section 3.1).
+const (
+	cborUint = iota << 5
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// appendCBOR appends the CBOR encoding of a generic value (see toGeneric) to b.
+func appendCBOR(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xf6), nil
+	case bool:
+		if v {
+			return append(b, 0xf5), nil
+		}
+		return append(b, 0xf4), nil
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			if n < 0 {
+				return appendCBORHead(b, cborNegInt, uint64(-1-n)), nil
+			}
+			return appendCBORHead(b, cborUint, uint64(n)), nil
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return appendCBORHead(b, cborUint, n), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xfb), math.Float64bits(f)), nil
+	case string:
+		return append(appendCBORHead(b, cborText, uint64(len(v))), v...), nil
+	case []interface{}:
+		b = appendCBORHead(b, cborArray, uint64(len(v)))
+		var err error
+		for _, item := range v {
+			b, err = appendCBOR(b, item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		b = appendCBORHead(b, cborMap, uint64(len(v)))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, k := range keys {
+			b, _ = appendCBOR(b, k)
+			b, err = appendCBOR(b, v[k])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("perigee: cannot encode %T as CBOR", v)
+}
+
+// appendCBORHead appends the initial bytes of a data item of the given major type and argument, in its shortest form.
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major|27), n)
+}
+
+// cborDecoder decodes CBOR into generic values.
+// Byte strings become []byte, map keys other than text strings are formatted as text, and tags are dropped, leaving the items they enclose.
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// cborBreak marks the "break" stop code ending an indefinite-length item.
+var cborBreak = new(struct{})
+
+func (d *cborDecoder) fail(msg string) error {
+	return &CodecError{Format: "CBOR", Offset: d.pos, Msg: msg}
+}
+
+// next consumes n bytes.
+func (d *cborDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, d.fail("unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// head consumes the initial bytes of a data item, returning its major type and argument.
+// The indefinite flag reports an argument of 31, which marks indefinite lengths and, for simple values, the break stop code.
+func (d *cborDecoder) head() (major byte, n uint64, indefinite bool, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	major, info := b[0]&0xe0, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), false, nil
+	case info == 31:
+		return major, 0, true, nil
+	case info > 27:
+		d.pos--
+		return 0, 0, false, d.fail(fmt.Sprintf("reserved additional information %d", info))
+	}
+	arg, err := d.next(1 << (info - 24))
+	for _, c := range arg {
+		n = n<<8 | uint64(c)
+	}
+	return major, n, false, err
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > maxCodecDepth {
+		return nil, d.fail("nesting too deep")
+	}
+	start := d.pos
+	major, n, indefinite, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	if indefinite {
+		switch major {
+		case cborBytes, cborText:
+			return d.chunks(major, depth)
+		case cborArray:
+			return d.array(-1, depth)
+		case cborMap:
+			return d.object(-1, depth)
+		case cborSimple:
+			return cborBreak, nil
+		}
+		d.pos = start
+		return nil, d.fail("indefinite length on an integer or tag")
+	}
+
+	switch major {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			// Below the range of int64; json.Number keeps it exact.
+			v := new(big.Int).SetUint64(n)
+			return json.Number(v.Neg(v.Add(v, big.NewInt(1))).String()), nil
+		}
+		return -1 - int64(n), nil
+	case cborBytes:
+		b, err := d.next(n)
+		return append([]byte(nil), b...), err
+	case cborText:
+		b, err := d.next(n)
+		return string(b), err
+	case cborArray:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, d.fail("unexpected end of data")
+		}
+		return d.array(int(n), depth)
+	case cborMap:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, d.fail("unexpected end of data")
+		}
+		return d.object(int(n), depth)
+	case cborTag:
+		return d.value(depth + 1)
+	}
+
+	switch d.data[start] {
+	case 0xf4:
+		return false, nil
+	case 0xf5:
+		return true, nil
+	case 0xf6, 0xf7:
+		return nil, nil
+	case 0xf9:
+		return halfFloat(uint16(n)), nil
+	case 0xfa:
+		return float64(math.Float32frombits(uint32(n))), nil
+	case 0xfb:
+		return math.Float64frombits(n), nil
+	}
+	d.pos = start
+	return nil, d.fail(fmt.Sprintf("unsupported simple value %d", n))
+}
+
+// chunks reads the chunks of an indefinite-length byte or text string, up to the break stop code.
+func (d *cborDecoder) chunks(major byte, depth int) (interface{}, error) {
+	var b []byte
+	for {
+		chunk, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch chunk := chunk.(type) {
+		case []byte:
+			if major == cborBytes {
+				b = append(b, chunk...)
+				continue
+			}
+		case string:
+			if major == cborText {
+				b = append(b, chunk...)
+				continue
+			}
+		}
+		if chunk != cborBreak {
+			return nil, d.fail("indefinite-length string chunk of the wrong type")
+		}
+		if major == cborText {
+			return string(b), nil
+		}
+		return b, nil
+	}
+}
+
+// array reads n items, or items up to the break stop code given a negative n.
+func (d *cborDecoder) array(n int, depth int) (interface{}, error) {
+	items := make([]interface{}, 0, lengthHint(n))
+	for i := 0; n < 0 || i < n; i++ {
+		item, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if item == cborBreak {
+			if n >= 0 {
+				return nil, d.fail("unexpected break")
+			}
+			break
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// object reads n pairs, or pairs up to the break stop code given a negative n.
+func (d *cborDecoder) object(n int, depth int) (interface{}, error) {
+	object := make(map[string]interface{}, lengthHint(n))
+	for i := 0; n < 0 || i < n; i++ {
+		key, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if key == cborBreak {
+			if n >= 0 {
+				return nil, d.fail("unexpected break")
+			}
+			break
+		}
+		value, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if value == cborBreak {
+			return nil, d.fail("unexpected break")
+		}
+		object[mapKey(key)] = value
+	}
+	return object, nil
+}
+
+// lengthHint returns the room to make for n items, none for an indefinite length.
+func lengthHint(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// halfFloat converts an IEEE 754 half-precision number.
+func halfFloat(h uint16) float64 {
+	exp, frac := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(frac, -24)
+	case 31:
+		f = math.Inf(1)
+		if frac != 0 {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(frac+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
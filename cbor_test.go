@@ -0,0 +1,78 @@
+package perigee
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCBOREncoding(t *testing.T) {
+	// Examples from RFC 8949, appendix A.
+	for _, c := range []struct {
+		in   interface{}
+		want string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{1000000, "1a000f4240"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{1.1, "fb3ff199999999999a"},
+		{false, "f4"},
+		{nil, "f6"},
+		{"IETF", "6449455446"},
+		{[]int{1, 2, 3}, "83010203"},
+		{map[string]string{"a": "A", "b": "B"}, "a26161614161626142"},
+	} {
+		got, err := CBORCodec.Marshal(c.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(got) != c.want {
+			t.Fatalf("Expected %v to encode as %s; got %x", c.in, c.want, got)
+		}
+	}
+}
+
+func TestCBORDecoding(t *testing.T) {
+	// Examples from RFC 8949, appendix A, decoded into generic JSON values.
+	for _, c := range []struct {
+		in   string
+		want interface{}
+	}{
+		{"3bffffffffffffffff", -18446744073709551616.0},
+		{"f93c00", 1.0},
+		{"f98001", -5.960464477539063e-08},
+		{"fa47c35000", 100000.0},
+		{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z"},
+		{"4401020304", "AQIDBA=="},
+		{"7f657374726561646d696e67ff", "streaming"},
+		{"9f018202039f0405ffff", []interface{}{1.0, []interface{}{2.0, 3.0}, []interface{}{4.0, 5.0}}},
+		{"bf61610161629f0203ffff", map[string]interface{}{"a": 1.0, "b": []interface{}{2.0, 3.0}}},
+		{"a201020304", map[string]interface{}{"1": 2.0, "3": 4.0}},
+		{"f7", nil},
+	} {
+		data, _ := hex.DecodeString(c.in)
+		var got interface{}
+		err := CBORCodec.Unmarshal(data, &got)
+		if err != nil {
+			t.Fatalf("%s: %v", c.in, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("Expected %s to decode as %#v; got %#v", c.in, c.want, got)
+		}
+	}
+
+	for _, bad := range []string{"", "1c", "6261", "ff", "8201ff", "5f61ff", "9b00000000ffffffff", "0000"} {
+		data, _ := hex.DecodeString(bad)
+		var v interface{}
+		var codecErr *CodecError
+		if err := CBORCodec.Unmarshal(data, &v); !errors.As(err, &codecErr) {
+			t.Fatalf("Expected a CodecError for %q; got %v", bad, err)
+		}
+	}
+}
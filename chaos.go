@@ -0,0 +1,153 @@
+package perigee
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyDistribution produces the artificial delays applied by a LatencyInjector.
+// Implementations receive the injector's random source, which is safe to use for the duration of the call.
+type LatencyDistribution interface {
+	Delay(rng *rand.Rand) time.Duration
+}
+
+// FixedLatency delays every request by the same amount.
+type FixedLatency time.Duration
+
+// Delay implements the LatencyDistribution interface.
+func (d FixedLatency) Delay(rng *rand.Rand) time.Duration {
+	return time.Duration(d)
+}
+
+// UniformLatency delays requests by an amount chosen uniformly between Min and Max, inclusive.
+type UniformLatency struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// Delay implements the LatencyDistribution interface.
+func (d UniformLatency) Delay(rng *rand.Rand) time.Duration {
+	if d.Max <= d.Min {
+		return d.Min
+	}
+	return d.Min + time.Duration(rng.Int63n(int64(d.Max-d.Min)+1))
+}
+
+// ParetoLatency delays requests according to a Pareto distribution, producing the long tail typical of overloaded upstreams.
+// Scale is the minimum delay; Shape (alpha) controls how heavy the tail is, smaller values producing more extreme outliers.
+// Delays are capped at Max, or at DefaultParetoMax if Max is zero, since the tail is otherwise unbounded.
+type ParetoLatency struct {
+	Scale time.Duration
+	Shape float64
+	Max   time.Duration
+}
+
+// Delay implements the LatencyDistribution interface.
+func (d ParetoLatency) Delay(rng *rand.Rand) time.Duration {
+	shape := d.Shape
+	if shape <= 0 {
+		shape = 1
+	}
+	ceiling := d.Max
+	if ceiling <= 0 {
+		ceiling = DefaultParetoMax
+	}
+	u := 1 - rng.Float64() // (0, 1]
+	// Clamp before converting: extreme samples overflow time.Duration.
+	delay := float64(d.Scale) / math.Pow(u, 1/shape)
+	if !(delay <= float64(ceiling)) {
+		return ceiling
+	}
+	return time.Duration(delay)
+}
+
+// DefaultParetoMax caps the delays of a ParetoLatency which sets no Max.
+const DefaultParetoMax = time.Hour
+
+// LatencyInjector is an http.RoundTripper which delays requests before handing them to an underlying transport.
+// It exists for load-testing how applications behave against slow upstreams;
+// install it as the Transport of the http.Client given in Options.CustomClient.
+//
+// Injection starts enabled, and may be toggled at runtime with Enable and Disable.
+// A request whose context is canceled while it is being delayed fails immediately with the context's error.
+type LatencyInjector struct {
+	// Transport performs the actual request.  If nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	disabled int32
+	mu       sync.Mutex
+	dist     LatencyDistribution
+	rng      *rand.Rand
+}
+
+// NewLatencyInjector creates an enabled injector delaying requests according to dist.
+func NewLatencyInjector(transport http.RoundTripper, dist LatencyDistribution) *LatencyInjector {
+	return &LatencyInjector{
+		Transport: transport,
+		dist:      dist,
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Enable resumes latency injection.
+func (l *LatencyInjector) Enable() {
+	atomic.StoreInt32(&l.disabled, 0)
+}
+
+// Disable suspends latency injection; requests pass straight through to the underlying transport.
+func (l *LatencyInjector) Disable() {
+	atomic.StoreInt32(&l.disabled, 1)
+}
+
+// Enabled reports whether latency is currently being injected.
+func (l *LatencyInjector) Enabled() bool {
+	return atomic.LoadInt32(&l.disabled) == 0
+}
+
+// SetDistribution replaces the distribution used for subsequent requests.
+func (l *LatencyInjector) SetDistribution(dist LatencyDistribution) {
+	l.mu.Lock()
+	l.dist = dist
+	l.mu.Unlock()
+}
+
+// nextDelay draws the delay for the next request.
+func (l *LatencyInjector) nextDelay() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dist == nil {
+		return 0
+	}
+	if l.rng == nil {
+		l.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return l.dist.Delay(l.rng)
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (l *LatencyInjector) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := l.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	if l.Enabled() {
+		if delay := l.nextDelay(); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				timer.Stop()
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return nil, req.Context().Err()
+			}
+		}
+	}
+	return transport.RoundTrip(req)
+}
@@ -0,0 +1,86 @@
+package perigee
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLatencyDistributions(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	if d := FixedLatency(5 * time.Millisecond).Delay(rng); d != 5*time.Millisecond {
+		t.Fatalf("Expected a fixed 5ms delay; got %s", d)
+	}
+
+	uniform := UniformLatency{Min: 10 * time.Millisecond, Max: 20 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if d := uniform.Delay(rng); d < uniform.Min || d > uniform.Max {
+			t.Fatalf("Uniform delay %s outside of [%s, %s]", d, uniform.Min, uniform.Max)
+		}
+	}
+
+	pareto := ParetoLatency{Scale: time.Millisecond, Shape: 1.5, Max: time.Second}
+	for i := 0; i < 100; i++ {
+		if d := pareto.Delay(rng); d < pareto.Scale || d > pareto.Max {
+			t.Fatalf("Pareto delay %s outside of [%s, %s]", d, pareto.Scale, pareto.Max)
+		}
+	}
+
+	// A heavy tail and no Max: samples would overflow time.Duration without the default cap.
+	heavy := ParetoLatency{Scale: time.Second, Shape: 0.05}
+	for i := 0; i < 1000; i++ {
+		if d := heavy.Delay(rng); d < heavy.Scale || d > DefaultParetoMax {
+			t.Fatalf("Pareto delay %s outside of [%s, %s]", d, heavy.Scale, DefaultParetoMax)
+		}
+	}
+}
+
+func TestLatencyInjector(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("testing"))
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	injector := NewLatencyInjector(nil, FixedLatency(50*time.Millisecond))
+	opts := Options{CustomClient: &http.Client{Transport: injector}}
+
+	start := time.Now()
+	_, err := Request("GET", ts.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("Expected the request to be delayed by at least 50ms; took %s", elapsed)
+	}
+
+	injector.Disable()
+	if injector.Enabled() {
+		t.Fatal("Expected the injector to be disabled")
+	}
+	injector.SetDistribution(FixedLatency(time.Hour))
+	_, err = Request("GET", ts.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLatencyInjectorHonorsCancellation(t *testing.T) {
+	injector := NewLatencyInjector(nil, FixedLatency(time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequest("GET", "http://example.invalid/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = injector.RoundTrip(req.WithContext(ctx))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected context.DeadlineExceeded; got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package perigee
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client issues requests on top of a set of default Options, so that settings common to every call
+// (the HTTP client, authentication hooks, headers, acceptable codes) live in one place.
+// The Options given to each call are layered over the defaults with Options.Merge.
+//
+// A Client is safe for concurrent use by multiple goroutines, including while its defaults are being replaced.
+// The Client keeps its own copy of the defaults (see Options.Clone), so callers remain free to modify the Options they passed in.
+//
+// Each request works from an immutable snapshot of the defaults, taken when the request is dispatched.
+// Updates never modify the defaults in place; they build a new copy and swap it in.
+// So a re-authentication replacing the token header while a request is being built cannot tear that request:
+// it carries either the old settings or the new ones, never a mixture.
+//
+// A Client may also carry a base URL, against which the relative URLs given to Request are resolved,
+// default acceptable codes for each method (see SetMethodOkCodes),
+// a signer for handing out temporary URLs (see PresignURL),
+// a maximum lifetime for the connections it reuses (see SetMaxConnLifetime),
+// and a ceiling on the requests it has in flight, fixed (see SetMaxInFlight) or adaptive (see SetAdaptiveLimiter).
+type Client struct {
+	mu       sync.RWMutex
+	defaults Options
+	baseURL  string
+	okCodes  map[string][]int
+	signer   URLSigner
+
+	connLifetime time.Duration
+	connBirths   *connBirths
+	limiter      *AdaptiveLimiter
+
+	lifeMu      sync.Mutex
+	shutdown    bool
+	inflight    map[uint64]context.CancelFunc
+	nextID      uint64
+	drained     chan struct{}
+	maxInFlight int
+}
+
+// RESTOkCodes lists the response codes standard REST semantics deem successful for each method.
+// Pass it to Client.SetMethodOkCodes to spare call sites from repeating them.
+var RESTOkCodes = map[string][]int{
+	"GET":    {200},
+	"HEAD":   {200},
+	"POST":   {200, 201, 202, 204},
+	"PUT":    {200, 201, 202, 204},
+	"PATCH":  {200, 202, 204},
+	"DELETE": {202, 204},
+}
+
+// NewClient creates a Client applying the given defaults to each request.
+func NewClient(defaults Options) *Client {
+	return &Client{defaults: defaults.Clone()}
+}
+
+// Defaults returns a copy of the Options applied to every request.
+func (c *Client) Defaults() Options {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.defaults.Clone()
+}
+
+// SetDefaults replaces the Options applied to every subsequent request.
+// Requests already in flight are unaffected.
+func (c *Client) SetDefaults(defaults Options) {
+	defaults = defaults.Clone()
+	c.mu.Lock()
+	c.defaults = defaults
+	c.mu.Unlock()
+}
+
+// Update atomically modifies the client's defaults.
+// The function receives a private copy of the current defaults to modify as it pleases;
+// once it returns, the copy replaces the defaults for every subsequent request.
+// Concurrent updates are serialized, so none is lost.
+func (c *Client) Update(modify func(defaults *Options)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	next := c.defaults.Clone()
+	modify(&next)
+	c.defaults = next.Clone()
+}
+
+// SetHeader sets a header sent with every subsequent request, such as a freshly issued authentication token.
+func (c *Client) SetHeader(name, value string) {
+	c.Update(func(defaults *Options) {
+		if defaults.MoreHeaders == nil {
+			defaults.MoreHeaders = make(map[string]string)
+		}
+		defaults.MoreHeaders[name] = value
+	})
+}
+
+// DelHeader stops sending a header previously set with SetHeader or the defaults.
+func (c *Client) DelHeader(name string) {
+	c.Update(func(defaults *Options) {
+		delete(defaults.MoreHeaders, name)
+	})
+}
+
+// SetAuth sets the AuthProvider authenticating every subsequent request, or stops authenticating them, given nil.
+func (c *Client) SetAuth(auth AuthProvider) {
+	c.Update(func(defaults *Options) {
+		defaults.Auth = auth
+	})
+}
+
+// BaseURL returns the URL against which relative request URLs are resolved, if any.
+func (c *Client) BaseURL() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.baseURL
+}
+
+// SetBaseURL sets the URL against which relative request URLs are resolved, typically a service's endpoint.
+// A relative URL is appended to the base URL's path, so with a base URL of https://example.com/v2/tenant,
+// "servers" and "/servers" alike resolve to https://example.com/v2/tenant/servers.
+// URLs with a scheme are used as given.
+func (c *Client) SetBaseURL(base string) {
+	c.mu.Lock()
+	c.baseURL = base
+	c.mu.Unlock()
+}
+
+// SetMethodOkCodes sets the acceptable response codes for requests of each method given, such as RESTOkCodes.
+// They apply to calls not specifying OkCodes of their own, taking precedence over OkCodes in the defaults.
+// Methods not given keep whatever codes they had; a nil list removes a method's codes.
+func (c *Client) SetMethodOkCodes(codes map[string][]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	next := make(map[string][]int, len(c.okCodes)+len(codes))
+	for method, list := range c.okCodes {
+		next[method] = list
+	}
+	for method, list := range codes {
+		method = strings.ToUpper(method)
+		if list == nil {
+			delete(next, method)
+			continue
+		}
+		next[method] = append([]int(nil), list...)
+	}
+	c.okCodes = next
+}
+
+// MethodOkCodes returns the acceptable response codes set for requests of the given method, if any.
+func (c *Client) MethodOkCodes(method string) []int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]int(nil), c.okCodes[strings.ToUpper(method)]...)
+}
+
+// resolve turns a request URL relative to the base URL into an absolute one.
+func (c *Client) resolve(url string) string {
+	base := c.BaseURL()
+	if base == "" || strings.Contains(url, "://") {
+		return url
+	}
+	if url == "" {
+		return base
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(url, "/")
+}
+
+// snapshot returns the defaults in effect right now.
+// Since the defaults are replaced rather than modified, the snapshot can be used without holding the lock.
+// The method's acceptable codes, if set, are folded in.
+func (c *Client) snapshot(method string) Options {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	defaults := c.defaults
+	if codes, ok := c.okCodes[strings.ToUpper(method)]; ok {
+		defaults.OkCodes = codes
+	}
+	return defaults
+}
+
+// RequestWithContext issues an HTTP request through the client as Request does, governed by ctx in place of Options.Context.
+func (c *Client) RequestWithContext(ctx context.Context, method string, url string, opts Options) (*Response, error) {
+	opts.Context = ctx
+	return c.Request(method, url, opts)
+}
+
+// Request issues an HTTP request as the package-level Request function does,
+// after layering opts over a snapshot of the client's defaults, and resolving url against the base URL.
+// It fails with ErrClientShutdown once the client has been shut down (see Shutdown).
+func (c *Client) Request(method string, url string, opts Options) (*Response, error) {
+	opts = c.snapshot(method).Merge(opts)
+	ctx, done, err := c.begin(opts.Context)
+	if overloaded, ok := err.(*OverloadedError); ok {
+		overloaded.Url = c.resolve(url)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	opts.Context = ctx
+	c.mu.RLock()
+	lifetime, births, limiter := c.connLifetime, c.connBirths, c.limiter
+	c.mu.RUnlock()
+	if lifetime > 0 {
+		opts.Transport = &lifetimeTransport{base: poolTransport(opts), births: births, lifetime: lifetime}
+	}
+	if limiter == nil {
+		return Request(method, c.resolve(url), opts)
+	}
+	if overloaded := limiter.acquire(); overloaded != nil {
+		overloaded.Url = c.resolve(url)
+		return nil, overloaded
+	}
+	resp, err := Request(method, c.resolve(url), opts)
+	limiter.release(resp, err)
+	return resp, err
+}
+
+// Get issues a GET request through the client; see Request.
+func (c *Client) Get(url string, opts Options) (*Response, error) {
+	return c.Request("GET", url, opts)
+}
+
+// Post issues a POST request through the client; see Request.
+func (c *Client) Post(url string, opts Options) (*Response, error) {
+	return c.Request("POST", url, opts)
+}
+
+// Put issues a PUT request through the client; see Request.
+func (c *Client) Put(url string, opts Options) (*Response, error) {
+	return c.Request("PUT", url, opts)
+}
+
+// Delete issues a DELETE request through the client; see Request.
+func (c *Client) Delete(url string, opts Options) (*Response, error) {
+	return c.Request("DELETE", url, opts)
+}
+
+// Patch issues a PATCH request through the client; see Request.
+func (c *Client) Patch(url string, opts Options) (*Response, error) {
+	return c.Request("PATCH", url, opts)
+}
+
+// Head issues a HEAD request through the client; see Request and the package-level Head.
+func (c *Client) Head(url string, opts Options) (*Response, error) {
+	return c.Request("HEAD", url, opts)
+}
+
+// Options issues an OPTIONS request through the client; see Request.
+func (c *Client) Options(url string, opts Options) (*Response, error) {
+	return c.Request("OPTIONS", url, opts)
+}
@@ -0,0 +1,259 @@
+package perigee
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientLayersDefaults(t *testing.T) {
+	var h http.Header
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h = r.Header
+		w.WriteHeader(202)
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client := NewClient(Options{
+		MoreHeaders: map[string]string{"X-Auth-Token": "secret", "X-Tenant": "t1"},
+		OkCodes:     []int{200},
+	})
+
+	_, err := client.Request("GET", ts.URL, Options{})
+	if e, ok := err.(*UnexpectedResponseCodeError); !ok || e.Actual != 202 {
+		t.Fatalf("Expected the default OkCodes to reject a 202; got %#v", err)
+	}
+	if h.Get("X-Auth-Token") != "secret" || h.Get("X-Tenant") != "t1" {
+		t.Fatalf("Expected default headers to be sent; got %v", h)
+	}
+
+	_, err = client.Request("GET", ts.URL, Options{
+		MoreHeaders: map[string]string{"X-Tenant": "t2"},
+		OkCodes:     []int{202},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Get("X-Auth-Token") != "secret" || h.Get("X-Tenant") != "t2" {
+		t.Fatalf("Expected per-call headers to override defaults; got %v", h)
+	}
+}
+
+func TestClientKeepsItsOwnDefaults(t *testing.T) {
+	defaults := Options{MoreHeaders: map[string]string{"X-Auth-Token": "one"}}
+	client := NewClient(defaults)
+
+	defaults.MoreHeaders["X-Auth-Token"] = "two"
+	if got := client.Defaults().MoreHeaders["X-Auth-Token"]; got != "one" {
+		t.Fatalf("Expected the client to keep its own copy of the defaults; got %q", got)
+	}
+
+	copied := client.Defaults()
+	copied.MoreHeaders["X-Auth-Token"] = "three"
+	if got := client.Defaults().MoreHeaders["X-Auth-Token"]; got != "one" {
+		t.Fatalf("Expected Defaults to return a copy; got %q", got)
+	}
+}
+
+func TestClientConcurrentUse(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client := NewClient(Options{MoreHeaders: map[string]string{"X-Auth-Token": "initial"}})
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			var err error
+			for j := 0; j < 10 && err == nil; j++ {
+				_, err = client.Request("GET", ts.URL, Options{MoreHeaders: map[string]string{"X-Call": "1"}})
+			}
+			done <- err
+		}()
+	}
+	for j := 0; j < 10; j++ {
+		client.SetDefaults(Options{MoreHeaders: map[string]string{"X-Auth-Token": "refreshed"}})
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClientUpdatesDoNotTearRequests(t *testing.T) {
+	torn := make(chan string, 100)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a, b := r.Header.Get("X-Token"), r.Header.Get("X-Token-Generation"); a != "token-"+b {
+			torn <- a + " / " + b
+		}
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client := NewClient(Options{})
+	reauth := func(generation string) {
+		client.Update(func(defaults *Options) {
+			if defaults.MoreHeaders == nil {
+				defaults.MoreHeaders = make(map[string]string)
+			}
+			defaults.MoreHeaders["X-Token"] = "token-" + generation
+			defaults.MoreHeaders["X-Token-Generation"] = generation
+		})
+	}
+	reauth("0")
+
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			var err error
+			for j := 0; j < 20 && err == nil; j++ {
+				_, err = client.Request("GET", ts.URL, Options{})
+			}
+			done <- err
+		}()
+	}
+	for j := 1; j <= 50; j++ {
+		reauth(string(rune('a' + j%26)))
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(torn)
+	for mismatch := range torn {
+		t.Errorf("Request carried a torn set of headers: %s", mismatch)
+	}
+
+	client.SetHeader("X-Extra", "1")
+	client.DelHeader("X-Token-Generation")
+	defaults := client.Defaults()
+	if defaults.MoreHeaders["X-Extra"] != "1" {
+		t.Fatal("Expected SetHeader to add a default header")
+	}
+	if _, ok := defaults.MoreHeaders["X-Token-Generation"]; ok {
+		t.Fatal("Expected DelHeader to remove a default header")
+	}
+}
+
+func TestClientBaseURL(t *testing.T) {
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	defer ts.Close()
+
+	client := NewClient(Options{})
+	client.SetBaseURL(ts.URL + "/v2/tenant/")
+	for _, url := range []string{"servers", "/servers"} {
+		_, err := client.Request("GET", url, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != "/v2/tenant/servers" {
+			t.Fatalf("%q: expected the base URL's path to be extended; got %s", url, path)
+		}
+	}
+
+	_, err := client.Request("GET", ts.URL+"/other", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/other" {
+		t.Fatalf("Expected absolute URLs to be used as given; got %s", path)
+	}
+}
+
+func TestPerRequestTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"via":"default"}`))
+	}))
+	defer ts.Close()
+
+	var used bool
+	override := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		used = true
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	client := NewClient(Options{CustomClient: &http.Client{Timeout: time.Minute}})
+	_, err := client.Request("GET", ts.URL, Options{Transport: override})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !used {
+		t.Fatal("Expected the request to use its own transport")
+	}
+	if client.Defaults().CustomClient.Transport != nil {
+		t.Fatal("Expected the client's own transport to be left alone")
+	}
+}
+
+func TestClientMethodOkCodes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			w.WriteHeader(201)
+		case "DELETE":
+			w.WriteHeader(204)
+		case "PUT":
+			w.WriteHeader(409)
+		}
+	}))
+	defer ts.Close()
+
+	client := NewClient(Options{OkCodes: []int{200}})
+	client.SetMethodOkCodes(RESTOkCodes)
+	client.SetMethodOkCodes(map[string][]int{"put": nil})
+
+	if _, err := client.Request("POST", ts.URL, Options{}); err != nil {
+		t.Fatalf("Expected 201 to suit a POST; got %v", err)
+	}
+	if _, err := client.Request("DELETE", ts.URL, Options{}); err != nil {
+		t.Fatalf("Expected 204 to suit a DELETE; got %v", err)
+	}
+	if _, err := client.Request("DELETE", ts.URL, Options{OkCodes: []int{202}}); err == nil {
+		t.Fatal("Expected a call's own OkCodes to take precedence")
+	}
+	if _, err := client.Request("PUT", ts.URL, Options{}); err == nil {
+		t.Fatal("Expected a method without codes to fall back on the defaults")
+	}
+	if codes := client.MethodOkCodes("post"); len(codes) != 4 {
+		t.Fatalf("Expected 4 codes for POST; got %v", codes)
+	}
+}
+
+func TestClientVerbs(t *testing.T) {
+	var seen []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Method+" "+r.URL.Path+" "+r.Header.Get("X-Auth-Token")+" "+r.Header.Get("X-Tenant"))
+	}))
+	defer ts.Close()
+
+	client := NewClient(Options{MoreHeaders: map[string]string{"X-Tenant": "t1"}})
+	client.SetBaseURL(ts.URL + "/v2")
+	client.SetAuth(&TokenAuth{Fetch: func(ctx context.Context) (string, time.Time, error) {
+		return "secret", time.Now().Add(time.Hour), nil
+	}})
+	for _, call := range []func(string, Options) (*Response, error){client.Get, client.Post, client.Put, client.Delete} {
+		_, err := call("/servers", Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"GET", "POST", "PUT", "DELETE"}
+	for i, method := range want {
+		if seen[i] != method+" /v2/servers secret t1" {
+			t.Fatalf("Expected %s with the client's base URL, auth, and headers; got %q", method, seen[i])
+		}
+	}
+
+	client.SetAuth(nil)
+	client.Get("/servers", Options{})
+	if seen[4] != "GET /v2/servers  t1" {
+		t.Fatalf("Expected no authentication once removed; got %q", seen[4])
+	}
+}
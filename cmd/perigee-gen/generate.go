@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/racker/perigee"
+)
+
+// Config controls the shape of the generated code.
+type Config struct {
+	// Package names the package the generated file belongs to.
+	Package string
+
+	// Source, if set, is mentioned in the generated file's header.
+	Source string
+}
+
+// methods lists the HTTP methods in the order their operations are emitted.
+var methods = []string{"GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH", "TRACE"}
+
+// initialisms are rendered in upper case when they form a whole word of an identifier.
+var initialisms = map[string]bool{
+	"API": true, "HTTP": true, "ID": true, "IP": true, "JSON": true,
+	"URI": true, "URL": true, "UUID": true, "XML": true,
+}
+
+type generator struct {
+	spec     *perigee.OpenAPISpec
+	types    bytes.Buffer
+	funcs    bytes.Buffer
+	declared map[string]bool
+	owners   map[string]*perigee.OpenAPISchema
+	structs  map[*perigee.OpenAPISchema]string
+	usesFmt  bool
+	usesURL  bool
+}
+
+// Generate writes Go source declaring one function per operation in the spec, along with the types they use.
+// The output is gofmt-formatted.
+func Generate(w io.Writer, spec *perigee.OpenAPISpec, cfg Config) error {
+	g := &generator{
+		spec:     spec,
+		declared: make(map[string]bool),
+		owners:   make(map[string]*perigee.OpenAPISchema),
+		structs:  make(map[*perigee.OpenAPISchema]string),
+	}
+
+	names := make([]string, 0, len(spec.Components.Schemas))
+	for name := range spec.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// Components keep their own names; inline schemas whose names would clash with one are renamed instead.
+	for _, name := range names {
+		if _, ok := g.owners[goName(name)]; !ok {
+			g.owners[goName(name)] = spec.Components.Schemas[name]
+		}
+	}
+	for _, name := range names {
+		_, err := g.componentType(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	paths := make([]string, 0, len(spec.Paths))
+	for path := range spec.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		item := spec.Paths[path]
+		for _, method := range methods {
+			op := item.Operation(method)
+			if op == nil {
+				continue
+			}
+			err := g.operation(method, path, item, op)
+			if err != nil {
+				return fmt.Errorf("%s %s: %s", method, path, err)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if cfg.Source != "" {
+		fmt.Fprintf(&out, "// Code generated by perigee-gen from %s; DO NOT EDIT.\n\n", cfg.Source)
+	} else {
+		fmt.Fprintf(&out, "// Code generated by perigee-gen; DO NOT EDIT.\n\n")
+	}
+	fmt.Fprintf(&out, "package %s\n\nimport (\n", cfg.Package)
+	if g.usesFmt {
+		fmt.Fprintf(&out, "\t\"fmt\"\n")
+	}
+	if g.usesURL {
+		fmt.Fprintf(&out, "\t\"net/url\"\n")
+	}
+	fmt.Fprintf(&out, "\n\t\"github.com/racker/perigee\"\n)\n\n")
+	out.Write(g.types.Bytes())
+	out.Write(g.funcs.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated code does not parse: %s", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// componentType declares the named component schema, if it hasn't been already, and returns its Go type.
+func (g *generator) componentType(name string) (string, error) {
+	schema, ok := g.spec.Components.Schemas[name]
+	if !ok {
+		return "", fmt.Errorf("unresolved schema reference %s", name)
+	}
+	return g.typeFor(schema, goName(name))
+}
+
+// typeFor returns the Go type representing the schema, declaring structs as needed.
+// The hint names any struct declared for an inline object schema.
+func (g *generator) typeFor(schema *perigee.OpenAPISchema, hint string) (string, error) {
+	if schema == nil {
+		return "interface{}", nil
+	}
+	if schema.Ref != "" {
+		const prefix = "#/components/schemas/"
+		if !strings.HasPrefix(schema.Ref, prefix) {
+			return "", fmt.Errorf("unsupported schema reference %s", schema.Ref)
+		}
+		return g.componentType(strings.TrimPrefix(schema.Ref, prefix))
+	}
+
+	switch schema.Type {
+	case "string":
+		return "string", nil
+	case "integer":
+		if schema.Format == "int32" {
+			return "int32", nil
+		}
+		return "int64", nil
+	case "number":
+		if schema.Format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		elem, err := g.typeFor(schema.Items, hint+"Item")
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	case "object", "":
+		if len(schema.Properties) == 0 {
+			if schema.Type == "" {
+				return "interface{}", nil
+			}
+			return "map[string]interface{}", nil
+		}
+		return g.declareStruct(schema, hint)
+	}
+	return "", fmt.Errorf("unsupported schema type %q", schema.Type)
+}
+
+// declareStruct emits a struct type for an object schema, once, and returns its name.
+// A name already taken by a different schema is given a numeric suffix.
+func (g *generator) declareStruct(schema *perigee.OpenAPISchema, name string) (string, error) {
+	if declared, ok := g.structs[schema]; ok {
+		return declared, nil
+	}
+	for base, i := name, 2; g.owners[name] != nil && g.owners[name] != schema; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	g.owners[name] = schema
+	g.structs[schema] = name
+	g.declared[name] = true
+
+	required := make(map[string]bool)
+	for _, r := range schema.Required {
+		required[r] = true
+	}
+	props := make([]string, 0, len(schema.Properties))
+	for prop := range schema.Properties {
+		props = append(props, prop)
+	}
+	sort.Strings(props)
+
+	var body bytes.Buffer
+	for _, prop := range props {
+		field := goName(prop)
+		typ, err := g.typeFor(schema.Properties[prop], name+field)
+		if err != nil {
+			return "", err
+		}
+		tag := prop
+		if !required[prop] {
+			tag += ",omitempty"
+			if g.declared[typ] {
+				typ = "*" + typ
+			}
+		}
+		fmt.Fprintf(&body, "\t%s %s `json:%s`\n", field, typ, strconv.Quote(tag))
+	}
+
+	fmt.Fprintf(&g.types, "// %s is generated from the specification's schema of the same shape.\n", name)
+	fmt.Fprintf(&g.types, "type %s struct {\n%s}\n\n", name, body.String())
+	return name, nil
+}
+
+// parameter captures what the generator needs to know about an operation parameter.
+type parameter struct {
+	name     string
+	in       string
+	goName   string
+	goType   string
+	required bool
+}
+
+// operation emits the function for a single method/path pair.
+func (g *generator) operation(method, path string, item *perigee.OpenAPIPath, op *perigee.OpenAPIOperation) error {
+	name := goName(op.OperationID)
+	if name == "" {
+		name = goName(strings.ToLower(method) + " " + path)
+	}
+
+	var pathParams, otherParams []parameter
+	for _, p := range item.ParametersFor(op) {
+		typ, err := g.typeFor(p.Schema, name+goName(p.Name))
+		if err != nil {
+			return err
+		}
+		if p.Schema == nil {
+			typ = "string"
+		}
+		param := parameter{name: p.Name, in: p.In, goName: goName(p.Name), goType: typ, required: p.Required}
+		switch p.In {
+		case "path":
+			pathParams = append(pathParams, param)
+		case "query", "header":
+			otherParams = append(otherParams, param)
+		}
+	}
+	sort.SliceStable(pathParams, func(i, j int) bool {
+		return strings.Index(path, "{"+pathParams[i].name+"}") < strings.Index(path, "{"+pathParams[j].name+"}")
+	})
+
+	var bodyType string
+	if op.RequestBody != nil {
+		if media, ok := op.RequestBody.Content["application/json"]; ok {
+			typ, err := g.typeFor(media.Schema, name+"Request")
+			if err != nil {
+				return err
+			}
+			bodyType = typ
+		}
+	}
+
+	var okCodes []int
+	var resultType string
+	codes := make([]string, 0, len(op.Responses))
+	for code := range op.Responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		n, err := strconv.Atoi(code)
+		if err != nil || n < 200 || n > 299 {
+			continue
+		}
+		okCodes = append(okCodes, n)
+		if resultType != "" {
+			continue
+		}
+		if media, ok := op.Responses[code].Content["application/json"]; ok && media.Schema != nil {
+			typ, err := g.typeFor(media.Schema, name+"Result")
+			if err != nil {
+				return err
+			}
+			resultType = typ
+		}
+	}
+
+	if len(otherParams) > 0 {
+		fmt.Fprintf(&g.types, "// %sParams holds the query and header parameters accepted by %s.\n", name, name)
+		fmt.Fprintf(&g.types, "// Optional parameters left nil are omitted from the request.\ntype %sParams struct {\n", name)
+		for _, p := range otherParams {
+			typ := p.goType
+			if !p.required {
+				typ = "*" + typ
+			}
+			fmt.Fprintf(&g.types, "\t%s %s\n", p.goName, typ)
+		}
+		fmt.Fprintf(&g.types, "}\n\n")
+	}
+
+	args := []string{"baseURL string"}
+	for _, p := range pathParams {
+		args = append(args, lowerFirst(p.goName)+" "+p.goType)
+	}
+	if len(otherParams) > 0 {
+		args = append(args, "params "+name+"Params")
+	}
+	if bodyType != "" {
+		args = append(args, "body "+bodyType)
+	}
+	args = append(args, "opts perigee.Options")
+
+	returns := "(*perigee.Response, error)"
+	resultVar := ""
+	if resultType != "" {
+		resultVar = "result"
+		if g.declared[resultType] {
+			returns = fmt.Sprintf("(*%s, *perigee.Response, error)", resultType)
+			resultVar = "&result"
+		} else {
+			returns = fmt.Sprintf("(%s, *perigee.Response, error)", resultType)
+		}
+	}
+
+	f := &g.funcs
+	fmt.Fprintf(f, "// %s issues %s %s.\n", name, method, path)
+	if op.Summary != "" {
+		fmt.Fprintf(f, "// %s\n", strings.TrimSpace(op.Summary))
+	}
+	fmt.Fprintf(f, "func %s(%s) %s {\n", name, strings.Join(args, ", "), returns)
+
+	urlExpr := strconv.Quote(path)
+	for _, p := range pathParams {
+		value := lowerFirst(p.goName)
+		if p.goType != "string" {
+			value = fmt.Sprintf("fmt.Sprint(%s)", value)
+			g.usesFmt = true
+		}
+		urlExpr = strings.Replace(urlExpr, "{"+p.name+"}", `" + url.PathEscape(`+value+`) + "`, 1)
+	}
+	urlExpr = strings.TrimSuffix(urlExpr, ` + ""`)
+	fmt.Fprintf(f, "\tu := baseURL + %s\n", urlExpr)
+
+	hasQuery, hasHeader := false, false
+	for _, p := range otherParams {
+		if p.in == "query" {
+			hasQuery = true
+		} else {
+			hasHeader = true
+		}
+	}
+	if hasQuery {
+		fmt.Fprintf(f, "\tquery := url.Values{}\n")
+	}
+	if hasQuery || len(pathParams) > 0 {
+		g.usesURL = true
+	}
+	if hasHeader {
+		fmt.Fprintf(f, "\theaders := make(map[string]string, len(opts.MoreHeaders))\n")
+		fmt.Fprintf(f, "\tfor k, v := range opts.MoreHeaders {\n\t\theaders[k] = v\n\t}\n")
+		fmt.Fprintf(f, "\topts.MoreHeaders = headers\n")
+	}
+	for _, p := range otherParams {
+		value := "params." + p.goName
+		if !p.required {
+			value = "*" + value
+		}
+		if p.goType != "string" {
+			value = fmt.Sprintf("fmt.Sprint(%s)", value)
+			g.usesFmt = true
+		}
+		set := fmt.Sprintf("query.Set(%q, %s)", p.name, value)
+		if p.in == "header" {
+			set = fmt.Sprintf("headers[%q] = %s", p.name, value)
+		}
+		if p.required {
+			fmt.Fprintf(f, "\t%s\n", set)
+		} else {
+			fmt.Fprintf(f, "\tif params.%s != nil {\n\t\t%s\n\t}\n", p.goName, set)
+		}
+	}
+	if hasQuery {
+		fmt.Fprintf(f, "\tif len(query) > 0 {\n\t\tu += \"?\" + query.Encode()\n\t}\n")
+	}
+
+	if bodyType != "" {
+		fmt.Fprintf(f, "\topts.ReqBody = body\n")
+	}
+	if len(okCodes) > 0 {
+		codes := make([]string, len(okCodes))
+		for i, c := range okCodes {
+			codes[i] = strconv.Itoa(c)
+		}
+		fmt.Fprintf(f, "\tif opts.OkCodes == nil {\n\t\topts.OkCodes = []int{%s}\n\t}\n", strings.Join(codes, ", "))
+	}
+	if resultType != "" {
+		fmt.Fprintf(f, "\tvar result %s\n\topts.Results = &result\n", resultType)
+		fmt.Fprintf(f, "\tresp, err := perigee.Request(%q, u, opts)\n", method)
+		fmt.Fprintf(f, "\tif err != nil {\n\t\treturn nil, resp, err\n\t}\n")
+		fmt.Fprintf(f, "\treturn %s, resp, nil\n}\n\n", resultVar)
+	} else {
+		fmt.Fprintf(f, "\treturn perigee.Request(%q, u, opts)\n}\n\n", method)
+	}
+	return nil
+}
+
+// goName converts an identifier such as "flavor_ref", "X-Auth-Token", or "get /servers/{id}" into exported Go form.
+func goName(s string) string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+
+	var out strings.Builder
+	for _, w := range words {
+		upper := strings.ToUpper(w)
+		if initialisms[upper] {
+			out.WriteString(upper)
+			continue
+		}
+		out.WriteString(strings.ToUpper(w[:1]) + strings.ToLower(w[1:]))
+	}
+	name := out.String()
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "N" + name
+	}
+	return name
+}
+
+// lowerFirst converts an exported Go name into a local variable name.
+func lowerFirst(s string) string {
+	for upper := range initialisms {
+		if s == upper {
+			return strings.ToLower(s)
+		}
+	}
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	name := string(r)
+	switch name {
+	case "body", "opts", "params", "query", "headers", "u", "result", "resp", "err", "baseURL", "type", "func", "range", "map":
+		name += "Param"
+	}
+	return name
+}
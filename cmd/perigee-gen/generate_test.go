@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/racker/perigee"
+)
+
+const testSpec = `{
+	"openapi": "3.0.0",
+	"paths": {
+		"/servers": {
+			"get": {
+				"operationId": "listServers",
+				"summary": "Lists servers visible to the tenant.",
+				"parameters": [
+					{"name": "limit", "in": "query", "schema": {"type": "integer"}},
+					{"name": "X-Auth-Token", "in": "header", "required": true, "schema": {"type": "string"}}
+				],
+				"responses": {
+					"200": {"content": {"application/json": {"schema": {
+						"type": "object",
+						"properties": {"servers": {"type": "array", "items": {"$ref": "#/components/schemas/Server"}}}
+					}}}}
+				}
+			},
+			"post": {
+				"operationId": "create_server",
+				"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Server"}}}},
+				"responses": {"202": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Server"}}}}}
+			}
+		},
+		"/servers/{server_id}": {
+			"parameters": [{"name": "server_id", "in": "path", "required": true, "schema": {"type": "string"}}],
+			"delete": {"responses": {"204": {"description": "deleted"}}}
+		}
+	},
+	"components": {
+		"schemas": {
+			"Server": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"id": {"type": "string"},
+					"name": {"type": "string"},
+					"flavorRef": {"type": "string"},
+					"min_count": {"type": "integer", "format": "int32"},
+					"metadata": {"type": "object"},
+					"addresses": {"type": "object", "properties": {"public": {"type": "array", "items": {"type": "string"}}}}
+				}
+			}
+		}
+	}
+}`
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"flavorRef":            "FlavorRef",
+		"min_count":            "MinCount",
+		"X-Auth-Token":         "XAuthToken",
+		"server_id":            "ServerID",
+		"createServer":         "CreateServer",
+		"imageRef":             "ImageRef",
+		"HTTPServer":           "HTTPServer",
+		"delete /servers/{id}": "DeleteServersID",
+	}
+	for in, want := range tests {
+		if got := goName(in); got != want {
+			t.Errorf("goName(%q): expected %q; got %q", in, want, got)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	spec, err := perigee.LoadOpenAPISpec(strings.NewReader(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = Generate(&buf, spec, Config{Package: "compute", Source: "compute.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+
+	_, err = parser.ParseFile(token.NewFileSet(), "compute_gen.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %s\n%s", err, src)
+	}
+
+	expected := []string{
+		"// Code generated by perigee-gen from compute.json; DO NOT EDIT.",
+		"package compute",
+		"type Server struct {",
+		"ID        string                 `json:\"id,omitempty\"`",
+		"Name      string                 `json:\"name\"`",
+		"MinCount  int32                  `json:\"min_count,omitempty\"`",
+		"Metadata  map[string]interface{} `json:\"metadata,omitempty\"`",
+		"Addresses *ServerAddresses",
+		"type ServerAddresses struct {",
+		"type ListServersResult struct {",
+		"Servers []Server `json:\"servers,omitempty\"`",
+		"type ListServersParams struct {",
+		"Limit      *int64",
+		"XAuthToken string",
+		"// ListServers issues GET /servers.\n// Lists servers visible to the tenant.",
+		"func ListServers(baseURL string, params ListServersParams, opts perigee.Options) (*ListServersResult, *perigee.Response, error) {",
+		`query.Set("limit", fmt.Sprint(*params.Limit))`,
+		`headers["X-Auth-Token"] = params.XAuthToken`,
+		"func CreateServer(baseURL string, body Server, opts perigee.Options) (*Server, *perigee.Response, error) {",
+		"opts.OkCodes = []int{202}",
+		"func DeleteServersServerID(baseURL string, serverID string, opts perigee.Options) (*perigee.Response, error) {",
+		`u := baseURL + "/servers/" + url.PathEscape(serverID)`,
+		`return perigee.Request("DELETE", u, opts)`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(src, want) {
+			t.Errorf("expected generated code to contain %q\n%s", want, src)
+		}
+	}
+}
+
+// collidingSpec declares a component named as the inline schema of another component's property would be.
+const collidingSpec = `{
+	"openapi": "3.0.0",
+	"paths": {},
+	"components": {
+		"schemas": {
+			"Server": {
+				"type": "object",
+				"properties": {
+					"addresses": {"type": "object", "properties": {"public": {"type": "string"}}},
+					"links": {"$ref": "#/components/schemas/ServerAddresses"}
+				}
+			},
+			"ServerAddresses": {"type": "object", "properties": {"count": {"type": "integer"}}}
+		}
+	}
+}`
+
+func TestGenerateNameCollisions(t *testing.T) {
+	spec, err := perigee.LoadOpenAPISpec(strings.NewReader(collidingSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Generate(&buf, spec, Config{Package: "compute"}); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+
+	expected := []string{
+		"Addresses *ServerAddresses2",
+		"Links     *ServerAddresses",
+		"type ServerAddresses2 struct {\n\tPublic string",
+		"type ServerAddresses struct {\n\tCount int64",
+	}
+	for _, want := range expected {
+		if !strings.Contains(src, want) {
+			t.Errorf("expected generated code to contain %q\n%s", want, src)
+		}
+	}
+}
+
+// generatedTest exercises the generated compute package against a server checking what the generated code sends.
+const generatedTest = `package compute
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/racker/perigee"
+)
+
+func TestListServers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/servers" || r.URL.Query().Get("limit") != "2" || r.Header.Get("X-Auth-Token") != "secret" {
+			w.WriteHeader(400)
+			return
+		}
+		w.Write([]byte(` + "`" + `{"servers": [{"id": "1", "name": "web-01", "min_count": 3}]}` + "`" + `))
+	}))
+	defer ts.Close()
+
+	limit := int64(2)
+	result, _, err := ListServers(ts.URL, ListServersParams{Limit: &limit, XAuthToken: "secret"}, perigee.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Servers) != 1 || result.Servers[0].Name != "web-01" || result.Servers[0].MinCount != 3 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+}
+`
+
+func TestGeneratedCodeRuns(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the generated package with the go tool")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	spec, err := perigee.LoadOpenAPISpec(strings.NewReader(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = Generate(&buf, spec, Config{Package: "compute", Source: "compute.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lay out the package where the go tool finds it alongside perigee: in a GOPATH, or in a module replacing perigee with this tree.
+	work := t.TempDir()
+	dir := filepath.Join(work, "src", "compute")
+	err = os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "compute_gen.go"), buf.Bytes(), 0644)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(dir, "compute_test.go"), []byte(generatedTest), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	gomod, err := exec.Command(goTool, "env", "GOMOD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := os.Environ()
+	if mod := strings.TrimSpace(string(gomod)); mod == "" || mod == os.DevNull {
+		gopath, err := exec.Command(goTool, "env", "GOPATH").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		env = append(env, "GO111MODULE=off", "GOFLAGS=", "GOPATH="+work+string(os.PathListSeparator)+strings.TrimSpace(string(gopath)))
+	} else {
+		root, err := filepath.Abs(filepath.Join("..", ".."))
+		if err != nil {
+			t.Fatal(err)
+		}
+		gomodText := "module compute\n\nrequire github.com/racker/perigee v0.0.0\n\nreplace github.com/racker/perigee => " + root + "\n"
+		err = ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte(gomodText), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env = append(env, "GO111MODULE=on", "GOFLAGS=-mod=mod")
+	}
+
+	cmd := exec.Command(goTool, "test", ".")
+	cmd.Dir, cmd.Env = dir, env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("generated package fails to build or run: %s\n%s\n%s", err, out, buf.String())
+	}
+}
@@ -0,0 +1,70 @@
+// Command perigee-gen generates typed, perigee-based client functions from an OpenAPI 3 specification.
+//
+// Each operation in the specification becomes a Go function that builds the request URL from its path and query parameters,
+// marshals the request body, and decodes the successful response into a generated struct.
+// Component schemas become named structs; inline schemas are named after the operation that uses them.
+//
+// perigee-gen is intended to be driven by go generate:
+//
+//	//go:generate perigee-gen -spec compute.json -package compute -o compute_gen.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/racker/perigee"
+)
+
+func main() {
+	specFile := flag.String("spec", "", "path to the OpenAPI 3 specification, in JSON form")
+	pkg := flag.String("package", "", "package name for the generated code (defaults to $GOPACKAGE)")
+	output := flag.String("o", "", "output file (defaults to standard output)")
+	flag.Parse()
+
+	if *specFile == "" {
+		fmt.Fprintln(os.Stderr, "perigee-gen: -spec is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *pkg == "" {
+		*pkg = os.Getenv("GOPACKAGE")
+	}
+	if *pkg == "" {
+		fmt.Fprintln(os.Stderr, "perigee-gen: -package is required outside of go generate")
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*specFile)
+	if err != nil {
+		fatal(err)
+	}
+	spec, err := perigee.LoadOpenAPISpec(f)
+	f.Close()
+	if err != nil {
+		fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = Generate(&buf, spec, Config{Package: *pkg, Source: *specFile})
+	if err != nil {
+		fatal(err)
+	}
+
+	if *output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	err = ioutil.WriteFile(*output, buf.Bytes(), 0644)
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "perigee-gen: %s\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,75 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+)
+
+// Codec marshals request bodies into, and unmarshals response bodies from, one media type; see Options.Codec.
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// The built-in codecs.
+// MsgPackCodec and CBORCodec encode values as encoding/json would, honoring json tags and MarshalJSON methods,
+// then render the result in MessagePack or CBOR; decoding reverses the process.
+// So []byte fields travel as base64 text, not as binary strings, though binary strings received decode into []byte fields.
+var (
+	JSONCodec    Codec = jsonCodec{}
+	XMLCodec     Codec = xmlCodec{}
+	MsgPackCodec Codec = msgpackCodec{}
+	CBORCodec    Codec = cborCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return "application/json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string                        { return "application/xml" }
+func (xmlCodec) Marshal(v interface{}) ([]byte, error)      { return xml.Marshal(v) }
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+
+// The CodecError structure is returned when a MessagePack or CBOR body is malformed, or holds something JSON cannot represent.
+type CodecError struct {
+	Format string
+	Offset int
+	Msg    string
+}
+
+func (err *CodecError) Error() string {
+	return fmt.Sprintf("Malformed %s at offset %d: %s", err.Format, err.Offset, err.Msg)
+}
+
+// toGeneric converts a value to the generic form encoding/json decodes into (maps, slices, strings, numbers, booleans, and nil),
+// by way of its JSON encoding, with numbers kept as json.Number.
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err = dec.Decode(&generic)
+	return generic, err
+}
+
+// fromGeneric stores a generic value, as decoded from MessagePack or CBOR, into v, by way of its JSON encoding.
+func fromGeneric(generic interface{}, v interface{}) error {
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// maxCodecDepth bounds the nesting of MessagePack and CBOR bodies, so that hostile input cannot exhaust the stack.
+const maxCodecDepth = 1000
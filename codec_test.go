@@ -0,0 +1,78 @@
+package perigee
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type codecServer struct {
+	ID    int      `json:"id" xml:"id"`
+	Name  string   `json:"name" xml:"name"`
+	Tags  []string `json:"tags,omitempty" xml:"tag"`
+	Ratio float64  `json:"ratio" xml:"ratio"`
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	in := codecServer{ID: -70000, Name: "web-01", Tags: []string{"a", "b"}, Ratio: 0.25}
+	for _, codec := range []Codec{JSONCodec, XMLCodec, MsgPackCodec, CBORCodec} {
+		data, err := codec.Marshal(in)
+		if err != nil {
+			t.Fatalf("%s: %v", codec.ContentType(), err)
+		}
+		var out codecServer
+		err = codec.Unmarshal(data, &out)
+		if err != nil {
+			t.Fatalf("%s: %v", codec.ContentType(), err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Fatalf("Expected %s to round-trip %+v; got %+v", codec.ContentType(), in, out)
+		}
+	}
+}
+
+func TestOptionsCodec(t *testing.T) {
+	var contentType, accept string
+	var sent []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType, accept = r.Header.Get("Content-Type"), r.Header.Get("Accept")
+		sent, _ = ioutil.ReadAll(r.Body)
+		if r.URL.Query().Get("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id": 2, "name": "json"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/msgpack")
+		w.Write(sent)
+	}))
+	defer ts.Close()
+
+	in := codecServer{ID: 1, Name: "packed"}
+	var out codecServer
+	_, err := Request("POST", ts.URL, Options{Codec: MsgPackCodec, ReqBody: in, Results: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/msgpack" || accept != "application/msgpack" {
+		t.Fatalf("Expected the codec's media type in Content-Type and Accept; got %q and %q", contentType, accept)
+	}
+	want, _ := MsgPackCodec.Marshal(in)
+	if !bytes.Equal(sent, want) {
+		t.Fatalf("Expected the body to be marshaled with the codec; got %x", sent)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("Expected the response to be unmarshaled with the codec; got %+v", out)
+	}
+
+	out = codecServer{}
+	_, err = Request("GET", ts.URL+"?format=json", Options{Codec: MsgPackCodec, Results: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "json" {
+		t.Fatalf("Expected a JSON response to be decoded as JSON; got %+v", out)
+	}
+}
@@ -0,0 +1,277 @@
+package perigee
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientConfig describes the transport-level settings of a Client built with NewClientWithConfig.
+//
+// Proxy selects the proxy for each request, as http.Transport's field of the same name does.
+// If nil, no proxy is used.
+//
+// RootCAs, if set, replaces the system's certificate pool when verifying servers.
+//
+// Timeout bounds each request in its entirety, including reading the response body; zero means no limit.
+//
+// DialTimeout, TLSHandshakeTimeout, and ResponseHeaderTimeout bound the phases of a request separately,
+// so a server slow to accept connections can be told apart from one slow to answer.
+// They limit, respectively, establishing a TCP connection, completing the TLS handshake over it,
+// and receiving the response headers once the request has been written.
+// Zero keeps the defaults of http.DefaultTransport: 30 seconds, 10 seconds, and no limit.
+// All are subject to Timeout, if that is shorter.
+//
+// DNSCache, if set, resolves the host names of new connections, sparing repeated DNS lookups.
+//
+// HostOverrides maps host names to the addresses to connect to in their stead, as an /etc/hosts entry would,
+// so that tests and split-horizon setups can target alternate servers without touching the system's configuration.
+// Keys name a host ("api.example.com"), or a host and port ("api.example.com:443") to override that port alone;
+// values give an IP address, keeping the port requested, or an address and port ("10.0.0.5:8443").
+// Requests still carry the original host name in their Host header and TLS server name, and certificates are verified against it.
+// With a proxy, overrides apply to the proxy's address, the one connected to.
+//
+// DialContext, if set, makes the client's connections in place of its own dialer, for complete control over address resolution;
+// DialTimeout, DNSCache, and FallbackDelay then have no effect.
+//
+// AddressFamily pins connections to IPv4 or IPv6, e.g., to steer clear of a provider endpoint whose IPv6 is broken.
+// By default, both are used.
+//
+// FallbackDelay sets how long a dual-stack connection attempt waits on the preferred address family
+// (the family of the host's first address) before racing the other, as in RFC 6555 ("Happy Eyeballs").
+// Zero keeps net.Dialer's default of 300ms; a negative value disables the race, trying addresses strictly in turn.
+// Connections to hosts resolved through DNSCache always try addresses in turn.
+//
+// TLSSessionCacheSize, if positive, enables TLS session resumption, remembering the sessions of up to that many servers,
+// so that new connections to them skip most of the cost of a full handshake.
+// Zero leaves resumption off, as Go does by default; DefaultTLSSessionCacheSize suits most clients.
+// ConnInfo.TLSResumed on each Response reports whether its connection was resumed.
+//
+// HTTP3, if set, sends requests over HTTP/3 (QUIC), falling back to HTTP/2 or HTTP/1.1 for any request HTTP/3 fails to deliver.
+// Proxy, DNSCache, and the dial timeout apply only to the fallback.
+// HTTP/3 support is compiled in only with the http3 build tag; without it, NewClientWithConfig returns ErrHTTP3Unavailable.
+type ClientConfig struct {
+	Proxy                 func(*http.Request) (*url.URL, error)
+	RootCAs               *x509.CertPool
+	Timeout               time.Duration
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	DNSCache              *DNSCache
+	HostOverrides         map[string]string
+	DialContext           func(ctx context.Context, network, address string) (net.Conn, error)
+	AddressFamily         AddressFamily
+	FallbackDelay         time.Duration
+	TLSSessionCacheSize   int
+	HTTP3                 bool
+}
+
+// DefaultTLSSessionCacheSize is a TLS session cache size ample for clients talking to a handful of services.
+const DefaultTLSSessionCacheSize = 64
+
+// AddressFamily selects the IP versions a Client may connect over.
+type AddressFamily int
+
+const (
+	DualStack AddressFamily = iota // IPv4 and IPv6 both
+	IPv4Only                       // IPv4 alone
+	IPv6Only                       // IPv6 alone
+)
+
+// network narrows a network name, such as "tcp", to the address family.
+func (f AddressFamily) network(network string) string {
+	if network != "tcp" && network != "udp" && network != "ip" {
+		return network
+	}
+	switch f {
+	case IPv4Only:
+		return network + "4"
+	case IPv6Only:
+		return network + "6"
+	}
+	return network
+}
+
+// newTransport builds the http.Transport described by the configuration.
+func (cfg ClientConfig) newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = cfg.Proxy
+	transport.TLSClientConfig = cfg.tlsConfig()
+	if cfg.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	if cfg.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	}
+	if cfg.DNSCache != nil || cfg.DialTimeout > 0 || cfg.AddressFamily != DualStack || cfg.FallbackDelay != 0 ||
+		len(cfg.HostOverrides) > 0 || cfg.DialContext != nil {
+		dial := cfg.newDialer().DialContext
+		if cfg.DNSCache != nil {
+			dial = cfg.DNSCache.dialContext(cfg.newDialer())
+		}
+		if cfg.DialContext != nil {
+			dial = cfg.DialContext
+		}
+		family := cfg.AddressFamily
+		overrides := make(map[string]string, len(cfg.HostOverrides))
+		for host, addr := range cfg.HostOverrides {
+			overrides[strings.ToLower(host)] = addr
+		}
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dial(ctx, family.network(network), overrideAddress(overrides, address))
+		}
+	}
+	return transport
+}
+
+// overrideAddress returns the address to connect to in place of the given one, according to a ClientConfig's HostOverrides.
+func overrideAddress(overrides map[string]string, address string) string {
+	if len(overrides) == 0 {
+		return address
+	}
+	if addr, ok := overrides[strings.ToLower(address)]; ok {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	addr, ok := overrides[strings.ToLower(host)]
+	if !ok {
+		return address
+	}
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, port)
+}
+
+// tlsConfig builds the TLS settings described by the configuration, or returns nil if it leaves them all at their defaults.
+func (cfg ClientConfig) tlsConfig() *tls.Config {
+	if cfg.RootCAs == nil && cfg.TLSSessionCacheSize <= 0 {
+		return nil
+	}
+	config := &tls.Config{RootCAs: cfg.RootCAs}
+	if cfg.TLSSessionCacheSize > 0 {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(cfg.TLSSessionCacheSize)
+	}
+	return config
+}
+
+// newDialer builds the net.Dialer described by the configuration.
+// Unless overridden, its settings match those of http.DefaultTransport.
+func (cfg ClientConfig) newDialer() *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if cfg.DialTimeout > 0 {
+		dialer.Timeout = cfg.DialTimeout
+	}
+	dialer.FallbackDelay = cfg.FallbackDelay
+	return dialer
+}
+
+// NewClientWithConfig creates a Client whose requests travel through an HTTP client built from cfg.
+// The new HTTP client is installed as the defaults' CustomClient, replacing any given.
+func NewClientWithConfig(cfg ClientConfig, defaults Options) (*Client, error) {
+	var transport http.RoundTripper = cfg.newTransport()
+	if cfg.HTTP3 {
+		if newHTTP3Transport == nil {
+			return nil, ErrHTTP3Unavailable
+		}
+		transport = &FallbackTransport{Primary: newHTTP3Transport(cfg), Fallback: transport}
+	}
+	defaults.CustomClient = &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+	}
+	return NewClient(defaults), nil
+}
+
+// NewClientFromEnv creates a Client configured by the process environment, so operational knobs work without code changes.
+//
+// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY (or their lower-case forms) select proxies, as described by http.ProxyFromEnvironment.
+//
+// SSL_CERT_FILE names a PEM file, and SSL_CERT_DIR a colon-separated list of directories of PEM files,
+// whose certificates replace the system's pool when verifying servers.
+//
+// PERIGEE_TIMEOUT bounds each request; it holds either a Go duration (e.g., "30s") or a whole number of seconds.
+func NewClientFromEnv(defaults Options) (*Client, error) {
+	cfg, err := clientConfigFromEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithConfig(cfg, defaults)
+}
+
+// clientConfigFromEnv builds a ClientConfig from environment variables looked up with getenv.
+func clientConfigFromEnv(getenv func(string) string) (ClientConfig, error) {
+	cfg := ClientConfig{Proxy: http.ProxyFromEnvironment}
+
+	if timeout := getenv("PERIGEE_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			seconds, convErr := strconv.Atoi(timeout)
+			if convErr != nil {
+				return cfg, fmt.Errorf("PERIGEE_TIMEOUT: invalid duration %q", timeout)
+			}
+			d = time.Duration(seconds) * time.Second
+		}
+		if d < 0 {
+			return cfg, fmt.Errorf("PERIGEE_TIMEOUT: negative duration %q", timeout)
+		}
+		cfg.Timeout = d
+	}
+
+	certFile, certDirs := getenv("SSL_CERT_FILE"), getenv("SSL_CERT_DIR")
+	if certFile == "" && certDirs == "" {
+		return cfg, nil
+	}
+	pool := x509.NewCertPool()
+	if certFile != "" {
+		err := appendCertsFromFile(pool, certFile)
+		if err != nil {
+			return cfg, fmt.Errorf("SSL_CERT_FILE: %s", err)
+		}
+	}
+	for _, dir := range strings.Split(certDirs, ":") {
+		if dir == "" {
+			continue
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return cfg, fmt.Errorf("SSL_CERT_DIR: %s", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			// Directories prepared by c_rehash hold links to certificates which may not parse; skip them quietly.
+			appendCertsFromFile(pool, filepath.Join(dir, entry.Name()))
+		}
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
+
+func appendCertsFromFile(pool *x509.CertPool, name string) error {
+	pem, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in %s", name)
+	}
+	return nil
+}
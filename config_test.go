@@ -0,0 +1,290 @@
+package perigee
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeServerCert saves a TLS test server's certificate as a PEM file in dir.
+func writeServerCert(t *testing.T, ts *httptest.Server, dir string) string {
+	name := filepath.Join(dir, "server.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}
+	err := ioutil.WriteFile(name, pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestClientConfigFromEnvTimeout(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":    0,
+		"30s": 30 * time.Second,
+		"15":  15 * time.Second,
+		"1m":  time.Minute,
+	}
+	for value, want := range tests {
+		cfg, err := clientConfigFromEnv(func(name string) string {
+			if name == "PERIGEE_TIMEOUT" {
+				return value
+			}
+			return ""
+		})
+		if err != nil {
+			t.Fatalf("%q: %s", value, err)
+		}
+		if cfg.Timeout != want {
+			t.Errorf("%q: expected %s; got %s", value, want, cfg.Timeout)
+		}
+		if cfg.Proxy == nil {
+			t.Errorf("%q: expected proxies to be taken from the environment", value)
+		}
+	}
+
+	_, err := clientConfigFromEnv(func(name string) string {
+		if name == "PERIGEE_TIMEOUT" {
+			return "soon"
+		}
+		return ""
+	})
+	if err == nil {
+		t.Fatal("Expected an invalid PERIGEE_TIMEOUT to be rejected")
+	}
+}
+
+func TestNewClientFromEnvCertificates(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	certFile := writeServerCert(t, ts, dir)
+
+	t.Setenv("SSL_CERT_FILE", "")
+	t.Setenv("SSL_CERT_DIR", dir)
+	client, err := NewClientFromEnv(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Request("GET", ts.URL, Options{})
+	if err != nil {
+		t.Fatalf("Expected the certificate in SSL_CERT_DIR to be trusted; got %s", err)
+	}
+
+	t.Setenv("SSL_CERT_FILE", certFile)
+	t.Setenv("SSL_CERT_DIR", "")
+	client, err = NewClientFromEnv(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Request("GET", ts.URL, Options{})
+	if err != nil {
+		t.Fatalf("Expected the certificate in SSL_CERT_FILE to be trusted; got %s", err)
+	}
+
+	t.Setenv("SSL_CERT_FILE", filepath.Join(dir, "missing.pem"))
+	_, err = NewClientFromEnv(Options{})
+	if err == nil {
+		t.Fatal("Expected a missing SSL_CERT_FILE to be reported")
+	}
+}
+
+func TestNewClientFromEnvTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	t.Setenv("PERIGEE_TIMEOUT", "20ms")
+	client, err := NewClientFromEnv(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Request("GET", ts.URL, Options{})
+	if err == nil {
+		t.Fatal("Expected the request to time out")
+	}
+}
+
+func TestClientConfigPhaseTimeouts(t *testing.T) {
+	cfg := ClientConfig{DialTimeout: time.Second, TLSHandshakeTimeout: 2 * time.Second, ResponseHeaderTimeout: 3 * time.Second}
+	transport := cfg.newTransport()
+	if transport.TLSHandshakeTimeout != 2*time.Second || transport.ResponseHeaderTimeout != 3*time.Second {
+		t.Fatalf("Expected the TLS handshake and response header timeouts to be set; got %s and %s",
+			transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+	if d := cfg.newDialer(); d.Timeout != time.Second {
+		t.Fatalf("Expected a dial timeout of 1s; got %s", d.Timeout)
+	}
+
+	transport = ClientConfig{}.newTransport()
+	if transport.TLSHandshakeTimeout != 10*time.Second || transport.ResponseHeaderTimeout != 0 {
+		t.Fatalf("Expected the default transport's timeouts; got %s and %s",
+			transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+}
+
+func TestClientConfigTLSHandshakeTimeout(t *testing.T) {
+	// A server which accepts connections, then never says a word.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client, _ := NewClientWithConfig(ClientConfig{TLSHandshakeTimeout: 50 * time.Millisecond}, Options{})
+	start := time.Now()
+	_, err = client.Request("GET", "https://"+ln.Addr().String(), Options{})
+	if err == nil {
+		t.Fatal("Expected the TLS handshake to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the handshake to be cut short; took %s", elapsed)
+	}
+}
+
+func TestClientConfigResponseHeaderTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	client, _ := NewClientWithConfig(ClientConfig{ResponseHeaderTimeout: 20 * time.Millisecond}, Options{})
+	_, err := client.Request("GET", ts.URL, Options{})
+	if err == nil {
+		t.Fatal("Expected the response headers to time out")
+	}
+}
+
+func TestClientConfigAddressFamily(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client, _ := NewClientWithConfig(ClientConfig{AddressFamily: IPv4Only}, Options{})
+	_, err := client.Request("GET", ts.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, _ = NewClientWithConfig(ClientConfig{AddressFamily: IPv6Only}, Options{})
+	_, err = client.Request("GET", ts.URL, Options{})
+	if err == nil {
+		t.Fatal("Expected an IPv6-only client to refuse an IPv4 address")
+	}
+
+	// Resolved through a DNSCache, addresses of the wrong family are skipped rather than dialed.
+	cache := NewDNSCache(time.Minute)
+	cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"::1", "127.0.0.1"}, nil
+	}
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	client, _ = NewClientWithConfig(ClientConfig{AddressFamily: IPv4Only, DNSCache: cache}, Options{})
+	_, err = client.Request("GET", "http://dual.example.test:"+port, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientConfigFallbackDelay(t *testing.T) {
+	if d := (ClientConfig{FallbackDelay: -1}).newDialer(); d.FallbackDelay != -1 {
+		t.Fatalf("Expected the fallback delay to be passed to the dialer; got %s", d.FallbackDelay)
+	}
+	if got := IPv4Only.network("tcp"); got != "tcp4" {
+		t.Fatalf("Expected tcp4; got %s", got)
+	}
+	if got := DualStack.network("tcp"); got != "tcp" {
+		t.Fatalf("Expected tcp; got %s", got)
+	}
+}
+
+func TestClientConfigTLSSessionCache(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	ts.Config.SetKeepAlivesEnabled(false)
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	for _, size := range []int{0, DefaultTLSSessionCacheSize} {
+		client, _ := NewClientWithConfig(ClientConfig{RootCAs: pool, TLSSessionCacheSize: size}, Options{})
+		var resumed []bool
+		for i := 0; i < 2; i++ {
+			resp, err := client.Request("GET", ts.URL, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resumed = append(resumed, resp.Conn.TLSResumed)
+		}
+		if resumed[0] || resumed[1] != (size > 0) {
+			t.Fatalf("With a cache of %d, expected resumption only on the second connection if enabled; got %v", size, resumed)
+		}
+	}
+}
+
+func TestOverrideAddress(t *testing.T) {
+	overrides := map[string]string{
+		"api.example.com":     "10.0.0.5",
+		"api.example.com:444": "10.0.0.6:8443",
+		"v6.example.com":      "::1",
+	}
+	for address, want := range map[string]string{
+		"api.example.com:443": "10.0.0.5:443",
+		"API.example.com:80":  "10.0.0.5:80",
+		"api.example.com:444": "10.0.0.6:8443",
+		"v6.example.com:443":  "[::1]:443",
+		"other.example:443":   "other.example:443",
+	} {
+		if got := overrideAddress(overrides, address); got != want {
+			t.Errorf("Expected %s to connect to %s; got %s", address, want, got)
+		}
+	}
+}
+
+func TestClientConfigHostOverrides(t *testing.T) {
+	var host string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+	defer ts.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	// The test server's certificate is issued to example.com, so the request verifies only if SNI and verification use that name.
+	cfg := ClientConfig{RootCAs: pool, HostOverrides: map[string]string{"example.com": ts.Listener.Addr().String()}}
+	client, _ := NewClientWithConfig(cfg, Options{})
+	_, err := client.Request("GET", "https://example.com/servers", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host != "example.com" {
+		t.Fatalf("Expected the Host header to keep the logical name; got %q", host)
+	}
+
+	var dialed string
+	cfg = ClientConfig{DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = address
+		return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+	}, RootCAs: pool}
+	client, _ = NewClientWithConfig(cfg, Options{})
+	_, err = client.Request("GET", "https://example.com/servers", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialed != "example.com:443" {
+		t.Fatalf("Expected the custom dialer to receive the logical address; got %q", dialed)
+	}
+}
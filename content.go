@@ -0,0 +1,304 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"mime"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// AcceptType names a media type the caller is prepared to receive, along with its relative preference.
+// Quality ranges from 0 (exclusive) to 1; zero is taken to mean 1, the most preferred.
+type AcceptType struct {
+	MediaType string
+	Quality   float64
+}
+
+// formatAccept renders an ordered list of acceptable media types as an Accept header value.
+func formatAccept(types []AcceptType) string {
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = t.MediaType
+		if t.Quality > 0 && t.Quality < 1 {
+			parts[i] += ";q=" + strconv.FormatFloat(t.Quality, 'f', -1, 64)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// mediaType extracts the bare, lower-cased media type from a Content-Type header value.
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	if isPlainMediaType(contentType) {
+		return contentType
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mt
+}
+
+// isPlainMediaType reports whether a Content-Type header value is already a bare, lower-cased media type, as most are,
+// so that mediaType can return it without allocating.
+func isPlainMediaType(contentType string) bool {
+	for i := 0; i < len(contentType); i++ {
+		switch c := contentType[i]; {
+		case c >= 'A' && c <= 'Z', c == ';', c == ' ', c == '\t', c == '"':
+			return false
+		}
+	}
+	return true
+}
+
+// matchMediaType reports whether a bare media type matches a pattern such as "application/json" or "application/*+json".
+func matchMediaType(pattern, mt string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(strings.Split(pattern, ";")[0]))
+	matched, err := path.Match(pattern, mt)
+	return err == nil && matched
+}
+
+// Decoder unmarshals a response body into the container provided in Options.Results.
+type Decoder func(data []byte, v interface{}) error
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]Decoder{
+		"application/json": json.Unmarshal,
+		"application/xml":  xml.Unmarshal,
+		"text/xml":         xml.Unmarshal,
+		"text/csv":         UnmarshalCSV,
+
+		"application/msgpack":     MsgPackCodec.Unmarshal,
+		"application/x-msgpack":   MsgPackCodec.Unmarshal,
+		"application/vnd.msgpack": MsgPackCodec.Unmarshal,
+		"application/cbor":        CBORCodec.Unmarshal,
+	}
+
+	// registered records the media types given decoders with RegisterDecoder.
+	registered = map[string]bool{}
+)
+
+// RegisterDecoder makes a Decoder available for responses of the given media type (e.g., "application/yaml").
+// Registering a decoder for a media type already registered replaces it.
+func RegisterDecoder(mediaType string, d Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[strings.ToLower(mediaType)] = d
+	registered[strings.ToLower(mediaType)] = true
+}
+
+// decodesAsText reports whether a body of the given media type is captured as text when Results points to a string:
+// unless the body is a JSON string of a type decoded as JSON, or the type has a decoder registered with RegisterDecoder.
+func decodesAsText(mt string, text []byte) bool {
+	if decodesAsJSON(mt) {
+		return !isJSONString(text)
+	}
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	return !registered[mt]
+}
+
+// decoderFor selects the Decoder for a response's media type.
+// Structured syntax suffixes are honored, so application/vnd.foo+xml decodes as XML.
+// Anything unrecognized, including a missing Content-Type, decodes as JSON, as perigee always has.
+func decoderFor(mt string) Decoder {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	if d, ok := decoders[mt]; ok {
+		return d
+	}
+	if i := strings.LastIndex(mt, "+"); i >= 0 {
+		if d, ok := decoders["application/"+mt[i+1:]]; ok {
+			return d
+		}
+	}
+	return json.Unmarshal
+}
+
+// Transcoder converts text in some character set to UTF-8.
+type Transcoder func(data []byte) ([]byte, error)
+
+var (
+	charsetsMu sync.RWMutex
+	charsets   = map[string]Transcoder{
+		"iso-8859-1":   decodeLatin1,
+		"latin1":       decodeLatin1,
+		"windows-1252": decodeWindows1252,
+		"cp1252":       decodeWindows1252,
+		"utf-16":       decodeUTF16(binary.BigEndian),
+		"utf-16be":     decodeUTF16(binary.BigEndian),
+		"utf-16le":     decodeUTF16(binary.LittleEndian),
+	}
+)
+
+// RegisterCharset makes a Transcoder available for response bodies labeled with the given charset (e.g., "shift_jis").
+func RegisterCharset(name string, t Transcoder) {
+	charsetsMu.Lock()
+	defer charsetsMu.Unlock()
+	charsets[strings.ToLower(name)] = t
+}
+
+// transcodeToUTF8 converts a response body to UTF-8, as labeled by the charset parameter of its Content-Type.
+// A UTF-16 byte order mark overrides the label, since services often mislabel such bodies, or don't label them at all.
+// Bodies in UTF-8, or in a charset perigee doesn't know, are returned untouched.
+func transcodeToUTF8(data []byte, contentType string) ([]byte, error) {
+	if len(data) >= 2 && ((data[0] == 0xFE && data[1] == 0xFF) || (data[0] == 0xFF && data[1] == 0xFE)) {
+		return decodeUTF16(binary.BigEndian)(data)
+	}
+	// Most responses name no charset at all; spare them the parse.
+	if strings.IndexByte(contentType, ';') < 0 {
+		return data, nil
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return data, nil
+	}
+	charsetsMu.RLock()
+	t, ok := charsets[strings.ToLower(params["charset"])]
+	charsetsMu.RUnlock()
+	if !ok {
+		return data, nil
+	}
+	return t(data)
+}
+
+func decodeLatin1(data []byte) ([]byte, error) {
+	buf := make([]byte, 0, len(data)+len(data)/4)
+	for _, b := range data {
+		buf = utf8.AppendRune(buf, rune(b))
+	}
+	return buf, nil
+}
+
+// windows1252 maps the bytes 0x80 through 0x9F, where Windows-1252 departs from ISO-8859-1.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+func decodeWindows1252(data []byte) ([]byte, error) {
+	buf := make([]byte, 0, len(data)+len(data)/4)
+	for _, b := range data {
+		r := rune(b)
+		if b >= 0x80 && b <= 0x9F {
+			r = windows1252[b-0x80]
+		}
+		buf = utf8.AppendRune(buf, r)
+	}
+	return buf, nil
+}
+
+// decodeUTF16 returns a Transcoder for UTF-16 in the given byte order, unless a byte order mark says otherwise.
+func decodeUTF16(defaultOrder binary.ByteOrder) Transcoder {
+	return func(data []byte) ([]byte, error) {
+		order := defaultOrder
+		if len(data) >= 2 {
+			switch {
+			case data[0] == 0xFE && data[1] == 0xFF:
+				order, data = binary.BigEndian, data[2:]
+			case data[0] == 0xFF && data[1] == 0xFE:
+				order, data = binary.LittleEndian, data[2:]
+			}
+		}
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("UTF-16 body has an odd number of bytes (%d)", len(data))
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[2*i:])
+		}
+		buf := make([]byte, 0, len(units))
+		for _, r := range utf16.Decode(units) {
+			buf = utf8.AppendRune(buf, r)
+		}
+		return buf, nil
+	}
+}
+
+// xssiPrefixes lists the anti-hijacking prefixes some services place before their JSON.
+var xssiPrefixes = [][]byte{
+	[]byte(")]}',"),
+	[]byte(")]}'"),
+	[]byte("while(1);"),
+	[]byte("for(;;);"),
+}
+
+// stripJSONPreamble removes a leading UTF-8 byte order mark and any known XSSI prefix from a body.
+func stripJSONPreamble(data []byte) []byte {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	for _, prefix := range xssiPrefixes {
+		if bytes.HasPrefix(trimmed, prefix) {
+			return bytes.TrimLeft(trimmed[len(prefix):], " \t\r\n")
+		}
+	}
+	return data
+}
+
+// htmlSnippetLength caps the text quoted from an HTML page in an UpstreamHTMLError.
+const htmlSnippetLength = 200
+
+var (
+	htmlTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlTag   = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlNoise = regexp.MustCompile(`(?is)<(head|script|style)[^>]*>.*?</(head|script|style)>`)
+)
+
+// looksLikeHTML reports whether a body appears to be an HTML document rather than the data it should have held.
+func looksLikeHTML(data []byte) bool {
+	data = bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF")), " \t\r\n")
+	if len(data) == 0 || data[0] != '<' {
+		return false
+	}
+	start := strings.ToLower(string(data[:min(len(data), 512)]))
+	for _, marker := range []string{"<!doctype html", "<html", "<head", "<body", "<title"} {
+		if strings.Contains(start, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// newUpstreamHTMLError summarizes an HTML page in an UpstreamHTMLError.
+func newUpstreamHTMLError(url string, statusCode int, page []byte) *UpstreamHTMLError {
+	err := &UpstreamHTMLError{Url: url, StatusCode: statusCode}
+	if m := htmlTitle.FindSubmatch(page); m != nil {
+		err.Title = htmlText(m[1])
+	}
+	err.Snippet = htmlText(htmlNoise.ReplaceAll(page, nil))
+	if len(err.Snippet) > htmlSnippetLength {
+		cut := htmlSnippetLength
+		for cut > 0 && !utf8.RuneStart(err.Snippet[cut]) {
+			cut--
+		}
+		err.Snippet = err.Snippet[:cut] + "..."
+	}
+	return err
+}
+
+// htmlText strips markup from an HTML fragment and collapses its whitespace.
+func htmlText(fragment []byte) string {
+	text := html.UnescapeString(string(htmlTag.ReplaceAll(fragment, []byte(" "))))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// bodyDecoder selects the Decoder for a response body of the given media type, honoring Options.Codec.
+func bodyDecoder(mt string, opts Options) Decoder {
+	if opts.Codec != nil && (mt == "" || mt == mediaType(opts.Codec.ContentType())) {
+		return opts.Codec.Unmarshal
+	}
+	return decoderFor(mt)
+}
@@ -0,0 +1,262 @@
+package perigee
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormatAccept(t *testing.T) {
+	got := formatAccept([]AcceptType{
+		{MediaType: "application/json"},
+		{MediaType: "application/xml", Quality: 0.5},
+		{MediaType: "*/*", Quality: 0.1},
+	})
+	want := "application/json, application/xml;q=0.5, */*;q=0.1"
+	if got != want {
+		t.Fatalf("Expected %q; got %q", want, got)
+	}
+}
+
+func TestNegotiatedDecoding(t *testing.T) {
+	var accept string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		if r.URL.Query().Get("format") == "xml" {
+			w.Header().Set("Content-Type", "application/vnd.example+xml; charset=utf-8")
+			w.Write([]byte(`<server><name>xml-server</name></server>`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "json-server"}`))
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	type Server struct {
+		Name string `json:"name" xml:"name"`
+	}
+	types := []AcceptType{{MediaType: "application/json"}, {MediaType: "application/xml", Quality: 0.9}}
+
+	for _, format := range []string{"json", "xml"} {
+		var server Server
+		response, err := Request("GET", ts.URL+"?format="+format, Options{
+			Accept:      "text/plain",
+			AcceptTypes: types,
+			Results:     &server,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "application/json, application/xml;q=0.9" {
+			t.Fatalf("Expected AcceptTypes to determine the Accept header; got %q", accept)
+		}
+		if server.Name != format+"-server" {
+			t.Fatalf("Expected %s-server; got %q", format, server.Name)
+		}
+		want := map[string]string{"json": "application/json", "xml": "application/vnd.example+xml"}[format]
+		if response.ContentType != want {
+			t.Fatalf("Expected ContentType %q; got %q", want, response.ContentType)
+		}
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-test")
+		w.Write([]byte(`ignored`))
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	RegisterDecoder("application/x-test", func(data []byte, v interface{}) error {
+		return json.Unmarshal([]byte(`"decoded"`), v)
+	})
+	defer func() {
+		decodersMu.Lock()
+		delete(decoders, "application/x-test")
+		delete(registered, "application/x-test")
+		decodersMu.Unlock()
+	}()
+
+	var result string
+	_, err := Request("GET", ts.URL, Options{Results: &result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "decoded" {
+		t.Fatalf("Expected the registered decoder to be used; got %q", result)
+	}
+}
+
+func TestTranscodeToUTF8(t *testing.T) {
+	utf16le := []byte{0xFF, 0xFE, '"', 0, 0xE9, 0, '"', 0}
+	utf16be := []byte{0, '"', 0, 0xE9, 0, '"'}
+	tests := []struct {
+		contentType string
+		body        []byte
+		want        string
+	}{
+		{"application/json; charset=ISO-8859-1", []byte{'"', 'c', 'a', 'f', 0xE9, '"'}, `"café"`},
+		{"application/json; charset=windows-1252", []byte{'"', 0x80, 0x93, 'x', 0x94, '"'}, `"€“x”"`},
+		{"application/json; charset=utf-16", utf16le, `"é"`},
+		{"application/json; charset=utf-16be", utf16be, `"é"`},
+		{"application/json", utf16le, `"é"`},
+		{"application/json; charset=utf-8", []byte(`"café"`), `"café"`},
+		{"application/json; charset=koi8-r", []byte(`"x"`), `"x"`},
+	}
+	for _, test := range tests {
+		got, err := transcodeToUTF8(test.body, test.contentType)
+		if err != nil {
+			t.Fatalf("%s: %s", test.contentType, err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: expected %s; got %s", test.contentType, test.want, got)
+		}
+	}
+}
+
+func TestCharsetAwareDecoding(t *testing.T) {
+	raw := []byte{'{', '"', 'n', '"', ':', '"', 'M', 0xFC, 'n', 'c', 'h', 'e', 'n', '"', '}'}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=iso-8859-1")
+		w.Write(raw)
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	var result struct {
+		N string `json:"n"`
+	}
+	response, err := Request("GET", ts.URL, Options{Results: &result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.N != "München" {
+		t.Fatalf("Expected München; got %q", result.N)
+	}
+	if string(response.JsonResult) != string(raw) {
+		t.Fatal("Expected JsonResult to hold the body as received")
+	}
+}
+
+func TestLenientJson(t *testing.T) {
+	bodies := []string{
+		"\xEF\xBB\xBF{\"ok\": true}",
+		")]}'\n{\"ok\": true}",
+		")]}',\n{\"ok\": true}",
+		"while(1);{\"ok\": true}",
+		"for(;;);\n{\"ok\": true}",
+	}
+	for _, body := range bodies {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		})
+		ts := httptest.NewServer(handler)
+
+		var result struct {
+			Ok bool `json:"ok"`
+		}
+		_, err := Request("GET", ts.URL, Options{Results: &result})
+		if err == nil {
+			t.Errorf("%q: expected strict decoding to fail", body)
+		}
+		_, err = Request("GET", ts.URL, Options{Results: &result, LenientJson: true})
+		if err != nil || !result.Ok {
+			t.Errorf("%q: expected lenient decoding to succeed; got %v, %v", body, result, err)
+		}
+		ts.Close()
+	}
+}
+
+func TestUpstreamHTMLError(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<!DOCTYPE html>
+<html><head><title>502 Bad Gateway</title><style>body { color: red; }</style></head>
+<body><h1>Bad Gateway</h1><p>The upstream server &amp; its friends are unavailable.</p></body></html>`))
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	var result map[string]interface{}
+	_, err := Request("GET", ts.URL, Options{Results: &result})
+	e, ok := err.(*UpstreamHTMLError)
+	if !ok {
+		t.Fatalf("Expected an UpstreamHTMLError; got %#v", err)
+	}
+	if e.StatusCode != 200 || e.Url != ts.URL {
+		t.Fatalf("Expected the status and URL to be reported; got %#v", e)
+	}
+	if e.Title != "502 Bad Gateway" {
+		t.Fatalf("Expected the page title; got %q", e.Title)
+	}
+	if e.Snippet != "Bad Gateway The upstream server & its friends are unavailable." {
+		t.Fatalf("Expected the page text; got %q", e.Snippet)
+	}
+}
+
+func TestUpstreamHTMLErrorOnlyForHTML(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"truncated": `))
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	var result map[string]interface{}
+	_, err := Request("GET", ts.URL, Options{Results: &result})
+	if _, ok := err.(*json.SyntaxError); !ok {
+		t.Fatalf("Expected a plain decoding error for malformed JSON; got %#v", err)
+	}
+}
+
+func TestMatchMediaType(t *testing.T) {
+	tests := []struct {
+		pattern, mt string
+		want        bool
+	}{
+		{"application/json", "application/json", true},
+		{"Application/JSON; charset=utf-8", "application/json", true},
+		{"application/json", "text/html", false},
+		{"application/*", "application/xml", true},
+		{"application/*+json", "application/vnd.api+json", true},
+		{"application/*+json", "application/json", false},
+		{"*/*", "text/plain", true},
+		{"application/json", "", false},
+	}
+	for _, test := range tests {
+		if got := matchMediaType(test.pattern, test.mt); got != test.want {
+			t.Errorf("matchMediaType(%q, %q): expected %v; got %v", test.pattern, test.mt, test.want, got)
+		}
+	}
+}
+
+func TestExpectContentType(t *testing.T) {
+	contentType := "text/html"
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(`{"ok": true}`))
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	var result map[string]interface{}
+	_, err := Request("GET", ts.URL, Options{Results: &result, ExpectContentType: "application/json"})
+	e, ok := err.(*ContentTypeMismatchError)
+	if !ok {
+		t.Fatalf("Expected a ContentTypeMismatchError; got %#v", err)
+	}
+	if e.Expected != "application/json" || e.Actual != "text/html" {
+		t.Fatalf("Expected the mismatch to be described; got %#v", e)
+	}
+	if result != nil {
+		t.Fatal("Expected no attempt to decode a mismatched response")
+	}
+
+	contentType = "application/json; charset=utf-8"
+	_, err = Request("GET", ts.URL, Options{Results: &result, ExpectContentType: "application/json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
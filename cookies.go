@@ -0,0 +1,34 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// EnableCookies gives the client a cookie jar of its own, so that the cookies its responses set are sent back with its later requests.
+// Each client's jar is separate, so that the sessions of two tenants served by one process can never bleed into each other;
+// clients meant to share a session must share a jar explicitly (see SetCookieJar).
+// A client which already has a jar keeps it.
+func (c *Client) EnableCookies() {
+	c.Update(func(defaults *Options) {
+		if defaults.Jar == nil {
+			// cookiejar.New fails only on invalid options.
+			defaults.Jar, _ = cookiejar.New(nil)
+		}
+	})
+}
+
+// SetCookieJar replaces the client's cookie jar, or removes it if jar is nil.
+// Passing one client's CookieJar to another makes the two share their cookies.
+func (c *Client) SetCookieJar(jar http.CookieJar) {
+	c.Update(func(defaults *Options) {
+		defaults.Jar = jar
+	})
+}
+
+// CookieJar returns the client's cookie jar, if it has one.
+func (c *Client) CookieJar() http.CookieJar {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.defaults.Jar
+}
@@ -0,0 +1,69 @@
+package perigee
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientCookieIsolation(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: r.URL.Query().Get("tenant")})
+			return
+		}
+		cookie, err := r.Cookie("session")
+		if err != nil {
+			w.Write([]byte("none"))
+			return
+		}
+		w.Write([]byte(cookie.Value))
+	}))
+	defer ts.Close()
+
+	session := func(c *Client) string {
+		var buf bytes.Buffer
+		_, err := c.Request("GET", "/whoami", Options{ResponseBuffer: &buf})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	login := func(c *Client, tenant string) {
+		if _, err := c.Request("GET", "/login?tenant="+tenant, Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	shared := Options{CustomClient: &http.Client{}}
+	a, b, plain := NewClient(shared), NewClient(shared), NewClient(shared)
+	for _, c := range []*Client{a, b, plain} {
+		c.SetBaseURL(ts.URL)
+	}
+	a.EnableCookies()
+	b.EnableCookies()
+	login(a, "alpha")
+	login(b, "beta")
+	login(plain, "gamma")
+
+	if got := session(a); got != "alpha" {
+		t.Fatalf("Expected client a to keep its own session; got %q", got)
+	}
+	if got := session(b); got != "beta" {
+		t.Fatalf("Expected client b to keep its own session; got %q", got)
+	}
+	if got := session(plain); got != "none" {
+		t.Fatalf("Expected a client without a jar to keep no cookies; got %q", got)
+	}
+	if shared.CustomClient.Jar != nil {
+		t.Fatal("EnableCookies must not modify the shared http.Client")
+	}
+
+	c := NewClient(Options{})
+	c.SetBaseURL(ts.URL)
+	c.SetCookieJar(a.CookieJar())
+	if got := session(c); got != "alpha" {
+		t.Fatalf("Expected an explicitly shared jar to share the session; got %q", got)
+	}
+}
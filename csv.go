@@ -0,0 +1,188 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The CSVFieldError structure is returned when a CSV cell cannot be converted to the type of the field it maps to.
+// Line counts from 1, the header row.
+type CSVFieldError struct {
+	Line   int
+	Column string
+	Err    error
+}
+
+func (err *CSVFieldError) Error() string {
+	return fmt.Sprintf("CSV line %d, column %q: %s", err.Line, err.Column, err.Err)
+}
+
+func (err *CSVFieldError) Unwrap() error {
+	return err.Err
+}
+
+// errCSVTarget is returned when UnmarshalCSV is given something other than a pointer to a slice.
+var errCSVTarget = errors.New("perigee: CSV decodes only into a pointer to a slice of structures, maps, or string slices")
+
+// UnmarshalCSV decodes a CSV document, whose first row names the columns, into v,
+// which must point to a slice of structures (or pointers to them), of map[string]string, or of []string.
+// It is the Decoder registered for text/csv, for report and export endpoints.
+//
+// Columns map to structure fields by their csv tag (e.g., `csv:"created_at"`), or else by the field's name, ignoring case;
+// a tag of "-" leaves a field out, as do columns without a matching field.
+// Cells convert to strings, numbers, booleans, time.Time (RFC 3339), or types implementing encoding.TextUnmarshaler;
+// an empty cell leaves its field zero, or a pointer field nil.
+// Rows decoded into []string include no header row.
+func UnmarshalCSV(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return errCSVTarget
+	}
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	header, rows := records[0], records[1:]
+	if len(header) > 0 {
+		// A byte order mark, as spreadsheets write, is not part of the first column's name.
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	out := reflect.MakeSlice(slice.Type(), 0, len(rows))
+	switch {
+	case elemType == reflect.TypeOf([]string(nil)):
+		for _, row := range rows {
+			out = reflect.Append(out, reflect.ValueOf(row))
+		}
+	case elemType == reflect.TypeOf(map[string]string(nil)):
+		for _, row := range rows {
+			m := make(map[string]string, len(header))
+			for i, cell := range row {
+				if i < len(header) {
+					m[header[i]] = cell
+				}
+			}
+			out = reflect.Append(out, reflect.ValueOf(m))
+		}
+	default:
+		structType, pointers := elemType, false
+		if structType.Kind() == reflect.Ptr {
+			structType, pointers = structType.Elem(), true
+		}
+		if structType.Kind() != reflect.Struct {
+			return errCSVTarget
+		}
+		fields := csvColumns(structType, header)
+		for n, row := range rows {
+			elem := reflect.New(structType).Elem()
+			for i, cell := range row {
+				if i >= len(fields) || fields[i] == nil || cell == "" {
+					continue
+				}
+				err = setCSVField(elem.FieldByIndex(fields[i]), cell)
+				if err != nil {
+					return &CSVFieldError{Line: n + 2, Column: header[i], Err: err}
+				}
+			}
+			if pointers {
+				elem = elem.Addr()
+			}
+			out = reflect.Append(out, elem)
+		}
+	}
+	slice.Set(out)
+	return nil
+}
+
+// csvColumns finds the field index for each column of the header, or nil for columns without a field.
+func csvColumns(t reflect.Type, header []string) [][]int {
+	columns := make([][]int, len(header))
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := f.Tag.Get("csv"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = strings.Split(tag, ",")[0]
+		}
+		for c, column := range header {
+			if columns[c] == nil && strings.EqualFold(strings.TrimSpace(column), name) {
+				columns[c] = f.Index
+			}
+		}
+	}
+	return columns
+}
+
+// setCSVField converts a cell to the type of a field and stores it.
+func setCSVField(f reflect.Value, cell string) error {
+	if f.Kind() == reflect.Ptr {
+		p := reflect.New(f.Type().Elem())
+		err := setCSVField(p.Elem(), cell)
+		if err != nil {
+			return err
+		}
+		f.Set(p)
+		return nil
+	}
+	if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(cell))
+	}
+	if f.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := time.Parse(time.RFC3339, cell)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(cell)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(cell))
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(cell), 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.TrimSpace(cell), 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(strings.TrimSpace(cell), f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
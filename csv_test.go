@@ -0,0 +1,74 @@
+package perigee
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type usageRow struct {
+	Account string `csv:"account_id"`
+	Region  string
+	Bytes   int64     `csv:"bytes"`
+	Cost    *float64  `csv:"cost"`
+	Billed  bool      `csv:"billed"`
+	Day     time.Time `csv:"day"`
+	Note    string    `csv:"-"`
+}
+
+func TestUnmarshalCSV(t *testing.T) {
+	data := []byte("\ufeffaccount_id,REGION,bytes,cost,billed,day,note\n" +
+		"a1,ord,1024,0.25,true,2024-03-01T00:00:00Z,x\n" +
+		"a2,\"dfw, tx\",2048,,false,2024-03-02T00:00:00Z,y\n")
+
+	var rows []usageRow
+	if err := UnmarshalCSV(data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	cost := 0.25
+	want := []usageRow{
+		{Account: "a1", Region: "ord", Bytes: 1024, Cost: &cost, Billed: true, Day: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{Account: "a2", Region: "dfw, tx", Bytes: 2048, Day: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("Expected %+v; got %+v", want, rows)
+	}
+
+	var maps []map[string]string
+	if err := UnmarshalCSV(data, &maps); err != nil || maps[1]["REGION"] != "dfw, tx" {
+		t.Fatalf("Expected rows as maps; got %v, %v", maps, err)
+	}
+	var raw [][]string
+	if err := UnmarshalCSV(data, &raw); err != nil || len(raw) != 2 || raw[0][0] != "a1" {
+		t.Fatalf("Expected rows without the header; got %v, %v", raw, err)
+	}
+
+	var fieldErr *CSVFieldError
+	err := UnmarshalCSV([]byte("bytes\n1\nlots\n"), &rows)
+	if !errors.As(err, &fieldErr) || fieldErr.Line != 3 || fieldErr.Column != "bytes" || !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("Expected a CSVFieldError on line 3; got %v", err)
+	}
+	if err := UnmarshalCSV(data, &struct{}{}); err != errCSVTarget {
+		t.Fatalf("Expected errCSVTarget; got %v", err)
+	}
+}
+
+func TestCSVResponses(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Write([]byte("account_id,bytes\na1,10\n"))
+	}))
+	defer ts.Close()
+
+	var rows []*usageRow
+	if _, err := Request("GET", ts.URL, Options{Results: &rows}); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Account != "a1" || rows[0].Bytes != 10 {
+		t.Fatalf("Expected the CSV report to be decoded; got %+v", rows)
+	}
+}
@@ -0,0 +1,92 @@
+package perigee
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Deprecation describes a server's warning that an endpoint is deprecated or due for removal,
+// as conveyed by the Deprecation (RFC 9745), Sunset (RFC 8594), and Warning headers; see Options.OnDeprecation.
+//
+// Since holds the date the endpoint was, or will be, deprecated, if the server gave one;
+// it is zero for the older "Deprecation: true" form.
+// Sunset holds the date the endpoint is expected to stop responding, if given.
+// Link points to documentation of the deprecation or sunset, from a Link header with relation "deprecation" or "sunset".
+// Warnings holds the text of any persistent warnings (code 299), as Kubernetes, among others, sends to flag deprecated APIs.
+type Deprecation struct {
+	Url      string
+	Since    time.Time
+	Sunset   time.Time
+	Link     string
+	Warnings []string
+}
+
+// parseDeprecation extracts a Deprecation from a response's headers, returning nil if the response carries no warning.
+func parseDeprecation(url string, header http.Header) *Deprecation {
+	d := &Deprecation{Url: url}
+	found := false
+	if value := strings.TrimSpace(header.Get("Deprecation")); value != "" && !strings.EqualFold(value, "false") {
+		found = true
+		if strings.HasPrefix(value, "@") {
+			if seconds, err := strconv.ParseInt(value[1:], 10, 64); err == nil {
+				d.Since = time.Unix(seconds, 0).UTC()
+			}
+		} else if t, ok := parseHTTPTime(value); ok {
+			d.Since = t
+		}
+	}
+	if t, ok := parseHTTPTime(header.Get("Sunset")); ok {
+		found = true
+		d.Sunset = t
+	}
+	for _, value := range header.Values("Warning") {
+		if text, ok := persistentWarning(value); ok {
+			found = true
+			d.Warnings = append(d.Warnings, text)
+		}
+	}
+	if !found {
+		return nil
+	}
+	d.Link = linkHeader(header, "deprecation")
+	if d.Link == "" {
+		d.Link = linkHeader(header, "sunset")
+	}
+	return d
+}
+
+// persistentWarning returns the text of a Warning header value with code 299, such as `299 - "v1 is deprecated"`.
+func persistentWarning(value string) (string, bool) {
+	fields := strings.SplitN(strings.TrimSpace(value), " ", 3)
+	if len(fields) < 3 || fields[0] != "299" {
+		return "", false
+	}
+	text := strings.TrimSpace(fields[2])
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		return unquoted, true
+	}
+	if strings.HasPrefix(text, `"`) {
+		if end := strings.Index(text[1:], `"`); end >= 0 {
+			return text[1 : end+1], true
+		}
+	}
+	return text, true
+}
+
+// LogDeprecation logs a Deprecation with the standard logger, for use as Options.OnDeprecation.
+func LogDeprecation(d *Deprecation) {
+	msg := "perigee: URL(" + d.Url + ") is deprecated"
+	if !d.Sunset.IsZero() {
+		msg += "; sunset " + d.Sunset.Format(http.TimeFormat)
+	}
+	for _, w := range d.Warnings {
+		msg += "; " + w
+	}
+	if d.Link != "" {
+		msg += "; see " + d.Link
+	}
+	log.Print(msg)
+}
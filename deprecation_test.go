@@ -0,0 +1,68 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseDeprecation(t *testing.T) {
+	header := http.Header{
+		"Deprecation": {"@1688169599"},
+		"Sunset":      {"Wed, 11 Nov 2026 23:59:59 GMT"},
+		"Link":        {`<https://api.example.com/v2>; rel="successor-version", <https://developer.example.com/deprecation>; rel="deprecation"`},
+		"Warning":     {`299 - "extensions/v1beta1 Ingress is deprecated"`, `110 - "Response is Stale"`},
+	}
+	d := parseDeprecation("https://api.example.com/v1/ingresses", header)
+	if d == nil {
+		t.Fatal("Expected a deprecation")
+	}
+	if !d.Since.Equal(time.Unix(1688169599, 0)) || d.Sunset.Year() != 2026 {
+		t.Fatalf("Unexpected dates %s and %s", d.Since, d.Sunset)
+	}
+	if d.Link != "https://developer.example.com/deprecation" {
+		t.Fatalf("Unexpected link %q", d.Link)
+	}
+	if len(d.Warnings) != 1 || d.Warnings[0] != "extensions/v1beta1 Ingress is deprecated" {
+		t.Fatalf("Expected only the persistent warning; got %q", d.Warnings)
+	}
+
+	if d := parseDeprecation("", http.Header{"Deprecation": {"true"}}); d == nil || !d.Since.IsZero() {
+		t.Fatalf("Expected an undated deprecation; got %+v", d)
+	}
+	if d := parseDeprecation("", http.Header{"Warning": {`299 - "going away" "Wed, 11 Nov 2026 23:59:59 GMT"`}}); d == nil || d.Warnings[0] != "going away" {
+		t.Fatalf("Expected the warning text without its date; got %+v", d)
+	}
+	if d := parseDeprecation("", http.Header{"Warning": {`110 - "Response is Stale"`}}); d != nil {
+		t.Fatalf("Expected no deprecation; got %+v", d)
+	}
+}
+
+func TestOnDeprecation(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1" {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", `</v2>; rel="sunset"`)
+		}
+	}))
+	defer ts.Close()
+
+	var seen []*Deprecation
+	opts := Options{OnDeprecation: func(d *Deprecation) { seen = append(seen, d) }}
+	resp, err := Request("GET", ts.URL+"/v1", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 1 || resp.Deprecation != seen[0] || seen[0].Url != ts.URL+"/v1" || seen[0].Link != "/v2" {
+		t.Fatalf("Expected the hook to see the response's deprecation; got %+v and %+v", seen, resp.Deprecation)
+	}
+
+	resp, err = Request("GET", ts.URL+"/v2", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 1 || resp.Deprecation != nil {
+		t.Fatal("Expected no deprecation for a current endpoint")
+	}
+}
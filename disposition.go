@@ -0,0 +1,65 @@
+package perigee
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Filename returns the name the server suggests for saving the response body, from its Content-Disposition header,
+// so that exported files keep their server-provided names.
+// The RFC 5987 form (filename*=UTF-8”...) is decoded, and preferred over the plain form when both are given.
+// Any directory components are removed, so the name is safe to join to a directory of the caller's choosing.
+// Filename returns "" if the server suggests no name.
+func (r *Response) Filename() string {
+	return dispositionFilename(r.HttpResponse.Header.Get("Content-Disposition"))
+}
+
+// dispositionFilename extracts the file name from a Content-Disposition header value.
+func dispositionFilename(value string) string {
+	if value == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return ""
+	}
+	name := params["filename"]
+	if latin1, ok := latin1Filename(value); ok {
+		name = latin1
+	}
+	// Servers send Windows paths, too.
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	switch name {
+	case ".", "..", "/":
+		return ""
+	}
+	return name
+}
+
+// latin1Filename decodes an ISO-8859-1 filename* parameter, which RFC 5987 requires recipients to support,
+// but mime.ParseMediaType drops.
+func latin1Filename(value string) (string, bool) {
+	for _, param := range strings.Split(value, ";") {
+		key, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "filename*") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSpace(v), "'", 3)
+		if len(parts) != 3 || !strings.EqualFold(parts[0], "iso-8859-1") {
+			return "", false
+		}
+		raw, err := url.PathUnescape(parts[2])
+		if err != nil {
+			return "", false
+		}
+		buf := make([]byte, 0, len(raw))
+		for i := 0; i < len(raw); i++ {
+			buf = utf8.AppendRune(buf, rune(raw[i]))
+		}
+		return string(buf), true
+	}
+	return "", false
+}
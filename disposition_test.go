@@ -0,0 +1,41 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDispositionFilename(t *testing.T) {
+	for value, want := range map[string]string{
+		`attachment; filename="report.csv"`:                                           "report.csv",
+		`attachment; filename=plain.txt`:                                              "plain.txt",
+		`attachment; filename="fallback.txt"; filename*=UTF-8''%E2%82%AC%20rates.txt`: "€ rates.txt",
+		`attachment; filename*=iso-8859-1'en'caf%E9.txt`:                              "café.txt",
+		`attachment; filename="../../etc/passwd"`:                                     "passwd",
+		`attachment; filename="C:\\Users\\x\\evil.exe"`:                               "evil.exe",
+		`attachment; filename=".."`:                                                   "",
+		`inline`:                                                                      "",
+		``:                                                                            "",
+		`attachment; filename="unterminated`:                                          "",
+	} {
+		if got := dispositionFilename(value); got != want {
+			t.Errorf("Expected %q from %s; got %q", want, value, got)
+		}
+	}
+}
+
+func TestResponseFilename(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="export-2024.csv"`)
+	}))
+	defer ts.Close()
+
+	resp, err := Request("GET", ts.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Filename() != "export-2024.csv" {
+		t.Fatalf("Expected the server's file name; got %q", resp.Filename())
+	}
+}
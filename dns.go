@@ -0,0 +1,154 @@
+package perigee
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDNSCacheTTL is how long a DNSCache created with a zero TTL keeps an answer.
+const DefaultDNSCacheTTL = time.Minute
+
+// DNSCache remembers the addresses host names resolve to, so hot request paths don't pay for a DNS lookup on every new connection.
+// Install one with ClientConfig.DNSCache.
+// A single DNSCache may be shared by several clients, and is safe for concurrent use.
+//
+// Answers are kept for TTL regardless of the TTL in the DNS records themselves, which the standard resolver doesn't expose.
+// Failed lookups are not cached.
+type DNSCache struct {
+	TTL      time.Duration
+	Resolver *net.Resolver
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+	hits    uint64
+	misses  uint64
+
+	// lookup replaces the resolver, for testing.
+	lookup func(ctx context.Context, host string) ([]string, error)
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// DNSCacheStats reports how effective a DNSCache has been since it was created.
+type DNSCacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// HitRate returns the fraction of lookups answered from the cache, or zero if there were none.
+func (s DNSCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// NewDNSCache creates a DNSCache keeping answers for the given time.
+func NewDNSCache(ttl time.Duration) *DNSCache {
+	if ttl <= 0 {
+		ttl = DefaultDNSCacheTTL
+	}
+	return &DNSCache{TTL: ttl}
+}
+
+// LookupHost returns the addresses of the given host, from the cache if it has a fresh answer.
+func (c *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.entries[host]; ok && now.Before(e.expires) {
+		c.hits++
+		c.mu.Unlock()
+		return e.addrs, nil
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	lookup := c.lookup
+	if lookup == nil {
+		resolver := c.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+		lookup = resolver.LookupHost
+	}
+	addrs, err := lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultDNSCacheTTL
+	}
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]dnsEntry)
+	}
+	c.entries[host] = dnsEntry{addrs: addrs, expires: now.Add(ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// Flush forgets every cached answer, e.g., after a failover has moved a service.
+// Statistics are unaffected.
+func (c *DNSCache) Flush() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+// Stats reports the cache's hits, misses, and current size.
+func (c *DNSCache) Stats() DNSCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return DNSCacheStats{Hits: c.hits, Misses: c.misses, Entries: len(c.entries)}
+}
+
+// dialContext wraps a dialer, resolving host names through the cache.
+// Each of a host's addresses is tried in turn until a connection succeeds.
+// Addresses outside the network's family (as with "tcp4" or "tcp6") are skipped.
+func (c *DNSCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+		addrs, err := c.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		err = &net.DNSError{Err: "no suitable address found", Name: host, IsNotFound: true}
+		for _, addr := range addrs {
+			if !inFamily(network, addr) {
+				continue
+			}
+			var conn net.Conn
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
+
+// inFamily reports whether an IP address may be dialed over the given network.
+func inFamily(network, addr string) bool {
+	ip := net.ParseIP(addr)
+	switch {
+	case ip == nil:
+		return false
+	case strings.HasSuffix(network, "4"):
+		return ip.To4() != nil
+	case strings.HasSuffix(network, "6"):
+		return ip.To4() == nil
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package perigee
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDNSCache(t *testing.T) {
+	lookups := 0
+	cache := NewDNSCache(time.Hour)
+	cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		if host != "api.example.test" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	target := "http://api.example.test:" + u.Port()
+
+	client, err := NewClientWithConfig(ClientConfig{DNSCache: cache}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		// Close idle connections so each request dials anew.
+		client.Defaults().CustomClient.CloseIdleConnections()
+		_, err = client.Request("GET", target, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lookups != 1 {
+		t.Fatalf("Expected a single DNS lookup; got %d", lookups)
+	}
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Fatalf("Expected 2 hits and 1 miss for 1 entry; got %+v", stats)
+	}
+	if rate := stats.HitRate(); rate < 0.66 || rate > 0.67 {
+		t.Fatalf("Expected a hit rate of 2/3; got %f", rate)
+	}
+
+	cache.Flush()
+	client.Defaults().CustomClient.CloseIdleConnections()
+	_, err = client.Request("GET", target, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 2 {
+		t.Fatalf("Expected Flush to force a fresh lookup; got %d lookups", lookups)
+	}
+}
+
+func TestDNSCacheExpires(t *testing.T) {
+	lookups := 0
+	cache := NewDNSCache(10 * time.Millisecond)
+	cache.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		return []string{"127.0.0.1"}, nil
+	}
+	cache.LookupHost(context.Background(), "a.test")
+	cache.LookupHost(context.Background(), "a.test")
+	time.Sleep(20 * time.Millisecond)
+	cache.LookupHost(context.Background(), "a.test")
+	if lookups != 2 {
+		t.Fatalf("Expected answers to expire after their TTL; got %d lookups", lookups)
+	}
+}
@@ -0,0 +1,60 @@
+package perigee
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Download fetches a resource with a GET request, copying the response body straight to w as it arrives,
+// so that large downloads take bounded memory instead of being buffered in Response.JsonResult.
+// It is Request with TeeBody set to w and no Results; other Options apply as usual.
+// A body cut short by an error is only partially written.
+func Download(url string, w io.Writer, opts Options) (*Response, error) {
+	opts.TeeBody = w
+	opts.Results = nil
+	opts.ResponseBuffer = nil
+	return Request("GET", url, opts)
+}
+
+// DownloadToDir downloads a resource (see Download) into a new file in dir, returning the file's path.
+// The file is named as the server suggests in its Content-Disposition header (see Response.Filename),
+// or else after the last segment of the URL, so that exported files keep their server-provided names.
+// An existing file of the same name is replaced.
+// The body is written to a temporary file first, so a failed download leaves no partial file behind.
+func DownloadToDir(rawurl, dir string, opts Options) (string, *Response, error) {
+	tmp, err := ioutil.TempFile(dir, ".perigee-download-*")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.Remove(tmp.Name())
+	resp, err := Download(rawurl, tmp, opts)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", resp, err
+	}
+	name := filepath.Join(dir, downloadName(resp, rawurl))
+	return name, resp, os.Rename(tmp.Name(), name)
+}
+
+// downloadName chooses the name of a downloaded file.
+func downloadName(resp *Response, rawurl string) string {
+	if name := resp.Filename(); name != "" {
+		return name
+	}
+	final := resp.FinalURL()
+	if final == "" {
+		final = rawurl
+	}
+	if u, err := url.Parse(final); err == nil {
+		if name := path.Base(u.Path); name != "." && name != "/" && name != ".." {
+			return name
+		}
+	}
+	return "download"
+}
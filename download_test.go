@@ -0,0 +1,62 @@
+package perigee
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+	payload := strings.Repeat("row,", 1<<16)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/export":
+			w.Header().Set("Content-Disposition", `attachment; filename*=UTF-8''report%202024.csv`)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(payload))
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	resp, err := Download(ts.URL+"/export", &buf, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != payload || resp.JsonResult != nil {
+		t.Fatalf("Expected the body in the writer alone; got %d bytes, and %d buffered", buf.Len(), len(resp.JsonResult))
+	}
+
+	dir := t.TempDir()
+	name, _, err := DownloadToDir(ts.URL+"/export", dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != filepath.Join(dir, "report 2024.csv") {
+		t.Fatalf("Expected the server's file name; got %s", name)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != payload {
+		t.Fatalf("Expected the file to hold the body; got %d bytes", len(data))
+	}
+
+	name, _, err = DownloadToDir(ts.URL+"/files/data.bin?version=2", dir, Options{})
+	if err != nil || name != filepath.Join(dir, "data.bin") {
+		t.Fatalf("Expected the file to be named after the URL; got %s, %v", name, err)
+	}
+
+	_, _, err = DownloadToDir(ts.URL+"/missing", dir, Options{OkCodes: []int{200}})
+	if err == nil {
+		t.Fatal("Expected the failed download to fail")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Fatalf("Expected no partial files to be left behind; found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,154 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Dynamic holds a JSON document decoded without a schema, for exploratory tooling and endpoints not worth modeling with structures.
+// It may be passed (by pointer) in Options.Results, or obtained from RequestDynamic.
+//
+// Values are reached by paths of dot-separated object keys and array indexes, as in GetString("server.addresses.0.addr").
+// The typed getters return the zero value of their type when the path leads nowhere or to a value of another type;
+// use Get(path).Exists() to tell a missing value from a zero one.
+// Numbers are held as json.Number, so large integers survive intact.
+type Dynamic struct {
+	value interface{}
+	found bool
+}
+
+// ParseDynamic decodes a JSON document into a Dynamic value.
+func ParseDynamic(data []byte) (Dynamic, error) {
+	var d Dynamic
+	err := d.UnmarshalJSON(data)
+	return d, err
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *Dynamic) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		return err
+	}
+	*d = Dynamic{value: v, found: true}
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Dynamic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.value)
+}
+
+// Value returns the underlying value: a map[string]interface{}, []interface{}, string, json.Number, bool, or nil.
+func (d Dynamic) Value() interface{} {
+	return d.value
+}
+
+// Exists reports whether the value is present, even if null.
+func (d Dynamic) Exists() bool {
+	return d.found
+}
+
+// Get follows a path to a nested value.
+// An empty path refers to the value itself.
+func (d Dynamic) Get(path string) Dynamic {
+	if path == "" || !d.found {
+		return d
+	}
+	v := d.value
+	for _, key := range strings.Split(path, ".") {
+		switch container := v.(type) {
+		case map[string]interface{}:
+			elem, ok := container[key]
+			if !ok {
+				return Dynamic{}
+			}
+			v = elem
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(container) {
+				return Dynamic{}
+			}
+			v = container[i]
+		default:
+			return Dynamic{}
+		}
+	}
+	return Dynamic{value: v, found: true}
+}
+
+// GetString returns the string at the path.
+func (d Dynamic) GetString(path string) string {
+	s, _ := d.Get(path).value.(string)
+	return s
+}
+
+// GetInt returns the integer at the path.
+func (d Dynamic) GetInt(path string) int64 {
+	n, _ := d.Get(path).value.(json.Number)
+	i, err := n.Int64()
+	if err != nil {
+		f, _ := n.Float64()
+		i = int64(f)
+	}
+	return i
+}
+
+// GetFloat returns the number at the path.
+func (d Dynamic) GetFloat(path string) float64 {
+	n, _ := d.Get(path).value.(json.Number)
+	f, _ := n.Float64()
+	return f
+}
+
+// GetBool returns the boolean at the path.
+func (d Dynamic) GetBool(path string) bool {
+	b, _ := d.Get(path).value.(bool)
+	return b
+}
+
+// GetArray returns the elements of the array at the path.
+func (d Dynamic) GetArray(path string) []Dynamic {
+	a, _ := d.Get(path).value.([]interface{})
+	elems := make([]Dynamic, len(a))
+	for i, v := range a {
+		elems[i] = Dynamic{value: v, found: true}
+	}
+	return elems
+}
+
+// GetMap returns the members of the object at the path.
+func (d Dynamic) GetMap(path string) map[string]Dynamic {
+	m, _ := d.Get(path).value.(map[string]interface{})
+	if m == nil {
+		return nil
+	}
+	members := make(map[string]Dynamic, len(m))
+	for k, v := range m {
+		members[k] = Dynamic{value: v, found: true}
+	}
+	return members
+}
+
+// RequestMap issues a request as Request does, decoding the response body into a generic map.
+// Options.Results is ignored.
+func RequestMap(method, url string, opts Options) (map[string]interface{}, *Response, error) {
+	var m map[string]interface{}
+	opts.Results = &m
+	resp, err := Request(method, url, opts)
+	return m, resp, err
+}
+
+// RequestDynamic issues a request as Request does, decoding the response body into a Dynamic value.
+// Options.Results is ignored.
+func RequestDynamic(method, url string, opts Options) (Dynamic, *Response, error) {
+	var d Dynamic
+	opts.Results = &d
+	resp, err := Request(method, url, opts)
+	return d, resp, err
+}
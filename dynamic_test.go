@@ -0,0 +1,82 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const dynamicServer = `{
+	"server": {
+		"id": "abc",
+		"progress": 100,
+		"size": 12345678901234567,
+		"ratio": 0.5,
+		"locked": true,
+		"addresses": {"private": [{"addr": "10.0.0.1"}, {"addr": "10.0.0.2"}]},
+		"description": null
+	}
+}`
+
+func TestDynamicGetters(t *testing.T) {
+	d, err := ParseDynamic([]byte(dynamicServer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.GetString("server.id"); got != "abc" {
+		t.Errorf("Expected server.id abc; got %q", got)
+	}
+	if got := d.GetInt("server.size"); got != 12345678901234567 {
+		t.Errorf("Expected large integers intact; got %d", got)
+	}
+	if got := d.GetInt("server.progress"); got != 100 {
+		t.Errorf("Expected progress 100; got %d", got)
+	}
+	if got := d.GetFloat("server.ratio"); got != 0.5 {
+		t.Errorf("Expected ratio 0.5; got %v", got)
+	}
+	if !d.GetBool("server.locked") {
+		t.Error("Expected locked to be true")
+	}
+	if got := d.GetString("server.addresses.private.1.addr"); got != "10.0.0.2" {
+		t.Errorf("Expected to index arrays; got %q", got)
+	}
+	if got := len(d.GetArray("server.addresses.private")); got != 2 {
+		t.Errorf("Expected 2 addresses; got %d", got)
+	}
+	if got := len(d.GetMap("server")); got != 7 {
+		t.Errorf("Expected 7 server members; got %d", got)
+	}
+	if got := d.GetString("server.progress"); got != "" {
+		t.Errorf("Expected a mismatched type to yield the zero value; got %q", got)
+	}
+	if d.Get("server.missing").Exists() || d.Get("server.addresses.private.5").Exists() {
+		t.Error("Expected missing paths not to exist")
+	}
+	if !d.Get("server.description").Exists() {
+		t.Error("Expected a null value to exist")
+	}
+}
+
+func TestRequestDynamic(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(dynamicServer))
+	}))
+	defer ts.Close()
+
+	d, _, err := RequestDynamic("GET", ts.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.GetString("server.addresses.private.0.addr"); got != "10.0.0.1" {
+		t.Fatalf("Expected 10.0.0.1; got %q", got)
+	}
+
+	m, _, err := RequestMap("GET", ts.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server, ok := m["server"].(map[string]interface{}); !ok || server["id"] != "abc" {
+		t.Fatalf("Expected a generic map; got %v", m)
+	}
+}
@@ -0,0 +1,175 @@
+package perigee
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ContentCoding compresses and decompresses bodies in one HTTP content coding (e.g., gzip or zstd).
+// Decode wraps a compressed response body; Encode wraps a writer receiving a compressed request body.
+// Either may be nil if the coding is supported in only one direction.
+type ContentCoding struct {
+	Decode func(r io.Reader) (io.ReadCloser, error)
+	Encode func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	codingsMu sync.RWMutex
+	codings   = map[string]ContentCoding{
+		"gzip": {
+			Decode: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+			Encode: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		},
+		"deflate": {
+			Decode: func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil },
+			Encode: func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.DefaultCompression) },
+		},
+	}
+
+	// advertised lists the registered codings offered in Accept-Encoding, most preferred first.
+	// Go's transport negotiates gzip by itself, so perigee only advertises codings once some other is registered.
+	advertised []string
+)
+
+// RegisterContentCoding makes a content coding available for response and request bodies.
+// Once any coding besides gzip and deflate is registered with a Decode function, requests advertise it in Accept-Encoding,
+// ahead of gzip, unless the caller sets that header; the most recently registered coding is most preferred.
+// Registering a coding already registered replaces it.
+//
+// Support for zstd, which the standard library lacks, is compiled in with the zstd build tag.
+func RegisterContentCoding(name string, c ContentCoding) {
+	name = strings.ToLower(name)
+	codingsMu.Lock()
+	defer codingsMu.Unlock()
+	codings[name] = c
+	if name == "gzip" || name == "deflate" || c.Decode == nil {
+		return
+	}
+	for _, a := range advertised {
+		if a == name {
+			return
+		}
+	}
+	advertised = append([]string{name}, advertised...)
+}
+
+// acceptEncoding returns the Accept-Encoding header perigee sends, or "" to leave negotiation to the transport.
+func acceptEncoding() string {
+	codingsMu.RLock()
+	defer codingsMu.RUnlock()
+	if len(advertised) == 0 {
+		return ""
+	}
+	return strings.Join(append(append([]string(nil), advertised...), "gzip"), ", ")
+}
+
+// The UnsupportedCodingError structure is returned when a request asks to compress its body in an unregistered content coding.
+type UnsupportedCodingError struct {
+	Coding string
+}
+
+func (err *UnsupportedCodingError) Error() string {
+	return fmt.Sprintf("Content coding %q is not registered for request bodies", err.Coding)
+}
+
+// compressBody compresses a request body in the named coding.
+func compressBody(name string, body io.Reader) ([]byte, error) {
+	codingsMu.RLock()
+	c, ok := codings[strings.ToLower(name)]
+	codingsMu.RUnlock()
+	if !ok || c.Encode == nil {
+		return nil, &UnsupportedCodingError{Coding: name}
+	}
+	var buf bytes.Buffer
+	w, err := c.Encode(&buf)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(w, body)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	return buf.Bytes(), err
+}
+
+// identity reports whether a Content-Encoding header value leaves the body as it is.
+func identity(contentEncoding string) bool {
+	ce := strings.TrimSpace(contentEncoding)
+	return ce == "" || strings.EqualFold(ce, "identity")
+}
+
+// decodeContent replaces a compressed response body with its decompressed form, as Go's transport does for gzip it negotiated itself.
+// Bodies in codings not registered are left untouched, along with their Content-Encoding header.
+// Responses that carry no body (to HEAD, 204, 304, or an explicit zero length) are left alone,
+// since their Content-Encoding describes a body that was never sent.
+func decodeContent(resp *http.Response) error {
+	if resp.ContentLength == 0 || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified ||
+		(resp.Request != nil && resp.Request.Method == http.MethodHead) {
+		return nil
+	}
+	var names []string
+	for _, v := range resp.Header.Values("Content-Encoding") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "" && name != "identity" {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	decoders := make([]func(io.Reader) (io.ReadCloser, error), len(names))
+	codingsMu.RLock()
+	for i, name := range names {
+		decoders[i] = codings[name].Decode
+	}
+	codingsMu.RUnlock()
+	for _, d := range decoders {
+		if d == nil {
+			return nil
+		}
+	}
+
+	// Codings are listed in the order they were applied, so they are undone in reverse.
+	raw := resp.Body
+	var r io.Reader = raw
+	closers := []io.Closer{raw}
+	for i := len(decoders) - 1; i >= 0; i-- {
+		rc, err := decoders[i](r)
+		if err != nil {
+			return err
+		}
+		r = rc
+		closers = append(closers, rc)
+	}
+	resp.Body = &decodedBody{Reader: r, closers: closers}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decodedBody reads a decompressed response body, closing the decompressors along with the underlying body.
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if cerr := b.closers[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
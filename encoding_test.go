@@ -0,0 +1,241 @@
+package perigee
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// reverseCoding is a toy content coding, reversing the bytes of a body.
+var reverseCoding = ContentCoding{
+	Decode: func(r io.Reader) (io.ReadCloser, error) {
+		b, err := ioutil.ReadAll(r)
+		return ioutil.NopCloser(bytes.NewReader(reverse(b))), err
+	},
+}
+
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i, c := range b {
+		r[len(b)-1-i] = c
+	}
+	return r
+}
+
+func TestRegisteredCodingIsAdvertisedAndDecoded(t *testing.T) {
+	RegisterContentCoding("x-reverse", reverseCoding)
+	defer func() {
+		codingsMu.Lock()
+		delete(codings, "x-reverse")
+		advertised = nil
+		codingsMu.Unlock()
+	}()
+
+	var acceptEncoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "x-reverse")
+		w.Write(reverse([]byte(`{"name":"perigee"}`)))
+	}))
+	defer ts.Close()
+
+	var result struct{ Name string }
+	resp, err := Request("GET", ts.URL, Options{Results: &result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acceptEncoding != "x-reverse, gzip" {
+		t.Errorf("Expected Accept-Encoding x-reverse, gzip; got %q", acceptEncoding)
+	}
+	if result.Name != "perigee" {
+		t.Errorf("Expected the body to be decoded; got %q", resp.JsonResult)
+	}
+	if resp.HttpResponse.Header.Get("Content-Encoding") != "" {
+		t.Error("Expected Content-Encoding to be removed once decoded")
+	}
+}
+
+func TestGzipResponseWithCallerAcceptEncoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(`{"name":"perigee"}`))
+		zw.Close()
+	}))
+	defer ts.Close()
+
+	// Setting Accept-Encoding ourselves stops Go's transport from decompressing.
+	var result struct{ Name string }
+	_, err := Request("GET", ts.URL, Options{
+		Results:     &result,
+		MoreHeaders: map[string]string{"Accept-Encoding": "gzip"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "perigee" {
+		t.Fatalf("Expected the gzipped body to be decoded; got %+v", result)
+	}
+}
+
+func TestCompressRequest(t *testing.T) {
+	var encoding, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		b, _ := ioutil.ReadAll(zr)
+		body = string(b)
+	}))
+	defer ts.Close()
+
+	_, err := Request("POST", ts.URL, Options{
+		ReqBody:         map[string]string{"name": "perigee"},
+		CompressRequest: "gzip",
+		Retry:           &RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoding != "gzip" || body != `{"name":"perigee"}` {
+		t.Fatalf("Expected a gzipped JSON body; got %q encoded as %q", body, encoding)
+	}
+
+	_, err = Request("POST", ts.URL, Options{
+		ReqBody:         strings.NewReader("text"),
+		ContentType:     "text/plain",
+		CompressRequest: "x-unknown",
+	})
+	if _, ok := err.(*UnsupportedCodingError); !ok {
+		t.Fatalf("Expected an UnsupportedCodingError; got %v", err)
+	}
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Accept-Encoding")
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	_, err := Request("GET", ts.URL, Options{AcceptEncoding: "identity"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "identity" {
+		t.Fatalf("Expected Accept-Encoding identity; got %q", got)
+	}
+}
+
+func TestKeepCompressed(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(`{"name":"perigee"}`))
+	zw.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("Expected gzip to be requested; got %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	resp, err := Request("GET", ts.URL, Options{KeepCompressed: true, TeeBody: &buf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), compressed.Bytes()) {
+		t.Fatalf("Expected the compressed bytes untouched; got %q", buf.Bytes())
+	}
+	if resp.HttpResponse.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("Expected Content-Encoding to be kept")
+	}
+}
+
+func TestKeepCompressedSkipsDecoding(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(`{"name":"perigee"}`))
+	zw.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+	defer ts.Close()
+
+	var result struct{ Name string }
+	resp, err := Request("GET", ts.URL, Options{KeepCompressed: true, Results: &result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp.JsonResult, compressed.Bytes()) || resp.ContentEncoding != "gzip" {
+		t.Fatalf("Expected the compressed bytes and their coding; got %q in %q", resp.JsonResult, resp.ContentEncoding)
+	}
+	if result.Name != "" || resp.Results != nil {
+		t.Fatal("Expected no results to be decoded")
+	}
+
+	// Without KeepCompressed, the body is decoded, but its original coding is still reported.
+	resp, err = Request("GET", ts.URL, Options{MoreHeaders: map[string]string{"Accept-Encoding": "gzip"}, Results: &result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "perigee" || resp.ContentEncoding != "gzip" {
+		t.Fatalf("Expected a decoded body arriving in gzip; got %+v in %q", result, resp.ContentEncoding)
+	}
+}
+
+func TestBodilessResponsesSkipDecoding(t *testing.T) {
+	for _, code := range []int{http.StatusNoContent, http.StatusNotModified} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Header().Set("ETag", `"v1"`)
+			w.WriteHeader(code)
+		}))
+
+		resp, err := Request("GET", ts.URL, Options{
+			OkCodes:     []int{code},
+			MoreHeaders: map[string]string{"Accept-Encoding": "gzip", "If-None-Match": `"v1"`},
+		})
+		ts.Close()
+		if err != nil {
+			t.Fatalf("Expected a %d response with Content-Encoding gzip to succeed; got %s", code, err)
+		}
+		if resp.StatusCode != code {
+			t.Fatalf("Expected status %d; got %d", code, resp.StatusCode)
+		}
+	}
+}
+
+func TestHeadSkipsDecoding(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The headers describe the gzipped body a GET would have sent.
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", "38")
+	}))
+	defer ts.Close()
+
+	var result struct{ Name string }
+	resp, err := Head(ts.URL, Options{Results: &result, MoreHeaders: map[string]string{"Accept-Encoding": "gzip"}})
+	if err != nil {
+		t.Fatalf("Expected HEAD with Content-Encoding gzip to succeed; got %s", err)
+	}
+	if resp.HttpResponse.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("Expected Content-Encoding to be left on a HEAD response")
+	}
+}
@@ -0,0 +1,113 @@
+package perigee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// ErrTemplatedLink is returned when asked to follow a HAL link whose href is a URI template, which must be expanded first.
+var ErrTemplatedLink = errors.New("perigee: cannot follow a templated link")
+
+// The LinkNotFoundError structure is returned when a response has no HAL link with the relation asked for.
+type LinkNotFoundError struct {
+	Url string
+	Rel string
+}
+
+func (err *LinkNotFoundError) Error() string {
+	return fmt.Sprintf("No %q link in the response from URL(%s)", err.Rel, err.Url)
+}
+
+// HALLink is a link of a HAL document (application/hal+json), as found under _links.
+type HALLink struct {
+	Href      string `json:"href"`
+	Templated bool   `json:"templated,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// Links parses the _links of a HAL response body, by relation.
+// A relation holding a single link yields a slice of one.
+// The body must have been read, by giving Options.Results or Options.ResponseBuffer; a body without _links yields no links.
+func (r *Response) Links() (map[string][]HALLink, error) {
+	var doc struct {
+		Links map[string]json.RawMessage `json:"_links"`
+	}
+	if len(r.JsonResult) == 0 {
+		return nil, nil
+	}
+	err := json.Unmarshal(r.JsonResult, &doc)
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string][]HALLink, len(doc.Links))
+	for rel, raw := range doc.Links {
+		var many []HALLink
+		if json.Unmarshal(raw, &many) == nil {
+			links[rel] = many
+			continue
+		}
+		var one HALLink
+		err = json.Unmarshal(raw, &one)
+		if err != nil {
+			return nil, err
+		}
+		links[rel] = []HALLink{one}
+	}
+	return links, nil
+}
+
+// Link returns the first HAL link with the given relation, with its href resolved against the URL of the request.
+func (r *Response) Link(rel string) (HALLink, error) {
+	base := r.url()
+	links, err := r.Links()
+	if err != nil {
+		return HALLink{}, err
+	}
+	if len(links[rel]) == 0 {
+		return HALLink{}, &LinkNotFoundError{Url: base, Rel: rel}
+	}
+	link := links[rel][0]
+	if link.Templated {
+		return link, ErrTemplatedLink
+	}
+	if b, err := url.Parse(base); err == nil && base != "" {
+		ref, err := url.Parse(link.Href)
+		if err != nil {
+			return link, err
+		}
+		link.Href = b.ResolveReference(ref).String()
+	}
+	return link, nil
+}
+
+// Follow issues a GET request for the resource a HAL link of the response points to, with the given Options,
+// so that hypermedia-driven clients need not extract URLs themselves.
+// Use Client.Follow to apply a client's defaults, such as its credentials, to the request.
+func (r *Response) Follow(rel string, opts Options) (*Response, error) {
+	link, err := r.Link(rel)
+	if err != nil {
+		return nil, err
+	}
+	return Request("GET", link.Href, opts)
+}
+
+// Follow issues a GET request through the client for the resource a HAL link of the response points to; see Response.Follow.
+func (c *Client) Follow(r *Response, rel string, opts Options) (*Response, error) {
+	link, err := r.Link(rel)
+	if err != nil {
+		return nil, err
+	}
+	return c.Request("GET", link.Href, opts)
+}
+
+// url returns the URL the response was fetched from, if known.
+func (r *Response) url() string {
+	if r.HttpResponse.Request == nil || r.HttpResponse.Request.URL == nil {
+		return ""
+	}
+	return r.HttpResponse.Request.URL.String()
+}
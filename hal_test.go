@@ -0,0 +1,62 @@
+package perigee
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHALFollow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/hal+json")
+		switch r.URL.String() {
+		case "/orders":
+			fmt.Fprint(w, `{"_links": {
+				"self": {"href": "/orders"},
+				"next": {"href": "/orders?page=2"},
+				"item": [{"href": "orders/123"}, {"href": "orders/124"}],
+				"find": {"href": "/orders{?id}", "templated": true}
+			}, "total": 2}`)
+		default:
+			fmt.Fprintf(w, `{"path": %q, "query": %q, "token": %q}`, r.URL.Path, r.URL.RawQuery, r.Header.Get("X-Auth-Token"))
+		}
+	}))
+	defer ts.Close()
+
+	var orders struct{ Total int }
+	resp, err := Request("GET", ts.URL+"/orders", Options{Results: &orders})
+	if err != nil {
+		t.Fatal(err)
+	}
+	links, err := resp.Links()
+	if err != nil || len(links["item"]) != 2 || links["self"][0].Href != "/orders" {
+		t.Fatalf("Expected the parsed links; got %+v, %v", links, err)
+	}
+
+	var next struct{ Path, Query string }
+	if _, err := resp.Follow("next", Options{Results: &next}); err != nil {
+		t.Fatal(err)
+	}
+	if next.Path != "/orders" || next.Query != "page=2" {
+		t.Fatalf("Expected to follow the next link; got %+v", next)
+	}
+
+	client := NewClient(Options{MoreHeaders: map[string]string{"X-Auth-Token": "secret"}})
+	var item struct{ Path, Token string }
+	if _, err := client.Follow(resp, "item", Options{Results: &item}); err != nil {
+		t.Fatal(err)
+	}
+	if item.Path != "/orders/123" || item.Token != "secret" {
+		t.Fatalf("Expected to follow the first item link through the client; got %+v", item)
+	}
+
+	var notFound *LinkNotFoundError
+	if _, err := resp.Follow("prev", Options{}); !errors.As(err, &notFound) || notFound.Rel != "prev" {
+		t.Fatalf("Expected a LinkNotFoundError; got %v", err)
+	}
+	if _, err := resp.Follow("find", Options{}); err != ErrTemplatedLink {
+		t.Fatalf("Expected ErrTemplatedLink; got %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package perigee
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The HeaderDecodeError structure is returned when a response header cannot be converted to the type of the field it is bound to,
+// or when a field of Options.ReqHeaders cannot be rendered as a request header.
+type HeaderDecodeError struct {
+	Header string
+	Field  string
+	Err    error
+}
+
+func (err *HeaderDecodeError) Error() string {
+	return fmt.Sprintf("Cannot decode header %s into field %s: %s", err.Header, err.Field, err.Err)
+}
+
+// decodeHeaders fills the fields of the structure v points to from response headers, as directed by their header tags.
+//
+// A tag names the header a field is filled from, as in `header:"X-Object-Count"`.
+// Fields may be strings, integers, floating-point numbers, booleans, time.Time, or time.Duration
+// (read as a whole number of seconds, as in Retry-After), pointers to any of these, or []string to collect every value of a header.
+// A tag ending in * (e.g., `header:"X-Object-Meta-*"`) binds a map[string]string, collecting every header with that prefix,
+// keyed by the rest of its name.
+// Times are parsed as HTTP dates, RFC 3339 timestamps, or (possibly fractional) seconds since the Unix epoch.
+// Headers absent from the response leave their fields untouched.
+func decodeHeaders(h http.Header, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("perigee: HeaderResults must point to a structure")
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		name, ok := sf.Tag.Lookup("header")
+		if !ok || name == "" || name == "-" || sf.PkgPath != "" {
+			continue
+		}
+		field := rv.Field(i)
+
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			if field.Type() != reflect.TypeOf(map[string]string(nil)) {
+				return &HeaderDecodeError{Header: name, Field: sf.Name, Err: errors.New("wildcard headers bind only map[string]string")}
+			}
+			prefix = http.CanonicalHeaderKey(prefix)
+			m := make(map[string]string)
+			for k, values := range h {
+				if strings.HasPrefix(k, prefix) && len(k) > len(prefix) && len(values) > 0 {
+					m[k[len(prefix):]] = values[0]
+				}
+			}
+			if len(m) > 0 {
+				field.Set(reflect.ValueOf(m))
+			}
+			continue
+		}
+
+		values := h.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if field.Type() == reflect.TypeOf([]string(nil)) {
+			field.Set(reflect.ValueOf(append([]string(nil), values...)))
+			continue
+		}
+		if field.Kind() == reflect.Ptr {
+			target := reflect.New(field.Type().Elem())
+			if err := setHeaderValue(target.Elem(), values[0]); err != nil {
+				return &HeaderDecodeError{Header: name, Field: sf.Name, Err: err}
+			}
+			field.Set(target)
+			continue
+		}
+		if err := setHeaderValue(field, values[0]); err != nil {
+			return &HeaderDecodeError{Header: name, Field: sf.Name, Err: err}
+		}
+	}
+	return nil
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// setHeaderValue converts a header value to the field's type and stores it.
+func setHeaderValue(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	switch field.Type() {
+	case timeType:
+		t, err := parseHeaderTime(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(time.Duration(seconds) * time.Second))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			switch strings.ToLower(value) {
+			case "yes", "on":
+				b = true
+			case "no", "off":
+				b = false
+			default:
+				return err
+			}
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// parseHeaderTime parses an HTTP date, an RFC 3339 timestamp, or seconds since the Unix epoch.
+func parseHeaderTime(value string) (time.Time, error) {
+	if t, err := http.ParseTime(value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unrecognized time %q", value)
+	}
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)).UTC(), nil
+}
+
+// encodeHeaders builds request headers from the fields of a structure (or a pointer to one), as directed by their header tags.
+// Tags and field types follow decodeHeaders: times are sent as HTTP dates, durations as whole seconds,
+// []string fields as one header per element, and wildcard map[string]string fields as one header per entry.
+// Zero values (empty strings, zero numbers, false, the zero time, nil pointers, and the like) are omitted;
+// use a pointer to send a zero value explicitly.
+func encodeHeaders(v interface{}) (http.Header, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.New("perigee: ReqHeaders must be a structure, or point to one")
+	}
+	rt := rv.Type()
+	h := make(http.Header)
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		name, ok := sf.Tag.Lookup("header")
+		if !ok || name == "" || name == "-" || sf.PkgPath != "" {
+			continue
+		}
+		field := rv.Field(i)
+
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			m, ok := field.Interface().(map[string]string)
+			if !ok {
+				return nil, &HeaderDecodeError{Header: name, Field: sf.Name, Err: errors.New("wildcard headers bind only map[string]string")}
+			}
+			for k, value := range m {
+				h.Set(prefix+k, value)
+			}
+			continue
+		}
+
+		if values, ok := field.Interface().([]string); ok {
+			for _, value := range values {
+				h.Add(name, value)
+			}
+			continue
+		}
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		} else if field.IsZero() {
+			continue
+		}
+		value, err := formatHeaderValue(field)
+		if err != nil {
+			return nil, &HeaderDecodeError{Header: name, Field: sf.Name, Err: err}
+		}
+		h.Set(name, value)
+	}
+	return h, nil
+}
+
+// formatHeaderValue renders a field as a header value.
+func formatHeaderValue(field reflect.Value) (string, error) {
+	switch field.Type() {
+	case timeType:
+		return field.Interface().(time.Time).UTC().Format(http.TimeFormat), nil
+	case durationType:
+		return strconv.FormatInt(int64(field.Interface().(time.Duration)/time.Second), 10), nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(field.Float(), 'f', -1, field.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported field type %s", field.Type())
+}
@@ -0,0 +1,140 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type objectHeaders struct {
+	ContentLength int64             `header:"Content-Length"`
+	ETag          string            `header:"Etag"`
+	LastModified  time.Time         `header:"Last-Modified"`
+	Timestamp     time.Time         `header:"X-Timestamp"`
+	Static        bool              `header:"X-Static-Large-Object"`
+	DeleteAt      *int64            `header:"X-Delete-At"`
+	RetryAfter    time.Duration     `header:"Retry-After"`
+	Ratio         float64           `header:"X-Ratio"`
+	Vary          []string          `header:"Vary"`
+	Meta          map[string]string `header:"X-Object-Meta-*"`
+	Missing       string            `header:"X-Missing"`
+	Untagged      string
+}
+
+func TestHeaderResults(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Etag", `"abc"`)
+		h.Set("Last-Modified", "Tue, 15 Nov 1994 12:45:26 GMT")
+		h.Set("X-Timestamp", "1414180016.5")
+		h.Set("X-Static-Large-Object", "True")
+		h.Set("X-Delete-At", "1500000000")
+		h.Set("Retry-After", "120")
+		h.Set("X-Ratio", "0.75")
+		h.Add("Vary", "Accept")
+		h.Add("Vary", "Accept-Encoding")
+		h.Set("X-Object-Meta-Color", "blue")
+		h.Set("X-Object-Meta-Owner", "ops")
+		w.Write([]byte("12345"))
+	}))
+	defer ts.Close()
+
+	headers := objectHeaders{Missing: "untouched"}
+	_, err := Request("GET", ts.URL, Options{HeaderResults: &headers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if headers.ContentLength != 5 || headers.ETag != `"abc"` || !headers.Static || headers.Ratio != 0.75 {
+		t.Fatalf("Expected scalar headers to be decoded; got %+v", headers)
+	}
+	if !headers.LastModified.Equal(time.Date(1994, 11, 15, 12, 45, 26, 0, time.UTC)) {
+		t.Fatalf("Expected an HTTP date; got %s", headers.LastModified)
+	}
+	if !headers.Timestamp.Equal(time.Unix(1414180016, 5e8)) {
+		t.Fatalf("Expected a fractional Unix timestamp; got %s", headers.Timestamp)
+	}
+	if headers.DeleteAt == nil || *headers.DeleteAt != 1500000000 || headers.RetryAfter != 2*time.Minute {
+		t.Fatalf("Expected pointer and duration headers to be decoded; got %+v", headers)
+	}
+	if len(headers.Vary) != 2 || headers.Meta["Color"] != "blue" || headers.Meta["Owner"] != "ops" || len(headers.Meta) != 2 {
+		t.Fatalf("Expected multi-valued and wildcard headers to be collected; got %v and %v", headers.Vary, headers.Meta)
+	}
+	if headers.Missing != "untouched" {
+		t.Fatalf("Expected absent headers to leave fields alone; got %q", headers.Missing)
+	}
+}
+
+func TestHeaderResultsErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Count", "many")
+	}))
+	defer ts.Close()
+
+	var bad struct {
+		Count int `header:"X-Count"`
+	}
+	_, err := Request("GET", ts.URL, Options{HeaderResults: &bad})
+	if e, ok := err.(*HeaderDecodeError); !ok || e.Header != "X-Count" || e.Field != "Count" {
+		t.Fatalf("Expected a HeaderDecodeError; got %#v", err)
+	}
+
+	_, err = Request("GET", ts.URL, Options{HeaderResults: bad})
+	if err == nil {
+		t.Fatal("Expected a non-pointer HeaderResults to be rejected")
+	}
+}
+
+func TestReqHeaders(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer ts.Close()
+
+	zero := int64(0)
+	params := struct {
+		ContentType string            `header:"Content-Type"`
+		DeleteAt    *int64            `header:"X-Delete-At"`
+		DeleteAfter time.Duration     `header:"X-Delete-After"`
+		IfModified  time.Time         `header:"If-Modified-Since"`
+		Versioned   bool              `header:"X-Versions-Enabled"`
+		Empty       string            `header:"X-Empty"`
+		Tags        []string          `header:"X-Tag"`
+		Meta        map[string]string `header:"X-Object-Meta-*"`
+	}{
+		ContentType: "image/png",
+		DeleteAt:    &zero,
+		DeleteAfter: time.Hour,
+		IfModified:  time.Date(1994, 11, 15, 12, 45, 26, 0, time.UTC),
+		Tags:        []string{"a", "b"},
+		Meta:        map[string]string{"Color": "blue"},
+	}
+	_, err := Request("PUT", ts.URL, Options{
+		ReqHeaders:  &params,
+		MoreHeaders: map[string]string{"X-Delete-After": "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{
+		"X-Delete-At":         "0",
+		"X-Delete-After":      "3600",
+		"If-Modified-Since":   "Tue, 15 Nov 1994 12:45:26 GMT",
+		"X-Object-Meta-Color": "blue",
+	}
+	for k, v := range expect {
+		if got.Get(k) != v {
+			t.Errorf("Expected %s: %s; got %q", k, v, got.Values(k))
+		}
+	}
+	if _, ok := got["X-Versions-Enabled"]; ok {
+		t.Error("Expected a false bool to be omitted")
+	}
+	if _, ok := got["X-Empty"]; ok {
+		t.Error("Expected an empty string to be omitted")
+	}
+	if len(got.Values("X-Tag")) != 2 {
+		t.Errorf("Expected a header per element; got %q", got.Values("X-Tag"))
+	}
+}
@@ -0,0 +1,53 @@
+package perigee
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrHTTP3Unavailable is returned when ClientConfig.HTTP3 is set, but perigee was built without HTTP/3 support.
+// HTTP/3 support wraps github.com/quic-go/quic-go, and is compiled in only with the http3 build tag:
+//
+//	go build -tags http3
+var ErrHTTP3Unavailable = errors.New("perigee: HTTP/3 requires building with -tags http3")
+
+// newHTTP3Transport builds an HTTP/3 transport for the configuration.
+// It remains nil unless perigee is built with the http3 tag.
+var newHTTP3Transport func(cfg ClientConfig) http.RoundTripper
+
+// FallbackTransport sends each request through Primary, and again through Fallback if Primary fails to deliver it.
+// ClientConfig.HTTP3 uses one to fall back to HTTP/2 or HTTP/1.1 wherever QUIC is blocked or unsupported.
+//
+// Only failures to obtain any response at all trigger the fallback; an error status from the server is returned as is.
+// Requests whose body cannot be replayed (see http.Request.GetBody) are not sent a second time.
+type FallbackTransport struct {
+	Primary  http.RoundTripper
+	Fallback http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *FallbackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.Primary.RoundTrip(req)
+	if err == nil || req.Context().Err() != nil {
+		return resp, err
+	}
+
+	retry := req
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return resp, err
+		}
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return resp, err
+		}
+		retry = req.Clone(req.Context())
+		retry.Body = body
+	}
+
+	fallback := t.Fallback
+	if fallback == nil {
+		fallback = http.DefaultTransport
+	}
+	return fallback.RoundTrip(retry)
+}
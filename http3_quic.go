@@ -0,0 +1,22 @@
+//go:build http3
+
+package perigee
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+func init() {
+	newHTTP3Transport = func(cfg ClientConfig) http.RoundTripper {
+		config := cfg.tlsConfig()
+		if config == nil {
+			config = &tls.Config{}
+		}
+		return &http3.Transport{
+			TLSClientConfig: config,
+		}
+	}
+}
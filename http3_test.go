@@ -0,0 +1,59 @@
+package perigee
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// failingTransport fails every request, counting them.
+type failingTransport struct{ calls int }
+
+func (t *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, errors.New("QUIC blocked")
+}
+
+func TestHTTP3RequiresBuildTag(t *testing.T) {
+	if newHTTP3Transport != nil {
+		t.Skip("built with HTTP/3 support")
+	}
+	_, err := NewClientWithConfig(ClientConfig{HTTP3: true}, Options{})
+	if err != ErrHTTP3Unavailable {
+		t.Fatalf("Expected ErrHTTP3Unavailable; got %v", err)
+	}
+}
+
+func TestFallbackTransport(t *testing.T) {
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer ts.Close()
+
+	primary := &failingTransport{}
+	client := &http.Client{Transport: &FallbackTransport{Primary: primary, Fallback: http.DefaultTransport}}
+	_, err := Request("POST", ts.URL, Options{CustomClient: client, ReqBody: map[string]int{"a": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary.calls != 1 || len(bodies) != 1 || bodies[0] != `{"a":1}` {
+		t.Fatalf("Expected the request to fall back with its body intact; got %d primary calls and %q", primary.calls, bodies)
+	}
+
+	_, err = Request("POST", ts.URL, Options{
+		CustomClient: client,
+		ReqBody:      ioutil.NopCloser(strings.NewReader("once")),
+		ContentType:  "text/plain",
+	})
+	if err == nil || len(bodies) != 1 {
+		t.Fatalf("Expected a body which cannot be replayed not to fall back; got %v", err)
+	}
+}
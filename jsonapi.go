@@ -0,0 +1,225 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// JSONAPIMediaType is the media type of JSON:API documents (https://jsonapi.org).
+const JSONAPIMediaType = "application/vnd.api+json"
+
+// JSONAPIError is one entry of the errors array of a JSON:API document.
+type JSONAPIError struct {
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status,omitempty"`
+	Code   string `json:"code,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	Source struct {
+		Pointer   string `json:"pointer,omitempty"`
+		Parameter string `json:"parameter,omitempty"`
+	} `json:"source"`
+}
+
+// JSONAPIErrors holds the errors array of a JSON:API document, and is returned as an error by UnmarshalJSONAPI.
+type JSONAPIErrors []JSONAPIError
+
+func (errs JSONAPIErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msg := e.Title
+		if e.Detail != "" {
+			msg = strings.TrimSpace(msg + ": " + e.Detail)
+		}
+		if e.Source.Pointer != "" {
+			msg += " (" + e.Source.Pointer + ")"
+		}
+		msgs[i] = msg
+	}
+	return "JSON:API errors: " + strings.Join(msgs, "; ")
+}
+
+// ParseJSONAPIErrors extracts the errors array from a JSON:API document, such as the Body of an UnexpectedResponseCodeError.
+// The boolean result is false if the body holds no errors.
+func ParseJSONAPIErrors(body []byte) (JSONAPIErrors, bool) {
+	var doc struct {
+		Errors JSONAPIErrors `json:"errors"`
+	}
+	if json.Unmarshal(body, &doc) != nil || len(doc.Errors) == 0 {
+		return nil, false
+	}
+	return doc.Errors, true
+}
+
+// jsonapiResource is a resource object of a JSON:API document.
+type jsonapiResource struct {
+	Type          string                     `json:"type"`
+	ID            string                     `json:"id,omitempty"`
+	Attributes    map[string]json.RawMessage `json:"attributes,omitempty"`
+	Relationships map[string]struct {
+		Data json.RawMessage `json:"data"`
+	} `json:"relationships,omitempty"`
+}
+
+// UnmarshalJSONAPI decodes a JSON:API document into v, flattening its primary data into the shape of plain JSON:
+// each resource becomes an object holding its id and type alongside its attributes,
+// with each relationship given as the id of the related resource, or an array of ids for to-many relationships.
+// So a structure with fields for "id", the attributes, and the relationship names, or a slice of them, receives the data.
+// A document carrying an errors array yields JSONAPIErrors instead.
+//
+// To decode JSON:API responses this way, register it: RegisterDecoder(JSONAPIMediaType, UnmarshalJSONAPI).
+func UnmarshalJSONAPI(data []byte, v interface{}) error {
+	var doc struct {
+		Data   json.RawMessage `json:"data"`
+		Errors JSONAPIErrors   `json:"errors"`
+	}
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return err
+	}
+	if len(doc.Errors) > 0 {
+		return doc.Errors
+	}
+	primary := bytes.TrimSpace(doc.Data)
+	if len(primary) == 0 || bytes.Equal(primary, []byte("null")) {
+		return nil
+	}
+
+	var flat interface{}
+	if primary[0] == '[' {
+		var resources []jsonapiResource
+		err = json.Unmarshal(primary, &resources)
+		if err != nil {
+			return err
+		}
+		objects := make([]map[string]interface{}, len(resources))
+		for i, r := range resources {
+			objects[i], err = r.flatten()
+			if err != nil {
+				return err
+			}
+		}
+		flat = objects
+	} else {
+		var resource jsonapiResource
+		err = json.Unmarshal(primary, &resource)
+		if err != nil {
+			return err
+		}
+		flat, err = resource.flatten()
+		if err != nil {
+			return err
+		}
+	}
+	text, err := json.Marshal(flat)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(text, v)
+}
+
+// flatten turns a resource object into a plain JSON object.
+func (r jsonapiResource) flatten() (map[string]interface{}, error) {
+	object := make(map[string]interface{}, len(r.Attributes)+len(r.Relationships)+2)
+	for k, v := range r.Attributes {
+		object[k] = v
+	}
+	for name, rel := range r.Relationships {
+		linkage := bytes.TrimSpace(rel.Data)
+		switch {
+		case len(linkage) == 0:
+			// A relationship given only by links has no linkage to flatten.
+		case linkage[0] == '[':
+			var refs []jsonapiResource
+			err := json.Unmarshal(linkage, &refs)
+			if err != nil {
+				return nil, err
+			}
+			ids := make([]string, len(refs))
+			for i, ref := range refs {
+				ids[i] = ref.ID
+			}
+			object[name] = ids
+		case bytes.Equal(linkage, []byte("null")):
+			object[name] = nil
+		default:
+			var ref jsonapiResource
+			err := json.Unmarshal(linkage, &ref)
+			if err != nil {
+				return nil, err
+			}
+			object[name] = ref.ID
+		}
+	}
+	object["id"] = r.ID
+	object["type"] = r.Type
+	return object, nil
+}
+
+// MarshalJSONAPI encodes v, a structure or map (or a slice of them), as the primary data of a JSON:API document,
+// with resources of the given type.
+// The "id" member of v's JSON form, if any, becomes the resource's id; all other members become its attributes.
+// Send the result with ContentType set to JSONAPIMediaType, e.g., ReqBody: bytes.NewReader(body).
+func MarshalJSONAPI(resourceType string, v interface{}) ([]byte, error) {
+	text, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	text = bytes.TrimSpace(text)
+	if len(text) > 0 && text[0] == '[' {
+		var objects []map[string]json.RawMessage
+		err = json.Unmarshal(text, &objects)
+		if err != nil {
+			return nil, fmt.Errorf("perigee: JSON:API resources must encode as objects: %w", err)
+		}
+		resources := make([]jsonapiResource, len(objects))
+		for i, o := range objects {
+			resources[i], err = newJSONAPIResource(resourceType, o)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(map[string]interface{}{"data": resources})
+	}
+	var object map[string]json.RawMessage
+	err = json.Unmarshal(text, &object)
+	if err != nil {
+		return nil, fmt.Errorf("perigee: JSON:API resources must encode as objects: %w", err)
+	}
+	resource, err := newJSONAPIResource(resourceType, object)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{"data": resource})
+}
+
+// errJSONAPIID is returned when a resource's id is neither a string nor a number.
+var errJSONAPIID = errors.New("perigee: JSON:API resource id must be a string or a number")
+
+// newJSONAPIResource builds a resource object from a plain JSON object.
+func newJSONAPIResource(resourceType string, object map[string]json.RawMessage) (jsonapiResource, error) {
+	r := jsonapiResource{Type: resourceType}
+	if raw, ok := object["id"]; ok {
+		delete(object, "id")
+		var id interface{}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if dec.Decode(&id) != nil {
+			return r, errJSONAPIID
+		}
+		switch id := id.(type) {
+		case string:
+			r.ID = id
+		case json.Number:
+			r.ID = id.String()
+		case nil:
+		default:
+			return r, errJSONAPIID
+		}
+	}
+	r.Attributes = object
+	return r, nil
+}
@@ -0,0 +1,112 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type article struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Author   string   `json:"author"`
+	Comments []string `json:"comments"`
+}
+
+func TestUnmarshalJSONAPI(t *testing.T) {
+	doc := []byte(`{"data": [{
+		"type": "articles", "id": "1",
+		"attributes": {"title": "JSON:API paints my bikeshed!"},
+		"relationships": {
+			"author": {"data": {"type": "people", "id": "9"}},
+			"comments": {"data": [{"type": "comments", "id": "5"}, {"type": "comments", "id": "12"}]},
+			"tags": {"links": {"related": "/articles/1/tags"}}
+		}
+	}]}`)
+	var articles []article
+	if err := UnmarshalJSONAPI(doc, &articles); err != nil {
+		t.Fatal(err)
+	}
+	want := []article{{ID: "1", Title: "JSON:API paints my bikeshed!", Author: "9", Comments: []string{"5", "12"}}}
+	if !reflect.DeepEqual(articles, want) {
+		t.Fatalf("Expected %+v; got %+v", want, articles)
+	}
+
+	errDoc := []byte(`{"errors": [{"status": "422", "title": "Invalid Attribute", "detail": "must be at least 3 characters", "source": {"pointer": "/data/attributes/title"}}]}`)
+	err := UnmarshalJSONAPI(errDoc, &articles)
+	var errs JSONAPIErrors
+	if !errors.As(err, &errs) || errs[0].Status != "422" || errs[0].Source.Pointer != "/data/attributes/title" {
+		t.Fatalf("Expected JSONAPIErrors; got %v", err)
+	}
+	if err.Error() != "JSON:API errors: Invalid Attribute: must be at least 3 characters (/data/attributes/title)" {
+		t.Fatalf("Unexpected message %q", err)
+	}
+	if parsed, ok := ParseJSONAPIErrors(errDoc); !ok || len(parsed) != 1 {
+		t.Fatalf("Expected ParseJSONAPIErrors to find the error; got %v", parsed)
+	}
+}
+
+func TestMarshalJSONAPI(t *testing.T) {
+	body, err := MarshalJSONAPI("articles", article{ID: "1", Title: "Hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	json.Unmarshal(body, &doc)
+	data := doc["data"].(map[string]interface{})
+	if data["type"] != "articles" || data["id"] != "1" || data["attributes"].(map[string]interface{})["title"] != "Hello" {
+		t.Fatalf("Unexpected document %s", body)
+	}
+	if _, ok := data["attributes"].(map[string]interface{})["id"]; ok {
+		t.Fatalf("Expected the id not to be repeated among the attributes; got %s", body)
+	}
+
+	body, err = MarshalJSONAPI("articles", []map[string]interface{}{{"title": "New"}})
+	if err != nil || string(body) != `{"data":[{"type":"articles","attributes":{"title":"New"}}]}` {
+		t.Fatalf("Unexpected document %s (%v)", body, err)
+	}
+	if _, err := MarshalJSONAPI("articles", 42); err == nil {
+		t.Fatal("Expected a non-object to be refused")
+	}
+}
+
+func TestJSONAPIRoundTrip(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var doc struct {
+			Data jsonapiResource `json:"data"`
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &doc)
+		doc.Data.ID = "7"
+		w.Header().Set("Content-Type", JSONAPIMediaType)
+		json.NewEncoder(w).Encode(doc)
+	}))
+	defer ts.Close()
+
+	RegisterDecoder(JSONAPIMediaType, UnmarshalJSONAPI)
+	defer func() {
+		decodersMu.Lock()
+		delete(decoders, JSONAPIMediaType)
+		delete(registered, JSONAPIMediaType)
+		decodersMu.Unlock()
+	}()
+
+	body, _ := MarshalJSONAPI("articles", article{Title: "Hello"})
+	var created article
+	_, err := Request("POST", ts.URL, Options{
+		ReqBody:     bytes.NewReader(body),
+		ContentType: JSONAPIMediaType,
+		Results:     &created,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != "7" || created.Title != "Hello" {
+		t.Fatalf("Expected the created article; got %+v", created)
+	}
+}
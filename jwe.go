@@ -0,0 +1,185 @@
+package perigee
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	// ErrMalformedJWE is returned when a response encrypted with JWE is not in compact serialization.
+	ErrMalformedJWE = errors.New("perigee: malformed JWE payload")
+
+	// ErrJWEDecryption is returned when a JWE payload cannot be decrypted with the keys given, or was tampered with.
+	ErrJWEDecryption = errors.New("perigee: could not decrypt JWE payload")
+
+	// ErrNoJWEKey is returned when a JWE lacks the key needed for the algorithm at hand.
+	ErrNoJWEKey = errors.New("perigee: no key for JWE payload")
+)
+
+// JWE encrypts request bodies and decrypts response bodies end to end, in JSON Web Encryption compact serialization (RFC 7516),
+// for APIs requiring payloads be encrypted in addition to TLS; see Options.Encryption.
+//
+// With Key, a symmetric key shared with the server, payloads are encrypted directly ("dir"),
+// with AES-GCM of the key's size (A128GCM, A192GCM, or A256GCM for 16, 24, or 32 bytes).
+// With PublicKey, the server's key, request bodies are encrypted with a fresh key under A256GCM,
+// the key itself being encrypted with RSA-OAEP-256; PrivateKey, the client's own key, decrypts responses encrypted likewise.
+// Responses under RSA-OAEP (with SHA-1) are decrypted as well.
+type JWE struct {
+	Key        []byte
+	PublicKey  *rsa.PublicKey
+	PrivateKey *rsa.PrivateKey
+}
+
+// jweHeader is the protected header of a JWE payload.
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Cty string `json:"cty,omitempty"`
+}
+
+// encrypt reads a request body and encrypts it, recording its content type in the header.
+func (j *JWE) encrypt(body io.Reader, contentType string) ([]byte, error) {
+	plaintext, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	header := jweHeader{Cty: contentType}
+	var cek, encryptedKey []byte
+	switch {
+	case j.PublicKey != nil:
+		header.Alg, header.Enc = "RSA-OAEP-256", "A256GCM"
+		cek = make([]byte, 32)
+		_, err = rand.Read(cek)
+		if err == nil {
+			encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, j.PublicKey, cek, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case j.Key != nil:
+		header.Alg, cek = "dir", j.Key
+		header.Enc = fmt.Sprintf("A%dGCM", len(j.Key)*8)
+	default:
+		return nil, ErrNoJWEKey
+	}
+
+	gcm, err := newGCM(header.Enc, cek)
+	if err != nil {
+		return nil, err
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(headerJSON)
+	iv := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(iv)
+	if err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(plaintext)], sealed[len(plaintext):]
+
+	enc := base64.RawURLEncoding
+	parts := []string{protected, enc.EncodeToString(encryptedKey), enc.EncodeToString(iv), enc.EncodeToString(ciphertext), enc.EncodeToString(tag)}
+	var out bytes.Buffer
+	for i, p := range parts {
+		if i > 0 {
+			out.WriteByte('.')
+		}
+		out.WriteString(p)
+	}
+	return out.Bytes(), nil
+}
+
+// decrypt decrypts a response body, returning the plaintext and the content type recorded in its header, if any.
+func (j *JWE) decrypt(payload []byte) ([]byte, string, error) {
+	parts := bytes.Split(bytes.TrimSpace(payload), []byte("."))
+	if len(parts) != 5 {
+		return nil, "", ErrMalformedJWE
+	}
+	decoded := make([][]byte, 5)
+	for i, p := range parts {
+		d, err := base64.RawURLEncoding.DecodeString(string(p))
+		if err != nil {
+			return nil, "", ErrMalformedJWE
+		}
+		decoded[i] = d
+	}
+	var header jweHeader
+	if json.Unmarshal(decoded[0], &header) != nil {
+		return nil, "", ErrMalformedJWE
+	}
+
+	var cek []byte
+	var err error
+	switch header.Alg {
+	case "dir":
+		if j.Key == nil {
+			return nil, "", ErrNoJWEKey
+		}
+		cek = j.Key
+	case "RSA-OAEP-256", "RSA-OAEP":
+		if j.PrivateKey == nil {
+			return nil, "", ErrNoJWEKey
+		}
+		h := sha256.New()
+		if header.Alg == "RSA-OAEP" {
+			h = sha1.New()
+		}
+		cek, err = rsa.DecryptOAEP(h, nil, j.PrivateKey, decoded[1], nil)
+		if err != nil {
+			return nil, "", ErrJWEDecryption
+		}
+	default:
+		return nil, "", fmt.Errorf("perigee: unsupported JWE algorithm %q", header.Alg)
+	}
+
+	gcm, err := newGCM(header.Enc, cek)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(decoded[2]) != gcm.NonceSize() {
+		return nil, "", ErrMalformedJWE
+	}
+	plaintext, err := gcm.Open(nil, decoded[2], append(decoded[3], decoded[4]...), parts[0])
+	if err != nil {
+		return nil, "", ErrJWEDecryption
+	}
+	return plaintext, header.Cty, nil
+}
+
+// newGCM prepares AES-GCM for the named content encryption algorithm, checking the key's size.
+func newGCM(enc string, key []byte) (cipher.AEAD, error) {
+	var size int
+	switch enc {
+	case "A128GCM":
+		size = 16
+	case "A192GCM":
+		size = 24
+	case "A256GCM":
+		size = 32
+	default:
+		return nil, fmt.Errorf("perigee: unsupported JWE encryption %q", enc)
+	}
+	if len(key) != size {
+		return nil, ErrJWEDecryption
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
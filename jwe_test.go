@@ -0,0 +1,110 @@
+package perigee
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// jweEchoServer decrypts each request with one JWE and encrypts the body back with another.
+func jweEchoServer(t *testing.T, in, out *JWE) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := ioutil.ReadAll(r.Body)
+		plaintext, cty, err := in.decrypt(payload)
+		if err != nil || r.Header.Get("Content-Type") != "application/jose" || cty != "application/json" {
+			t.Errorf("Expected an encrypted JSON request; got %s (%v)", payload, err)
+			w.WriteHeader(400)
+			return
+		}
+		reply, _ := out.encrypt(bytes.NewReader(plaintext), "")
+		w.Header().Set("Content-Type", "application/jose")
+		w.Write(reply)
+	}))
+}
+
+func TestJWEDirect(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	shared := &JWE{Key: key}
+	ts := jweEchoServer(t, shared, shared)
+	defer ts.Close()
+
+	var results map[string]string
+	response, err := Request("POST", ts.URL, Options{
+		ReqBody:    map[string]string{"card": "4111"},
+		Results:    &results,
+		Encryption: shared,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results["card"] != "4111" {
+		t.Fatalf("Expected the decrypted echo; got %v", results)
+	}
+	if bytes.Contains(response.JsonResult, []byte("4111")) {
+		t.Fatalf("Expected JsonResult to hold the encrypted body; got %s", response.JsonResult)
+	}
+}
+
+func TestJWERSA(t *testing.T) {
+	serverKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	clientKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ts := jweEchoServer(t, &JWE{PrivateKey: serverKey}, &JWE{PublicKey: &clientKey.PublicKey})
+	defer ts.Close()
+
+	var results []int
+	_, err := Request("POST", ts.URL, Options{
+		ReqBody:    []int{1, 2, 3},
+		Results:    &results,
+		Encryption: &JWE{PublicKey: &serverKey.PublicKey, PrivateKey: clientKey},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[2] != 3 {
+		t.Fatalf("Expected the decrypted echo; got %v", results)
+	}
+}
+
+func TestJWERejectsBadPayloads(t *testing.T) {
+	key := make([]byte, 16)
+	shared := &JWE{Key: key}
+	sealed, err := shared.encrypt(bytes.NewReader([]byte(`{"a":1}`)), "application/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first character of a base64 segment carries six whole bits, so changing it alters the ciphertext.
+	parts := bytes.Split(sealed, []byte("."))
+	if parts[3][0] == 'A' {
+		parts[3][0] = 'B'
+	} else {
+		parts[3][0] = 'A'
+	}
+	tampered := bytes.Join(parts, []byte("."))
+
+	for _, tc := range []struct {
+		body []byte
+		want error
+	}{
+		{[]byte(`{"a":1}`), ErrMalformedJWE},
+		{tampered, ErrJWEDecryption},
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(tc.body)
+		}))
+		var results map[string]int
+		_, err := Request("GET", ts.URL, Options{Results: &results, Encryption: shared})
+		ts.Close()
+		if err != tc.want {
+			t.Fatalf("Expected %v for %s; got %v", tc.want, tc.body, err)
+		}
+	}
+
+	if _, _, err := (&JWE{}).decrypt(sealed); err != ErrNoJWEKey {
+		t.Fatalf("Expected ErrNoJWEKey; got %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+var (
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// snakeCase converts a Go field name to its snake_case form, keeping initialisms together (e.g., ServerID becomes server_id).
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// jsonField describes a structure field as encoding/json sees it.
+type jsonField struct {
+	key    string // the key encoding/json uses for the field
+	tagged bool   // whether a json tag names the key explicitly
+	typ    reflect.Type
+}
+
+// jsonFields lists the fields of a structure type as encoding/json sees them, promoting those of embedded structures.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(ft)...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			fields = append(fields, jsonField{key: sf.Name, typ: sf.Type})
+		} else {
+			fields = append(fields, jsonField{key: name, tagged: true, typ: sf.Type})
+		}
+	}
+	return fields
+}
+
+// renameKeys rewrites the object keys of a generically decoded JSON value bound for (or produced from) a value of type t,
+// so that the keys of untagged structure fields appear in snake_case (toSnake) or as encoding/json expects them (!toSnake).
+// Keys of tagged fields, and of types with their own JSON methods, are left alone.
+func renameKeys(v interface{}, t reflect.Type, toSnake bool) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Implements(marshalerType) || t.Implements(unmarshalerType) ||
+		reflect.PtrTo(t).Implements(marshalerType) || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return v
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Map:
+			for k, elem := range v {
+				v[k] = renameKeys(elem, t.Elem(), toSnake)
+			}
+		case reflect.Struct:
+			fields := jsonFields(t)
+			renamed := make(map[string]interface{}, len(v))
+			for k, elem := range v {
+				key, field := k, matchField(fields, k, toSnake)
+				if field != nil {
+					if !field.tagged {
+						if toSnake {
+							key = snakeCase(field.key)
+						} else {
+							key = field.key
+						}
+					}
+					elem = renameKeys(elem, field.typ, toSnake)
+				}
+				renamed[key] = elem
+			}
+			return renamed
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, elem := range v {
+				v[i] = renameKeys(elem, t.Elem(), toSnake)
+			}
+		}
+	}
+	return v
+}
+
+// matchField finds the field a key belongs to.
+// Marshaled keys match exactly; keys bound for decoding match as encoding/json would match them, or else in snake_case.
+func matchField(fields []jsonField, key string, toSnake bool) *jsonField {
+	for i := range fields {
+		if fields[i].key == key {
+			return &fields[i]
+		}
+	}
+	if toSnake {
+		return nil
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].key, key) {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if !fields[i].tagged && snakeCase(fields[i].key) == strings.ToLower(key) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// marshalJSON marshals a request body, giving the keys of its untagged structure fields in snake_case if Options.SnakeCaseKeys is set.
+func marshalJSON(opts Options) ([]byte, error) {
+	data, err := json.Marshal(opts.ReqBody)
+	if err != nil || !opts.SnakeCaseKeys {
+		return data, err
+	}
+	return rewriteKeys(data, reflect.TypeOf(opts.ReqBody), true)
+}
+
+// unsnakeKeys rewrites the snake_case keys of a JSON document to match the untagged structure fields of the type it will be decoded into.
+func unsnakeKeys(data []byte, t reflect.Type) ([]byte, error) {
+	return rewriteKeys(data, t, false)
+}
+
+func rewriteKeys(data []byte, t reflect.Type, toSnake bool) ([]byte, error) {
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err := dec.Decode(&generic)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(renameKeys(generic, t, toSnake))
+}
+
+// decodesAsJSON reports whether responses of the given media type are decoded as JSON.
+func decodesAsJSON(mt string) bool {
+	if mt == "application/json" {
+		return true
+	}
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	if _, ok := decoders[mt]; ok {
+		return false
+	}
+	if i := strings.LastIndex(mt, "+"); i >= 0 {
+		suffix := "application/" + mt[i+1:]
+		if _, ok := decoders[suffix]; ok {
+			return suffix == "application/json"
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package perigee
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSnakeCase(t *testing.T) {
+	cases := map[string]string{
+		"Name":           "name",
+		"ServerID":       "server_id",
+		"HTTPServerName": "http_server_name",
+		"Flavor2Ref":     "flavor2_ref",
+	}
+	for in, want := range cases {
+		if got := snakeCase(in); got != want {
+			t.Errorf("Expected %s to become %s; got %s", in, want, got)
+		}
+	}
+}
+
+type snakeServer struct {
+	ServerID  string
+	ImageRef  string `json:"imageRef"`
+	Created   time.Time
+	Addresses map[string][]snakeAddress
+	Networks  []snakeAddress
+}
+
+type snakeAddress struct {
+	IPAddress string
+	MacAddr   string `json:"OS-EXT-IPS-MAC:mac_addr"`
+}
+
+func TestSnakeCaseKeys(t *testing.T) {
+	var sent map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &sent)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"server_id": "abc",
+			"imageRef": "img",
+			"created": "2024-01-02T03:04:05Z",
+			"addresses": {"private": [{"ip_address": "10.0.0.1", "OS-EXT-IPS-MAC:mac_addr": "fa:16"}]},
+			"networks": [{"ip_address": "10.0.0.2"}]
+		}`))
+	}))
+	defer ts.Close()
+
+	var server snakeServer
+	_, err := Request("POST", ts.URL, Options{
+		ReqBody:       snakeServer{ServerID: "abc", ImageRef: "img", Networks: []snakeAddress{{IPAddress: "10.0.0.2"}}},
+		Results:       &server,
+		SnakeCaseKeys: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"server_id", "imageRef", "created", "addresses", "networks"} {
+		if _, ok := sent[key]; !ok {
+			t.Errorf("Expected request key %s; got %v", key, sent)
+		}
+	}
+	if network := sent["networks"].([]interface{})[0].(map[string]interface{}); network["ip_address"] != "10.0.0.2" {
+		t.Errorf("Expected nested keys in snake_case; got %v", network)
+	}
+
+	if server.ServerID != "abc" || server.ImageRef != "img" || server.Created.Year() != 2024 {
+		t.Fatalf("Expected snake_case keys to fill their fields; got %+v", server)
+	}
+	private := server.Addresses["private"]
+	if len(private) != 1 || private[0].IPAddress != "10.0.0.1" || private[0].MacAddr != "fa:16" {
+		t.Fatalf("Expected nested snake_case keys to fill their fields; got %+v", server.Addresses)
+	}
+	if len(server.Networks) != 1 || server.Networks[0].IPAddress != "10.0.0.2" {
+		t.Fatalf("Expected slice elements to be mapped; got %+v", server.Networks)
+	}
+}
+
+func TestSnakeCaseKeysIgnoresOtherDecoders(t *testing.T) {
+	if !decodesAsJSON("application/vnd.api+json") || !decodesAsJSON("") {
+		t.Error("Expected JSON media types to decode as JSON")
+	}
+	if decodesAsJSON("application/xml") || decodesAsJSON("application/atom+xml") {
+		t.Error("Expected XML media types not to decode as JSON")
+	}
+}
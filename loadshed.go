@@ -0,0 +1,32 @@
+package perigee
+
+import "fmt"
+
+// The OverloadedError structure is returned when a Client already has as many requests in flight as SetMaxInFlight permits.
+// The request is failed at once, without being sent, rather than queued behind requests which are slow to complete.
+type OverloadedError struct {
+	Url      string
+	Limit    int
+	InFlight int
+}
+
+func (err *OverloadedError) Error() string {
+	return fmt.Sprintf("Too many requests in flight (%d, limit %d); request to URL(%s) shed", err.InFlight, err.Limit, err.Url)
+}
+
+// SetMaxInFlight limits the number of requests the client has in flight at once.
+// Requests beyond the limit fail fast with an *OverloadedError instead of waiting,
+// protecting callers' latency when an upstream slows down and requests pile up.
+// A limit of zero, the default, leaves the number unbounded.
+func (c *Client) SetMaxInFlight(n int) {
+	c.lifeMu.Lock()
+	defer c.lifeMu.Unlock()
+	c.maxInFlight = n
+}
+
+// InFlight reports the number of requests the client currently has in flight.
+func (c *Client) InFlight() int {
+	c.lifeMu.Lock()
+	defer c.lifeMu.Unlock()
+	return len(c.inflight)
+}
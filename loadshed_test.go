@@ -0,0 +1,48 @@
+package perigee
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMaxInFlight(t *testing.T) {
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer ts.Close()
+
+	client := NewClient(Options{})
+	client.SetMaxInFlight(2)
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := client.Request("GET", ts.URL, Options{})
+			results <- err
+		}()
+	}
+	<-started
+	<-started
+
+	_, err := client.Request("GET", ts.URL+"/shed", Options{})
+	var overloaded *OverloadedError
+	if !errors.As(err, &overloaded) || overloaded.Limit != 2 || overloaded.InFlight != 2 || overloaded.Url != ts.URL+"/shed" {
+		t.Fatalf("Expected an OverloadedError; got %#v", err)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if client.InFlight() != 0 {
+		t.Fatalf("Expected nothing in flight; got %d", client.InFlight())
+	}
+	if _, err := client.Request("GET", ts.URL, Options{}); err != nil {
+		t.Fatalf("Expected requests to be accepted again; got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package perigee
+
+import "net/http"
+
+// Handler sends an HTTP request and returns the response, as the HTTP client does at the end of a middleware chain.
+type Handler func(req *http.Request) (*http.Response, error)
+
+// Middleware intercepts requests on their way to the server and responses on their way back,
+// so that cross-cutting concerns (injecting credentials, logging, metrics, rewriting headers) compose without changes to Request.
+// It may modify req, call next to pass it on (or not, to answer the request itself), and inspect or replace the response.
+// With Options.Retry, the chain runs once for every attempt.
+// See Options.Middleware and Client.Use.
+type Middleware func(req *http.Request, next Handler) (*http.Response, error)
+
+// chain wraps send in the given middleware, the first outermost.
+func chain(send Handler, middleware []Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		mw, next := middleware[i], send
+		send = func(req *http.Request) (*http.Response, error) {
+			return mw(req, next)
+		}
+	}
+	return send
+}
+
+// Use adds middleware to the client's defaults, after (and so nested inside) any already there.
+func (c *Client) Use(middleware ...Middleware) {
+	c.Update(func(defaults *Options) {
+		defaults.Middleware = append(defaults.Middleware, middleware...)
+	})
+}
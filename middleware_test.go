@@ -0,0 +1,87 @@
+package perigee
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var header string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Trace")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ts.Close()
+
+	var calls []string
+	tag := func(name string) Middleware {
+		return func(req *http.Request, next Handler) (*http.Response, error) {
+			calls = append(calls, name+" in")
+			req.Header.Set("X-Trace", name)
+			resp, err := next(req)
+			calls = append(calls, name+" out")
+			return resp, err
+		}
+	}
+
+	client := NewClient(Options{})
+	client.Use(tag("client"))
+	var result struct{ OK bool }
+	_, err := client.Request("GET", ts.URL, Options{Middleware: []Middleware{tag("call")}, Results: &result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"client in", "call in", "call out", "client out"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("Expected %v; got %v", want, calls)
+	}
+	if header != "call" || !result.OK {
+		t.Fatalf("Expected the per-call middleware to have the last word; got %q, %+v", header, result)
+	}
+}
+
+func TestMiddlewareShortCircuits(t *testing.T) {
+	canned := func(req *http.Request, next Handler) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"name":"cached"}`)),
+			Request:    req,
+		}, nil
+	}
+	var result struct{ Name string }
+	_, err := Request("GET", "http://unreachable.invalid/", Options{Middleware: []Middleware{canned}, Results: &result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "cached" {
+		t.Fatalf("Expected the middleware's response to be decoded; got %+v", result)
+	}
+}
+
+func TestMiddlewareRunsPerAttempt(t *testing.T) {
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	seen := 0
+	count := func(req *http.Request, next Handler) (*http.Response, error) {
+		seen++
+		return next(req)
+	}
+	_, err := Request("GET", ts.URL, Options{Middleware: []Middleware{count}, Retry: &RetryPolicy{MaxAttempts: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != 3 {
+		t.Fatalf("Expected the middleware to see all 3 attempts; saw %d", seen)
+	}
+}
@@ -0,0 +1,292 @@
+package perigee
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	return appendMsgPack(nil, generic)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	d := &msgpackDecoder{data: data}
+	generic, err := d.value(0)
+	if err != nil {
+		return err
+	}
+	if d.pos != len(data) {
+		return d.fail("trailing data")
+	}
+	return fromGeneric(generic, v)
+}
+
+// appendMsgPack appends the MessagePack encoding of a generic value (see toGeneric) to b.
+func appendMsgPack(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return appendMsgPackInt(b, n), nil
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return binary.BigEndian.AppendUint64(append(b, 0xcf), n), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f)), nil
+	case string:
+		b = appendMsgPackHead(b, len(v), 0xa0, 32, 0xd9)
+		return append(b, v...), nil
+	case []interface{}:
+		b = appendMsgPackHead(b, len(v), 0x90, 16, 0xdc-1)
+		var err error
+		for _, item := range v {
+			b, err = appendMsgPack(b, item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		b = appendMsgPackHead(b, len(v), 0x80, 16, 0xde-1)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, k := range keys {
+			b, _ = appendMsgPack(b, k)
+			b, err = appendMsgPack(b, v[k])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("perigee: cannot encode %T as MessagePack", v)
+}
+
+// appendMsgPackHead appends the header of a string, array or map of n elements.
+// Short ones use the fix form, whose tag is fix|n, below fixLimit elements;
+// longer ones use the 8-bit (strings only), 16-bit and 32-bit length forms whose tags follow base.
+func appendMsgPackHead(b []byte, n int, fix byte, fixLimit int, base byte) []byte {
+	switch {
+	case n < fixLimit:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint8 && fix == 0xa0:
+		return append(b, base, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, base+1), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, base+2), uint32(n))
+}
+
+// appendMsgPackInt appends an integer in its most compact MessagePack form.
+func appendMsgPackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= math.MaxInt8:
+		return append(b, byte(n))
+	case n < 0 && n >= -32:
+		return append(b, byte(n))
+	case n >= 0 && n <= math.MaxUint8:
+		return append(b, 0xcc, byte(n))
+	case n >= 0 && n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(n))
+	case n >= 0:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), uint64(n))
+	case n >= math.MinInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+}
+
+// msgpackDecoder decodes MessagePack into generic values.
+// Binary strings become []byte, and map keys other than strings are formatted as text.
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) fail(msg string) error {
+	return &CodecError{Format: "MessagePack", Offset: d.pos, Msg: msg}
+}
+
+// next consumes n bytes.
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, d.fail("unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint consumes a big-endian unsigned integer of the given width in bytes.
+func (d *msgpackDecoder) uint(width int) (uint64, error) {
+	b, err := d.next(width)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (d *msgpackDecoder) value(depth int) (interface{}, error) {
+	if depth > maxCodecDepth {
+		return nil, d.fail("nesting too deep")
+	}
+	tag, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	t := tag[0]
+	switch {
+	case t <= 0x7f:
+		return int64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t&0xe0 == 0xa0:
+		return d.str(int(t & 0x1f))
+	case t&0xf0 == 0x90:
+		return d.array(int(t&0x0f), depth)
+	case t&0xf0 == 0x80:
+		return d.object(int(t&0x0f), depth)
+	}
+
+	switch t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (t - 0xcc))
+		if err != nil || n > math.MaxInt64 {
+			return n, err
+		}
+		return int64(n), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		width := 1 << (t - 0xd0)
+		n, err := d.uint(width)
+		shift := uint(64 - 8*width)
+		return int64(n<<shift) >> shift, err
+	case 0xca:
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	}
+
+	var width int
+	switch t {
+	case 0xd9, 0xc4:
+		width = 1
+	case 0xda, 0xc5, 0xdc, 0xde:
+		width = 2
+	case 0xdb, 0xc6, 0xdd, 0xdf:
+		width = 4
+	default:
+		d.pos--
+		return nil, d.fail(fmt.Sprintf("unsupported type 0x%02x", t))
+	}
+	n, err := d.uint(width)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.data)) {
+		return nil, d.fail("unexpected end of data")
+	}
+	switch t {
+	case 0xd9, 0xda, 0xdb:
+		return d.str(int(n))
+	case 0xc4, 0xc5, 0xc6:
+		b, err := d.next(int(n))
+		return append([]byte(nil), b...), err
+	case 0xdc, 0xdd:
+		return d.array(int(n), depth)
+	}
+	return d.object(int(n), depth)
+}
+
+func (d *msgpackDecoder) str(n int) (interface{}, error) {
+	b, err := d.next(n)
+	return string(b), err
+}
+
+func (d *msgpackDecoder) array(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, d.fail("unexpected end of data")
+	}
+	items := make([]interface{}, n)
+	for i := range items {
+		item, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func (d *msgpackDecoder) object(n int, depth int) (interface{}, error) {
+	if n > len(d.data)-d.pos {
+		return nil, d.fail("unexpected end of data")
+	}
+	object := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		key, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		object[mapKey(key)] = value
+	}
+	return object, nil
+}
+
+// mapKey formats a decoded map key as the string JSON objects require.
+func mapKey(key interface{}) string {
+	switch key := key.(type) {
+	case string:
+		return key
+	case []byte:
+		return string(key)
+	}
+	return fmt.Sprint(key)
+}
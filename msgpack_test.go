@@ -0,0 +1,73 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMsgPackEncoding(t *testing.T) {
+	for _, c := range []struct {
+		in   interface{}
+		want string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{127, "7f"},
+		{-32, "e0"},
+		{200, "ccc8"},
+		{-129, "d1ff7f"},
+		{uint64(1) << 63, "cf8000000000000000"},
+		{1.5, "cb3ff8000000000000"},
+		{"abc", "a3616263"},
+		{[]int{1, 2}, "920102"},
+		{map[string]bool{"b": false, "a": true}, "82a161c3a162c2"},
+	} {
+		got, err := MsgPackCodec.Marshal(c.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(got) != c.want {
+			t.Fatalf("Expected %v to encode as %s; got %x", c.in, c.want, got)
+		}
+	}
+
+	long, _ := MsgPackCodec.Marshal(string(bytes.Repeat([]byte("x"), 40)))
+	if long[0] != 0xd9 || long[1] != 40 {
+		t.Fatalf("Expected a str8 header; got %x", long[:2])
+	}
+}
+
+func TestMsgPackDecoding(t *testing.T) {
+	// {"id": 1, 2: bin(ff), "f": float32(0.5), "n": int64(-2)}
+	data, _ := hex.DecodeString("84a2696401" + "02c401ff" + "a166ca3f000000" + "a16ed3fffffffffffffffe")
+	var out map[string]interface{}
+	err := MsgPackCodec.Unmarshal(data, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"id": 1.0, "2": "/w==", "f": 0.5, "n": -2.0}
+	if !reflect.DeepEqual(out, want) {
+		t.Fatalf("Expected %v; got %v", want, out)
+	}
+
+	var blob struct {
+		Data []byte `json:"data"`
+	}
+	data, _ = hex.DecodeString("81a464617461c403010203")
+	err = MsgPackCodec.Unmarshal(data, &blob)
+	if err != nil || !bytes.Equal(blob.Data, []byte{1, 2, 3}) {
+		t.Fatalf("Expected a binary string to decode into []byte; got %v, %v", blob.Data, err)
+	}
+
+	for _, bad := range []string{"", "a5616263", "dc0010", "c1", "0101", "ddffffffff"} {
+		data, _ := hex.DecodeString(bad)
+		var v interface{}
+		var codecErr *CodecError
+		if err := MsgPackCodec.Unmarshal(data, &v); !errors.As(err, &codecErr) {
+			t.Fatalf("Expected a CodecError for %q; got %v", bad, err)
+		}
+	}
+}
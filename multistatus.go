@@ -0,0 +1,143 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errMultiStatusEnvelope is returned when a 207 body holds no list of per-item results.
+var errMultiStatusEnvelope = errors.New("perigee: no list of item results in the multi-status body")
+
+// multiStatusLists names the fields under which batch endpoints commonly list their per-item results.
+var multiStatusLists = []string{"responses", "results", "items", "data"}
+
+// The MultiStatusItemError structure is returned when an item of a multi-status body carries no usable status code.
+type MultiStatusItemError struct {
+	Index int
+}
+
+func (err *MultiStatusItemError) Error() string {
+	return fmt.Sprintf("Item %d of the multi-status body has no status code", err.Index)
+}
+
+// MultiStatusItem is the outcome of one item of a batch request, as reported in a 207 (Multi-Status) response.
+// Index gives the item's position in the response, from 0, and ID its "id" field, if it has one.
+// Body holds the item's whole entry, for Decode.
+type MultiStatusItem struct {
+	Index  int
+	Status int
+	ID     string
+	Body   json.RawMessage
+}
+
+// OK reports whether the item succeeded, i.e., its status code is 2xx.
+func (item MultiStatusItem) OK() bool {
+	return item.Status >= 200 && item.Status <= 299
+}
+
+// Decode unmarshals the item's entry into v.
+func (item MultiStatusItem) Decode(v interface{}) error {
+	return json.Unmarshal(item.Body, v)
+}
+
+// MultiStatus sorts the items of a 207 (Multi-Status) response into those which succeeded and those which failed,
+// each in the order the server listed them.
+type MultiStatus struct {
+	Succeeded []MultiStatusItem
+	Failed    []MultiStatusItem
+}
+
+// OK reports whether every item succeeded.
+func (m *MultiStatus) OK() bool {
+	return len(m.Failed) == 0
+}
+
+// ParseMultiStatus decodes the JSON body of a 207 (Multi-Status) response.
+// The body may be a list of item results, or an object listing them under "responses", "results", "items", or "data".
+// Each item's code is taken from its "status", "statusCode", or "code" field,
+// which may be a number or a string such as "404" or "HTTP/1.1 404 Not Found".
+func ParseMultiStatus(data []byte) (*MultiStatus, error) {
+	var entries []json.RawMessage
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		err := json.Unmarshal(data, &entries)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var envelope map[string]json.RawMessage
+		err := json.Unmarshal(data, &envelope)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, name := range multiStatusLists {
+			if raw, ok := envelope[name]; ok && json.Unmarshal(raw, &entries) == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errMultiStatusEnvelope
+		}
+	}
+
+	m := &MultiStatus{}
+	for i, raw := range entries {
+		var fields map[string]json.RawMessage
+		err := json.Unmarshal(raw, &fields)
+		if err != nil {
+			return nil, err
+		}
+		item := MultiStatusItem{Index: i, ID: jsonScalar(fields["id"]), Body: raw}
+		for _, name := range []string{"status", "statusCode", "code"} {
+			if code, ok := statusCode(jsonScalar(fields[name])); ok {
+				item.Status = code
+				break
+			}
+		}
+		if item.Status == 0 {
+			return nil, &MultiStatusItemError{Index: i}
+		}
+		if item.OK() {
+			m.Succeeded = append(m.Succeeded, item)
+		} else {
+			m.Failed = append(m.Failed, item)
+		}
+	}
+	return m, nil
+}
+
+// MultiStatus decodes the body of a 207 (Multi-Status) response; see ParseMultiStatus.
+// The body must have been read, by giving Options.Results or Options.ResponseBuffer,
+// and OkCodes must admit 207 if given.
+func (r *Response) MultiStatus() (*MultiStatus, error) {
+	return ParseMultiStatus(r.JsonResult)
+}
+
+// jsonScalar returns the text of a JSON string or number, or "" for anything else.
+func jsonScalar(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var n json.Number
+	if json.Unmarshal(raw, &n) == nil {
+		return n.String()
+	}
+	return ""
+}
+
+// statusCode extracts a status code from text such as "404" or "HTTP/1.1 404 Not Found", as WebDAV writes them.
+func statusCode(text string) (int, bool) {
+	for _, word := range strings.Fields(text) {
+		if code, err := strconv.Atoi(word); err == nil && code >= 100 && code <= 599 {
+			return code, true
+		}
+	}
+	return 0, false
+}
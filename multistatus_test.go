@@ -0,0 +1,66 @@
+package perigee
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseMultiStatus(t *testing.T) {
+	for _, body := range []string{
+		`[{"id":"a","status":201},{"id":"b","status":"409"},{"id":3,"status":"HTTP/1.1 200 OK"}]`,
+		`{"responses":[{"id":"a","code":201},{"id":"b","statusCode":409,"error":"conflict"},{"id":3,"status":200}]}`,
+	} {
+		m, err := ParseMultiStatus([]byte(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.OK() || len(m.Succeeded) != 2 || len(m.Failed) != 1 {
+			t.Fatalf("Expected two successes and one failure from %s; got %+v", body, m)
+		}
+		if m.Succeeded[0].ID != "a" || m.Succeeded[1].ID != "3" || m.Succeeded[1].Index != 2 {
+			t.Fatalf("Expected items in order with their ids; got %+v", m.Succeeded)
+		}
+		if failed := m.Failed[0]; failed.ID != "b" || failed.Status != 409 || failed.Index != 1 {
+			t.Fatalf("Unexpected failure %+v", failed)
+		}
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	m, _ := ParseMultiStatus([]byte(`{"results":[{"status":500,"error":"boom"}]}`))
+	if err := m.Failed[0].Decode(&failure); err != nil || failure.Error != "boom" {
+		t.Fatalf("Expected the item to decode; got %v, %+v", err, failure)
+	}
+
+	if _, err := ParseMultiStatus([]byte(`{"total":2}`)); err != errMultiStatusEnvelope {
+		t.Fatalf("Expected errMultiStatusEnvelope; got %v", err)
+	}
+	var itemErr *MultiStatusItemError
+	if _, err := ParseMultiStatus([]byte(`[{"status":200},{"id":"x"}]`)); !errors.As(err, &itemErr) || itemErr.Index != 1 {
+		t.Fatalf("Expected a MultiStatusItemError for item 1; got %v", err)
+	}
+}
+
+func TestResponseMultiStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"items":[{"id":"1","status":200},{"id":"2","status":404}]}`))
+	}))
+	defer ts.Close()
+
+	resp, err := Request("POST", ts.URL, Options{ResponseBuffer: &bytes.Buffer{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := resp.MultiStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Succeeded) != 1 || len(m.Failed) != 1 || m.Failed[0].ID != "2" {
+		t.Fatalf("Unexpected result %+v", m)
+	}
+}
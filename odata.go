@@ -0,0 +1,161 @@
+package perigee
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ODataQuery builds the system query options of an OData request ($filter, $select, $orderby, and so on),
+// escaping them correctly, for services offering OData-flavored REST interfaces.
+// Zero fields are left out; Top and Skip are sent only when positive.
+//
+//	q := ODataQuery{
+//		Filter:  ODataField("Price").Lt(20).And(ODataField("Name").StartsWith("Widget")),
+//		Select:  []string{"Name", "Price"},
+//		OrderBy: []string{"Price desc"},
+//		Top:     10,
+//	}
+//	perigee.Request("GET", q.URL(base+"/Products"), opts)
+type ODataQuery struct {
+	Filter  ODataExpr
+	Select  []string
+	Expand  []string
+	OrderBy []string
+	Top     int
+	Skip    int
+	Count   bool
+}
+
+// Encode renders the query as a query string, without a leading "?".
+// The dollar signs of the option names are left unescaped, since some services require them so.
+func (q ODataQuery) Encode() string {
+	var parts []string
+	add := func(name, value string) {
+		parts = append(parts, name+"="+strings.ReplaceAll(url.QueryEscape(value), "+", "%20"))
+	}
+	if q.Filter != "" {
+		add("$filter", string(q.Filter))
+	}
+	if len(q.Select) > 0 {
+		add("$select", strings.Join(q.Select, ","))
+	}
+	if len(q.Expand) > 0 {
+		add("$expand", strings.Join(q.Expand, ","))
+	}
+	if len(q.OrderBy) > 0 {
+		add("$orderby", strings.Join(q.OrderBy, ","))
+	}
+	if q.Top > 0 {
+		add("$top", strconv.Itoa(q.Top))
+	}
+	if q.Skip > 0 {
+		add("$skip", strconv.Itoa(q.Skip))
+	}
+	if q.Count {
+		add("$count", "true")
+	}
+	return strings.Join(parts, "&")
+}
+
+// URL appends the query to a URL, which may already carry a query string of its own.
+func (q ODataQuery) URL(base string) string {
+	query := q.Encode()
+	switch {
+	case query == "":
+		return base
+	case strings.Contains(base, "?"):
+		return base + "&" + query
+	}
+	return base + "?" + query
+}
+
+// ODataExpr is a boolean expression for ODataQuery.Filter, built from ODataField comparisons.
+type ODataExpr string
+
+// And combines expressions, requiring all of them to hold.
+func (e ODataExpr) And(others ...ODataExpr) ODataExpr {
+	return e.join("and", others)
+}
+
+// Or combines expressions, requiring any of them to hold.
+func (e ODataExpr) Or(others ...ODataExpr) ODataExpr {
+	return e.join("or", others)
+}
+
+func (e ODataExpr) join(op string, others []ODataExpr) ODataExpr {
+	terms := []string{"(" + string(e) + ")"}
+	for _, o := range others {
+		terms = append(terms, "("+string(o)+")")
+	}
+	return ODataExpr(strings.Join(terms, " "+op+" "))
+}
+
+// ODataNot negates an expression.
+func ODataNot(e ODataExpr) ODataExpr {
+	return ODataExpr("not (" + string(e) + ")")
+}
+
+// ODataField names a property in a filter expression; its methods compare it with literal values.
+// Values are rendered as OData literals: strings are quoted, with embedded quotes doubled;
+// time.Time becomes a DateTimeOffset; nil becomes null; numbers and booleans appear as they are.
+type ODataField string
+
+// Eq, Ne, Gt, Ge, Lt, and Le compare the property with a value.
+func (f ODataField) Eq(v interface{}) ODataExpr { return f.compare("eq", v) }
+func (f ODataField) Ne(v interface{}) ODataExpr { return f.compare("ne", v) }
+func (f ODataField) Gt(v interface{}) ODataExpr { return f.compare("gt", v) }
+func (f ODataField) Ge(v interface{}) ODataExpr { return f.compare("ge", v) }
+func (f ODataField) Lt(v interface{}) ODataExpr { return f.compare("lt", v) }
+func (f ODataField) Le(v interface{}) ODataExpr { return f.compare("le", v) }
+
+// In requires the property to equal one of the values.
+func (f ODataField) In(values ...interface{}) ODataExpr {
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i] = odataLiteral(v)
+	}
+	return ODataExpr(string(f) + " in (" + strings.Join(literals, ",") + ")")
+}
+
+// Contains requires the string property to contain s.
+func (f ODataField) Contains(s string) ODataExpr { return f.call("contains", s) }
+
+// StartsWith requires the string property to start with s.
+func (f ODataField) StartsWith(s string) ODataExpr { return f.call("startswith", s) }
+
+// EndsWith requires the string property to end with s.
+func (f ODataField) EndsWith(s string) ODataExpr { return f.call("endswith", s) }
+
+func (f ODataField) compare(op string, v interface{}) ODataExpr {
+	return ODataExpr(string(f) + " " + op + " " + odataLiteral(v))
+}
+
+func (f ODataField) call(fn, s string) ODataExpr {
+	return ODataExpr(fn + "(" + string(f) + "," + odataLiteral(s) + ")")
+}
+
+// odataLiteral renders a value as an OData literal.
+func odataLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case fmt.Stringer:
+		return odataLiteral(v.String())
+	}
+	return odataLiteral(fmt.Sprint(v))
+}
@@ -0,0 +1,59 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestODataFilter(t *testing.T) {
+	name, price := ODataField("Name"), ODataField("Price")
+	for _, tc := range []struct {
+		expr ODataExpr
+		want string
+	}{
+		{name.Eq("O'Brien"), `Name eq 'O''Brien'`},
+		{price.Lt(20.5).And(name.StartsWith("Widget")), `(Price lt 20.5) and (startswith(Name,'Widget'))`},
+		{ODataNot(name.Eq(nil)).Or(price.Ge(3)), `(not (Name eq null)) or (Price ge 3)`},
+		{ODataField("Created").Gt(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)), `Created gt 2024-01-02T03:04:05Z`},
+		{ODataField("Status").In("Open", "Pending"), `Status in ('Open','Pending')`},
+		{ODataField("Active").Ne(false), `Active ne false`},
+	} {
+		if string(tc.expr) != tc.want {
+			t.Fatalf("Expected %s; got %s", tc.want, tc.expr)
+		}
+	}
+}
+
+func TestODataQuery(t *testing.T) {
+	q := ODataQuery{
+		Filter:  ODataField("Name").Eq("A & B"),
+		Select:  []string{"Name", "Price"},
+		OrderBy: []string{"Price desc"},
+		Top:     10,
+		Skip:    20,
+		Count:   true,
+	}
+	want := "$filter=Name%20eq%20%27A%20%26%20B%27&$select=Name%2CPrice&$orderby=Price%20desc&$top=10&$skip=20&$count=true"
+	if got := q.Encode(); got != want {
+		t.Fatalf("Expected %s; got %s", want, got)
+	}
+	if got := (ODataQuery{Top: 1}).URL("http://x/Products?api-version=2"); got != "http://x/Products?api-version=2&$top=1" {
+		t.Fatalf("Unexpected URL %s", got)
+	}
+	if got := (ODataQuery{}).URL("http://x/Products"); got != "http://x/Products" {
+		t.Fatalf("Expected an empty query to leave the URL alone; got %s", got)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("$filter") != "Name eq 'A & B'" || q.Get("$select") != "Name,Price" || q.Get("$orderby") != "Price desc" {
+			w.WriteHeader(400)
+		}
+	}))
+	defer ts.Close()
+	if _, err := Request("GET", q.URL(ts.URL), Options{OkCodes: []int{200}}); err != nil {
+		t.Fatalf("Expected the server to decode the options; got %v", err)
+	}
+}
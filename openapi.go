@@ -0,0 +1,472 @@
+package perigee
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RequestValidator checks an outgoing request before it is sent.
+// The body parameter holds the marshaled JSON request body, if any; it is nil for bodiless or non-JSON requests.
+// Any error returned aborts the request and propagates back to the caller.
+type RequestValidator interface {
+	ValidateRequest(req *http.Request, body []byte) error
+}
+
+// The SpecViolationError structure represents a request which does not conform to the API specification it was validated against.
+// Reason explains precisely which part of the request failed to match.
+type SpecViolationError struct {
+	Method string
+	Url    string
+	Reason string
+}
+
+func (err *SpecViolationError) Error() string {
+	return fmt.Sprintf("Request %s %s does not conform to the API specification: %s", err.Method, err.Url, err.Reason)
+}
+
+// OpenAPISpec represents the subset of an OpenAPI 3 document needed to validate requests.
+// Use LoadOpenAPISpec to read one from its JSON representation.
+type OpenAPISpec struct {
+	OpenAPI    string                  `json:"openapi"`
+	Servers    []OpenAPIServer         `json:"servers"`
+	Paths      map[string]*OpenAPIPath `json:"paths"`
+	Components struct {
+		Schemas map[string]*OpenAPISchema `json:"schemas"`
+	} `json:"components"`
+}
+
+// OpenAPIServer describes a base URL against which the spec's paths are resolved.
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// OpenAPIPath describes the operations available on a single path template.
+// Parameters listed here apply to every operation on the path.
+type OpenAPIPath struct {
+	Parameters []OpenAPIParameter `json:"parameters"`
+	Get        *OpenAPIOperation  `json:"get"`
+	Put        *OpenAPIOperation  `json:"put"`
+	Post       *OpenAPIOperation  `json:"post"`
+	Delete     *OpenAPIOperation  `json:"delete"`
+	Options    *OpenAPIOperation  `json:"options"`
+	Head       *OpenAPIOperation  `json:"head"`
+	Patch      *OpenAPIOperation  `json:"patch"`
+	Trace      *OpenAPIOperation  `json:"trace"`
+}
+
+// Operation returns the operation registered for the given HTTP method, or nil if none exists.
+func (p *OpenAPIPath) Operation(method string) *OpenAPIOperation {
+	switch strings.ToUpper(method) {
+	case "GET":
+		return p.Get
+	case "PUT":
+		return p.Put
+	case "POST":
+		return p.Post
+	case "DELETE":
+		return p.Delete
+	case "OPTIONS":
+		return p.Options
+	case "HEAD":
+		return p.Head
+	case "PATCH":
+		return p.Patch
+	case "TRACE":
+		return p.Trace
+	}
+	return nil
+}
+
+// OpenAPIOperation describes a single API call.
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary"`
+	Parameters  []OpenAPIParameter          `json:"parameters"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter describes a path, query, or header parameter.
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIRequestBody describes the body an operation accepts, keyed by media type.
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse describes one of the responses an operation may produce.
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIMediaType associates a schema with a media type.
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema describes the shape of a JSON value.
+// Only the keywords needed for structural validation are supported.
+type OpenAPISchema struct {
+	Ref        string                    `json:"$ref"`
+	Type       string                    `json:"type"`
+	Format     string                    `json:"format"`
+	Properties map[string]*OpenAPISchema `json:"properties"`
+	Required   []string                  `json:"required"`
+	Items      *OpenAPISchema            `json:"items"`
+	Enum       []interface{}             `json:"enum"`
+	Nullable   bool                      `json:"nullable"`
+}
+
+// LoadOpenAPISpec reads an OpenAPI 3 document in JSON form.
+func LoadOpenAPISpec(r io.Reader) (*OpenAPISpec, error) {
+	var spec OpenAPISpec
+	err := json.NewDecoder(r).Decode(&spec)
+	if err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// resolve follows a local $ref (e.g., "#/components/schemas/Server") to the schema it names.
+func (spec *OpenAPISpec) resolve(s *OpenAPISchema) (*OpenAPISchema, error) {
+	for seen := 0; s != nil && s.Ref != ""; seen++ {
+		if seen > 32 {
+			return nil, fmt.Errorf("reference cycle detected at %s", s.Ref)
+		}
+		const prefix = "#/components/schemas/"
+		if !strings.HasPrefix(s.Ref, prefix) {
+			return nil, fmt.Errorf("unsupported schema reference %s", s.Ref)
+		}
+		target, ok := spec.Components.Schemas[strings.TrimPrefix(s.Ref, prefix)]
+		if !ok {
+			return nil, fmt.Errorf("unresolved schema reference %s", s.Ref)
+		}
+		s = target
+	}
+	return s, nil
+}
+
+// basePaths returns the path prefixes declared by the spec's servers.
+func (spec *OpenAPISpec) basePaths() []string {
+	var bases []string
+	for _, server := range spec.Servers {
+		u, err := url.Parse(server.URL)
+		if err != nil {
+			continue
+		}
+		bases = append(bases, strings.TrimSuffix(u.Path, "/"))
+	}
+	if len(bases) == 0 {
+		bases = append(bases, "")
+	}
+	return bases
+}
+
+// FindPath locates the path template matching the given request path.
+// Literal segments are preferred over templated ones when several templates match.
+// The template and the values of its path parameters are returned; ok is false when nothing matches.
+func (spec *OpenAPISpec) FindPath(requestPath string) (template string, params map[string]string, ok bool) {
+	bestLiterals := -1
+	for _, base := range spec.basePaths() {
+		if !strings.HasPrefix(requestPath, base) {
+			continue
+		}
+		rel := strings.TrimPrefix(requestPath, base)
+		if rel == "" {
+			rel = "/"
+		}
+		for candidate := range spec.Paths {
+			values, literals, matched := matchTemplate(candidate, rel)
+			if !matched {
+				continue
+			}
+			if literals > bestLiterals || (literals == bestLiterals && candidate < template) {
+				template, params, bestLiterals = candidate, values, literals
+			}
+		}
+	}
+	return template, params, bestLiterals >= 0
+}
+
+// matchTemplate compares a path template such as /servers/{id} against a concrete path.
+func matchTemplate(template, path string) (map[string]string, int, bool) {
+	want := strings.Split(strings.Trim(template, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return nil, 0, false
+	}
+	values := make(map[string]string)
+	literals := 0
+	for i, segment := range want {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if got[i] == "" {
+				return nil, 0, false
+			}
+			value, err := url.PathUnescape(got[i])
+			if err != nil {
+				value = got[i]
+			}
+			values[segment[1:len(segment)-1]] = value
+			continue
+		}
+		if segment != got[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+	return values, literals, true
+}
+
+// OpenAPIValidator validates outgoing requests against an OpenAPI specification.
+// It checks that the path and method are documented, that required parameters are present and well-typed,
+// and that JSON request bodies conform to the documented schema.
+type OpenAPIValidator struct {
+	Spec *OpenAPISpec
+}
+
+// NewOpenAPIValidator creates a validator for the given specification.
+func NewOpenAPIValidator(spec *OpenAPISpec) *OpenAPIValidator {
+	return &OpenAPIValidator{Spec: spec}
+}
+
+// ValidateRequest implements the RequestValidator interface.
+// Violations are reported as *SpecViolationError.
+// Only JSON bodies are checked against the schema; bodies sent in other formats (see Options.Codec) are let through.
+func (v *OpenAPIValidator) ValidateRequest(req *http.Request, body []byte) error {
+	violation := func(format string, args ...interface{}) error {
+		return &SpecViolationError{
+			Method: req.Method,
+			Url:    req.URL.String(),
+			Reason: fmt.Sprintf(format, args...),
+		}
+	}
+
+	template, pathValues, ok := v.Spec.FindPath(req.URL.Path)
+	if !ok {
+		return violation("path %s is not described by the specification", req.URL.Path)
+	}
+	item := v.Spec.Paths[template]
+	op := item.Operation(req.Method)
+	if op == nil {
+		return violation("method %s is not allowed on %s", req.Method, template)
+	}
+
+	query := req.URL.Query()
+	for _, p := range item.ParametersFor(op) {
+		var value string
+		var present bool
+		switch p.In {
+		case "path":
+			value, present = pathValues[p.Name]
+		case "query":
+			_, present = query[p.Name]
+			value = query.Get(p.Name)
+		case "header":
+			present = req.Header.Get(p.Name) != ""
+			value = req.Header.Get(p.Name)
+		default:
+			continue
+		}
+		if !present {
+			if p.Required || p.In == "path" {
+				return violation("missing required %s parameter %q", p.In, p.Name)
+			}
+			continue
+		}
+		schema, err := v.Spec.resolve(p.Schema)
+		if err != nil {
+			return violation("%s", err)
+		}
+		if err := checkParameter(schema, value); err != nil {
+			return violation("%s parameter %q %s", p.In, p.Name, err)
+		}
+	}
+
+	if op.RequestBody == nil {
+		if body != nil {
+			return violation("operation %s %s does not accept a request body", req.Method, template)
+		}
+		return nil
+	}
+	if body == nil {
+		if op.RequestBody.Required && req.Body == nil {
+			return violation("missing required request body")
+		}
+		return nil
+	}
+	media, ok := op.RequestBody.Content["application/json"]
+	if !ok || media.Schema == nil || !decodesAsJSON(mediaType(req.Header.Get("Content-Type"))) {
+		return nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return violation("request body is not valid JSON: %s", err)
+	}
+	if err := v.checkValue(media.Schema, doc, "body"); err != nil {
+		return violation("%s", err)
+	}
+	return nil
+}
+
+// ParametersFor combines the path-level parameters with those of the given operation.
+// Operation-level parameters take precedence over path-level parameters of the same name and location.
+func (p *OpenAPIPath) ParametersFor(op *OpenAPIOperation) []OpenAPIParameter {
+	merged := make([]OpenAPIParameter, 0, len(p.Parameters)+len(op.Parameters))
+	merged = append(merged, op.Parameters...)
+	for _, param := range p.Parameters {
+		overridden := false
+		for _, q := range op.Parameters {
+			if param.Name == q.Name && param.In == q.In {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, param)
+		}
+	}
+	return merged
+}
+
+// checkParameter verifies that a textual parameter value is compatible with its schema.
+func checkParameter(schema *OpenAPISchema, value string) error {
+	if schema == nil {
+		return nil
+	}
+	switch schema.Type {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("must be an integer, got %q", value)
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("must be a number, got %q", value)
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("must be a boolean, got %q", value)
+		}
+	}
+	if len(schema.Enum) > 0 {
+		for _, e := range schema.Enum {
+			if fmt.Sprint(e) == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %v, got %q", schema.Enum, value)
+	}
+	return nil
+}
+
+// checkValue verifies a decoded JSON value against a schema, reporting the location of the first mismatch.
+func (v *OpenAPIValidator) checkValue(schema *OpenAPISchema, value interface{}, location string) error {
+	schema, err := v.Spec.resolve(schema)
+	if err != nil || schema == nil {
+		return err
+	}
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: expected %s, got null", location, schema.Type)
+	}
+	if len(schema.Enum) > 0 {
+		found := false
+		for _, e := range schema.Enum {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value %v is not one of %v", location, value, schema.Enum)
+		}
+	}
+	switch schema.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %s", location, jsonTypeName(value))
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", location, name)
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := schema.Properties[name]; ok {
+				if err := v.checkValue(prop, obj[name], location+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %s", location, jsonTypeName(value))
+		}
+		for i, elem := range arr {
+			if err := v.checkValue(schema.Items, elem, fmt.Sprintf("%s[%d]", location, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected string, got %s", location, jsonTypeName(value))
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s: expected integer, got %s", location, jsonTypeName(value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: expected number, got %s", location, jsonTypeName(value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %s", location, jsonTypeName(value))
+		}
+	}
+	return nil
+}
+
+// jsonTypeName names the JSON type of a value produced by encoding/json.
+func jsonTypeName(value interface{}) string {
+	switch n := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
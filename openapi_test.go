@@ -0,0 +1,186 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSpec = `{
+	"openapi": "3.0.0",
+	"servers": [{"url": "https://compute.example.com/v2"}],
+	"paths": {
+		"/servers": {
+			"get": {
+				"operationId": "listServers",
+				"parameters": [
+					{"name": "limit", "in": "query", "schema": {"type": "integer"}},
+					{"name": "status", "in": "query", "schema": {"type": "string", "enum": ["ACTIVE", "ERROR"]}}
+				]
+			},
+			"post": {
+				"operationId": "createServer",
+				"requestBody": {
+					"required": true,
+					"content": {"application/json": {"schema": {"$ref": "#/components/schemas/CreateServer"}}}
+				}
+			}
+		},
+		"/servers/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+			"get": {"operationId": "getServer"},
+			"delete": {
+				"operationId": "deleteServer",
+				"parameters": [{"name": "X-Auth-Token", "in": "header", "required": true}]
+			}
+		},
+		"/servers/detail": {
+			"get": {"operationId": "listServersDetail"}
+		}
+	},
+	"components": {
+		"schemas": {
+			"CreateServer": {
+				"type": "object",
+				"required": ["server"],
+				"properties": {
+					"server": {
+						"type": "object",
+						"required": ["name", "flavorRef"],
+						"properties": {
+							"name": {"type": "string"},
+							"flavorRef": {"type": "string"},
+							"min_count": {"type": "integer"},
+							"networks": {"type": "array", "items": {"type": "string"}}
+						}
+					}
+				}
+			}
+		}
+	}
+}`
+
+func loadTestSpec(t *testing.T) *OpenAPIValidator {
+	spec, err := LoadOpenAPISpec(strings.NewReader(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewOpenAPIValidator(spec)
+}
+
+func TestFindPathPrefersLiterals(t *testing.T) {
+	v := loadTestSpec(t)
+
+	template, params, ok := v.Spec.FindPath("/v2/servers/detail")
+	if !ok || template != "/servers/detail" {
+		t.Fatalf("Expected /servers/detail; got %q (ok=%v)", template, ok)
+	}
+
+	template, params, ok = v.Spec.FindPath("/v2/servers/abc")
+	if !ok || template != "/servers/{id}" {
+		t.Fatalf("Expected /servers/{id}; got %q (ok=%v)", template, ok)
+	}
+	if params["id"] != "abc" {
+		t.Fatalf("Expected id parameter abc; got %q", params["id"])
+	}
+
+	if _, _, ok = v.Spec.FindPath("/v2/flavors"); ok {
+		t.Fatal("Expected /v2/flavors not to match any path")
+	}
+}
+
+func TestOpenAPIValidatorRequests(t *testing.T) {
+	v := loadTestSpec(t)
+
+	tests := []struct {
+		method string
+		url    string
+		header map[string]string
+		body   string
+		reason string
+	}{
+		{"GET", "https://compute.example.com/v2/servers?limit=10", nil, "", ""},
+		{"GET", "https://compute.example.com/v2/servers?limit=ten", nil, "", `query parameter "limit" must be an integer, got "ten"`},
+		{"GET", "https://compute.example.com/v2/servers?status=BUILD", nil, "", `query parameter "status" must be one of [ACTIVE ERROR], got "BUILD"`},
+		{"GET", "https://compute.example.com/v2/images", nil, "", "path /v2/images is not described by the specification"},
+		{"PUT", "https://compute.example.com/v2/servers/abc", nil, "", "method PUT is not allowed on /servers/{id}"},
+		{"DELETE", "https://compute.example.com/v2/servers/abc", nil, "", `missing required header parameter "X-Auth-Token"`},
+		{"DELETE", "https://compute.example.com/v2/servers/abc", map[string]string{"X-Auth-Token": "t"}, "", ""},
+		{"POST", "https://compute.example.com/v2/servers", nil, `{"server": {"name": "a", "flavorRef": "1"}}`, ""},
+		{"POST", "https://compute.example.com/v2/servers", nil, `{"server": {"name": "a"}}`, `body.server: missing required property "flavorRef"`},
+		{"POST", "https://compute.example.com/v2/servers", nil, `{"server": {"name": 5, "flavorRef": "1"}}`, "body.server.name: expected string, got integer"},
+		{"POST", "https://compute.example.com/v2/servers", nil, `{"server": {"name": "a", "flavorRef": "1", "min_count": 1.5}}`, "body.server.min_count: expected integer, got number"},
+		{"POST", "https://compute.example.com/v2/servers", nil, `{"server": {"name": "a", "flavorRef": "1", "networks": ["n", 2]}}`, "body.server.networks[1]: expected string, got integer"},
+		{"POST", "https://compute.example.com/v2/servers", map[string]string{"Content-Type": "application/msgpack"}, "\x81\xa6server\x80", ""},
+		{"GET", "https://compute.example.com/v2/servers/abc", nil, `{}`, "operation GET /servers/{id} does not accept a request body"},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, val := range test.header {
+			req.Header.Set(k, val)
+		}
+		var body []byte
+		if test.body != "" {
+			body = []byte(test.body)
+		}
+
+		err = v.ValidateRequest(req, body)
+		if test.reason == "" {
+			if err != nil {
+				t.Errorf("%s %s: expected no error; got %s", test.method, test.url, err)
+			}
+			continue
+		}
+		violation, ok := err.(*SpecViolationError)
+		if !ok {
+			t.Errorf("%s %s: expected *SpecViolationError; got %#v", test.method, test.url, err)
+			continue
+		}
+		if violation.Reason != test.reason {
+			t.Errorf("%s %s: expected reason %q; got %q", test.method, test.url, test.reason, violation.Reason)
+		}
+	}
+}
+
+func TestValidatorFailsFast(t *testing.T) {
+	var wasCalled bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wasCalled = true
+	})
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	spec, err := LoadOpenAPISpec(strings.NewReader(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.Servers = []OpenAPIServer{{URL: ts.URL + "/v2"}}
+	v := NewOpenAPIValidator(spec)
+
+	_, err = Request("POST", ts.URL+"/v2/servers", Options{
+		ReqBody:   map[string]interface{}{"server": map[string]string{"name": "a"}},
+		Validator: v,
+	})
+	if _, ok := err.(*SpecViolationError); !ok {
+		t.Fatalf("Expected a *SpecViolationError; got %#v", err)
+	}
+	if wasCalled {
+		t.Fatal("I expected the invalid request never to reach the server")
+	}
+
+	_, err = Request("POST", ts.URL+"/v2/servers", Options{
+		ReqBody:   map[string]interface{}{"server": map[string]string{"name": "a", "flavorRef": "1"}},
+		Validator: v,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !wasCalled {
+		t.Fatal("I expected the valid request to reach the server")
+	}
+}
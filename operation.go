@@ -0,0 +1,299 @@
+package perigee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultOperationInterval is the wait before the first poll of an operation, unless OperationOptions names another.
+const DefaultOperationInterval = time.Second
+
+// ErrNoOperationURL is returned by WaitForOperation when an accepted response says nothing of where to follow the operation.
+var ErrNoOperationURL = errors.New("perigee: response carries no operation URL to poll")
+
+// The OperationFailedError structure is returned when a polled operation reaches a failed terminal state.
+// Status holds the state the server reported (e.g., "failed"), and Response the final poll.
+//
+// Payload holds the operation's error as the server described it: the error (or errors) field of the final poll's body,
+// or the whole body if it has no such field.
+// Code and Message are lifted from the payload's code and message fields, where present.
+// Details holds the payload decoded into OperationOptions.ErrorResults, if given; it is left nil if the payload doesn't fit.
+type OperationFailedError struct {
+	Url      string
+	Status   string
+	Response *Response
+	Payload  json.RawMessage
+	Code     string
+	Message  string
+	Details  interface{}
+}
+
+func (err *OperationFailedError) Error() string {
+	msg := fmt.Sprintf("Operation at URL(%s) failed with status %q", err.Url, err.Status)
+	if err.Code != "" {
+		msg += " (" + err.Code + ")"
+	}
+	if err.Message != "" {
+		msg += ": " + err.Message
+	}
+	return msg
+}
+
+// newOperationFailedError extracts the error payload from the final poll of a failed operation.
+func newOperationFailedError(target, status string, poll *Response, details interface{}) error {
+	err := &OperationFailedError{Url: target, Status: status, Response: poll, Payload: json.RawMessage(poll.JsonResult)}
+	var body map[string]json.RawMessage
+	if json.Unmarshal(poll.JsonResult, &body) == nil {
+		for _, key := range []string{"error", "errors"} {
+			if payload, ok := body[key]; ok {
+				err.Payload = payload
+				break
+			}
+		}
+	}
+
+	var fields struct {
+		Code    interface{} `json:"code"`
+		Message string      `json:"message"`
+	}
+	var message string
+	if json.Unmarshal(err.Payload, &fields) == nil {
+		if fields.Code != nil {
+			err.Code = fmt.Sprint(fields.Code)
+		}
+		err.Message = fields.Message
+	} else if json.Unmarshal(err.Payload, &message) == nil {
+		err.Message = message
+	}
+
+	if details != nil && len(err.Payload) > 0 {
+		if json.Unmarshal(err.Payload, details) == nil {
+			err.Details = details
+		}
+	}
+	return err
+}
+
+// The OperationTimeoutError structure is returned when an operation is still pending once OperationOptions.Timeout has passed.
+// Response holds the last poll.
+type OperationTimeoutError struct {
+	Url      string
+	Waited   time.Duration
+	Response *Response
+}
+
+func (err *OperationTimeoutError) Error() string {
+	return fmt.Sprintf("Operation at URL(%s) still pending after %s", err.Url, err.Waited)
+}
+
+// OperationState classifies a poll of an asynchronous operation.
+type OperationState int
+
+const (
+	OperationPending   OperationState = iota // still running; poll again
+	OperationSucceeded                       // finished successfully
+	OperationFailed                          // finished unsuccessfully
+)
+
+// OperationStatusFunc inspects a poll of an asynchronous operation and reports its state,
+// along with the status as the server named it.
+type OperationStatusFunc func(poll *Response) (state OperationState, status string, err error)
+
+// OperationOptions configures WaitForOperation.
+//
+// Options applies to every poll; Results is ignored, the raw body of each poll being available through Response.JsonResult.
+// Options.Context, if set, bounds the whole wait, and cancels it at once when done.
+//
+// Status classifies each poll; if nil, DefaultOperationStatus is used.
+//
+// Interval is the wait before the first poll, DefaultOperationInterval if zero.
+// Later waits are computed by Backoff, up to MaxInterval, as with RetryPolicy; the default Backoff waits Interval every time.
+// A Retry-After header on a poll, given in seconds or as a date, takes precedence if it asks for a longer wait.
+//
+// Timeout, if set, bounds the whole wait; an operation still pending by then yields an OperationTimeoutError.
+//
+// Progress, if set, is called with every poll, e.g., to report the operation's progress to a user.
+//
+// Results, if set, receives the final poll of a successful operation, decoded according to its Content-Type as Request decodes Options.Results;
+// the final Response refers to it.
+// ResultsField, if set, names a field of the final poll's JSON body to decode instead, for APIs wrapping the operation's outcome (e.g., "result").
+//
+// ErrorResults, if set, receives the error payload of a failed operation; see OperationFailedError.
+type OperationOptions struct {
+	Options     Options
+	Status      OperationStatusFunc
+	Interval    time.Duration
+	MaxInterval time.Duration
+	Backoff     Backoff
+	Timeout     time.Duration
+	Progress    func(poll *Response)
+
+	Results      interface{}
+	ResultsField string
+	ErrorResults interface{}
+}
+
+// constantBackoff waits base every time.
+type constantBackoff struct{}
+
+func (constantBackoff) Delay(attempt int, base, max, previous time.Duration) time.Duration {
+	return base
+}
+
+// WaitForOperation follows an asynchronous operation, started by a request answered with 202 (Accepted), until it finishes.
+// It polls the operation URL named by the accepted response (see OperationURL) with GET requests,
+// returning the final poll once the operation succeeds, or an *OperationFailedError if it fails.
+func WaitForOperation(accepted *Response, opts OperationOptions) (*Response, error) {
+	target, ok := OperationURL(accepted)
+	if !ok {
+		return nil, ErrNoOperationURL
+	}
+	status := opts.Status
+	if status == nil {
+		status = DefaultOperationStatus
+	}
+	policy := &RetryPolicy{BaseDelay: opts.Interval, MaxDelay: opts.MaxInterval, Backoff: opts.Backoff}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultOperationInterval
+	}
+	if policy.Backoff == nil {
+		policy.Backoff = constantBackoff{}
+	}
+
+	start := time.Now()
+	var wait time.Duration
+	var poll *Response
+	latest := accepted
+	for attempt := 1; ; attempt++ {
+		// The accepted response may itself carry a Retry-After, advising when to poll first.
+		wait = policy.delay(attempt, wait, &latest.HttpResponse)
+		if opts.Timeout > 0 && time.Since(start)+wait > opts.Timeout {
+			return poll, &OperationTimeoutError{Url: target, Waited: time.Since(start), Response: poll}
+		}
+		if err := sleep(opts.Options.Context, wait); err != nil {
+			return poll, err
+		}
+
+		pollOpts := opts.Options
+		pollOpts.Results = new(json.RawMessage)
+		var err error
+		poll, err = Request("GET", target, pollOpts)
+		if err != nil {
+			return poll, err
+		}
+		latest = poll
+		if opts.Progress != nil {
+			opts.Progress(poll)
+		}
+		state, name, err := status(poll)
+		switch {
+		case err != nil:
+			return poll, err
+		case state == OperationSucceeded:
+			return poll, decodeOperationResults(poll, opts)
+		case state == OperationFailed:
+			return poll, newOperationFailedError(target, name, poll, opts.ErrorResults)
+		}
+	}
+}
+
+// decodeOperationResults decodes the final poll of a successful operation into OperationOptions.Results.
+func decodeOperationResults(poll *Response, opts OperationOptions) error {
+	if opts.Results == nil {
+		return nil
+	}
+	data := poll.JsonResult
+	if opts.ResultsField != "" {
+		var body map[string]json.RawMessage
+		err := json.Unmarshal(data, &body)
+		if err != nil {
+			return err
+		}
+		field, ok := body[opts.ResultsField]
+		if !ok {
+			return fmt.Errorf("operation result has no %q field", opts.ResultsField)
+		}
+		data = field
+	}
+	err := decoderFor(poll.ContentType)(data, opts.Results)
+	if err != nil {
+		return err
+	}
+	poll.Results = opts.Results
+	return nil
+}
+
+// operationURLKeys lists the body fields, in order of preference, which may name an operation URL.
+var operationURLKeys = []string{"operation", "operation_url", "operationUrl", "status_url", "statusUrl", "href"}
+
+// OperationURL finds where to follow the operation started by an accepted request.
+// It looks, in order, at the Operation-Location and Location response headers,
+// then at the operation, operation_url, operationUrl, status_url, statusUrl, and href fields of a JSON body.
+// Relative URLs are resolved against the URL of the request.
+func OperationURL(accepted *Response) (string, bool) {
+	if accepted == nil {
+		return "", false
+	}
+	header := accepted.HttpResponse.Header
+	candidate := header.Get("Operation-Location")
+	if candidate == "" {
+		candidate = header.Get("Location")
+	}
+	if candidate == "" && len(accepted.JsonResult) > 0 {
+		var body map[string]interface{}
+		if json.Unmarshal(accepted.JsonResult, &body) == nil {
+			for _, key := range operationURLKeys {
+				if s, ok := body[key].(string); ok && s != "" {
+					candidate = s
+					break
+				}
+			}
+		}
+	}
+	if candidate == "" {
+		return "", false
+	}
+	if req := accepted.HttpResponse.Request; req != nil && req.URL != nil {
+		ref, err := url.Parse(candidate)
+		if err != nil {
+			return "", false
+		}
+		candidate = req.URL.ResolveReference(ref).String()
+	}
+	return candidate, true
+}
+
+// operationStatusKeys lists the body fields, in order of preference, which may hold an operation's status.
+var operationStatusKeys = []string{"status", "state"}
+
+// DefaultOperationStatus classifies polls by the conventions most APIs follow.
+// If the JSON body has a status (or state) field, its value decides:
+// succeeded, success, successful, completed, complete, done, and active mean success;
+// failed, failure, error, errored, canceled, and cancelled mean failure; anything else means the operation is pending.
+// Otherwise, a 202 (Accepted) means pending, and any other response success.
+func DefaultOperationStatus(poll *Response) (OperationState, string, error) {
+	var body map[string]interface{}
+	if len(poll.JsonResult) > 0 && json.Unmarshal(poll.JsonResult, &body) == nil {
+		for _, key := range operationStatusKeys {
+			s, ok := body[key].(string)
+			if !ok {
+				continue
+			}
+			switch strings.ToLower(s) {
+			case "succeeded", "success", "successful", "completed", "complete", "done", "active":
+				return OperationSucceeded, s, nil
+			case "failed", "failure", "error", "errored", "canceled", "cancelled":
+				return OperationFailed, s, nil
+			}
+			return OperationPending, s, nil
+		}
+	}
+	if poll.StatusCode == 202 {
+		return OperationPending, "", nil
+	}
+	return OperationSucceeded, "", nil
+}
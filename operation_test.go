@@ -0,0 +1,208 @@
+package perigee
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// operationServer accepts a job at /jobs, reporting it at /operations/1, which stays pending for the given number of polls.
+func operationServer(pending int, final string) *httptest.Server {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/operations/1")
+		w.WriteHeader(202)
+	})
+	mux.HandleFunc("/operations/1", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := "running"
+		if polls > pending {
+			status = final
+		}
+		fmt.Fprintf(w, `{"status": %q, "progress": %d}`, status, polls)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestWaitForOperation(t *testing.T) {
+	ts := operationServer(2, "succeeded")
+	defer ts.Close()
+
+	accepted, err := Request("POST", ts.URL+"/jobs", Options{OkCodes: []int{202}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, ok := OperationURL(accepted); !ok || u != ts.URL+"/operations/1" {
+		t.Fatalf("Expected the Location header to be resolved; got %q", u)
+	}
+
+	polls := 0
+	final, err := WaitForOperation(accepted, OperationOptions{
+		Interval: time.Millisecond,
+		Progress: func(poll *Response) { polls++ },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polls != 3 || string(final.JsonResult) != `{"status": "succeeded", "progress": 3}` {
+		t.Fatalf("Expected success on the third poll; got %d polls ending with %s", polls, final.JsonResult)
+	}
+}
+
+func TestWaitForOperationFailure(t *testing.T) {
+	ts := operationServer(1, "failed")
+	defer ts.Close()
+
+	accepted, _ := Request("POST", ts.URL+"/jobs", Options{OkCodes: []int{202}})
+	_, err := WaitForOperation(accepted, OperationOptions{Interval: time.Millisecond})
+	e, ok := err.(*OperationFailedError)
+	if !ok || e.Status != "failed" {
+		t.Fatalf("Expected an OperationFailedError; got %#v", err)
+	}
+}
+
+func TestWaitForOperationDeadlines(t *testing.T) {
+	ts := operationServer(1000, "succeeded")
+	defer ts.Close()
+	accepted, _ := Request("POST", ts.URL+"/jobs", Options{OkCodes: []int{202}})
+
+	_, err := WaitForOperation(accepted, OperationOptions{Interval: 10 * time.Millisecond, Timeout: 50 * time.Millisecond})
+	if e, ok := err.(*OperationTimeoutError); !ok || e.Response == nil {
+		t.Fatalf("Expected an OperationTimeoutError carrying the last poll; got %#v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = WaitForOperation(accepted, OperationOptions{Interval: time.Hour, Options: Options{Context: ctx}})
+	if err != context.Canceled || time.Since(start) > time.Second {
+		t.Fatalf("Expected cancellation to end the wait at once; got %v", err)
+	}
+}
+
+func TestOperationURLFromBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(202)
+		w.Write([]byte(`{"operation_url": "ops/7"}`))
+	}))
+	defer ts.Close()
+
+	var body map[string]interface{}
+	accepted, err := Request("POST", ts.URL+"/v1/jobs", Options{Results: &body, OkCodes: []int{202}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, ok := OperationURL(accepted); !ok || u != ts.URL+"/v1/ops/7" {
+		t.Fatalf("Expected the body's operation URL to be resolved; got %q", u)
+	}
+
+	_, err = WaitForOperation(&Response{}, OperationOptions{})
+	if err != ErrNoOperationURL {
+		t.Fatalf("Expected ErrNoOperationURL; got %v", err)
+	}
+}
+
+func TestDefaultOperationStatus(t *testing.T) {
+	tests := []struct {
+		code  int
+		body  string
+		state OperationState
+	}{
+		{200, `{"status": "Completed"}`, OperationSucceeded},
+		{200, `{"state": "ERROR"}`, OperationFailed},
+		{200, `{"status": "queued"}`, OperationPending},
+		{202, ``, OperationPending},
+		{200, ``, OperationSucceeded},
+	}
+	for _, test := range tests {
+		state, _, _ := DefaultOperationStatus(&Response{StatusCode: test.code, JsonResult: []byte(test.body)})
+		if state != test.state {
+			t.Errorf("%d %s: expected state %d; got %d", test.code, test.body, test.state, state)
+		}
+	}
+}
+
+func TestWaitForOperationResults(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.Header().Set("Location", "/op")
+			w.WriteHeader(202)
+			return
+		}
+		w.Write([]byte(`{"status": "done", "result": {"id": "srv-1", "flavor": 2}}`))
+	}))
+	defer ts.Close()
+
+	accepted, _ := Request("POST", ts.URL, Options{OkCodes: []int{202}})
+	var server struct {
+		Id     string
+		Flavor int
+	}
+	final, err := WaitForOperation(accepted, OperationOptions{Interval: time.Millisecond, Results: &server, ResultsField: "result"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Id != "srv-1" || server.Flavor != 2 || final.Results != &server {
+		t.Fatalf("Expected the operation's result to be decoded; got %+v", server)
+	}
+}
+
+func TestWaitForOperationErrorPayload(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.Header().Set("Location", "/op")
+			w.WriteHeader(202)
+			return
+		}
+		w.Write([]byte(`{"status": "failed", "error": {"code": 409, "message": "Quota exceeded", "retryable": false}}`))
+	}))
+	defer ts.Close()
+
+	accepted, _ := Request("POST", ts.URL, Options{OkCodes: []int{202}})
+	var details struct {
+		Code      int
+		Message   string
+		Retryable bool
+	}
+	_, err := WaitForOperation(accepted, OperationOptions{Interval: time.Millisecond, ErrorResults: &details})
+	e, ok := err.(*OperationFailedError)
+	if !ok {
+		t.Fatalf("Expected an OperationFailedError; got %#v", err)
+	}
+	if e.Code != "409" || e.Message != "Quota exceeded" || e.Details != &details || details.Code != 409 {
+		t.Fatalf("Expected the error payload to be lifted into the error; got %+v", e)
+	}
+	if string(e.Payload) != `{"code": 409, "message": "Quota exceeded", "retryable": false}` {
+		t.Fatalf("Expected the raw payload; got %s", e.Payload)
+	}
+	if e.Error() != `Operation at URL(`+ts.URL+`/op) failed with status "failed" (409): Quota exceeded` {
+		t.Fatalf("Unexpected message: %s", e.Error())
+	}
+}
+
+func TestWaitForOperationMismatchedErrorResults(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.Header().Set("Location", "/op")
+			w.WriteHeader(202)
+			return
+		}
+		w.Write([]byte(`{"status": "failed", "error": "Quota exceeded"}`))
+	}))
+	defer ts.Close()
+
+	accepted, _ := Request("POST", ts.URL, Options{OkCodes: []int{202}})
+	var details struct{ Code int }
+	_, err := WaitForOperation(accepted, OperationOptions{Interval: time.Millisecond, ErrorResults: &details})
+	e, ok := err.(*OperationFailedError)
+	if !ok {
+		t.Fatalf("Expected an OperationFailedError despite the mismatched details; got %#v", err)
+	}
+	if e.Details != nil || e.Message != "Quota exceeded" {
+		t.Fatalf("Expected the message without details; got %+v", e)
+	}
+}
@@ -0,0 +1,251 @@
+package perigee
+
+import (
+	"net/http"
+)
+
+// Merge overlays other on top of opts, returning the combined Options; neither input is modified.
+// It lets common settings live in one place (see Client) while individual calls specify only what differs.
+//
+// Precedence is as follows:
+//
+// - Scalar, pointer, and interface fields (CustomClient, ReqBody, Results, ContentType, Validator, and so on) are taken from other whenever other sets them.
+//
+// - Boolean switches (OmitContentType, OmitAccept, and the like) are enabled if either side enables them.
+//
+// - MoreHeaders and StatusErrors are combined; where both sides name the same key, other wins.
+//
+// - OkCodes, RejectCodes, AcceptTypes, and RedactFields are replaced wholesale when other provides a non-nil slice, since such lists rarely make sense piecemeal.
+// OkCodes given by other also displace an OkPredicate of opts, unless other gives its own.
+//
+// - SetHeaders hooks are chained: opts's hook runs first, then other's, and the first error stops the chain.
+//
+// - Middleware is chained likewise: opts's middleware is outermost, and other's nested inside it.
+func (opts Options) Merge(other Options) Options {
+	merged := opts
+
+	if other.CustomClient != nil {
+		merged.CustomClient = other.CustomClient
+	}
+	if other.ReqBody != nil {
+		merged.ReqBody = other.ReqBody
+	}
+	if other.RawBody != nil {
+		merged.RawBody = other.RawBody
+	}
+	if other.QueryParams != nil {
+		merged.QueryParams = other.QueryParams
+	}
+	if other.Codec != nil {
+		merged.Codec = other.Codec
+	}
+	if other.FormBody != nil {
+		merged.FormBody = other.FormBody
+	}
+	if other.ErrorResults != nil {
+		merged.ErrorResults = other.ErrorResults
+	}
+	if other.OkPredicate != nil {
+		merged.OkPredicate = other.OkPredicate
+	}
+	if other.Results != nil {
+		merged.Results = other.Results
+	}
+	if other.StatusCode != nil {
+		merged.StatusCode = other.StatusCode
+	}
+	if other.ResponseJson != nil {
+		merged.ResponseJson = other.ResponseJson
+	}
+	if other.Response != nil {
+		merged.Response = other.Response
+	}
+	if other.ContentType != "" {
+		merged.ContentType = other.ContentType
+	}
+	if other.ContentLength != 0 {
+		merged.ContentLength = other.ContentLength
+	}
+	if other.Accept != "" {
+		merged.Accept = other.Accept
+	}
+	if other.Validator != nil {
+		merged.Validator = other.Validator
+	}
+	if other.TeeBody != nil {
+		merged.TeeBody = other.TeeBody
+	}
+	if other.ResponseBuffer != nil {
+		merged.ResponseBuffer = other.ResponseBuffer
+	}
+	if other.Context != nil {
+		merged.Context = other.Context
+	}
+	if other.Retry != nil {
+		merged.Retry = other.Retry
+	}
+	if other.OnInformational != nil {
+		merged.OnInformational = other.OnInformational
+	}
+	if other.StreamBody != nil {
+		merged.StreamBody = other.StreamBody
+	}
+	if other.Transport != nil {
+		merged.Transport = other.Transport
+	}
+	if other.Jar != nil {
+		merged.Jar = other.Jar
+	}
+	if other.Auth != nil {
+		merged.Auth = other.Auth
+	}
+	if other.ReplayGuard != nil {
+		merged.ReplayGuard = other.ReplayGuard
+	}
+	if other.Verifier != nil {
+		merged.Verifier = other.Verifier
+	}
+	if other.Encryption != nil {
+		merged.Encryption = other.Encryption
+	}
+	if other.Scrubber != nil {
+		merged.Scrubber = other.Scrubber
+	}
+	if !other.IfUnmodifiedSince.IsZero() {
+		merged.IfUnmodifiedSince = other.IfUnmodifiedSince
+	}
+	if other.ThrottleUpload != nil {
+		merged.ThrottleUpload = other.ThrottleUpload
+	}
+	if other.ThrottleDownload != nil {
+		merged.ThrottleDownload = other.ThrottleDownload
+	}
+	if other.DeadlineHeader != "" {
+		merged.DeadlineHeader = other.DeadlineHeader
+	}
+	if other.OnDeprecation != nil {
+		merged.OnDeprecation = other.OnDeprecation
+	}
+	if other.Chunking != ChunkingAuto {
+		merged.Chunking = other.Chunking
+	}
+	if other.AcceptEncoding != "" {
+		merged.AcceptEncoding = other.AcceptEncoding
+	}
+	if other.CompressRequest != "" {
+		merged.CompressRequest = other.CompressRequest
+	}
+	if other.ReqHeaders != nil {
+		merged.ReqHeaders = other.ReqHeaders
+	}
+	if other.HeaderResults != nil {
+		merged.HeaderResults = other.HeaderResults
+	}
+	if other.Priority != PriorityNormal {
+		merged.Priority = other.Priority
+	}
+	if other.ExpectContentType != "" {
+		merged.ExpectContentType = other.ExpectContentType
+	}
+
+	merged.DumpReqJson = opts.DumpReqJson || other.DumpReqJson
+	merged.OmitContentType = opts.OmitContentType || other.OmitContentType
+	merged.OmitAccept = opts.OmitAccept || other.OmitAccept
+	merged.NotModifiedIsError = opts.NotModifiedIsError || other.NotModifiedIsError
+	merged.LenientJson = opts.LenientJson || other.LenientJson
+	merged.SnakeCaseKeys = opts.SnakeCaseKeys || other.SnakeCaseKeys
+	merged.KeepCompressed = opts.KeepCompressed || other.KeepCompressed
+
+	if other.OkCodes != nil {
+		merged.OkCodes = other.OkCodes
+		if other.OkPredicate == nil {
+			merged.OkPredicate = nil
+		}
+	}
+	if other.RejectCodes != nil {
+		merged.RejectCodes = other.RejectCodes
+	}
+	if other.AcceptTypes != nil {
+		merged.AcceptTypes = other.AcceptTypes
+	}
+	if other.RedactFields != nil {
+		merged.RedactFields = other.RedactFields
+	}
+
+	if len(other.MoreHeaders) > 0 {
+		merged.MoreHeaders = make(map[string]string, len(opts.MoreHeaders)+len(other.MoreHeaders))
+		for k, v := range opts.MoreHeaders {
+			merged.MoreHeaders[k] = v
+		}
+		for k, v := range other.MoreHeaders {
+			merged.MoreHeaders[k] = v
+		}
+	}
+	if len(other.StatusErrors) > 0 {
+		merged.StatusErrors = make(map[int]ErrorConstructor, len(opts.StatusErrors)+len(other.StatusErrors))
+		for k, v := range opts.StatusErrors {
+			merged.StatusErrors[k] = v
+		}
+		for k, v := range other.StatusErrors {
+			merged.StatusErrors[k] = v
+		}
+	}
+
+	if len(other.Middleware) > 0 {
+		merged.Middleware = append(append(make([]Middleware, 0, len(opts.Middleware)+len(other.Middleware)), opts.Middleware...), other.Middleware...)
+	}
+
+	if opts.SetHeaders != nil && other.SetHeaders != nil {
+		first, second := opts.SetHeaders, other.SetHeaders
+		merged.SetHeaders = func(r *http.Request) error {
+			err := first(r)
+			if err != nil {
+				return err
+			}
+			return second(r)
+		}
+	} else if other.SetHeaders != nil {
+		merged.SetHeaders = other.SetHeaders
+	}
+
+	return merged
+}
+
+// Clone returns a deep copy of opts' maps and slices (MoreHeaders, OkCodes, StatusErrors, AcceptTypes, and so on),
+// so that the copy may be modified without affecting requests which are using the original.
+// Pointer, interface, and function fields (CustomClient, Results, SetHeaders, and so on) still refer to the same values.
+//
+// Request never modifies the Options it's given, so a single Options value may be shared freely among goroutines,
+// provided nobody modifies its maps or slices while requests are in flight.
+// Clone it first, and modify the clone, instead.
+func (opts Options) Clone() Options {
+	clone := opts
+	if opts.MoreHeaders != nil {
+		clone.MoreHeaders = make(map[string]string, len(opts.MoreHeaders))
+		for k, v := range opts.MoreHeaders {
+			clone.MoreHeaders[k] = v
+		}
+	}
+	if opts.OkCodes != nil {
+		clone.OkCodes = append(make([]int, 0, len(opts.OkCodes)), opts.OkCodes...)
+	}
+	if opts.RejectCodes != nil {
+		clone.RejectCodes = append(make([]int, 0, len(opts.RejectCodes)), opts.RejectCodes...)
+	}
+	if opts.AcceptTypes != nil {
+		clone.AcceptTypes = append(make([]AcceptType, 0, len(opts.AcceptTypes)), opts.AcceptTypes...)
+	}
+	if opts.RedactFields != nil {
+		clone.RedactFields = append(make([]string, 0, len(opts.RedactFields)), opts.RedactFields...)
+	}
+	if opts.Middleware != nil {
+		clone.Middleware = append(make([]Middleware, 0, len(opts.Middleware)), opts.Middleware...)
+	}
+	if opts.StatusErrors != nil {
+		clone.StatusErrors = make(map[int]ErrorConstructor, len(opts.StatusErrors))
+		for k, v := range opts.StatusErrors {
+			clone.StatusErrors[k] = v
+		}
+	}
+	return clone
+}
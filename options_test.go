@@ -0,0 +1,189 @@
+package perigee
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fullOptions returns Options with every field set.
+// When a field is added to Options, add it here too; TestMergeCarriesEveryField then checks that Merge handles it.
+func fullOptions() Options {
+	status := 0
+	raw := []byte{}
+	var response *Response
+	return Options{
+		CustomClient:       &http.Client{},
+		ReqBody:            "body",
+		Results:            new(interface{}),
+		MoreHeaders:        map[string]string{"X-Test": "1"},
+		OkCodes:            []int{200},
+		StatusCode:         &status,
+		DumpReqJson:        true,
+		ResponseJson:       &raw,
+		Response:           &response,
+		ContentType:        "text/plain",
+		ContentLength:      1,
+		Accept:             "text/plain",
+		SetHeaders:         func(r *http.Request) error { return nil },
+		OmitContentType:    true,
+		OmitAccept:         true,
+		Validator:          &OpenAPIValidator{},
+		TeeBody:            &bytes.Buffer{},
+		NotModifiedIsError: true,
+		StatusErrors:       map[int]ErrorConstructor{404: func(*UnexpectedResponseCodeError) error { return nil }},
+		ResponseBuffer:     &bytes.Buffer{},
+		AcceptTypes:        []AcceptType{{MediaType: "text/plain"}},
+		LenientJson:        true,
+		ExpectContentType:  "text/plain",
+		Context:            context.Background(),
+		Retry:              &RetryPolicy{},
+		Priority:           PriorityHigh,
+		HeaderResults:      &struct{}{},
+		ReqHeaders:         struct{}{},
+		SnakeCaseKeys:      true,
+		CompressRequest:    "gzip",
+		AcceptEncoding:     "identity",
+		KeepCompressed:     true,
+		Chunking:           ChunkingForbid,
+		Transport:          http.DefaultTransport,
+		RejectCodes:        []int{500},
+		StreamBody:         func(io.Reader) error { return nil },
+		OnInformational:    func(int, http.Header) {},
+		Jar:                &cookiejar.Jar{},
+		Auth:               &TokenAuth{},
+		ReplayGuard:        &ReplayGuard{},
+		Verifier:           &HMACVerifier{},
+		Encryption:         &JWE{},
+		RedactFields:       []string{"password"},
+		Scrubber:           func(data []byte) []byte { return data },
+		IfUnmodifiedSince:  time.Now(),
+		ThrottleUpload:     NewThrottle(1, 0),
+		ThrottleDownload:   NewThrottle(1, 0),
+		DeadlineHeader:     "X-Request-Timeout-Ms",
+		OnDeprecation:      LogDeprecation,
+		Middleware:         []Middleware{func(r *http.Request, next Handler) (*http.Response, error) { return next(r) }},
+		RawBody:            &bytes.Buffer{},
+		QueryParams:        map[string]string{"limit": "10"},
+		Codec:              XMLCodec,
+		FormBody:           url.Values{"grant_type": {"client_credentials"}},
+		ErrorResults:       new(map[string]interface{}),
+		OkPredicate:        func(*http.Response) bool { return true },
+	}
+}
+
+func TestMergeCarriesEveryField(t *testing.T) {
+	full := fullOptions()
+	v := reflect.ValueOf(full)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			t.Fatalf("fullOptions() leaves %s unset; please update it", v.Type().Field(i).Name)
+		}
+	}
+
+	for _, merged := range []Options{(Options{}).Merge(full), full.Merge(Options{})} {
+		m := reflect.ValueOf(merged)
+		for i := 0; i < m.NumField(); i++ {
+			if m.Field(i).IsZero() {
+				t.Errorf("Merge dropped field %s", m.Type().Field(i).Name)
+			}
+		}
+	}
+}
+
+func TestMergePrecedence(t *testing.T) {
+	var calls []string
+	base := Options{
+		ContentType: "application/json",
+		Accept:      "application/json",
+		MoreHeaders: map[string]string{"X-Auth-Token": "base", "X-Tenant": "t1"},
+		OkCodes:     []int{200},
+		SetHeaders: func(r *http.Request) error {
+			calls = append(calls, "base")
+			return nil
+		},
+	}
+	overlay := Options{
+		Accept:      "application/xml",
+		MoreHeaders: map[string]string{"X-Auth-Token": "overlay"},
+		OkCodes:     []int{201, 202},
+		OmitAccept:  true,
+		SetHeaders: func(r *http.Request) error {
+			calls = append(calls, "overlay")
+			return nil
+		},
+	}
+
+	merged := base.Merge(overlay)
+	if merged.ContentType != "application/json" || merged.Accept != "application/xml" {
+		t.Fatalf("Unexpected content negotiation: %q, %q", merged.ContentType, merged.Accept)
+	}
+	if !reflect.DeepEqual(merged.MoreHeaders, map[string]string{"X-Auth-Token": "overlay", "X-Tenant": "t1"}) {
+		t.Fatalf("Unexpected headers %v", merged.MoreHeaders)
+	}
+	if base.MoreHeaders["X-Auth-Token"] != "base" {
+		t.Fatal("Merge must not modify its inputs")
+	}
+	if !reflect.DeepEqual(merged.OkCodes, []int{201, 202}) {
+		t.Fatalf("Expected OkCodes to be replaced; got %v", merged.OkCodes)
+	}
+	if !merged.OmitAccept {
+		t.Fatal("Expected OmitAccept to be enabled")
+	}
+
+	merged.SetHeaders(nil)
+	if !reflect.DeepEqual(calls, []string{"base", "overlay"}) {
+		t.Fatalf("Expected both SetHeaders hooks, in order; got %v", calls)
+	}
+
+	boom := errors.New("boom")
+	failing := Options{SetHeaders: func(r *http.Request) error { return boom }}
+	calls = nil
+	if err := failing.Merge(overlay).SetHeaders(nil); err != boom || len(calls) != 0 {
+		t.Fatalf("Expected the first error to stop the chain; got %v after %v", err, calls)
+	}
+
+	if kept := base.Merge(Options{}); !reflect.DeepEqual(kept.OkCodes, []int{200}) {
+		t.Fatalf("Expected OkCodes to be kept when the overlay has none; got %v", kept.OkCodes)
+	}
+
+	withPredicate := Options{OkPredicate: func(*http.Response) bool { return true }}
+	if merged := withPredicate.Merge(Options{OkCodes: []int{201}}); merged.OkPredicate != nil {
+		t.Fatalf("Expected OkCodes in the overlay to displace the base's OkPredicate")
+	}
+	if merged := withPredicate.Merge(Options{}); merged.OkPredicate == nil {
+		t.Fatalf("Expected OkPredicate to be kept when the overlay has no OkCodes")
+	}
+}
+
+func TestCloneCopiesMapsAndSlices(t *testing.T) {
+	full := fullOptions()
+	clone := full.Clone()
+
+	o, c := reflect.ValueOf(full), reflect.ValueOf(clone)
+	for i := 0; i < o.NumField(); i++ {
+		name := o.Type().Field(i).Name
+		switch o.Field(i).Kind() {
+		case reflect.Map, reflect.Slice:
+			if o.Field(i).Pointer() == c.Field(i).Pointer() {
+				t.Errorf("Clone shares %s with the original", name)
+			}
+			if o.Field(i).Len() != c.Field(i).Len() {
+				t.Errorf("Clone altered %s", name)
+			}
+		}
+	}
+
+	clone.MoreHeaders["X-Test"] = "changed"
+	clone.OkCodes[0] = 500
+	if full.MoreHeaders["X-Test"] != "1" || full.OkCodes[0] != 200 {
+		t.Fatal("Modifying the clone affected the original")
+	}
+}
@@ -0,0 +1,190 @@
+package perigee
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NextPageFunc inspects a page of results and returns the URL of the following page.
+// It returns an empty string once the last page has been reached.
+// Relative URLs are resolved against the URL of the page just fetched.
+type NextPageFunc func(page *Response) (string, error)
+
+// Pager walks a paginated listing, one page per request.
+//
+// Each page is fetched using Method (GET, if empty) and a copy of Options.
+// Options.QueryParams are added to URL for the first page only, since the server's links to the pages after it carry the query it wants.
+// The raw body of each page is available to the handler through Response.JsonResult; Options.Results is ignored.
+//
+// Prefetch sets how many pages the Pager may fetch ahead of the caller, in the background, while the caller processes the current page.
+// Overlapping I/O with processing this way makes long listings considerably faster.
+// Zero disables prefetching, fetching each page only once the caller has finished with the previous one.
+// Prefetched pages are fetched without the Options which write through to the caller (ResponseBuffer, HeaderResults, StatusCode, and ResponseJson),
+// since the writes would race with the caller's handling of earlier pages; each page's Response carries the same information.
+// A Pager cannot prefetch with Options.TeeBody, and fails with ErrPrefetchTeeBody.
+type Pager struct {
+	Method   string
+	URL      string
+	Options  Options
+	NextPage NextPageFunc
+	Prefetch int
+}
+
+// ErrPrefetchTeeBody is returned when a Pager is asked to prefetch pages with Options.TeeBody set.
+var ErrPrefetchTeeBody = errors.New("perigee: a Pager cannot prefetch pages with TeeBody set")
+
+// NewPager creates a Pager starting at the given URL.
+func NewPager(url string, opts Options, next NextPageFunc) *Pager {
+	return &Pager{
+		URL:      url,
+		Options:  opts,
+		NextPage: next,
+	}
+}
+
+// pageResult carries a fetched page, or the error which ended the listing, from the prefetcher to the caller.
+type pageResult struct {
+	page *Response
+	err  error
+}
+
+// EachPage invokes handler for every page of the listing, in order.
+// The handler returns false to stop early; any error it returns stops the walk and is returned from EachPage.
+func (p *Pager) EachPage(handler func(page *Response) (bool, error)) error {
+	// QueryParams apply to the first page alone; the URLs of the pages after it are the server's to give.
+	opts := p.Options
+	start := p.URL
+	if opts.QueryParams != nil {
+		var err error
+		start, err = appendQuery(start, opts.QueryParams)
+		if err != nil {
+			return err
+		}
+		opts.QueryParams = nil
+	}
+	if p.Prefetch <= 0 {
+		next := start
+		for next != "" {
+			page, following, err := p.fetch(next, opts)
+			if err != nil {
+				return err
+			}
+			more, err := handler(page)
+			if err != nil || !more {
+				return err
+			}
+			next = following
+		}
+		return nil
+	}
+
+	if opts.TeeBody != nil {
+		return ErrPrefetchTeeBody
+	}
+	opts.ResponseBuffer, opts.HeaderResults, opts.StatusCode, opts.ResponseJson = nil, nil, nil, nil
+
+	pages := make(chan pageResult, p.Prefetch-1)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(pages)
+		next := start
+		for next != "" {
+			page, following, err := p.fetch(next, opts)
+			select {
+			case pages <- pageResult{page, err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+			next = following
+		}
+	}()
+
+	for result := range pages {
+		if result.err != nil {
+			return result.err
+		}
+		more, err := handler(result.page)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// AllPages collects every page of the listing.
+func (p *Pager) AllPages() ([]*Response, error) {
+	var all []*Response
+	err := p.EachPage(func(page *Response) (bool, error) {
+		all = append(all, page)
+		return true, nil
+	})
+	return all, err
+}
+
+// fetch retrieves a single page with the given Options, returning it along with the absolute URL of the page after it.
+func (p *Pager) fetch(pageURL string, opts Options) (*Response, string, error) {
+	method := p.Method
+	if method == "" {
+		method = "GET"
+	}
+	opts.Results = new(json.RawMessage)
+
+	page, err := Request(method, pageURL, opts)
+	if err != nil {
+		return page, "", err
+	}
+	if p.NextPage == nil {
+		return page, "", nil
+	}
+	next, err := p.NextPage(page)
+	if err != nil || next == "" {
+		return page, "", err
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return page, "", err
+	}
+	ref, err := url.Parse(next)
+	if err != nil {
+		return page, "", err
+	}
+	return page, base.ResolveReference(ref).String(), nil
+}
+
+// LinkHeaderNext is a NextPageFunc which follows the rel="next" entry of an RFC 5988 Link response header.
+func LinkHeaderNext(page *Response) (string, error) {
+	return linkHeader(page.HttpResponse.Header, "next"), nil
+}
+
+// linkHeader returns the target of the first entry with the given relation in a response's Link headers, or "" if there is none.
+func linkHeader(header http.Header, relation string) string {
+	for _, value := range header["Link"] {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				param = strings.TrimSpace(param)
+				if !strings.HasPrefix(strings.ToLower(param), "rel=") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(param[len("rel="):], `"`)) {
+					if strings.EqualFold(rel, relation) {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,190 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pagedServer serves pages 1 through n of a listing, linking each to the next with a relative Link header.
+func pagedServer(n int, fetched *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		atomic.AddInt32(fetched, 1)
+		if page < n {
+			w.Header().Set("Link", fmt.Sprintf(`</items?page=%d>; rel="next", </items?page=1>; rel="first"`, page+1))
+		}
+		fmt.Fprintf(w, `{"page": %d}`, page)
+	}))
+}
+
+func collectPages(t *testing.T, p *Pager, delay time.Duration) []int {
+	var pages []int
+	err := p.EachPage(func(page *Response) (bool, error) {
+		var body struct {
+			Page int `json:"page"`
+		}
+		err := json.Unmarshal(page.JsonResult, &body)
+		if err != nil {
+			return false, err
+		}
+		pages = append(pages, body.Page)
+		time.Sleep(delay)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pages
+}
+
+func TestPagerSequential(t *testing.T) {
+	var fetched int32
+	ts := pagedServer(3, &fetched)
+	defer ts.Close()
+
+	pages := collectPages(t, NewPager(ts.URL+"/items", Options{}, LinkHeaderNext), 0)
+	if fmt.Sprint(pages) != "[1 2 3]" {
+		t.Fatalf("Expected pages [1 2 3]; got %v", pages)
+	}
+}
+
+func TestPagerPrefetch(t *testing.T) {
+	var fetched int32
+	ts := pagedServer(4, &fetched)
+	defer ts.Close()
+
+	p := NewPager(ts.URL+"/items", Options{}, LinkHeaderNext)
+	p.Prefetch = 2
+
+	var aheadWhileProcessingFirst int32
+	first := true
+	err := p.EachPage(func(page *Response) (bool, error) {
+		if first {
+			first = false
+			time.Sleep(50 * time.Millisecond)
+			aheadWhileProcessingFirst = atomic.LoadInt32(&fetched)
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aheadWhileProcessingFirst != 3 {
+		t.Fatalf("Expected 3 pages fetched while the first was processed (1 + prefetch depth 2); got %d", aheadWhileProcessingFirst)
+	}
+	if fetched != 4 {
+		t.Fatalf("Expected 4 pages fetched in total; got %d", fetched)
+	}
+
+	pages := collectPages(t, p, 0)
+	if fmt.Sprint(pages) != "[1 2 3 4]" {
+		t.Fatalf("Expected pages [1 2 3 4]; got %v", pages)
+	}
+}
+
+func TestPagerStopsEarly(t *testing.T) {
+	var fetched int32
+	ts := pagedServer(100, &fetched)
+	defer ts.Close()
+
+	p := NewPager(ts.URL+"/items", Options{}, LinkHeaderNext)
+	p.Prefetch = 1
+	count := 0
+	err := p.EachPage(func(page *Response) (bool, error) {
+		count++
+		return count < 2, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected the handler to see 2 pages; saw %d", count)
+	}
+}
+
+func TestPagerPropagatesErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(500)
+			return
+		}
+		w.Header().Set("Link", `<?page=2>; rel="next"`)
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	for _, prefetch := range []int{0, 3} {
+		p := NewPager(ts.URL, Options{OkCodes: []int{200}}, LinkHeaderNext)
+		p.Prefetch = prefetch
+		pages, err := p.AllPages()
+		if _, ok := err.(*UnexpectedResponseCodeError); !ok {
+			t.Fatalf("Prefetch %d: expected *UnexpectedResponseCodeError; got %#v", prefetch, err)
+		}
+		if len(pages) != 1 {
+			t.Fatalf("Prefetch %d: expected 1 page before the error; got %d", prefetch, len(pages))
+		}
+	}
+}
+
+func TestPagerPrefetchDropsSharedOptions(t *testing.T) {
+	var fetched int32
+	ts := pagedServer(5, &fetched)
+	defer ts.Close()
+
+	var status int
+	p := NewPager(ts.URL+"/items", Options{ResponseBuffer: new(bytes.Buffer), StatusCode: &status}, LinkHeaderNext)
+	p.Prefetch = 2
+	// Run with -race: the handler reads each page while the pages after it are being fetched.
+	var bodies []string
+	err := p.EachPage(func(page *Response) (bool, error) {
+		time.Sleep(5 * time.Millisecond)
+		bodies = append(bodies, string(page.JsonResult))
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, body := range bodies {
+		if want := fmt.Sprintf(`{"page": %d}`, i+1); body != want {
+			t.Fatalf("Expected page %d to keep its own body; got %s", i+1, body)
+		}
+	}
+	if status != 0 {
+		t.Fatalf("Expected prefetched pages not to write through StatusCode; got %d", status)
+	}
+
+	p.Options = Options{TeeBody: new(bytes.Buffer)}
+	if err := p.EachPage(func(*Response) (bool, error) { return true, nil }); err != ErrPrefetchTeeBody {
+		t.Fatalf("Expected ErrPrefetchTeeBody; got %v", err)
+	}
+}
+
+func TestPagerQueryParamsFirstPageOnly(t *testing.T) {
+	var fetched int32
+	var queries []string
+	ts := pagedServer(3, &fetched)
+	defer ts.Close()
+	inner := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		inner.ServeHTTP(w, r)
+	})
+
+	p := NewPager(ts.URL+"/items", Options{QueryParams: map[string]string{"limit": "10"}}, LinkHeaderNext)
+	if pages := collectPages(t, p, 0); fmt.Sprint(pages) != "[1 2 3]" {
+		t.Fatalf("Expected pages [1 2 3]; got %v", pages)
+	}
+	if fmt.Sprint(queries) != "[limit=10 page=2 page=3]" {
+		t.Fatalf("Expected QueryParams on the first page only; got %q", queries)
+	}
+}
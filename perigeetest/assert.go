@@ -0,0 +1,108 @@
+// Package perigeetest helps test code built on perigee, such as SDKs, against httptest servers.
+package perigeetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/racker/perigee"
+)
+
+// ExpectStatus reports a test failure unless the response carries the given status code.
+func ExpectStatus(t testing.TB, resp *perigee.Response, code int) {
+	t.Helper()
+	if resp == nil {
+		t.Errorf("Expected status %d; got no response", code)
+		return
+	}
+	if resp.StatusCode != code {
+		t.Errorf("Expected status %d; got %d", code, resp.StatusCode)
+	}
+}
+
+// ExpectHeader reports a test failure unless the response carries the given value in the named header.
+// Headers with several values match if any of them does.
+func ExpectHeader(t testing.TB, resp *perigee.Response, name, value string) {
+	t.Helper()
+	if resp == nil {
+		t.Errorf("Expected header %s: %s; got no response", name, value)
+		return
+	}
+	values := resp.HttpResponse.Header.Values(name)
+	for _, v := range values {
+		if v == value {
+			return
+		}
+	}
+	if len(values) == 0 {
+		t.Errorf("Expected header %s: %s; got no such header", name, value)
+		return
+	}
+	t.Errorf("Expected header %s: %s; got %q", name, value, values)
+}
+
+// ExpectJSONEq reports a test failure unless the response body is JSON equivalent to want,
+// regardless of key order and insignificant whitespace.
+// The body is read from Response.JsonResult, so the request must have asked for Results or a ResponseBuffer.
+// want may be a JSON document, as a string, []byte, or json.RawMessage, or any value marshaling to the expected document.
+func ExpectJSONEq(t testing.TB, resp *perigee.Response, want interface{}) {
+	t.Helper()
+	if resp == nil {
+		t.Errorf("Expected a JSON body; got no response")
+		return
+	}
+	wantJSON, err := expectedJSON(want)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	equal, err := jsonEqual(wantJSON, resp.JsonResult)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	if !equal {
+		t.Errorf("Expected JSON %s; got %s", compact(wantJSON), compact(resp.JsonResult))
+	}
+}
+
+// expectedJSON renders an expected value as a JSON document, unless it already is one.
+func expectedJSON(want interface{}) ([]byte, error) {
+	switch w := want.(type) {
+	case string:
+		return []byte(w), nil
+	case []byte:
+		return w, nil
+	case json.RawMessage:
+		return w, nil
+	}
+	data, err := json.Marshal(want)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot marshal the expected JSON: %s", err)
+	}
+	return data, nil
+}
+
+// jsonEqual reports whether two JSON documents are equivalent.
+func jsonEqual(a, b []byte) (bool, error) {
+	var av, bv interface{}
+	if err := json.Unmarshal(a, &av); err != nil {
+		return false, fmt.Errorf("Expected JSON is invalid: %s", err)
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		return false, fmt.Errorf("Expected a JSON body; got %q (%s)", b, err)
+	}
+	return reflect.DeepEqual(av, bv), nil
+}
+
+// compact renders a JSON document on one line for failure messages.
+func compact(data []byte) string {
+	var buf bytes.Buffer
+	if json.Compact(&buf, data) != nil {
+		return string(data)
+	}
+	return buf.String()
+}
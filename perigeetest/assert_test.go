@@ -0,0 +1,68 @@
+package perigeetest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/racker/perigee"
+)
+
+// fakeT captures the failures an assertion reports.
+type fakeT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *fakeT) Helper() {}
+
+func (r *fakeT) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func serve(t *testing.T) *perigee.Response {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/servers/abc")
+		w.Header().Add("X-Tag", "a")
+		w.Header().Add("X-Tag", "b")
+		w.WriteHeader(201)
+		w.Write([]byte(`{"server": {"id": "abc", "tags": ["x", "y"]}}`))
+	}))
+	defer ts.Close()
+	var results interface{}
+	resp, err := perigee.Request("POST", ts.URL, perigee.Options{Results: &results, OkCodes: []int{201}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAssertionsPass(t *testing.T) {
+	resp := serve(t)
+	r := &fakeT{}
+	ExpectStatus(r, resp, 201)
+	ExpectHeader(r, resp, "Location", "/servers/abc")
+	ExpectHeader(r, resp, "X-Tag", "b")
+	ExpectJSONEq(r, resp, `{"server":{"tags":["x","y"],"id":"abc"}}`)
+	ExpectJSONEq(r, resp, map[string]interface{}{"server": map[string]interface{}{"id": "abc", "tags": []string{"x", "y"}}})
+	if len(r.failures) != 0 {
+		t.Fatalf("Expected no failures; got %q", r.failures)
+	}
+}
+
+func TestAssertionsFail(t *testing.T) {
+	resp := serve(t)
+	r := &fakeT{}
+	ExpectStatus(r, resp, 200)
+	ExpectHeader(r, resp, "Location", "/servers/xyz")
+	ExpectHeader(r, resp, "X-Missing", "value")
+	ExpectJSONEq(r, resp, `{"server":{"id":"xyz"}}`)
+	ExpectStatus(r, nil, 200)
+	if len(r.failures) != 5 {
+		t.Fatalf("Expected 5 failures; got %q", r.failures)
+	}
+	if want := "Expected status 200; got 201"; r.failures[0] != want {
+		t.Fatalf("Expected %q; got %q", want, r.failures[0])
+	}
+}
@@ -0,0 +1,161 @@
+package perigeetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/racker/perigee"
+)
+
+// RecordedRequest is a request as a Recorder saw it go out.
+type RecordedRequest struct {
+	Method string
+	URL    *url.URL
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// DecodeBody decodes the request's JSON body into v.
+func (r RecordedRequest) DecodeBody(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Recorder is an http.RoundTripper recording every request it carries before passing it on to Transport,
+// so that tests can verify exactly what an SDK sent without writing bespoke handlers.
+// A nil Transport means http.DefaultTransport.
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	Transport http.RoundTripper
+
+	mu       sync.Mutex
+	requests []RecordedRequest
+}
+
+// Record installs a Recorder in the client's defaults, in front of whatever transport the client already used, and returns it.
+func Record(c *perigee.Client) *Recorder {
+	r := new(Recorder)
+	c.Update(func(defaults *perigee.Options) {
+		r.Transport = defaults.Transport
+		if r.Transport == nil && defaults.CustomClient != nil {
+			r.Transport = defaults.CustomClient.Transport
+		}
+		defaults.Transport = r
+	})
+	return r
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Header: req.Header.Clone(),
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		rec.Body = body
+		outgoing := req.Clone(req.Context())
+		outgoing.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req = outgoing
+	}
+	r.mu.Lock()
+	r.requests = append(r.requests, rec)
+	r.mu.Unlock()
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return transport.RoundTrip(req)
+}
+
+// Requests returns every request recorded so far, in the order they were sent.
+func (r *Recorder) Requests() []RecordedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedRequest(nil), r.requests...)
+}
+
+// Find returns the recorded requests with the given method and path, in the order they were sent.
+func (r *Recorder) Find(method, path string) []RecordedRequest {
+	var found []RecordedRequest
+	for _, req := range r.Requests() {
+		if req.Method == method && req.Path == path {
+			found = append(found, req)
+		}
+	}
+	return found
+}
+
+// Reset forgets the requests recorded so far.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.requests = nil
+	r.mu.Unlock()
+}
+
+// ExpectRequest reports a test failure unless a request with the given method and path was sent.
+// It returns the most recent such request, for further checks.
+func (r *Recorder) ExpectRequest(t testing.TB, method, path string) RecordedRequest {
+	t.Helper()
+	found := r.Find(method, path)
+	if len(found) == 0 {
+		sent := make([]string, 0)
+		for _, req := range r.Requests() {
+			sent = append(sent, req.Method+" "+req.Path)
+		}
+		t.Errorf("Expected a request %s %s; got %q", method, path, sent)
+		return RecordedRequest{}
+	}
+	return found[len(found)-1]
+}
+
+// ExpectCount reports a test failure unless exactly n requests were sent.
+func (r *Recorder) ExpectCount(t testing.TB, n int) {
+	t.Helper()
+	if got := len(r.Requests()); got != n {
+		t.Errorf("Expected %d requests; got %d", n, got)
+	}
+}
+
+// ExpectRequestHeader reports a test failure unless the request carried the given value in the named header.
+func ExpectRequestHeader(t testing.TB, req RecordedRequest, name, value string) {
+	t.Helper()
+	for _, v := range req.Header.Values(name) {
+		if v == value {
+			return
+		}
+	}
+	t.Errorf("Expected request header %s: %s; got %q", name, value, req.Header.Values(name))
+}
+
+// ExpectBodyJSONEq reports a test failure unless the request's body is JSON equivalent to want; see ExpectJSONEq.
+func ExpectBodyJSONEq(t testing.TB, req RecordedRequest, want interface{}) {
+	t.Helper()
+	wantJSON, err := expectedJSON(want)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	equal, err := jsonEqual(wantJSON, req.Body)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+	if !equal {
+		t.Errorf("Expected request JSON %s; got %s", compact(wantJSON), compact(req.Body))
+	}
+}
@@ -0,0 +1,55 @@
+package perigeetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/racker/perigee"
+)
+
+func TestRecorder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(202)
+	}))
+	defer ts.Close()
+
+	client := perigee.NewClient(perigee.Options{MoreHeaders: map[string]string{"X-Auth-Token": "secret"}})
+	client.SetBaseURL(ts.URL)
+	rec := Record(client)
+
+	_, err := client.Request("POST", "servers/abc/action?force=true", perigee.Options{
+		ReqBody: map[string]interface{}{"reboot": map[string]string{"type": "SOFT"}},
+		OkCodes: []int{202},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Request("DELETE", "servers/abc", perigee.Options{OkCodes: []int{202}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec.ExpectCount(t, 2)
+	req := rec.ExpectRequest(t, "POST", "/servers/abc/action")
+	ExpectRequestHeader(t, req, "X-Auth-Token", "secret")
+	ExpectBodyJSONEq(t, req, `{"reboot": {"type": "SOFT"}}`)
+	if req.Query.Get("force") != "true" {
+		t.Errorf("Expected the query to be recorded; got %v", req.Query)
+	}
+	var body struct{ Reboot struct{ Type string } }
+	if err := req.DecodeBody(&body); err != nil || body.Reboot.Type != "SOFT" {
+		t.Errorf("Expected to decode the body; got %+v, %v", body, err)
+	}
+
+	f := &fakeT{}
+	rec.ExpectRequest(f, "GET", "/servers")
+	rec.ExpectCount(f, 3)
+	ExpectBodyJSONEq(f, req, `{"reboot": {"type": "HARD"}}`)
+	if len(f.failures) != 3 {
+		t.Fatalf("Expected 3 failures; got %q", f.failures)
+	}
+
+	rec.Reset()
+	rec.ExpectCount(t, 0)
+}
@@ -0,0 +1,99 @@
+package perigee
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// CloseIdleConnections closes the connections the client's transport keeps idle in its pool,
+// so that subsequent requests dial afresh, picking up changes such as a rotated certificate or a DNS failover.
+// Connections carrying requests are left alone.
+// The transport is that of the defaults' Transport or CustomClient, or http.DefaultTransport for neither;
+// transports without a CloseIdleConnections method are left alone as well.
+func (c *Client) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if t, ok := poolTransport(c.snapshot("")).(closeIdler); ok {
+		t.CloseIdleConnections()
+	}
+}
+
+// SetMaxConnLifetime limits how long the client reuses a pooled HTTP/1 connection, counting from the first request it carried.
+// The first request to draw a connection older than the limit asks the server to close it afterwards (Connection: close),
+// so that long-running daemons spread over a load balancer's new backends without failing requests in flight.
+// Connections already pooled when the limit is set count as expired.
+// A limit of zero, the default, lets connections live as long as the transport keeps them.
+func (c *Client) SetMaxConnLifetime(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connLifetime = d
+	if d > 0 && c.connBirths == nil {
+		c.connBirths = &connBirths{born: make(map[net.Conn]time.Time)}
+	}
+}
+
+// poolTransport returns the transport whose pool carries requests made with opts.
+func poolTransport(opts Options) http.RoundTripper {
+	if opts.Transport != nil {
+		return opts.Transport
+	}
+	if opts.CustomClient != nil && opts.CustomClient.Transport != nil {
+		return opts.CustomClient.Transport
+	}
+	return http.DefaultTransport
+}
+
+// connBirths remembers when each pooled connection first carried a request.
+type connBirths struct {
+	mu   sync.Mutex
+	born map[net.Conn]time.Time
+}
+
+// expired reports whether a connection has outlived the lifetime, forgetting it if so.
+// Connections outliving the lifetime are forgotten while others are recorded,
+// so that a reused connection which is not remembered is an expired one.
+func (b *connBirths) expired(info httptrace.GotConnInfo, lifetime time.Duration) bool {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !info.Reused {
+		for conn, born := range b.born {
+			if now.Sub(born) >= lifetime {
+				delete(b.born, conn)
+			}
+		}
+		b.born[info.Conn] = now
+		return false
+	}
+	born, ok := b.born[info.Conn]
+	if ok && now.Sub(born) < lifetime {
+		return false
+	}
+	delete(b.born, info.Conn)
+	return true
+}
+
+// lifetimeTransport retires connections older than a Client's maximum lifetime.
+type lifetimeTransport struct {
+	base     http.RoundTripper
+	births   *connBirths
+	lifetime time.Duration
+}
+
+func (t *lifetimeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var out *http.Request
+	trace := &httptrace.ClientTrace{
+		// The transport reports the connection before writing the request, so it still honors Close.
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Conn != nil && t.births.expired(info, t.lifetime) {
+				out.Close = true
+			}
+		},
+	}
+	out = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return t.base.RoundTrip(out)
+}
@@ -0,0 +1,59 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCloseIdleConnections(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	client := NewClient(Options{CustomClient: &http.Client{Transport: &http.Transport{}}})
+	if _, err := client.Request("GET", ts.URL, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	client.CloseIdleConnections()
+	response, err := client.Request("GET", ts.URL, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Conn.Reused {
+		t.Fatalf("Expected a fresh connection after CloseIdleConnections; got %+v", response.Conn)
+	}
+}
+
+func TestMaxConnLifetime(t *testing.T) {
+	var closing int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Close {
+			atomic.AddInt32(&closing, 1)
+		}
+	}))
+	defer ts.Close()
+
+	client := NewClient(Options{CustomClient: &http.Client{Transport: &http.Transport{}}})
+	client.SetMaxConnLifetime(50 * time.Millisecond)
+	get := func() ConnInfo {
+		response, err := client.Request("GET", ts.URL, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.Conn
+	}
+
+	first := get()
+	if second := get(); !second.Reused || second.LocalAddr != first.LocalAddr || atomic.LoadInt32(&closing) != 0 {
+		t.Fatalf("Expected a young connection to be reused; got %+v", second)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if third := get(); !third.Reused || atomic.LoadInt32(&closing) != 1 {
+		t.Fatalf("Expected the expired connection to carry one last request, with Connection: close; got %+v", third)
+	}
+	if fourth := get(); fourth.Reused || fourth.LocalAddr == first.LocalAddr {
+		t.Fatalf("Expected the expired connection to be retired; got %+v", fourth)
+	}
+}
@@ -0,0 +1,59 @@
+package perigee
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The PreconditionFailedError structure is returned when a server answers 412 (Precondition Failed),
+// typically because the resource was modified since the version a write was based on; see Options.IfUnmodifiedSince.
+// It wraps the UnexpectedResponseCodeError perigee would otherwise return, so errors.As finds either.
+// ETag and LastModified describe the server's current version of the resource, if it said;
+// call Current to decode its current state, if the server returned it in the body.
+type PreconditionFailedError struct {
+	*UnexpectedResponseCodeError
+	ETag         string
+	LastModified time.Time
+}
+
+func (err *PreconditionFailedError) Error() string {
+	if !err.LastModified.IsZero() {
+		return fmt.Sprintf("Precondition failed when accessing URL(%s); the resource was last modified at %s", err.Url, err.LastModified.Format(http.TimeFormat))
+	}
+	return fmt.Sprintf("Precondition failed when accessing URL(%s); the resource has been modified", err.Url)
+}
+
+func (err *PreconditionFailedError) Unwrap() error {
+	return err.UnexpectedResponseCodeError
+}
+
+// Current decodes the server's current state of the resource, returned in the body of the 412 response, into v.
+func (err *PreconditionFailedError) Current(v interface{}) error {
+	return json.Unmarshal(err.Body, v)
+}
+
+// newPreconditionFailedError describes a 412 response.
+func newPreconditionFailedError(unexpected *UnexpectedResponseCodeError, header http.Header) *PreconditionFailedError {
+	err := &PreconditionFailedError{UnexpectedResponseCodeError: unexpected, ETag: header.Get("ETag")}
+	if t, ok := parseHTTPTime(header.Get("Last-Modified")); ok {
+		err.LastModified = t
+	}
+	return err
+}
+
+// LastModified returns the time the server reports the resource was last modified, from the Last-Modified header,
+// for use as Options.IfUnmodifiedSince in a later write.
+func (r *Response) LastModified() (time.Time, bool) {
+	return parseHTTPTime(r.HttpResponse.Header.Get("Last-Modified"))
+}
+
+// parseHTTPTime parses a date in any of the formats HTTP allows.
+func parseHTTPTime(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(value)
+	return t, err == nil
+}
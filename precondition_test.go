@@ -0,0 +1,61 @@
+package perigee
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIfUnmodifiedSince(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		if r.Method == "GET" {
+			w.Write([]byte(`{"name": "old"}`))
+			return
+		}
+		since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since"))
+		if err != nil || since.Before(modified) {
+			w.Header().Set("ETag", `"v2"`)
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte(`{"name": "theirs"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	var current struct{ Name string }
+	resp, err := Request("GET", ts.URL, Options{Results: &current})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched, ok := resp.LastModified()
+	if !ok || !fetched.Equal(modified) {
+		t.Fatalf("Expected Last-Modified %s; got %s", modified, fetched)
+	}
+
+	_, err = Request("PUT", ts.URL, Options{ReqBody: current, IfUnmodifiedSince: fetched, OkCodes: []int{204}})
+	if err != nil {
+		t.Fatalf("Expected the write to succeed; got %v", err)
+	}
+
+	_, err = Request("PUT", ts.URL, Options{ReqBody: current, IfUnmodifiedSince: fetched.Add(-time.Hour), OkCodes: []int{204}})
+	var failed *PreconditionFailedError
+	if !errors.As(err, &failed) {
+		t.Fatalf("Expected a PreconditionFailedError; got %v", err)
+	}
+	if failed.ETag != `"v2"` || !failed.LastModified.Equal(modified) || failed.Actual != 412 {
+		t.Fatalf("Expected the server's current version; got %+v", failed)
+	}
+	var theirs struct{ Name string }
+	if err := failed.Current(&theirs); err != nil || theirs.Name != "theirs" {
+		t.Fatalf("Expected the server's current state; got %v, %v", theirs, err)
+	}
+	var unexpected *UnexpectedResponseCodeError
+	if !errors.As(err, &unexpected) {
+		t.Fatal("Expected the error to remain an UnexpectedResponseCodeError as well")
+	}
+}
@@ -0,0 +1,28 @@
+package perigee
+
+import "context"
+
+// Priority ranks a request against others competing for the same scarce resource, such as a Bulkhead slot.
+// Higher priorities are served first; requests of equal priority are served in order of arrival.
+// Any int is a valid priority; the named levels are merely conventional.
+type Priority int
+
+const (
+	PriorityLow    Priority = -10 // background work, e.g., synchronization
+	PriorityNormal Priority = 0   // the default
+	PriorityHigh   Priority = 10  // interactive operations, with a user waiting
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx carrying the given request priority.
+// Request attaches Options.Priority to each request's context this way; transports read it back with PriorityFrom.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the request priority carried by ctx, or PriorityNormal if it carries none.
+func PriorityFrom(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
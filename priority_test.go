@@ -0,0 +1,34 @@
+package perigee
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPriorityTravelsInContext(t *testing.T) {
+	if p := PriorityFrom(context.Background()); p != PriorityNormal {
+		t.Fatalf("Expected PriorityNormal by default; got %d", p)
+	}
+
+	var seen Priority
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		seen = PriorityFrom(req.Context())
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	_, err := Request("GET", ts.URL, Options{CustomClient: client, Priority: PriorityLow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != PriorityLow {
+		t.Fatalf("Expected the transport to see PriorityLow; got %d", seen)
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
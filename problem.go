@@ -0,0 +1,80 @@
+package perigee
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProblemMediaType is the media type of RFC 7807 problem details.
+const ProblemMediaType = "application/problem+json"
+
+// The ProblemDetails structure is returned when a server answers with an unacceptable code
+// and an RFC 7807 problem details body (Content-Type application/problem+json).
+// It wraps the UnexpectedResponseCodeError perigee would otherwise return, so errors.As finds either.
+// Type defaults to "about:blank", and Status to the response code, if the body omits them.
+// Extensions holds any members beyond the standard ones, undecoded.
+type ProblemDetails struct {
+	*UnexpectedResponseCodeError
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]json.RawMessage
+}
+
+func (err *ProblemDetails) Error() string {
+	msg := err.Title
+	if msg == "" {
+		msg = err.Type
+	}
+	if err.Detail != "" {
+		msg += ": " + err.Detail
+	}
+	return fmt.Sprintf("Problem with status %d when accessing URL(%s): %s", err.Status, err.Url, msg)
+}
+
+func (err *ProblemDetails) Unwrap() error {
+	return err.UnexpectedResponseCodeError
+}
+
+// Extension decodes the named extension member into v.
+// The boolean result is false if the problem has no such member.
+func (err *ProblemDetails) Extension(name string, v interface{}) (bool, error) {
+	raw, ok := err.Extensions[name]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// newProblemDetails parses the problem details in the body of an unacceptable response.
+// The boolean result is false if the body doesn't hold a JSON object.
+func newProblemDetails(unexpected *UnexpectedResponseCodeError) (*ProblemDetails, bool) {
+	var members map[string]json.RawMessage
+	if json.Unmarshal(unexpected.Body, &members) != nil || members == nil {
+		return nil, false
+	}
+	problem := &ProblemDetails{UnexpectedResponseCodeError: unexpected, Type: "about:blank", Status: unexpected.Actual}
+	// RFC 7807 says to ignore standard members of the wrong type, which Unmarshal leaves unset.
+	for name, raw := range members {
+		switch name {
+		case "type":
+			json.Unmarshal(raw, &problem.Type)
+		case "title":
+			json.Unmarshal(raw, &problem.Title)
+		case "status":
+			json.Unmarshal(raw, &problem.Status)
+		case "detail":
+			json.Unmarshal(raw, &problem.Detail)
+		case "instance":
+			json.Unmarshal(raw, &problem.Instance)
+		default:
+			if problem.Extensions == nil {
+				problem.Extensions = make(map[string]json.RawMessage)
+			}
+			problem.Extensions[name] = raw
+		}
+	}
+	return problem, true
+}
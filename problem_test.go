@@ -0,0 +1,49 @@
+package perigee
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProblemDetails(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"type":"https://example.com/probs/out-of-credit","title":"You do not have enough credit.",` +
+			`"detail":"Your current balance is 30, but that costs 50.","instance":"/account/12345/msgs/abc","balance":30}`))
+	}))
+	defer ts.Close()
+
+	_, err := Request("GET", ts.URL, Options{OkCodes: []int{200}})
+	var problem *ProblemDetails
+	if !errors.As(err, &problem) {
+		t.Fatalf("Expected a ProblemDetails; got %#v", err)
+	}
+	if problem.Type != "https://example.com/probs/out-of-credit" || problem.Status != 403 || problem.Instance != "/account/12345/msgs/abc" {
+		t.Fatalf("Unexpected problem %+v", problem)
+	}
+	if !strings.Contains(err.Error(), "Your current balance is 30") {
+		t.Fatalf("Expected the detail in the message; got %q", err.Error())
+	}
+	var balance int
+	if ok, err := problem.Extension("balance", &balance); !ok || err != nil || balance != 30 {
+		t.Fatalf("Expected the balance extension; got %v, %v, %d", ok, err, balance)
+	}
+	var unexpected *UnexpectedResponseCodeError
+	if !errors.As(err, &unexpected) || unexpected.Actual != 403 {
+		t.Fatalf("Expected the ProblemDetails to wrap an UnexpectedResponseCodeError; got %v", err)
+	}
+}
+
+func TestProblemDetailsDefaults(t *testing.T) {
+	problem, ok := newProblemDetails(&UnexpectedResponseCodeError{Actual: 500, Body: []byte(`{"status":"oops","title":7}`)})
+	if !ok || problem.Type != "about:blank" || problem.Status != 500 || problem.Title != "" || problem.Extensions != nil {
+		t.Fatalf("Expected defaults in place of members of the wrong type; got %+v", problem)
+	}
+	if _, ok := newProblemDetails(&UnexpectedResponseCodeError{Actual: 500, Body: []byte("not json")}); ok {
+		t.Fatal("Expected no problem details from a body which isn't JSON")
+	}
+}
@@ -0,0 +1,123 @@
+package perigee
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// The QueryParamError structure is returned when a field of Options.QueryParams cannot be rendered as a query parameter.
+type QueryParamError struct {
+	Param string
+	Field string
+	Err   error
+}
+
+func (err *QueryParamError) Error() string {
+	return fmt.Sprintf("Cannot encode field %s as query parameter %s: %s", err.Field, err.Param, err.Err)
+}
+
+// encodeQuery builds query parameters from url.Values, a map[string]string, or the fields of a structure (or a pointer to one).
+//
+// A field's url tag names its parameter, as in `url:"limit"`; untagged exported fields use the field's name, and `url:"-"` skips a field.
+// The omitempty option (`url:"marker,omitempty"`) omits zero values (empty strings, zero numbers, false, the zero time, and the like);
+// nil pointers and empty slices are always omitted.
+// Fields may be strings, integers, floating-point numbers, booleans, time.Time (sent in RFC 3339 form), or time.Duration (as whole seconds),
+// pointers to any of these, or slices of them, sent as one parameter per element.
+func encodeQuery(v interface{}) (url.Values, error) {
+	switch params := v.(type) {
+	case url.Values:
+		return params, nil
+	case map[string]string:
+		values := make(url.Values, len(params))
+		for k, v := range params {
+			values.Set(k, v)
+		}
+		return values, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.New("perigee: QueryParams must be url.Values, a map[string]string, or a structure")
+	}
+	rt := rv.Type()
+	values := make(url.Values)
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get("url")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+		omitEmpty := opts == "omitempty"
+		field := rv.Field(i)
+
+		if field.Kind() == reflect.Slice {
+			for j := 0; j < field.Len(); j++ {
+				value, err := formatQueryValue(field.Index(j))
+				if err != nil {
+					return nil, &QueryParamError{Param: name, Field: sf.Name, Err: err}
+				}
+				values.Add(name, value)
+			}
+			continue
+		}
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		} else if omitEmpty && field.IsZero() {
+			continue
+		}
+		value, err := formatQueryValue(field)
+		if err != nil {
+			return nil, &QueryParamError{Param: name, Field: sf.Name, Err: err}
+		}
+		values.Add(name, value)
+	}
+	return values, nil
+}
+
+// formatQueryValue renders a field as a query parameter value.
+// Only times are rendered differently from headers: in RFC 3339 form, which needs no spaces.
+func formatQueryValue(field reflect.Value) (string, error) {
+	if field.Type() == timeType {
+		return field.Interface().(time.Time).UTC().Format(time.RFC3339), nil
+	}
+	return formatHeaderValue(field)
+}
+
+// appendQuery adds the parameters encoded from params to the query of a URL, after any it already has.
+func appendQuery(rawurl string, params interface{}) (string, error) {
+	values, err := encodeQuery(params)
+	if err != nil || len(values) == 0 {
+		return rawurl, err
+	}
+	query := values.Encode()
+	base, fragment, hasFragment := strings.Cut(rawurl, "#")
+	switch {
+	case !strings.Contains(base, "?"):
+		base += "?" + query
+	case strings.HasSuffix(base, "?") || strings.HasSuffix(base, "&"):
+		base += query
+	default:
+		base += "&" + query
+	}
+	if hasFragment {
+		base += "#" + fragment
+	}
+	return base, nil
+}
@@ -0,0 +1,108 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type listServersQuery struct {
+	Limit   int       `url:"limit,omitempty"`
+	Marker  string    `url:"marker,omitempty"`
+	Status  []string  `url:"status"`
+	Deleted bool      `url:"deleted"`
+	Since   time.Time `url:"changes-since,omitempty"`
+	Name    *string   `url:"name"`
+	Flavor  string
+	Secret  string `url:"-"`
+}
+
+func TestEncodeQuery(t *testing.T) {
+	name := "web & db"
+	values, err := encodeQuery(&listServersQuery{
+		Limit:  10,
+		Status: []string{"ACTIVE", "ERROR"},
+		Since:  time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Name:   &name,
+		Flavor: "m1.small",
+		Secret: "hidden",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Flavor=m1.small&changes-since=2024-05-01T12%3A00%3A00Z&deleted=false&limit=10&name=web+%26+db&status=ACTIVE&status=ERROR"
+	if values.Encode() != want {
+		t.Fatalf("Expected %s; got %s", want, values.Encode())
+	}
+
+	if _, err := encodeQuery(struct{ Bad map[string]int }{map[string]int{"a": 1}}); err == nil {
+		t.Fatal("Expected an error for an unsupported field type")
+	}
+	if _, err := encodeQuery(42); err == nil {
+		t.Fatal("Expected an error for parameters which aren't a structure")
+	}
+}
+
+func TestAppendQuery(t *testing.T) {
+	params := url.Values{"limit": {"5"}}
+	for rawurl, want := range map[string]string{
+		"http://x/servers":              "http://x/servers?limit=5",
+		"http://x/servers?all_tenants":  "http://x/servers?all_tenants&limit=5",
+		"http://x/servers?":             "http://x/servers?limit=5",
+		"http://x/servers?a=1#fragment": "http://x/servers?a=1&limit=5#fragment",
+	} {
+		got, err := appendQuery(rawurl, params)
+		if err != nil || got != want {
+			t.Errorf("Expected %s; got %s, %v", want, got, err)
+		}
+	}
+}
+
+func TestQueryParams(t *testing.T) {
+	var query url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+	}))
+	defer ts.Close()
+
+	_, err := Request("GET", ts.URL+"/servers?detail=true", Options{QueryParams: listServersQuery{Marker: "a/b c", Status: []string{"ACTIVE"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("detail") != "true" || query.Get("marker") != "a/b c" || query.Get("status") != "ACTIVE" || query.Has("limit") {
+		t.Fatalf("Unexpected query %v", query)
+	}
+}
+
+func TestFormBody(t *testing.T) {
+	var contentType string
+	var form url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		r.ParseForm()
+		form = r.PostForm
+	}))
+	defer ts.Close()
+
+	type tokenRequest struct {
+		GrantType string   `url:"grant_type"`
+		Scope     []string `url:"scope"`
+		Secret    string   `url:"client_secret,omitempty"`
+	}
+	_, err := Request("POST", ts.URL, Options{
+		FormBody: tokenRequest{GrantType: "client_credentials", Scope: []string{"read", "write&more"}},
+		ReqBody:  map[string]string{"ignored": "yes"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/x-www-form-urlencoded" {
+		t.Fatalf("Expected a form Content-Type; got %q", contentType)
+	}
+	want := url.Values{"grant_type": {"client_credentials"}, "scope": {"read", "write&more"}}
+	if form.Encode() != want.Encode() {
+		t.Fatalf("Expected form %v; got %v", want, form)
+	}
+}
@@ -0,0 +1,428 @@
+package perigee
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyHeader names the header carrying a queued request's idempotency key, unless a RequestQueue names another.
+const DefaultIdempotencyHeader = "Idempotency-Key"
+
+// The QueuedError structure is returned when a RequestQueue stores a request for later replay instead of delivering it.
+// ID is the request's idempotency key; Err, the failure which prompted queuing, or nil if earlier requests were already queued.
+type QueuedError struct {
+	ID  string
+	Err error
+}
+
+func (err *QueuedError) Error() string {
+	if err.Err == nil {
+		return fmt.Sprintf("Request queued for replay behind earlier requests (idempotency key %s)", err.ID)
+	}
+	return fmt.Sprintf("Request queued for replay (idempotency key %s): %s", err.ID, err.Err)
+}
+
+// QueuedRequest is the unit of storage for a QueueStore: everything needed to send a request again.
+type QueuedRequest struct {
+	ID          string
+	Method      string
+	Url         string
+	Headers     map[string]string
+	ContentType string
+	Body        []byte
+	Enqueued    time.Time
+}
+
+// QueueStore persists the requests held by a RequestQueue, in the order they were pushed.
+// Implementations must be safe for concurrent use.
+type QueueStore interface {
+	Push(r *QueuedRequest) error
+	Front() (*QueuedRequest, error) // nil if the store is empty
+	Remove(id string) error
+	Len() (int, error)
+}
+
+// MemoryQueue is a QueueStore which keeps requests in memory; they are lost if the process exits.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	requests []*QueuedRequest
+}
+
+// NewMemoryQueue creates an empty in-memory queue.
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{}
+}
+
+// Push implements the QueueStore interface.
+func (q *MemoryQueue) Push(r *QueuedRequest) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.requests = append(q.requests, r)
+	return nil
+}
+
+// Front implements the QueueStore interface.
+func (q *MemoryQueue) Front() (*QueuedRequest, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.requests) == 0 {
+		return nil, nil
+	}
+	return q.requests[0], nil
+}
+
+// Remove implements the QueueStore interface.
+func (q *MemoryQueue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, r := range q.requests {
+		if r.ID == id {
+			q.requests = append(q.requests[:i], q.requests[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Len implements the QueueStore interface.
+func (q *MemoryQueue) Len() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.requests), nil
+}
+
+// DiskQueue is a QueueStore backed by a directory, so that queued requests survive process restarts.
+// Each request is stored as a JSON file named by its sequence number, written atomically as DiskCache's files are.
+//
+// A DiskQueue is safe for concurrent use within a process; sharing a directory between concurrently running processes is not supported.
+type DiskQueue struct {
+	dir  string
+	mu   sync.Mutex
+	next uint64
+}
+
+// OpenDiskQueue opens the queue stored in dir, creating the directory if needed.
+func OpenDiskQueue(dir string) (*DiskQueue, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	q := &DiskQueue{dir: dir}
+	names, err := q.names()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		fmt.Sscanf(names[len(names)-1], "%d-", &q.next)
+		q.next++
+	}
+	return q, nil
+}
+
+// names lists the queue's files in order.
+func (q *DiskQueue) names() ([]string, error) {
+	entries, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Push implements the QueueStore interface.
+func (q *DiskQueue) Push(r *QueuedRequest) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	name := fmt.Sprintf("%020d-%s.json", q.next, r.ID)
+	err = writeFile(filepath.Join(q.dir, name), data)
+	if err == nil {
+		q.next++
+	}
+	return err
+}
+
+// Front implements the QueueStore interface.
+func (q *DiskQueue) Front() (*QueuedRequest, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	names, err := q.names()
+	if err != nil || len(names) == 0 {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(q.dir, names[0]))
+	if err != nil {
+		return nil, err
+	}
+	r := new(QueuedRequest)
+	err = json.Unmarshal(data, r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", names[0], err)
+	}
+	return r, nil
+}
+
+// Remove implements the QueueStore interface.
+func (q *DiskQueue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	names, err := q.names()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, "-"+id+".json") {
+			return os.Remove(filepath.Join(q.dir, name))
+		}
+	}
+	return nil
+}
+
+// Len implements the QueueStore interface.
+func (q *DiskQueue) Len() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	names, err := q.names()
+	return len(names), err
+}
+
+// RequestQueue delivers mutating requests (POST, PUT, PATCH, and DELETE) to an upstream which may be unreachable at times,
+// as befits agents running at the network's edge.
+// A mutating request which cannot reach the server is stored in the QueueStore, and Do returns a *QueuedError.
+// Once any request is queued, subsequent mutating requests queue up behind it, so that they reach the server in the order they were made.
+// Replay delivers the queued requests once connectivity returns.
+// Other requests are simply passed to Request.
+//
+// Every mutating request carries a freshly generated idempotency key, in the header named by IdempotencyHeader,
+// both when first sent and when replayed.
+// Servers honoring the key can then discard a replay of a request which in fact arrived before the connection failed.
+//
+// Only what is needed to send a request is queued: its method, URL, MoreHeaders and ReqHeaders, content type, and body.
+// Options holds everything else applied when the request is sent, whether live or replayed (the HTTP client, authentication hooks, and the like);
+// the Options given to Do are layered over it as Client layers its defaults.
+// The results of a replayed request are reported only to OnReplay.
+type RequestQueue struct {
+	Store             QueueStore
+	Options           Options
+	IdempotencyHeader string
+	OnReplay          func(r *QueuedRequest, resp *Response, err error)
+
+	mu sync.Mutex
+}
+
+// NewRequestQueue creates a RequestQueue keeping undeliverable requests in the given store.
+func NewRequestQueue(store QueueStore, defaults Options) *RequestQueue {
+	return &RequestQueue{Store: store, Options: defaults}
+}
+
+// mutating reports whether requests of the given method change state on the server, and so must not be lost.
+func mutating(method string) bool {
+	switch strings.ToUpper(method) {
+	case "POST", "PUT", "PATCH", "DELETE":
+		return true
+	}
+	return false
+}
+
+// newIdempotencyKey generates a random key.
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// capture records what is needed to send a request again, consuming its body if it is an io.Reader.
+// Headers come from opts alone, so that the defaults' (such as a token since renewed) are applied afresh on replay;
+// the body is taken from opts layered over the defaults, as Request would send it.
+func capture(method, url string, defaults, opts Options) (*QueuedRequest, error) {
+	id, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+	r := &QueuedRequest{
+		ID:       id,
+		Method:   method,
+		Url:      url,
+		Headers:  opts.MoreHeaders,
+		Enqueued: time.Now(),
+	}
+	if opts.ReqHeaders != nil {
+		headers, err := encodeHeaders(opts.ReqHeaders)
+		if err != nil {
+			return nil, err
+		}
+		r.Headers = make(map[string]string)
+		for k, v := range opts.MoreHeaders {
+			r.Headers[k] = v
+		}
+		for k := range headers {
+			r.Headers[k] = headers.Get(k)
+		}
+	}
+
+	opts = defaults.Merge(opts)
+	if opts.QueryParams != nil {
+		r.Url, err = appendQuery(url, opts.QueryParams)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.ContentType = opts.ContentType
+	if opts.RawBody != nil {
+		if r.ContentType == "" && !opts.OmitContentType {
+			r.ContentType = "application/octet-stream"
+		}
+		r.Body, err = ioutil.ReadAll(opts.RawBody)
+		return r, err
+	}
+	if opts.FormBody != nil {
+		form, err := encodeQuery(opts.FormBody)
+		if err != nil {
+			return nil, err
+		}
+		if r.ContentType == "" && !opts.OmitContentType {
+			r.ContentType = "application/x-www-form-urlencoded"
+		}
+		r.Body = []byte(form.Encode())
+		return r, nil
+	}
+	if opts.ReqBody == nil {
+		r.ContentType = ""
+		return r, nil
+	}
+	if r.ContentType == "" && !opts.OmitContentType {
+		r.ContentType = "application/json"
+		if opts.Codec != nil {
+			r.ContentType = opts.Codec.ContentType()
+		}
+	}
+	// Bodies are encoded as Request encodes them.
+	reader, ok := opts.ReqBody.(io.Reader)
+	switch {
+	case ok && opts.Codec != nil:
+		r.Body, err = ioutil.ReadAll(reader)
+	case opts.Codec != nil:
+		r.Body, err = opts.Codec.Marshal(opts.ReqBody)
+	case r.ContentType == "application/json":
+		r.Body, err = marshalJSON(opts)
+	case ok:
+		r.Body, err = ioutil.ReadAll(reader)
+	default:
+		return nil, fmt.Errorf("cannot queue a request body of type %T", opts.ReqBody)
+	}
+	return r, err
+}
+
+// options reconstitutes the Options sending a queued request.
+// The body and URL are sent as captured, so the Options which produced them are cleared.
+func (q *RequestQueue) options(r *QueuedRequest, opts Options) Options {
+	header := q.IdempotencyHeader
+	if header == "" {
+		header = DefaultIdempotencyHeader
+	}
+	headers := map[string]string{header: r.ID}
+	for k, v := range r.Headers {
+		headers[k] = v
+	}
+	opts.MoreHeaders = headers
+	opts.ReqHeaders = nil
+	opts = q.Options.Merge(opts)
+	opts.ContentType = r.ContentType
+	opts.ReqBody, opts.RawBody, opts.FormBody, opts.QueryParams = nil, nil, nil, nil
+	if r.Body != nil {
+		if r.ContentType == "application/json" && opts.Codec == nil {
+			opts.ReqBody = json.RawMessage(r.Body)
+		} else {
+			opts.RawBody = bytes.NewReader(r.Body)
+		}
+	}
+	return opts
+}
+
+// Do issues a request as Request does, queuing it if it is a mutating request which cannot be delivered now.
+func (q *RequestQueue) Do(method, url string, opts Options) (*Response, error) {
+	if !mutating(method) {
+		return Request(method, url, q.Options.Merge(opts))
+	}
+	r, err := capture(method, url, q.Options, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	n, err := q.Store.Len()
+	if err == nil && n > 0 {
+		err = q.Store.Push(r)
+		q.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return nil, &QueuedError{ID: r.ID}
+	}
+	q.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := Request(method, r.Url, q.options(r, opts))
+	if err != nil && transportFailure(err) {
+		q.mu.Lock()
+		pushErr := q.Store.Push(r)
+		q.mu.Unlock()
+		if pushErr != nil {
+			return resp, err
+		}
+		return resp, &QueuedError{ID: r.ID, Err: err}
+	}
+	return resp, err
+}
+
+// Replay delivers queued requests in order, removing each from the store once the server has answered it, however it answered.
+// It stops at the first request which still cannot reach the server, leaving it and those behind it queued,
+// and returns the number of requests delivered along with the failure.
+func (q *RequestQueue) Replay() (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delivered := 0
+	for {
+		r, err := q.Store.Front()
+		if err != nil || r == nil {
+			return delivered, err
+		}
+		resp, reqErr := Request(r.Method, r.Url, q.options(r, Options{}))
+		if reqErr != nil && transportFailure(reqErr) {
+			return delivered, reqErr
+		}
+		err = q.Store.Remove(r.ID)
+		if err != nil {
+			return delivered, err
+		}
+		delivered++
+		if q.OnReplay != nil {
+			q.OnReplay(r, resp, reqErr)
+		}
+	}
+}
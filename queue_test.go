@@ -0,0 +1,232 @@
+package perigee
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// toggledServer answers requests only while up is true; otherwise connections are refused.
+type toggledServer struct {
+	ts       *httptest.Server
+	listener net.Listener
+	received []string
+	keys     []string
+}
+
+func newToggledServer() *toggledServer {
+	s := &toggledServer{}
+	s.ts = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		s.received = append(s.received, r.Method+" "+string(b))
+		s.keys = append(s.keys, r.Header.Get("Idempotency-Key"))
+		w.WriteHeader(201)
+	}))
+	s.listener = s.ts.Listener
+	return s
+}
+
+func (s *toggledServer) url() string { return "http://" + s.listener.Addr().String() }
+
+func (s *toggledServer) up() {
+	s.ts.Listener = s.listener
+	s.ts.Start()
+}
+
+func testQueueReplay(t *testing.T, store QueueStore) {
+	server := newToggledServer()
+	addr := server.listener.Addr().String()
+	server.listener.Close()
+
+	queue := NewRequestQueue(store, Options{OkCodes: []int{201}})
+	var replayed []string
+	queue.OnReplay = func(r *QueuedRequest, resp *Response, err error) {
+		if err != nil {
+			t.Errorf("Replay of %s failed: %s", r.ID, err)
+		}
+		replayed = append(replayed, r.ID)
+	}
+
+	var ids []string
+	for _, body := range []interface{}{map[string]int{"n": 1}, strings.NewReader("two")} {
+		opts := Options{ReqBody: body}
+		if _, ok := body.(*strings.Reader); ok {
+			opts.ContentType = "text/plain"
+		}
+		_, err := queue.Do("POST", "http://"+addr, opts)
+		queued, ok := err.(*QueuedError)
+		if !ok {
+			t.Fatalf("Expected the request to be queued; got %#v", err)
+		}
+		ids = append(ids, queued.ID)
+	}
+	if n, _ := store.Len(); n != 2 {
+		t.Fatalf("Expected two queued requests; got %d", n)
+	}
+
+	// Still down: nothing is delivered.
+	n, err := queue.Replay()
+	if n != 0 || err == nil {
+		t.Fatalf("Expected replay to fail while the server is down; got %d, %v", n, err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("Cannot reclaim %s: %s", addr, err)
+	}
+	server.listener = listener
+	server.up()
+	defer server.ts.Close()
+
+	// Requests made while others are queued go to the back of the line.
+	_, err = queue.Do("DELETE", server.url(), Options{})
+	if _, ok := err.(*QueuedError); !ok {
+		t.Fatalf("Expected the request to queue behind the others; got %#v", err)
+	}
+
+	n, err = queue.Replay()
+	if err != nil || n != 3 {
+		t.Fatalf("Expected all three requests to be delivered; got %d, %v", n, err)
+	}
+	want := []string{`POST {"n":1}`, "POST two", "DELETE "}
+	for i := range want {
+		if server.received[i] != want[i] {
+			t.Fatalf("Expected requests to be delivered in order %q; got %q", want, server.received)
+		}
+	}
+	if server.keys[0] != ids[0] || server.keys[1] != ids[1] || replayed[0] != ids[0] {
+		t.Fatalf("Expected idempotency keys %v to be sent; got %v", ids, server.keys)
+	}
+	if n, _ := store.Len(); n != 0 {
+		t.Fatalf("Expected an empty queue; got %d", n)
+	}
+
+	// With the queue empty, requests go straight through.
+	_, err = queue.Do("PUT", server.url(), Options{ReqBody: map[string]int{"n": 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.received) != 4 || server.keys[3] == "" {
+		t.Fatalf("Expected a live request carrying an idempotency key; got %q", server.keys)
+	}
+}
+
+func TestRequestQueueMemory(t *testing.T) {
+	testQueueReplay(t, NewMemoryQueue())
+}
+
+func TestRequestQueueDisk(t *testing.T) {
+	testQueueReplay(t, mustOpenDiskQueue(t, t.TempDir()))
+}
+
+func mustOpenDiskQueue(t *testing.T, dir string) *DiskQueue {
+	q, err := OpenDiskQueue(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestDiskQueueSurvivesReopening(t *testing.T) {
+	dir := t.TempDir()
+	q := mustOpenDiskQueue(t, dir)
+	for _, id := range []string{"a", "b"} {
+		if err := q.Push(&QueuedRequest{ID: id, Method: "POST", Body: []byte(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q = mustOpenDiskQueue(t, dir)
+	q.Push(&QueuedRequest{ID: "c"})
+	var order []string
+	for {
+		r, err := q.Front()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r == nil {
+			break
+		}
+		order = append(order, r.ID)
+		q.Remove(r.ID)
+	}
+	if strings.Join(order, "") != "abc" {
+		t.Fatalf("Expected requests in order a, b, c; got %v", order)
+	}
+}
+
+// receivedRequest is what a server saw of a request.
+type receivedRequest struct {
+	URL         string
+	ContentType string
+	Body        string
+}
+
+// sendQueued issues a request through a RequestQueue, queued behind an earlier request and replayed if queued is set,
+// and returns what the server received.
+func sendQueued(t *testing.T, queued bool, path string, defaults, opts Options) receivedRequest {
+	var last receivedRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		last = receivedRequest{r.URL.RequestURI(), r.Header.Get("Content-Type"), string(b)}
+	}))
+	defer ts.Close()
+
+	queue := NewRequestQueue(NewMemoryQueue(), defaults)
+	if !queued {
+		if _, err := queue.Do("POST", ts.URL+path, opts); err != nil {
+			t.Fatal(err)
+		}
+		return last
+	}
+	queue.Store.Push(&QueuedRequest{ID: "earlier", Method: "DELETE", Url: ts.URL})
+	if _, err := queue.Do("POST", ts.URL+path, opts); err == nil {
+		t.Fatal("Expected the request to be queued")
+	}
+	if n, err := queue.Replay(); n != 2 || err != nil {
+		t.Fatalf("Expected both requests to be replayed; got %d, %v", n, err)
+	}
+	return last
+}
+
+func TestRequestQueueRawBody(t *testing.T) {
+	for _, queued := range []bool{false, true} {
+		got := sendQueued(t, queued, "/", Options{}, Options{RawBody: strings.NewReader("RAW")})
+		if got.Body != "RAW" || got.ContentType != "application/octet-stream" {
+			t.Fatalf("Expected the raw body (queued: %v); got %+v", queued, got)
+		}
+	}
+}
+
+func TestRequestQueueFormBody(t *testing.T) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	for _, queued := range []bool{false, true} {
+		got := sendQueued(t, queued, "/", Options{}, Options{FormBody: form})
+		if got.Body != "grant_type=client_credentials" || got.ContentType != "application/x-www-form-urlencoded" {
+			t.Fatalf("Expected the form (queued: %v); got %+v", queued, got)
+		}
+	}
+}
+
+func TestRequestQueueQueryParams(t *testing.T) {
+	for _, queued := range []bool{false, true} {
+		got := sendQueued(t, queued, "/q?a=1", Options{QueryParams: url.Values{"d": {"4"}}}, Options{QueryParams: url.Values{"b": {"2"}}})
+		if got.URL != "/q?a=1&b=2" {
+			t.Fatalf("Expected the query parameters once (queued: %v); got %s", queued, got.URL)
+		}
+	}
+}
+
+func TestRequestQueueCodec(t *testing.T) {
+	want, _ := MsgPackCodec.Marshal(map[string]int{"n": 1})
+	for _, queued := range []bool{false, true} {
+		got := sendQueued(t, queued, "/", Options{Codec: MsgPackCodec}, Options{ReqBody: map[string]int{"n": 1}})
+		if got.Body != string(want) || got.ContentType != "application/msgpack" {
+			t.Fatalf("Expected a MessagePack body labeled as such (queued: %v); got %+v", queued, got)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Redacted replaces the values of redacted fields in logged bodies; see Options.RedactFields.
+const Redacted = "[REDACTED]"
+
+// redactJSON masks the fields of a JSON document named by paths, returning the document unchanged if none appears, or if it is not JSON.
+func redactJSON(data []byte, paths []string) []byte {
+	if len(paths) == 0 || len(data) == 0 {
+		return data
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if dec.Decode(&doc) != nil {
+		return data
+	}
+	split := make([][]string, len(paths))
+	for i, p := range paths {
+		split[i] = strings.Split(p, ".")
+	}
+	if !redactValue(doc, nil, split) {
+		return data
+	}
+	redacted, err := json.Marshal(doc)
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+// redactValue masks, in place, the fields of v whose key paths, from the document's root, end with any of paths.
+// It reports whether anything was masked.
+func redactValue(v interface{}, keys []string, paths [][]string) bool {
+	masked := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			path := append(keys[:len(keys):len(keys)], k)
+			if matchesRedaction(path, paths) {
+				v[k] = Redacted
+				masked = true
+			} else if redactValue(child, path, paths) {
+				masked = true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if redactValue(child, keys, paths) {
+				masked = true
+			}
+		}
+	}
+	return masked
+}
+
+// matchesRedaction reports whether a key path ends with any of the given paths, ignoring case.
+func matchesRedaction(keys []string, paths [][]string) bool {
+next:
+	for _, p := range paths {
+		if len(p) > len(keys) {
+			continue
+		}
+		tail := keys[len(keys)-len(p):]
+		for i := range p {
+			if !strings.EqualFold(p[i], tail[i]) {
+				continue next
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// A Scrubber masks sensitive data, such as personal information, in bytes perigee is about to log, dump, or attach to an error;
+// see Options.Scrubber.
+// It returns the data to use instead, and may modify data in place, since perigee hands it a copy.
+type Scrubber func(data []byte) []byte
+
+// scrub applies the scrubber, if any, to a copy of data, leaving data itself, which may back a Response's fields, intact.
+func (s Scrubber) scrub(data []byte) []byte {
+	if s == nil || data == nil {
+		return data
+	}
+	return s(append([]byte(nil), data...))
+}
@@ -0,0 +1,144 @@
+package perigee
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedactJSON(t *testing.T) {
+	body := []byte(`{"auth":{"passwordCredentials":{"username":"joe","Password":"hunter2"}},` +
+		`"authentication":{"apiKey":"k1"},"keys":[{"apiKey":"k2"}],"token":{"id":"t1"}}`)
+	got := string(redactJSON(body, []string{"password", "authentication.apiKey", "token"}))
+	for _, secret := range []string{"hunter2", "k1", "t1"} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("Expected %s to be redacted; got %s", secret, got)
+		}
+	}
+	if !strings.Contains(got, `"username":"joe"`) || !strings.Contains(got, `"apiKey":"k2"`) {
+		t.Fatalf("Expected other fields to be kept; got %s", got)
+	}
+
+	for _, unchanged := range []string{`not json`, `{"b":1, "a":2}`} {
+		if got := string(redactJSON([]byte(unchanged), []string{"password"})); got != unchanged {
+			t.Fatalf("Expected %s unchanged; got %s", unchanged, got)
+		}
+	}
+}
+
+func TestRedactFieldsInLogsAndErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+		w.Write([]byte(`{"error":"bad credentials","echo":{"password":"hunter2"}}`))
+	}))
+	defer ts.Close()
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	_, err := Request("POST", ts.URL, Options{
+		ReqBody:      map[string]string{"username": "joe", "password": "hunter2"},
+		DumpReqJson:  true,
+		OkCodes:      []int{200},
+		RedactFields: []string{"password"},
+	})
+	if err == nil {
+		t.Fatal("Expected an UnexpectedResponseCodeError")
+	}
+	if strings.Contains(logged.String(), "hunter2") || !strings.Contains(logged.String(), Redacted) {
+		t.Fatalf("Expected the dumped request to be redacted; got %s", logged.String())
+	}
+	if strings.Contains(err.Error(), "hunter2") || !strings.Contains(err.Error(), "bad credentials") {
+		t.Fatalf("Expected the error message to be redacted; got %s", err)
+	}
+	if !strings.Contains(string(err.(*UnexpectedResponseCodeError).Body), "hunter2") {
+		t.Fatal("Expected the error's Body to be left as it is")
+	}
+}
+
+func TestScrubber(t *testing.T) {
+	ssn := regexp.MustCompile(`\d{3}-\d{2}-\d{4}`)
+	scrub := func(data []byte) []byte { return ssn.ReplaceAll(data, []byte("XXX-XX-XXXX")) }
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/html" {
+			w.Write([]byte(`<html><body>No record for 123-45-6789</body></html>`))
+			return
+		}
+		w.WriteHeader(404)
+		w.Write([]byte(`{"error":"no record for 123-45-6789"}`))
+	}))
+	defer ts.Close()
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	_, err := Request("POST", ts.URL, Options{
+		ReqBody:     map[string]string{"ssn": "123-45-6789"},
+		DumpReqJson: true,
+		OkCodes:     []int{200},
+		Scrubber:    scrub,
+	})
+	if err == nil || strings.Contains(err.Error(), "6789") || strings.Contains(string(err.(*UnexpectedResponseCodeError).Body), "6789") {
+		t.Fatalf("Expected the error body to be scrubbed; got %v", err)
+	}
+	if strings.Contains(logged.String(), "6789") || !strings.Contains(logged.String(), "XXX-XX-XXXX") {
+		t.Fatalf("Expected the dumped request to be scrubbed; got %s", logged.String())
+	}
+
+	var results map[string]interface{}
+	_, err = Request("GET", ts.URL+"/html", Options{Results: &results, Scrubber: scrub})
+	if _, ok := err.(*UpstreamHTMLError); !ok || strings.Contains(err.Error(), "6789") {
+		t.Fatalf("Expected a scrubbed UpstreamHTMLError; got %v", err)
+	}
+}
+
+func TestScrubberLeavesResponseIntact(t *testing.T) {
+	// The scrubber modifies its input in place, and leaves invalid JSON behind, which RedactFields could not mask afterwards.
+	scrubDigits := func(data []byte) []byte {
+		for i, c := range data {
+			if c >= '0' && c <= '9' {
+				data[i] = 'X'
+			}
+		}
+		return append(data, " (scrubbed)"...)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/html" {
+			w.Write([]byte(`<html><body>Account 1234</body></html>`))
+			return
+		}
+		w.WriteHeader(409)
+		w.Write([]byte(`{"account":"1234","password":"secret"}`))
+	}))
+	defer ts.Close()
+
+	var details map[string]string
+	_, err := Request("GET", ts.URL, Options{OkCodes: []int{200}, ErrorResults: &details, RedactFields: []string{"password"}, Scrubber: scrubDigits})
+	e, ok := err.(*UnexpectedResponseCodeError)
+	if !ok || details["account"] != "1234" {
+		t.Fatalf("Expected ErrorResults to receive the original body; got %v", details)
+	}
+	if string(e.Body) != `{"account":"XXXX","password":"secret"} (scrubbed)` {
+		t.Fatalf("Expected the error's Body to be scrubbed, but not redacted; got %s", e.Body)
+	}
+	if msg := e.Error(); strings.Contains(msg, "secret") || strings.Contains(msg, "1234") || !strings.Contains(msg, "(scrubbed)") {
+		t.Fatalf("Expected the message to quote the body redacted, then scrubbed; got %q", msg)
+	}
+
+	var results map[string]interface{}
+	resp, err := Request("GET", ts.URL+"/html", Options{Results: &results, Scrubber: scrubDigits})
+	if _, ok := err.(*UpstreamHTMLError); !ok || strings.Contains(err.Error(), "1234") {
+		t.Fatalf("Expected a scrubbed UpstreamHTMLError; got %v", err)
+	}
+	if string(resp.JsonResult) != `<html><body>Account 1234</body></html>` {
+		t.Fatalf("Expected JsonResult to keep the original body; got %s", resp.JsonResult)
+	}
+}
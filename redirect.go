@@ -0,0 +1,30 @@
+package perigee
+
+// Redirect is one hop of a redirect chain: a URL requested, and the status code of the redirect it was answered with.
+type Redirect struct {
+	URL        string
+	StatusCode int
+}
+
+// Redirects lists the redirects followed on the way to the response, in the order they were followed,
+// so that callers can see when an API moves them between versions or regions; FinalURL gives where they ended up.
+// It returns nil if the request wasn't redirected.
+func (r *Response) Redirects() []Redirect {
+	var chain []Redirect
+	for req := r.HttpResponse.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		hop := Redirect{StatusCode: req.Response.StatusCode}
+		if req.Response.Request != nil && req.Response.Request.URL != nil {
+			hop.URL = req.Response.Request.URL.String()
+		}
+		chain = append(chain, hop)
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// FinalURL returns the URL the response was fetched from, after any redirects.
+func (r *Response) FinalURL() string {
+	return r.url()
+}
@@ -0,0 +1,44 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRedirects(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/servers":
+			http.Redirect(w, r, "/v2/servers", http.StatusMovedPermanently)
+		case "/v2/servers":
+			http.Redirect(w, r, ts.URL+"/region-b/v2/servers", http.StatusTemporaryRedirect)
+		}
+	}))
+	defer ts.Close()
+
+	resp, err := Request("GET", ts.URL+"/v1/servers", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Redirect{
+		{URL: ts.URL + "/v1/servers", StatusCode: 301},
+		{URL: ts.URL + "/v2/servers", StatusCode: 307},
+	}
+	if got := resp.Redirects(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v; got %v", want, got)
+	}
+	if resp.FinalURL() != ts.URL+"/region-b/v2/servers" {
+		t.Fatalf("Unexpected final URL %s", resp.FinalURL())
+	}
+
+	resp, err = Request("GET", ts.URL+"/region-b/v2/servers", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Redirects(); got != nil {
+		t.Fatalf("Expected no redirects; got %v", got)
+	}
+}
@@ -0,0 +1,46 @@
+package perigee
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ReplayGuard stamps each request with the time it was sent and a nonce never used before,
+// for APIs which reject requests replayed by an eavesdropper; see Options.ReplayGuard.
+//
+// TimestampHeader and NonceHeader name the headers, X-Request-Timestamp and X-Request-Nonce if empty.
+// The timestamp is given in Unix seconds, unless TimeFormat holds a layout for time.Time.Format (e.g., time.RFC3339).
+// The nonce is 16 random bytes, hex-encoded.
+type ReplayGuard struct {
+	TimestampHeader string
+	NonceHeader     string
+	TimeFormat      string
+}
+
+// stamp adds a fresh timestamp and nonce to a request.
+func (g *ReplayGuard) stamp(req *http.Request) error {
+	var nonce [16]byte
+	_, err := rand.Read(nonce[:])
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	if g.TimeFormat != "" {
+		timestamp = now.Format(g.TimeFormat)
+	}
+
+	tsHeader, nonceHeader := g.TimestampHeader, g.NonceHeader
+	if tsHeader == "" {
+		tsHeader = "X-Request-Timestamp"
+	}
+	if nonceHeader == "" {
+		nonceHeader = "X-Request-Nonce"
+	}
+	req.Header.Set(tsHeader, timestamp)
+	req.Header.Set(nonceHeader, hex.EncodeToString(nonce[:]))
+	return nil
+}
@@ -0,0 +1,65 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signingAuth records the headers visible to an AuthProvider when it signs a request.
+type signingAuth struct {
+	canonical []string
+}
+
+func (a *signingAuth) Authenticate(req *http.Request) error {
+	a.canonical = append(a.canonical, req.Header.Get("X-Request-Timestamp")+"\n"+req.Header.Get("X-Request-Nonce"))
+	return nil
+}
+
+func TestReplayGuard(t *testing.T) {
+	var seen []http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Clone())
+		if len(seen) == 1 {
+			w.WriteHeader(503)
+		}
+	}))
+	defer ts.Close()
+
+	auth := new(signingAuth)
+	_, err := Request("GET", ts.URL, Options{
+		ReplayGuard: &ReplayGuard{},
+		Auth:        auth,
+		Retry:       &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 {
+		t.Fatalf("Expected 2 attempts; got %d", len(seen))
+	}
+	first, second := seen[0].Get("X-Request-Nonce"), seen[1].Get("X-Request-Nonce")
+	if len(first) != 32 || first == second {
+		t.Fatalf("Expected a fresh nonce for each attempt; got %q and %q", first, second)
+	}
+	stamp, err := strconv.ParseInt(seen[1].Get("X-Request-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(stamp, 0)) > time.Minute {
+		t.Fatalf("Expected a current Unix timestamp; got %q", seen[1].Get("X-Request-Timestamp"))
+	}
+	if auth.canonical[1] != seen[1].Get("X-Request-Timestamp")+"\n"+second {
+		t.Fatalf("Expected the signing hook to see the stamp; got %q", auth.canonical[1])
+	}
+}
+
+func TestReplayGuardCustomHeaders(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	guard := &ReplayGuard{TimestampHeader: "X-Date", NonceHeader: "X-Nonce", TimeFormat: time.RFC3339}
+	if err := guard.stamp(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse(time.RFC3339, req.Header.Get("X-Date")); err != nil || req.Header.Get("X-Nonce") == "" {
+		t.Fatalf("Expected custom headers; got %v", req.Header)
+	}
+}
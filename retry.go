@@ -0,0 +1,356 @@
+package perigee
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRetryableCodes lists the response codes retried when a RetryPolicy names none of its own.
+// Each signals a condition likely to clear up by itself: throttling, a transient server fault, or an overloaded or restarting service.
+// A 500 may also be a bug which recurs on every attempt, and may come after a write took effect;
+// policies for non-idempotent requests may prefer RetryableCodes of their own.
+var DefaultRetryableCodes = []int{429, 500, 502, 503, 504}
+
+// RetryPolicy configures the transparent retrying of transient failures; see Options.Retry.
+// Failures eligible for retrying are errors reaching the server at all (refused connections, resets, and the like),
+// and responses whose code is listed in RetryableCodes (DefaultRetryableCodes, if nil) but which the request does not accept.
+// A request that sets any of Options.OkCodes, OkPredicate and RejectCodes accepts what Request would return without error;
+// so, for instance, a 503 is not retried when RejectCodes lists only 500.
+//
+// The method plays no part: POST and PATCH requests are retried like any other, including on a 500 by default,
+// which may repeat a write the server applied before failing; give such requests RetryableCodes without 500,
+// or send them through a RequestQueue, whose idempotency keys let a server that honors them skip the repeat.
+//
+// MaxAttempts bounds the number of attempts made, including the first; values below 2 disable retrying.
+//
+// ClassLimits, if set, bounds the retries prompted by each class of failure separately,
+// e.g., retrying connection failures up to five times, throttling twice, and server errors once;
+// classes not listed are bounded by MaxAttempts alone.
+// With ClassLimits, a MaxAttempts of zero leaves the total number of attempts bounded only by the class limits,
+// and classes not listed are not retried at all.
+//
+// MaxElapsed, if set, bounds the whole sequence of attempts, e.g., "give up after 30s in total".
+// No retry is attempted once the budget is spent, or if waiting for it would overrun the budget;
+// the last response or error received is returned instead.
+// A deadline on Options.Context bounds the sequence in the same way.
+// Canceling Options.Context interrupts a wait between attempts at once, returning the context's error.
+// Individual attempts are bounded only by the HTTP client's Timeout and by Options.Context.
+//
+// BaseDelay and MaxDelay (if set) parameterize the wait between attempts, as computed by Backoff.
+// If Backoff is nil, the wait starts at BaseDelay and doubles with each further retry, up to MaxDelay.
+// When many clients retry against a recovering service in lockstep, prefer one of the jittered strategies:
+// FullJitter, EqualJitter, or DecorrelatedJitter.
+// A Retry-After header, given in seconds or as a date, takes precedence if it asks for a longer wait.
+//
+// OnRetry, if set, is called before each retry, once its wait is decided, so that applications can log retries
+// and export metrics to spot retry storms.
+// It runs on the goroutine making the request, and the retry waits for it to return.
+type RetryPolicy struct {
+	MaxAttempts    int
+	MaxElapsed     time.Duration
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	Backoff        Backoff
+	RetryableCodes []int
+	ClassLimits    map[RetryClass]int
+	OnRetry        func(RetryEvent)
+}
+
+// RetryEvent describes a retry about to happen; see RetryPolicy.OnRetry.
+// Attempt numbers the attempt which failed, from 1, and Wait gives the pause before the next.
+// StatusCode holds the code of the failed attempt's response, or Err the error if there was none.
+type RetryEvent struct {
+	Attempt    int
+	Wait       time.Duration
+	Class      RetryClass
+	StatusCode int
+	Err        error
+}
+
+// RetryClass classifies the failures prompting retries, for RetryPolicy.ClassLimits.
+type RetryClass int
+
+const (
+	// RetryConnection covers failures to complete the exchange with the server: refused or reset connections, timeouts, and the like.
+	RetryConnection RetryClass = iota
+
+	// RetryThrottled covers responses with code 429 (Too Many Requests).
+	RetryThrottled
+
+	// RetryServerError covers responses with 5xx codes.
+	RetryServerError
+
+	// RetryOtherCode covers responses with any other code listed in RetryableCodes, such as 408 (Request Timeout).
+	RetryOtherCode
+)
+
+// retryClass classifies the outcome of an attempt which is to be retried.
+func retryClass(resp *http.Response, err error) RetryClass {
+	switch {
+	case err != nil:
+		return RetryConnection
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return RetryThrottled
+	case resp.StatusCode >= 500 && resp.StatusCode <= 599:
+		return RetryServerError
+	}
+	return RetryOtherCode
+}
+
+// Backoff computes the wait before a retry.
+// Attempt counts the attempts made so far, so is 1 when computing the wait before the first retry.
+// Previous holds the wait computed before the last retry, or base if there was none.
+// A max of zero means the wait is unbounded.
+type Backoff interface {
+	Delay(attempt int, base, max, previous time.Duration) time.Duration
+}
+
+// ExponentialBackoff waits base, doubling with each retry, up to max.
+// It is the Backoff used when a RetryPolicy names none.
+type ExponentialBackoff struct{}
+
+func (ExponentialBackoff) Delay(attempt int, base, max, previous time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempt && (max <= 0 || wait < max); i++ {
+		wait *= 2
+	}
+	if max > 0 && wait > max {
+		wait = max
+	}
+	return wait
+}
+
+// FullJitter waits a random time between zero and the exponential backoff.
+// It spreads retries out the most, at the cost of sometimes retrying almost immediately.
+type FullJitter struct{}
+
+func (FullJitter) Delay(attempt int, base, max, previous time.Duration) time.Duration {
+	return randomBetween(0, ExponentialBackoff{}.Delay(attempt, base, max, previous))
+}
+
+// EqualJitter waits at least half the exponential backoff, plus a random time up to the other half.
+type EqualJitter struct{}
+
+func (EqualJitter) Delay(attempt int, base, max, previous time.Duration) time.Duration {
+	half := ExponentialBackoff{}.Delay(attempt, base, max, previous) / 2
+	return half + randomBetween(0, half)
+}
+
+// DecorrelatedJitter waits a random time between base and three times the previous wait, up to max.
+// Each wait derives from the last rather than from the attempt count, so clients drift apart over successive retries.
+type DecorrelatedJitter struct{}
+
+func (DecorrelatedJitter) Delay(attempt int, base, max, previous time.Duration) time.Duration {
+	wait := randomBetween(base, 3*previous)
+	if max > 0 && wait > max {
+		wait = max
+	}
+	return wait
+}
+
+// randomBetween picks a duration uniformly from [lo, hi], or returns lo if the range is empty.
+func randomBetween(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	return lo + time.Duration(rand.Int63n(int64(hi-lo)+1))
+}
+
+// do sends the requests built by newRequest with send until one succeeds, fails permanently, or the policy gives up.
+// It returns the final response or error, along with the number of attempts made.
+// A nil policy makes a single attempt, as does a request whose body cannot be replayed.
+// Responses that accepted, if not nil, reports as successes are returned as they are, retryable or not.
+func (p *RetryPolicy) do(ctx context.Context, send Handler, accepted func(*http.Response) bool, replayable bool, newRequest func() (*http.Request, error)) (*http.Response, int, error) {
+	start := time.Now()
+	var wait time.Duration
+	var retries [RetryOtherCode + 1]int
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, attempt - 1, err
+		}
+		resp, err := send(req)
+		if p == nil || !replayable || !p.allows(attempt) || !p.shouldRetry(resp, err, accepted) {
+			return resp, attempt, err
+		}
+		class := retryClass(resp, err)
+		if limit, ok := p.ClassLimits[class]; (ok && retries[class] >= limit) || (!ok && p.MaxAttempts == 0) {
+			return resp, attempt, err
+		}
+		retries[class]++
+
+		wait = p.delay(attempt, wait, resp)
+		deadline, bounded := p.deadline(ctx, start)
+		if bounded && time.Now().Add(wait).After(deadline) {
+			return resp, attempt, err
+		}
+		if resp != nil {
+			// Drain what's left of the body, so the connection may be reused for the next attempt.
+			discardBody(resp.Body)
+		}
+		if p.OnRetry != nil {
+			event := RetryEvent{Attempt: attempt, Wait: wait, Class: class, Err: err}
+			if resp != nil {
+				event.StatusCode = resp.StatusCode
+			}
+			p.OnRetry(event)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, attempt, err
+		}
+	}
+}
+
+// allows reports whether MaxAttempts permits another attempt after the given one.
+func (p *RetryPolicy) allows(attempt int) bool {
+	if p.MaxAttempts == 0 && p.ClassLimits != nil {
+		return true
+	}
+	return attempt < p.MaxAttempts
+}
+
+// sleep pauses for the given duration, or until ctx is done, whichever comes first.
+// It returns the context's error if the pause was cut short.
+func sleep(ctx context.Context, d time.Duration) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shouldRetry decides whether the outcome of an attempt is worth retrying.
+func (p *RetryPolicy) shouldRetry(resp *http.Response, err error, accepted func(*http.Response) bool) bool {
+	if err != nil {
+		return transportFailure(err)
+	}
+	if accepted != nil && accepted(resp) {
+		return false
+	}
+	codes := p.RetryableCodes
+	if codes == nil {
+		codes = DefaultRetryableCodes
+	}
+	return !not_in(resp.StatusCode, codes)
+}
+
+// transportFailure reports whether an error from Request is a failure to complete the exchange with the server,
+// such as a refused or reset connection, rather than a problem with the request itself, which would recur on every attempt.
+// Cancellation by the caller doesn't count.
+func transportFailure(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && !errors.Is(err, context.Canceled)
+}
+
+// delay computes the wait before the retry following the given attempt, given the wait before the previous one.
+func (p *RetryPolicy) delay(attempt int, previous time.Duration, resp *http.Response) time.Duration {
+	backoff := p.Backoff
+	if backoff == nil {
+		backoff = ExponentialBackoff{}
+	}
+	if attempt == 1 {
+		previous = p.BaseDelay
+	}
+	wait := backoff.Delay(attempt, p.BaseDelay, p.MaxDelay, previous)
+	if resp != nil {
+		if after, ok := retryAfter(resp.Header); ok && after > wait {
+			wait = after
+		}
+	}
+	return wait
+}
+
+// RetryAfter returns the wait the server asks for before the request is tried again, from the Retry-After header,
+// given either in seconds or as a date.
+// A date is measured against the response's Date header, if it has one, to allow for skew between the client's and server's clocks.
+func (r *Response) RetryAfter() (time.Duration, bool) {
+	return retryAfter(r.HttpResponse.Header)
+}
+
+// retryAfter returns the wait a server asks for in a Retry-After header, given either in seconds or as an HTTP-date.
+// A date is measured against the response's Date header, if it has one, rather than the local clock,
+// so that skew between the client's and server's clocks doesn't distort the wait.
+// A date already past asks for no wait at all.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, ok := parseHTTPTime(value)
+	if !ok {
+		return 0, false
+	}
+	now := time.Now()
+	if date, ok := parseHTTPTime(header.Get("Date")); ok {
+		now = date
+	}
+	if wait := at.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+// deadline reports the time by which the whole sequence of attempts must be complete, if any.
+func (p *RetryPolicy) deadline(ctx context.Context, start time.Time) (time.Time, bool) {
+	var deadline time.Time
+	bounded := false
+	if p.MaxElapsed > 0 {
+		deadline, bounded = start.Add(p.MaxElapsed), true
+	}
+	if ctx != nil {
+		if d, ok := ctx.Deadline(); ok && (!bounded || d.Before(deadline)) {
+			deadline, bounded = d, true
+		}
+	}
+	return deadline, bounded
+}
+
+// rewindable arranges for a request body to be replayed on each attempt.
+// Marshaled bodies are simply re-read from their text; io.Seeker bodies are rewound to where they started.
+// Any other io.Reader can only be read once, so replayable is false.
+func rewindable(body io.Reader, text []byte) (next func() (io.Reader, error), replayable bool) {
+	if text != nil {
+		return func() (io.Reader, error) { return bytes.NewReader(text), nil }, true
+	}
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		return func() (io.Reader, error) { return body, nil }, body == nil
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return func() (io.Reader, error) { return body, nil }, false
+	}
+	first := true
+	return func() (io.Reader, error) {
+		if first {
+			first = false
+		} else if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		// Hide any Close method, or the transport would close the body (an *os.File, say) after the first attempt.
+		if _, ok := body.(io.Closer); ok {
+			return struct{ io.Reader }{body}, nil
+		}
+		return body, nil
+	}, true
+}
@@ -0,0 +1,418 @@
+package perigee
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyServer fails with the given code until it has been called failures times, then echoes the request body.
+func flakyServer(failures int, code int) (*httptest.Server, *[]string) {
+	var bodies []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		if len(bodies) <= failures {
+			w.WriteHeader(code)
+			return
+		}
+		w.Write([]byte(`{"ok": true}`))
+	})
+	return httptest.NewServer(handler), &bodies
+}
+
+func TestRetryRecovers(t *testing.T) {
+	ts, bodies := flakyServer(2, 503)
+	defer ts.Close()
+
+	var result struct{ Ok bool }
+	resp, err := Request("POST", ts.URL, Options{
+		ReqBody: map[string]string{"name": "x"},
+		Results: &result,
+		OkCodes: []int{200},
+		Retry:   &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Attempts != 3 || !result.Ok {
+		t.Fatalf("Expected success on the third attempt; got %d attempts and %v", resp.Attempts, result)
+	}
+	for _, b := range *bodies {
+		if b != `{"name":"x"}` {
+			t.Fatalf("Expected the body to be sent in full with every attempt; got %q", *bodies)
+		}
+	}
+
+	ts500, _ := flakyServer(1, 500)
+	defer ts500.Close()
+	resp, err = Request("GET", ts500.URL, Options{OkCodes: []int{200}, Retry: &RetryPolicy{MaxAttempts: 3}})
+	if err != nil || resp.Attempts != 2 {
+		t.Fatalf("Expected a 500 to be retried by default; got %v", err)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	ts, bodies := flakyServer(10, 502)
+	defer ts.Close()
+
+	resp, err := Request("GET", ts.URL, Options{
+		OkCodes: []int{200},
+		Retry:   &RetryPolicy{MaxAttempts: 3},
+	})
+	if e, ok := err.(*UnexpectedResponseCodeError); !ok || e.Actual != 502 {
+		t.Fatalf("Expected the last failure to be reported; got %#v", err)
+	}
+	if resp.Attempts != 3 || len(*bodies) != 3 {
+		t.Fatalf("Expected three attempts; got %d", resp.Attempts)
+	}
+
+	ts404, bodies := flakyServer(10, 404)
+	defer ts404.Close()
+	resp, _ = Request("GET", ts404.URL, Options{Retry: &RetryPolicy{MaxAttempts: 3}})
+	if resp.Attempts != 1 || len(*bodies) != 1 {
+		t.Fatalf("Expected a 404 not to be retried; got %d attempts", resp.Attempts)
+	}
+}
+
+func TestRetrySkipsOkCodes(t *testing.T) {
+	ts, bodies := flakyServer(10, 503)
+	defer ts.Close()
+
+	resp, err := Request("GET", ts.URL, Options{
+		OkCodes: []int{200, 503},
+		Retry:   &RetryPolicy{MaxAttempts: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 503 || resp.Attempts != 1 || len(*bodies) != 1 {
+		t.Fatalf("Expected a 503 listed in OkCodes to be returned without retrying; got %d attempts", resp.Attempts)
+	}
+}
+
+func TestRetrySkipsOkPredicate(t *testing.T) {
+	ts, bodies := flakyServer(10, 503)
+	defer ts.Close()
+
+	resp, err := Request("GET", ts.URL, Options{
+		OkPredicate: func(r *http.Response) bool { return r.StatusCode < 600 },
+		Retry:       &RetryPolicy{MaxAttempts: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 503 || resp.Attempts != 1 || len(*bodies) != 1 {
+		t.Fatalf("Expected a 503 accepted by OkPredicate to be returned without retrying; got %d attempts", resp.Attempts)
+	}
+}
+
+func TestRetrySkipsCodesNotRejected(t *testing.T) {
+	ts, bodies := flakyServer(10, 503)
+	defer ts.Close()
+
+	resp, err := Request("GET", ts.URL, Options{
+		RejectCodes: []int{500},
+		Retry:       &RetryPolicy{MaxAttempts: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 503 || resp.Attempts != 1 || len(*bodies) != 1 {
+		t.Fatalf("Expected a 503 outside RejectCodes to be returned without retrying; got %d attempts", resp.Attempts)
+	}
+
+	ts500, bodies := flakyServer(1, 500)
+	defer ts500.Close()
+	resp, err = Request("GET", ts500.URL, Options{RejectCodes: []int{500}, Retry: &RetryPolicy{MaxAttempts: 3}})
+	if err != nil || resp.Attempts != 2 || len(*bodies) != 2 {
+		t.Fatalf("Expected a rejected 500 to be retried; got %v", err)
+	}
+}
+
+func TestRetryMaxElapsed(t *testing.T) {
+	ts, _ := flakyServer(100, 503)
+	defer ts.Close()
+
+	start := time.Now()
+	resp, err := Request("GET", ts.URL, Options{
+		OkCodes: []int{200},
+		Retry:   &RetryPolicy{MaxAttempts: 100, BaseDelay: 40 * time.Millisecond, MaxElapsed: 100 * time.Millisecond},
+	})
+	if err == nil {
+		t.Fatal("Expected the retry budget to run out")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("Expected the retries to stop within the budget; took %s", elapsed)
+	}
+	if resp.Attempts != 2 {
+		t.Fatalf("Expected two attempts to fit in the budget; got %d", resp.Attempts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	resp, _ = Request("GET", ts.URL, Options{
+		Context: ctx,
+		Retry:   &RetryPolicy{MaxAttempts: 100, BaseDelay: 40 * time.Millisecond},
+	})
+	if resp.Attempts != 2 {
+		t.Fatalf("Expected the context's deadline to bound the retries; got %d attempts", resp.Attempts)
+	}
+}
+
+func TestRetryTransportErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := ts.URL
+	ts.Close()
+
+	resp, err := Request("GET", url, Options{Retry: &RetryPolicy{MaxAttempts: 3}})
+	if err == nil {
+		t.Fatal("Expected the connection to be refused")
+	}
+	if resp.Attempts != 3 {
+		t.Fatalf("Expected connection failures to be retried; got %d attempts", resp.Attempts)
+	}
+
+	resp, _ = Request("GET", url, Options{
+		SetHeaders: func(*http.Request) error { return io.ErrUnexpectedEOF },
+		Retry:      &RetryPolicy{MaxAttempts: 3},
+	})
+	if resp.Attempts != 0 {
+		t.Fatalf("Expected failures building the request not to be retried; got %d attempts", resp.Attempts)
+	}
+}
+
+func TestRetryRewindsBodies(t *testing.T) {
+	ts, bodies := flakyServer(1, 503)
+	defer ts.Close()
+
+	body := strings.NewReader("skipped:payload")
+	body.Seek(8, io.SeekStart)
+	resp, err := Request("PUT", ts.URL, Options{
+		ReqBody:     body,
+		ContentType: "text/plain",
+		Retry:       &RetryPolicy{MaxAttempts: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Attempts != 2 || (*bodies)[0] != "payload" || (*bodies)[1] != "payload" {
+		t.Fatalf("Expected the body to be rewound to its starting offset; got %q", *bodies)
+	}
+
+	ts2, bodies := flakyServer(1, 503)
+	defer ts2.Close()
+	resp, _ = Request("PUT", ts2.URL, Options{
+		ReqBody:     io.MultiReader(strings.NewReader("payload")),
+		ContentType: "text/plain",
+		Retry:       &RetryPolicy{MaxAttempts: 2},
+	})
+	if resp.Attempts != 1 || len(*bodies) != 1 {
+		t.Fatalf("Expected a body that cannot be rewound to be sent only once; got %d attempts", resp.Attempts)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := p.delay(i+1, 0, nil); got != w*time.Millisecond {
+			t.Errorf("Attempt %d: expected a delay of %s; got %s", i+1, w*time.Millisecond, got)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3"}}}
+	if got := p.delay(1, 0, resp); got != 3*time.Second {
+		t.Errorf("Expected Retry-After to lengthen the delay; got %s", got)
+	}
+}
+
+func TestRetryAfterDate(t *testing.T) {
+	// The server's clock runs an hour behind the client's; the wait is measured against the server's.
+	serverNow := time.Now().Add(-time.Hour).UTC()
+	header := http.Header{
+		"Date":        {serverNow.Format(http.TimeFormat)},
+		"Retry-After": {serverNow.Add(5 * time.Second).Format(http.TimeFormat)},
+	}
+	if wait, ok := retryAfter(header); !ok || wait != 5*time.Second {
+		t.Fatalf("Expected a wait of 5s; got %s, %v", wait, ok)
+	}
+
+	header.Del("Date")
+	if wait, ok := retryAfter(header); !ok || wait != 0 {
+		t.Fatalf("Expected a date already past by the local clock to ask for no wait; got %s, %v", wait, ok)
+	}
+	for _, value := range []string{"", "-1", "soon"} {
+		if _, ok := retryAfter(http.Header{"Retry-After": {value}}); ok {
+			t.Errorf("Expected %q to be ignored", value)
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	resp, err := Request("GET", ts.URL, Options{OkCodes: []int{200}})
+	unexpected, ok := err.(*UnexpectedResponseCodeError)
+	if !ok || unexpected.RetryAfter < 58*time.Second || unexpected.RetryAfter > time.Minute {
+		t.Fatalf("Expected the error to carry a wait of about a minute; got %#v", err)
+	}
+	if wait, ok := resp.RetryAfter(); !ok || wait != unexpected.RetryAfter {
+		t.Fatalf("Expected the Response to report the same wait; got %s, %v", wait, ok)
+	}
+}
+
+func TestJitteredBackoff(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+	for attempt := 1; attempt <= 6; attempt++ {
+		exp := ExponentialBackoff{}.Delay(attempt, base, max, 0)
+		for i := 0; i < 100; i++ {
+			if d := (FullJitter{}).Delay(attempt, base, max, 0); d < 0 || d > exp {
+				t.Fatalf("FullJitter: attempt %d waited %s, outside [0, %s]", attempt, d, exp)
+			}
+			if d := (EqualJitter{}).Delay(attempt, base, max, 0); d < exp/2 || d > exp {
+				t.Fatalf("EqualJitter: attempt %d waited %s, outside [%s, %s]", attempt, d, exp/2, exp)
+			}
+		}
+	}
+
+	previous := base
+	for i := 0; i < 100; i++ {
+		d := (DecorrelatedJitter{}).Delay(i+1, base, max, previous)
+		if d < base || d > max || d > 3*previous {
+			t.Fatalf("DecorrelatedJitter: waited %s after %s, outside [%s, min(%s, %s)]", d, previous, base, 3*previous, max)
+		}
+		previous = d
+	}
+}
+
+func TestRetryUsesBackoff(t *testing.T) {
+	var calls []time.Duration
+	p := &RetryPolicy{BaseDelay: 10 * time.Millisecond, Backoff: recordingBackoff{&calls}}
+	wait := p.delay(1, 0, nil)
+	p.delay(2, wait, nil)
+	if len(calls) != 2 || calls[0] != 10*time.Millisecond || calls[1] != 20*time.Millisecond {
+		t.Fatalf("Expected the backoff to be given the base, then its previous wait; got %v", calls)
+	}
+}
+
+type recordingBackoff struct{ previous *[]time.Duration }
+
+func (b recordingBackoff) Delay(attempt int, base, max, previous time.Duration) time.Duration {
+	*b.previous = append(*b.previous, previous)
+	return 2 * previous
+}
+
+func TestRetryWaitsAreCancelable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(503)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	resp, err := Request("GET", ts.URL, Options{
+		Context: ctx,
+		Retry:   &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Minute},
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected the wait to be canceled; got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected cancellation to interrupt the wait; took %s", elapsed)
+	}
+	if resp.Attempts != 1 {
+		t.Fatalf("Expected no further attempt after cancellation; got %d", resp.Attempts)
+	}
+}
+
+func TestRetryClassLimits(t *testing.T) {
+	codes := []int{503, 503, 429, 429, 429, 200}
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := codes[calls]
+		calls++
+		w.WriteHeader(code)
+	}))
+	defer ts.Close()
+
+	policy := &RetryPolicy{
+		BaseDelay:   time.Millisecond,
+		ClassLimits: map[RetryClass]int{RetryServerError: 2, RetryThrottled: 2},
+	}
+	resp, err := Request("GET", ts.URL, Options{OkCodes: []int{200}, Retry: policy})
+	if err == nil || resp.StatusCode != 429 || resp.Attempts != 5 {
+		t.Fatalf("Expected to give up on the third 429, after 5 attempts; got %d after %d attempts (%v)", resp.StatusCode, resp.Attempts, err)
+	}
+
+	calls = 0
+	policy = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, ClassLimits: map[RetryClass]int{RetryThrottled: 5}}
+	resp, _ = Request("GET", ts.URL, Options{OkCodes: []int{200}, Retry: policy})
+	if resp.Attempts != 3 {
+		t.Fatalf("Expected MaxAttempts to bound the total; got %d attempts", resp.Attempts)
+	}
+
+	calls = 0
+	policy = &RetryPolicy{BaseDelay: time.Millisecond, ClassLimits: map[RetryClass]int{RetryThrottled: 5}}
+	resp, _ = Request("GET", ts.URL, Options{OkCodes: []int{200}, Retry: policy})
+	if resp.Attempts != 1 {
+		t.Fatalf("Expected classes without a limit not to be retried; got %d attempts", resp.Attempts)
+	}
+}
+
+func TestRetryClass(t *testing.T) {
+	for _, tc := range []struct {
+		code int
+		err  error
+		want RetryClass
+	}{
+		{0, &url.Error{Op: "Get", Err: io.EOF}, RetryConnection},
+		{429, nil, RetryThrottled},
+		{502, nil, RetryServerError},
+		{408, nil, RetryOtherCode},
+	} {
+		var resp *http.Response
+		if tc.err == nil {
+			resp = &http.Response{StatusCode: tc.code}
+		}
+		if got := retryClass(resp, tc.err); got != tc.want {
+			t.Fatalf("Expected class %d for %d/%v; got %d", tc.want, tc.code, tc.err, got)
+		}
+	}
+}
+
+func TestRetryOnRetry(t *testing.T) {
+	ts, _ := flakyServer(2, 503)
+	defer ts.Close()
+
+	var events []RetryEvent
+	resp, err := Request("GET", ts.URL, Options{
+		OkCodes: []int{200},
+		Retry: &RetryPolicy{
+			MaxAttempts: 5,
+			BaseDelay:   time.Millisecond,
+			OnRetry:     func(e RetryEvent) { events = append(events, e) },
+		},
+	})
+	if err != nil || resp.Attempts != 3 {
+		t.Fatalf("Expected success on the third attempt; got %v after %d attempts", err, resp.Attempts)
+	}
+	want := []RetryEvent{
+		{Attempt: 1, Wait: time.Millisecond, Class: RetryServerError, StatusCode: 503},
+		{Attempt: 2, Wait: 2 * time.Millisecond, Class: RetryServerError, StatusCode: 503},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("Expected %+v; got %+v", want, events)
+	}
+}
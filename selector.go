@@ -0,0 +1,232 @@
+package perigee
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultProbeInterval is how often an EndpointSelector probes its endpoints, unless it names another interval.
+const DefaultProbeInterval = 30 * time.Second
+
+// DefaultStickiness is the Stickiness of an EndpointSelector created with NewEndpointSelector.
+const DefaultStickiness = 0.2
+
+// ProbeFunc measures the round-trip time to an endpoint, returning an error if the endpoint is unhealthy.
+type ProbeFunc func(ctx context.Context, endpoint string) (time.Duration, error)
+
+// EndpointHealth reports the outcome of the latest probe of an endpoint.
+type EndpointHealth struct {
+	Endpoint string
+	Latency  time.Duration
+	Err      error
+	Probed   time.Time
+}
+
+// Healthy reports whether the endpoint answered its latest probe.
+func (h EndpointHealth) Healthy() bool {
+	return h.Err == nil && !h.Probed.IsZero()
+}
+
+// EndpointSelector routes requests among several replicas of a service, such as one per region,
+// to whichever answers fastest while remaining healthy.
+// It probes every endpoint periodically once started; Clients bound to it have their base URL kept pointing at the best.
+// An EndpointSelector is safe for concurrent use.
+//
+// Probe measures an endpoint; if nil, each endpoint is sent a GET request with Options, healthy if it gets any answer short of a 5xx.
+//
+// Interval sets how often the endpoints are probed; zero means DefaultProbeInterval.
+//
+// Stickiness keeps the selector from flapping between endpoints of similar latency:
+// it abandons a healthy endpoint only for one faster by more than this fraction of its latency (e.g., 0.2 for 20%).
+// An unhealthy endpoint is abandoned for any healthy one.
+//
+// Override pins the selection to an endpoint of the caller's choosing, regardless of probes, until cleared.
+type EndpointSelector struct {
+	Endpoints  []string
+	Options    Options
+	Probe      ProbeFunc
+	Interval   time.Duration
+	Stickiness float64
+
+	mu       sync.Mutex
+	current  string
+	override string
+	health   map[string]EndpointHealth
+	clients  []*Client
+	stop     context.CancelFunc
+}
+
+// NewEndpointSelector creates an EndpointSelector among the given endpoints, initially selecting the first.
+// Probe requests carry the given options, e.g., to authenticate.
+func NewEndpointSelector(endpoints []string, opts Options) *EndpointSelector {
+	return &EndpointSelector{
+		Endpoints:  endpoints,
+		Options:    opts,
+		Stickiness: DefaultStickiness,
+	}
+}
+
+// Endpoint returns the endpoint requests should currently use.
+func (s *EndpointSelector) Endpoint() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.selectedLocked()
+}
+
+func (s *EndpointSelector) selectedLocked() string {
+	if s.override != "" {
+		return s.override
+	}
+	return s.selectedProbedLocked()
+}
+
+// Override pins the selection to the given endpoint until ClearOverride is called.
+func (s *EndpointSelector) Override(endpoint string) {
+	s.mu.Lock()
+	s.override = endpoint
+	s.mu.Unlock()
+	s.publish()
+}
+
+// ClearOverride returns the selection to the endpoint chosen by probing.
+func (s *EndpointSelector) ClearOverride() {
+	s.Override("")
+}
+
+// Bind keeps the client's base URL set to the selected endpoint.
+func (s *EndpointSelector) Bind(c *Client) {
+	s.mu.Lock()
+	s.clients = append(s.clients, c)
+	endpoint := s.selectedLocked()
+	s.mu.Unlock()
+	c.SetBaseURL(endpoint)
+}
+
+// publish points every bound client at the selected endpoint.
+func (s *EndpointSelector) publish() {
+	s.mu.Lock()
+	endpoint := s.selectedLocked()
+	clients := append([]*Client(nil), s.clients...)
+	s.mu.Unlock()
+	for _, c := range clients {
+		c.SetBaseURL(endpoint)
+	}
+}
+
+// Health reports the latest probe of every endpoint, in the order the endpoints were given.
+func (s *EndpointSelector) Health() []EndpointHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := make([]EndpointHealth, len(s.Endpoints))
+	for i, e := range s.Endpoints {
+		report[i] = s.health[e]
+		report[i].Endpoint = e
+	}
+	return report
+}
+
+// defaultProbe times a GET request to the endpoint.
+func (s *EndpointSelector) defaultProbe(ctx context.Context, endpoint string) (time.Duration, error) {
+	opts := s.Options
+	opts.Context = ctx
+	opts.OkCodes = nil
+	opts.OkPredicate = nil
+	start := time.Now()
+	resp, err := Request("GET", endpoint, opts)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode >= 500 {
+		return 0, fmt.Errorf("probe of %s answered %d", endpoint, resp.StatusCode)
+	}
+	return time.Since(start), nil
+}
+
+// ProbeNow probes every endpoint at once, and updates the selection with the results.
+func (s *EndpointSelector) ProbeNow(ctx context.Context) {
+	probe := s.Probe
+	if probe == nil {
+		probe = s.defaultProbe
+	}
+	results := make([]EndpointHealth, len(s.Endpoints))
+	var wg sync.WaitGroup
+	for i, e := range s.Endpoints {
+		wg.Add(1)
+		go func(i int, e string) {
+			defer wg.Done()
+			latency, err := probe(ctx, e)
+			results[i] = EndpointHealth{Endpoint: e, Latency: latency, Err: err, Probed: time.Now()}
+		}(i, e)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	if s.health == nil {
+		s.health = make(map[string]EndpointHealth)
+	}
+	var best *EndpointHealth
+	for i, r := range results {
+		s.health[r.Endpoint] = r
+		if r.Healthy() && (best == nil || r.Latency < best.Latency) {
+			best = &results[i]
+		}
+	}
+	if best != nil {
+		current, ok := s.health[s.selectedProbedLocked()]
+		if !ok || !current.Healthy() || float64(best.Latency) < float64(current.Latency)*(1-s.Stickiness) {
+			s.current = best.Endpoint
+		}
+	}
+	s.mu.Unlock()
+	s.publish()
+}
+
+// selectedProbedLocked returns the endpoint chosen by probing, ignoring any override.
+func (s *EndpointSelector) selectedProbedLocked() string {
+	if s.current == "" && len(s.Endpoints) > 0 {
+		return s.Endpoints[0]
+	}
+	return s.current
+}
+
+// Start probes the endpoints at once, then every Interval in the background, until Stop is called.
+func (s *EndpointSelector) Start() {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stop = cancel
+	s.mu.Unlock()
+
+	s.ProbeNow(ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.ProbeNow(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the background probing begun by Start, abandoning any probes in flight.
+func (s *EndpointSelector) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		s.stop()
+		s.stop = nil
+	}
+}
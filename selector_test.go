@@ -0,0 +1,101 @@
+package perigee
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeProbe reports fixed latencies, or failure for endpoints with none.
+type fakeProbe map[string]time.Duration
+
+func (p fakeProbe) probe(ctx context.Context, endpoint string) (time.Duration, error) {
+	if latency, ok := p[endpoint]; ok {
+		return latency, nil
+	}
+	return 0, errors.New("unreachable")
+}
+
+func TestEndpointSelectorPicksFastest(t *testing.T) {
+	latencies := fakeProbe{"a": 100 * time.Millisecond, "b": 50 * time.Millisecond, "c": 90 * time.Millisecond}
+	s := NewEndpointSelector([]string{"a", "b", "c"}, Options{})
+	s.Probe = latencies.probe
+	if s.Endpoint() != "a" {
+		t.Fatalf("Expected the first endpoint before any probe; got %s", s.Endpoint())
+	}
+
+	s.ProbeNow(context.Background())
+	if s.Endpoint() != "b" {
+		t.Fatalf("Expected the fastest endpoint; got %s", s.Endpoint())
+	}
+
+	// Within the stickiness margin, the selection stays put.
+	latencies["c"] = 45 * time.Millisecond
+	s.ProbeNow(context.Background())
+	if s.Endpoint() != "b" {
+		t.Fatalf("Expected the selection to stick to b; got %s", s.Endpoint())
+	}
+	latencies["c"] = 10 * time.Millisecond
+	s.ProbeNow(context.Background())
+	if s.Endpoint() != "c" {
+		t.Fatalf("Expected a much faster endpoint to win; got %s", s.Endpoint())
+	}
+
+	// An unhealthy endpoint is abandoned for any healthy one.
+	delete(latencies, "c")
+	s.ProbeNow(context.Background())
+	if s.Endpoint() != "b" {
+		t.Fatalf("Expected the selection to leave an unhealthy endpoint; got %s", s.Endpoint())
+	}
+	if health := s.Health(); health[2].Healthy() || !health[1].Healthy() {
+		t.Fatalf("Expected c to be reported unhealthy; got %+v", health)
+	}
+
+	s.Override("a")
+	if s.Endpoint() != "a" {
+		t.Fatalf("Expected the override to win; got %s", s.Endpoint())
+	}
+	s.ClearOverride()
+	if s.Endpoint() != "b" {
+		t.Fatalf("Expected the probed selection once the override was cleared; got %s", s.Endpoint())
+	}
+}
+
+func TestEndpointSelectorRoutesClients(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer broken.Close()
+	var hits int
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/servers" {
+			hits++
+		}
+	}))
+	defer fast.Close()
+
+	s := NewEndpointSelector([]string{slow.URL, broken.URL, fast.URL}, Options{})
+	s.Interval = time.Hour
+	client := NewClient(Options{})
+	s.Bind(client)
+	if client.BaseURL() != slow.URL {
+		t.Fatalf("Expected the client to start on the first endpoint; got %s", client.BaseURL())
+	}
+
+	s.Start()
+	defer s.Stop()
+	_, err := client.Request("GET", "servers", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits != 1 {
+		t.Fatalf("Expected the request to reach the fastest healthy endpoint; base URL is %s", client.BaseURL())
+	}
+}
@@ -0,0 +1,81 @@
+package perigee
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClientShutdown is returned by requests made through a Client after its Shutdown method has been called.
+var ErrClientShutdown = errors.New("perigee: client is shut down")
+
+// Shutdown drains the client, as services embedding perigee want on SIGTERM.
+// It stops the client accepting new requests, which fail with ErrClientShutdown from then on,
+// and waits for the requests in flight to complete, or for ctx to be done, whichever comes first.
+// Requests still in flight when ctx is done are canceled, failing with context.Canceled.
+// Either way, the client's idle connections are then closed (see CloseIdleConnections).
+//
+// Shutdown returns nil if every request completed in time, and ctx's error otherwise.
+// It may be called more than once; later calls wait as the first does.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.lifeMu.Lock()
+	c.shutdown = true
+	if c.drained == nil {
+		c.drained = make(chan struct{})
+		if len(c.inflight) == 0 {
+			close(c.drained)
+		}
+	}
+	drained := c.drained
+	c.lifeMu.Unlock()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		c.lifeMu.Lock()
+		for _, cancel := range c.inflight {
+			cancel()
+		}
+		c.lifeMu.Unlock()
+	}
+	c.CloseIdleConnections()
+	return err
+}
+
+// begin registers a request about to be made through the client, deriving from ctx a context which Shutdown can cancel.
+// The caller must call the returned function once the request completes.
+// It fails with an *OverloadedError, lacking only its Url, if the client already has its maximum in flight.
+func (c *Client) begin(ctx context.Context) (context.Context, func(), error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c.lifeMu.Lock()
+	defer c.lifeMu.Unlock()
+	if c.shutdown {
+		return nil, nil, ErrClientShutdown
+	}
+	if c.maxInFlight > 0 && len(c.inflight) >= c.maxInFlight {
+		return nil, nil, &OverloadedError{Limit: c.maxInFlight, InFlight: len(c.inflight)}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if c.inflight == nil {
+		c.inflight = make(map[uint64]context.CancelFunc)
+	}
+	c.nextID++
+	id := c.nextID
+	c.inflight[id] = cancel
+	return ctx, func() {
+		cancel()
+		c.lifeMu.Lock()
+		defer c.lifeMu.Unlock()
+		delete(c.inflight, id)
+		if c.drained != nil && len(c.inflight) == 0 {
+			select {
+			case <-c.drained:
+			default:
+				close(c.drained)
+			}
+		}
+	}, nil
+}
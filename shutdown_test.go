@@ -0,0 +1,87 @@
+package perigee
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	defer ts.Close()
+
+	client := NewClient(Options{CustomClient: &http.Client{Transport: &http.Transport{}}})
+	result := make(chan error, 1)
+	go func() {
+		_, err := client.Request("GET", ts.URL, Options{})
+		result <- err
+	}()
+	<-started
+
+	shut := make(chan error, 1)
+	go func() { shut <- client.Shutdown(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	if _, err := client.Request("GET", ts.URL, Options{}); err != ErrClientShutdown {
+		t.Fatalf("Expected ErrClientShutdown; got %v", err)
+	}
+	select {
+	case err := <-shut:
+		t.Fatalf("Expected Shutdown to wait for the request in flight; got %v", err)
+	default:
+	}
+
+	close(release)
+	if err := <-result; err != nil {
+		t.Fatalf("Expected the request in flight to complete; got %v", err)
+	}
+	if err := <-shut; err != nil {
+		t.Fatalf("Expected a clean shutdown; got %v", err)
+	}
+}
+
+func TestShutdownCancelsAtDeadline(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	client := NewClient(Options{})
+	result := make(chan error, 1)
+	go func() {
+		_, err := client.Request("GET", ts.URL, Options{})
+		result <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected the deadline to pass; got %v", err)
+	}
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the request in flight to be canceled; got %v", err)
+	}
+}
+
+func TestShutdownIdleClient(t *testing.T) {
+	client := NewClient(Options{})
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected an idle client to shut down at once; got %v", err)
+	}
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected a second Shutdown to succeed; got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package perigee
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHMACSignerTempURL(t *testing.T) {
+	u, _ := url.Parse("https://swift.example.com/v1/AUTH_acct/photos/cat%20pic.jpg?inline")
+	expires := time.Unix(1700000000, 0)
+	if err := (&HMACSigner{Key: []byte("secret")}).SignURL("GET", u, expires); err != nil {
+		t.Fatal(err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	fmt.Fprintf(mac, "GET\n1700000000\n/v1/AUTH_acct/photos/cat pic.jpg")
+	q := u.Query()
+	if q.Get("temp_url_sig") != hex.EncodeToString(mac.Sum(nil)) || q.Get("temp_url_expires") != "1700000000" {
+		t.Fatalf("Expected a Swift temporary URL signature; got %s", u)
+	}
+	if _, ok := q["inline"]; !ok {
+		t.Fatalf("Expected the original query to be kept; got %s", u)
+	}
+}
+
+func TestHMACSignerCustomScheme(t *testing.T) {
+	signer := &HMACSigner{
+		Key:            []byte("k"),
+		Hash:           sha1.New,
+		SignatureParam: "Signature",
+		ExpiresParam:   "Expires",
+		Canonical: func(method string, u *url.URL, expires time.Time) string {
+			return method + u.Host + u.Path + strconv.FormatInt(expires.Unix(), 10)
+		},
+	}
+	u, _ := url.Parse("https://files.example.com/a/b")
+	if err := signer.SignURL("PUT", u, time.Unix(10, 0)); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha1.New, []byte("k"))
+	mac.Write([]byte("PUTfiles.example.com/a/b10"))
+	if u.Query().Get("Signature") != hex.EncodeToString(mac.Sum(nil)) || u.Query().Get("Expires") != "10" {
+		t.Fatalf("Expected the custom scheme; got %s", u)
+	}
+}
+
+func TestClientPresignURL(t *testing.T) {
+	c := NewClient(Options{})
+	if _, err := c.PresignURL("GET", "x", time.Minute); err != ErrNoURLSigner {
+		t.Fatalf("Expected ErrNoURLSigner; got %v", err)
+	}
+	c.SetBaseURL("https://swift.example.com/v1/AUTH_acct")
+	c.SetURLSigner(&HMACSigner{Key: []byte("secret")})
+	before := time.Now()
+	signed, err := c.PresignURL("GET", "photos/cat.jpg", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/v1/AUTH_acct/photos/cat.jpg" || u.Query().Get("temp_url_sig") == "" {
+		t.Fatalf("Expected a signed URL under the base URL; got %s", signed)
+	}
+	expires, _ := strconv.ParseInt(u.Query().Get("temp_url_expires"), 10, 64)
+	if expires < before.Add(time.Hour).Unix() || expires > time.Now().Add(time.Hour).Unix() {
+		t.Fatalf("Expected the URL to expire in an hour; got %d", expires)
+	}
+}
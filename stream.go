@@ -0,0 +1,91 @@
+package perigee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrStopStreaming may be returned by the function given to StreamArray to stop reading the array early, without failing the request.
+var ErrStopStreaming = errors.New("perigee: stop streaming")
+
+// StreamArray issues a request as Request does, decoding a JSON array in the response body one element at a time,
+// and passing each to the given function as soon as it is decoded.
+// Memory use is bounded by the size of one element, however long the array, making it suitable for endpoints returning huge listings.
+//
+// If field is empty, the body must be the array itself; otherwise, it must be an object holding the array in the named field,
+// as in the {"servers": [...]} bodies of OpenStack listings.
+// Other fields of the object are skipped.
+//
+// Should the function return an error, streaming stops, and Request returns the error; ErrStopStreaming stops it quietly.
+// Options.Results and Options.StreamBody are ignored.
+func StreamArray[T any](method, url string, opts Options, field string, each func(elem T) error) (*Response, error) {
+	opts.Results = nil
+	opts.StreamBody = func(body io.Reader) error {
+		err := decodeArray(json.NewDecoder(body), field, func(dec *json.Decoder) error {
+			var elem T
+			err := dec.Decode(&elem)
+			if err != nil {
+				return err
+			}
+			return each(elem)
+		})
+		if err == ErrStopStreaming {
+			return nil
+		}
+		return err
+	}
+	return Request(method, url, opts)
+}
+
+// decodeArray finds the array in a JSON document, as StreamArray describes, calling decodeElem to consume each element.
+func decodeArray(dec *json.Decoder, field string, decodeElem func(dec *json.Decoder) error) error {
+	if field != "" {
+		err := expectDelim(dec, '{')
+		if err != nil {
+			return err
+		}
+		for {
+			if !dec.More() {
+				return fmt.Errorf("response body has no %q field", field)
+			}
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			if key == field {
+				break
+			}
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := expectDelim(dec, '[')
+	if err != nil {
+		return err
+	}
+	for dec.More() {
+		err = decodeElem(dec)
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// expectDelim consumes the next token, which must be the given delimiter.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != delim {
+		return fmt.Errorf("expected %q in response body; got %v", delim, t)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package perigee
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type streamedServer struct {
+	ID   string
+	Name string
+}
+
+func TestStreamArray(t *testing.T) {
+	var elems []string
+	for i := 0; i < 1000; i++ {
+		elems = append(elems, fmt.Sprintf(`{"id":"%d","name":"server-%d"}`, i, i))
+	}
+	array := "[" + strings.Join(elems, ",") + "]"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/wrapped" {
+			fmt.Fprintf(w, `{"links":[{"rel":"next"}],"servers":%s,"count":1000}`, array)
+			return
+		}
+		w.Write([]byte(array))
+	}))
+	defer ts.Close()
+
+	count := 0
+	_, err := StreamArray("GET", ts.URL, Options{}, "", func(s streamedServer) error {
+		if s.ID != fmt.Sprint(count) {
+			return fmt.Errorf("element %d out of order: %+v", count, s)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1000 {
+		t.Fatalf("Expected 1000 elements; got %d", count)
+	}
+
+	count = 0
+	_, err = StreamArray("GET", ts.URL+"/wrapped", Options{}, "servers", func(s streamedServer) error {
+		count++
+		if count == 10 {
+			return ErrStopStreaming
+		}
+		return nil
+	})
+	if err != nil || count != 10 {
+		t.Fatalf("Expected to stop quietly after 10 elements; got %d, %v", count, err)
+	}
+
+	failure := errors.New("failure")
+	_, err = StreamArray("GET", ts.URL, Options{}, "", func(s streamedServer) error { return failure })
+	if err != failure {
+		t.Fatalf("Expected the function's error; got %v", err)
+	}
+
+	_, err = StreamArray("GET", ts.URL+"/wrapped", Options{}, "images", func(s streamedServer) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), `"images"`) {
+		t.Fatalf("Expected a missing field to be reported; got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package perigee
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// The MissingPathParamError structure is returned when a RequestTemplate is instantiated without a value for one of its path parameters.
+type MissingPathParamError struct {
+	Path  string
+	Param string
+}
+
+func (err *MissingPathParamError) Error() string {
+	return fmt.Sprintf("No value given for parameter {%s} of path %s", err.Param, err.Path)
+}
+
+// RequestTemplate captures what is common to every call of one API operation, such as "POST servers/{id}/action",
+// so that SDKs making many near-identical calls state the method, path, headers, and acceptable codes once,
+// and supply only what varies with each call.
+//
+// Path may hold parameters in braces, as in "servers/{id}/action", replaced by escaped values with each call.
+// Options holds the settings common to every call; the Options given to each call are layered over them with Options.Merge.
+// If Client is set, calls go through it, so its defaults and base URL apply beneath the template's;
+// otherwise Path must expand to an absolute URL.
+//
+// A RequestTemplate is safe for concurrent use, provided it is not modified once in use.
+type RequestTemplate struct {
+	Method  string
+	Path    string
+	Options Options
+	Client  *Client
+
+	segments []templateSegment
+}
+
+// templateSegment is a literal stretch of a template's path, or, if param is set, a parameter.
+type templateSegment struct {
+	text  string
+	param bool
+}
+
+// NewRequestTemplate creates a template for calls with the given method and path, applying opts to each call.
+// The template keeps its own copy of opts (see Options.Clone).
+func NewRequestTemplate(method, path string, opts Options) *RequestTemplate {
+	return &RequestTemplate{
+		Method:   method,
+		Path:     path,
+		Options:  opts.Clone(),
+		segments: parseTemplatePath(path),
+	}
+}
+
+// parseTemplatePath splits a path into literal text and parameters.
+func parseTemplatePath(path string) []templateSegment {
+	var segments []templateSegment
+	for path != "" {
+		open := strings.IndexByte(path, '{')
+		if open < 0 {
+			break
+		}
+		close := strings.IndexByte(path[open:], '}')
+		if close < 0 {
+			break
+		}
+		if open > 0 {
+			segments = append(segments, templateSegment{text: path[:open]})
+		}
+		segments = append(segments, templateSegment{text: path[open+1 : open+close], param: true})
+		path = path[open+close+1:]
+	}
+	if path != "" {
+		segments = append(segments, templateSegment{text: path})
+	}
+	return segments
+}
+
+// URL expands the template's path with the given parameters, path-escaping each value.
+func (t *RequestTemplate) URL(params map[string]string) (string, error) {
+	segments := t.segments
+	if segments == nil {
+		segments = parseTemplatePath(t.Path)
+	}
+	var b strings.Builder
+	b.Grow(len(t.Path) + 32)
+	for _, s := range segments {
+		if !s.param {
+			b.WriteString(s.text)
+			continue
+		}
+		value, ok := params[s.text]
+		if !ok {
+			return "", &MissingPathParamError{Path: t.Path, Param: s.text}
+		}
+		b.WriteString(url.PathEscape(value))
+	}
+	return b.String(), nil
+}
+
+// Do issues a call of the template with the given path parameters, layering opts (typically a body and results) over the template's Options.
+func (t *RequestTemplate) Do(params map[string]string, opts Options) (*Response, error) {
+	u, err := t.URL(params)
+	if err != nil {
+		return nil, err
+	}
+	opts = t.Options.Merge(opts)
+	if t.Client != nil {
+		return t.Client.Request(t.Method, u, opts)
+	}
+	return Request(t.Method, u, opts)
+}
@@ -0,0 +1,69 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestTemplateURL(t *testing.T) {
+	tmpl := NewRequestTemplate("POST", "servers/{id}/metadata/{key}", Options{})
+	got, err := tmpl.URL(map[string]string{"id": "abc", "key": "a b/c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "servers/abc/metadata/a%20b%2Fc"; got != want {
+		t.Fatalf("Expected %s; got %s", want, got)
+	}
+
+	_, err = tmpl.URL(map[string]string{"id": "abc"})
+	if e, ok := err.(*MissingPathParamError); !ok || e.Param != "key" {
+		t.Fatalf("Expected a MissingPathParamError for key; got %v", err)
+	}
+
+	literal := &RequestTemplate{Path: "{a}{b}/static"}
+	got, err = literal.URL(map[string]string{"a": "x", "b": "y"})
+	if err != nil || got != "xy/static" {
+		t.Fatalf("Expected xy/static; got %s, %v", got, err)
+	}
+}
+
+func TestRequestTemplateDo(t *testing.T) {
+	var method, path, token, tag string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		token, tag = r.Header.Get("X-Auth-Token"), r.Header.Get("X-Tag")
+		w.WriteHeader(202)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(Options{MoreHeaders: map[string]string{"X-Auth-Token": "secret"}})
+	client.SetBaseURL(ts.URL + "/v2")
+	reboot := NewRequestTemplate("POST", "servers/{id}/action", Options{
+		OkCodes:     []int{202},
+		MoreHeaders: map[string]string{"X-Tag": "template"},
+	})
+	reboot.Client = client
+
+	var result struct{ Ok bool }
+	_, err := reboot.Do(map[string]string{"id": "abc"}, Options{
+		ReqBody: map[string]interface{}{"reboot": map[string]string{"type": "SOFT"}},
+		Results: &result,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != "POST" || path != "/v2/servers/abc/action" {
+		t.Fatalf("Expected POST /v2/servers/abc/action; got %s %s", method, path)
+	}
+	if token != "secret" || tag != "template" {
+		t.Fatalf("Expected client and template headers; got %q and %q", token, tag)
+	}
+	if !result.Ok {
+		t.Fatal("Expected results to be decoded")
+	}
+	if reboot.Options.ReqBody != nil {
+		t.Fatal("Expected the template to be left unmodified")
+	}
+}
@@ -0,0 +1,91 @@
+package perigee
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultThrottleBurst is the burst a Throttle allows when NewThrottle is given none.
+const DefaultThrottleBurst = 32 << 10
+
+// Throttle limits the rate at which body bytes are transferred, so that background jobs don't saturate links
+// shared with interactive traffic; see Options.ThrottleUpload and Options.ThrottleDownload.
+// Every transfer using the same Throttle shares its rate, so setting one in a Client's defaults limits the client as a whole,
+// while setting one in a single call's Options limits just that call.
+// A Throttle may be used by many goroutines at once.
+type Throttle struct {
+	rate  float64
+	burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewThrottle creates a Throttle passing bytesPerSecond on average, and up to burst bytes at once.
+// A burst of zero or less means DefaultThrottleBurst.
+func NewThrottle(bytesPerSecond, burst int) *Throttle {
+	if burst <= 0 {
+		burst = DefaultThrottleBurst
+	}
+	return &Throttle{rate: float64(bytesPerSecond), burst: burst, tokens: float64(burst)}
+}
+
+// wait takes n bytes' worth of allowance, pausing until the rate permits them to pass, or until ctx is done.
+// Allowance may be overdrawn, leaving those who follow to wait in turn.
+func (t *Throttle) wait(ctx context.Context, n int) error {
+	if t.rate <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	now := time.Now()
+	if !t.last.IsZero() {
+		t.tokens += now.Sub(t.last).Seconds() * t.rate
+		if t.tokens > float64(t.burst) {
+			t.tokens = float64(t.burst)
+		}
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	deficit := -t.tokens
+	t.mu.Unlock()
+	if deficit <= 0 {
+		return nil
+	}
+	return sleep(ctx, time.Duration(deficit/t.rate*float64(time.Second)))
+}
+
+// Reader returns a reader passing r's bytes through at the Throttle's rate.
+// A pause is cut short if ctx is done, returning the context's error.
+func (t *Throttle) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &throttledReader{ctx: ctx, r: r, t: t}
+}
+
+type throttledReader struct {
+	ctx context.Context
+	r   io.Reader
+	t   *Throttle
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > tr.t.burst {
+		p = p[:tr.t.burst]
+	}
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		if werr := tr.t.wait(tr.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// throttleBody wraps a request or response body in a Throttle, keeping its Close method.
+func throttleBody(ctx context.Context, t *Throttle, body io.ReadCloser) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{t.Reader(ctx, body), body}
+}
@@ -0,0 +1,67 @@
+package perigee
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottleReader(t *testing.T) {
+	throttle := NewThrottle(100<<10, 10<<10)
+	start := time.Now()
+	n, err := io.Copy(ioutil.Discard, throttle.Reader(context.Background(), bytes.NewReader(make([]byte, 40<<10))))
+	if err != nil || n != 40<<10 {
+		t.Fatalf("Expected all 40KiB to pass; got %d, %v", n, err)
+	}
+	// The first 10KiB pass at once, as the burst; the other 30KiB take 300ms at 100KiB/s.
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("Expected the transfer to take about 300ms; took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	slow := NewThrottle(1, 1)
+	_, err = io.Copy(ioutil.Discard, slow.Reader(ctx, strings.NewReader("abc")))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected the wait to end with the context; got %v", err)
+	}
+}
+
+func TestThrottledTransfers(t *testing.T) {
+	payload := strings.Repeat("x", 30<<10)
+	var received int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received = len(b)
+		w.Write([]byte(payload))
+	}))
+	defer ts.Close()
+
+	// Upload and download share one Throttle, as a client-wide limit would.
+	throttle := NewThrottle(200<<10, 10<<10)
+	var buf bytes.Buffer
+	start := time.Now()
+	_, err := Request("PUT", ts.URL, Options{
+		ReqBody:          strings.NewReader(payload),
+		ContentType:      "text/plain",
+		ResponseBuffer:   &buf,
+		ThrottleUpload:   throttle,
+		ThrottleDownload: throttle,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received != len(payload) || buf.Len() != len(payload) {
+		t.Fatalf("Expected %d bytes each way; sent %d and received %d", len(payload), received, buf.Len())
+	}
+	// 60KiB in all, less the 10KiB burst, at 200KiB/s takes 250ms.
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("Expected the transfers to be throttled; took %s", elapsed)
+	}
+}
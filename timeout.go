@@ -0,0 +1,89 @@
+package perigee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+// The TimeoutError structure is returned when a request fails because time ran out:
+// the deadline of Options.Context passed, the http.Client's Timeout elapsed,
+// or one of the transport's own timeouts (dialing, the TLS handshake, awaiting the response headers) expired.
+// Err holds the underlying error, usually a *url.Error, and remains reachable through errors.As.
+// Other transport failures, such as DNS or TLS errors, are returned as they are.
+type TimeoutError struct {
+	Url string
+	Err error
+}
+
+func (err *TimeoutError) Error() string {
+	return fmt.Sprintf("Timed out accessing URL(%s): %s", err.Url, err.Err)
+}
+
+func (err *TimeoutError) Unwrap() error {
+	return err.Err
+}
+
+// Timeout reports that the error is a timeout, as net.Error does.
+func (err *TimeoutError) Timeout() bool {
+	return true
+}
+
+// classifyTimeout wraps a transport failure in a TimeoutError if time ran out.
+func classifyTimeout(url string, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &TimeoutError{Url: url, Err: err}
+	}
+	return err
+}
+
+// IsTimeout reports whether err, or any error it wraps, reports a timeout:
+// a TimeoutError, an OperationTimeoutError, an expired context deadline, or a net.Error whose Timeout method says so.
+func IsTimeout(err error) bool {
+	var timeoutErr *TimeoutError
+	var operationErr *OperationTimeoutError
+	var netErr net.Error
+	return errors.As(err, &timeoutErr) || errors.As(err, &operationErr) ||
+		errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// temporaryCodes lists the response codes IsTemporary counts as temporary.
+// It is kept apart from DefaultRetryableCodes, which callers may change, and which includes 500.
+var temporaryCodes = []int{429, 502, 503, 504}
+
+// IsTemporary reports whether err describes a condition likely to pass, so that the request may succeed if tried again later:
+// timeouts, refused or reset connections, temporary DNS failures, a full Bulkhead,
+// and responses with codes 429, 502, 503 or 504.
+// A 500 is not counted: unlike the gateway errors, it as often reports a bug that recurs on every attempt.
+// Configuration errors, such as an unknown host or a certificate the client does not trust, are not temporary.
+func IsTemporary(err error) bool {
+	if err == nil {
+		return false
+	}
+	if IsTimeout(err) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary
+	}
+	var full *BulkheadFullError
+	if errors.As(err, &full) {
+		return true
+	}
+	var unexpected *UnexpectedResponseCodeError
+	if errors.As(err, &unexpected) {
+		return !not_in(unexpected.Actual, temporaryCodes)
+	}
+	return false
+}
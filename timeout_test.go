@@ -0,0 +1,171 @@
+package perigee
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTimeoutError(t *testing.T) {
+	unblock := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer ts.Close()
+	defer close(unblock)
+
+	// The http.Client's own timeout.
+	_, err := Request("GET", ts.URL, Options{CustomClient: &http.Client{Timeout: 20 * time.Millisecond}})
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || timeout.Url != ts.URL {
+		t.Fatalf("Expected a TimeoutError; got %#v", err)
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Fatal("Expected the underlying *url.Error to remain reachable")
+	}
+	if !IsTimeout(err) || !IsTemporary(err) {
+		t.Fatal("Expected a timeout to be reported as a temporary timeout")
+	}
+
+	// The context's deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = Request("GET", ts.URL, Options{Context: ctx})
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Fatalf("Expected a TimeoutError; got %#v", err)
+	}
+
+	// Cancellation is not a timeout.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = Request("GET", ts.URL, Options{Context: ctx})
+	if err == nil || IsTimeout(err) {
+		t.Fatalf("Expected cancellation not to be a timeout; got %#v", err)
+	}
+}
+
+func TestIsTemporary(t *testing.T) {
+	// Find a port nobody listens on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	_, err = Request("GET", "http://"+addr, Options{})
+	if err == nil || IsTimeout(err) || !IsTemporary(err) {
+		t.Fatalf("Expected a refused connection to be temporary, but not a timeout; got %#v", err)
+	}
+
+	cases := []struct {
+		err       error
+		temporary bool
+	}{
+		{&UnexpectedResponseCodeError{Actual: 503}, true},
+		{&UnexpectedResponseCodeError{Actual: 500}, false},
+		{&UnexpectedResponseCodeError{Actual: 404}, false},
+		{&net.DNSError{Err: "no such host", IsNotFound: true}, false},
+		{&net.DNSError{Err: "server misbehaving", IsTemporary: true}, true},
+		{errors.New("x509: certificate signed by unknown authority"), false},
+	}
+	for _, c := range cases {
+		if got := IsTemporary(c.err); got != c.temporary {
+			t.Errorf("Expected IsTemporary(%v) to be %v", c.err, c.temporary)
+		}
+	}
+}
+
+func TestPartialResponseOnTimeout(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "abc")
+		w.Write([]byte(`{"items": [1, 2`))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var results map[string]interface{}
+	resp, err := Request("GET", ts.URL, Options{Context: ctx, Results: &results})
+	if !IsTimeout(err) {
+		t.Fatalf("Expected a timeout; got %v", err)
+	}
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Fatalf("Expected a TimeoutError; got %T", err)
+	}
+	if resp == nil || resp.StatusCode != 200 || resp.HttpResponse.Header.Get("X-Request-Id") != "abc" {
+		t.Fatalf("Expected the status and headers alongside the error; got %+v", resp)
+	}
+	if string(resp.JsonResult) != `{"items": [1, 2` {
+		t.Fatalf("Expected the body read so far; got %q", resp.JsonResult)
+	}
+	if resp.Timing.Headers <= 0 || resp.Timing.Total < 50*time.Millisecond || resp.Timing.Total < resp.Timing.Headers {
+		t.Fatalf("Expected timings; got %+v", resp.Timing)
+	}
+}
+
+func TestDeadlineHeader(t *testing.T) {
+	var got []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("X-Request-Timeout-Ms"))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := Request("GET", ts.URL, Options{Context: ctx, DeadlineHeader: "X-Request-Timeout-Ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Request("GET", ts.URL, Options{DeadlineHeader: "X-Request-Timeout-Ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := strconv.Atoi(got[0])
+	if err != nil || ms <= 4000 || ms > 5000 {
+		t.Fatalf("Expected just under 5000ms to remain; got %q", got[0])
+	}
+	if got[1] != "" {
+		t.Fatalf("Expected no header without a deadline; got %q", got[1])
+	}
+}
+
+func TestRequestWithContext(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err := RequestWithContext(ctx, "GET", ts.URL, Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the request to be canceled; got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = NewClient(Options{}).RequestWithContext(ctx, "GET", ts.URL, Options{})
+	if !IsTimeout(err) {
+		t.Fatalf("Expected the client's request to time out; got %v", err)
+	}
+}
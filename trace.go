@@ -0,0 +1,63 @@
+package perigee
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"time"
+)
+
+// ConnInfo describes the connection which carried a request, for diagnosing connection pool exhaustion and load balancer behavior.
+// Reused reports whether the connection had carried earlier requests; if so, WasIdle and IdleTime tell whether,
+// and for how long, it sat idle in the pool beforehand.
+// RemoteAddr names the server (or load balancer) at the other end; LocalAddr, this end.
+// TLSResumed reports whether the connection's TLS session was resumed, rather than established by a full handshake;
+// see ClientConfig.TLSSessionCacheSize.
+// The fields are zero if no connection was obtained, or if the transport does not report connections (as with HTTP/3).
+type ConnInfo struct {
+	Reused     bool
+	WasIdle    bool
+	IdleTime   time.Duration
+	RemoteAddr string
+	LocalAddr  string
+	TLSResumed bool
+}
+
+// Timing records how long a request took.
+// Headers measures from the start of the request to the arrival of the final response's headers, including any retries;
+// Total measures to the completion of the request, including reading and decoding the body.
+// If no response arrived, Headers measures the time until the request failed.
+type Timing struct {
+	Headers time.Duration
+	Total   time.Duration
+}
+
+// withTrace attaches to ctx the httptrace hooks reporting on a request, recording its connection in conn.
+// With retries, conn describes the connection of the last attempt.
+func withTrace(ctx context.Context, opts Options, conn *ConnInfo) context.Context {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			*conn = ConnInfo{
+				Reused:   info.Reused,
+				WasIdle:  info.WasIdle,
+				IdleTime: info.IdleTime,
+			}
+			if info.Conn != nil {
+				conn.RemoteAddr = info.Conn.RemoteAddr().String()
+				conn.LocalAddr = info.Conn.LocalAddr().String()
+			}
+			if tc, ok := info.Conn.(*tls.Conn); ok {
+				conn.TLSResumed = tc.ConnectionState().DidResume
+			}
+		},
+	}
+	if opts.OnInformational != nil {
+		trace.Got1xxResponse = func(code int, header textproto.MIMEHeader) error {
+			opts.OnInformational(code, http.Header(header))
+			return nil
+		}
+	}
+	return httptrace.WithClientTrace(ctx, trace)
+}
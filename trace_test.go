@@ -0,0 +1,60 @@
+package perigee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOnInformational(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	var codes []int
+	var link string
+	_, err := Request("GET", ts.URL, Options{
+		OnInformational: func(code int, header http.Header) {
+			codes = append(codes, code)
+			link = header.Get("Link")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 1 || codes[0] != 103 {
+		t.Fatalf("Expected a 103; got %v", codes)
+	}
+	if link != "</style.css>; rel=preload; as=style" {
+		t.Fatalf("Expected the hint's Link header; got %q", link)
+	}
+}
+
+func TestConnInfo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	var results map[string]interface{}
+	first, err := Request("GET", ts.URL, Options{CustomClient: client, Results: &results})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Conn.Reused || first.Conn.RemoteAddr != ts.Listener.Addr().String() || first.Conn.LocalAddr == "" {
+		t.Fatalf("Expected a fresh connection to %s; got %+v", ts.Listener.Addr(), first.Conn)
+	}
+
+	second, err := Request("GET", ts.URL, Options{CustomClient: client, Results: &results})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Conn.Reused || !second.Conn.WasIdle || second.Conn.LocalAddr != first.Conn.LocalAddr {
+		t.Fatalf("Expected the idle connection to be reused; got %+v", second.Conn)
+	}
+}
@@ -0,0 +1,182 @@
+package perigee
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TusVersion is the version of the tus resumable upload protocol spoken by TusUpload.
+const TusVersion = "1.0.0"
+
+// DefaultTusChunkSize is the number of bytes TusUpload sends per PATCH request when ChunkSize is unset.
+const DefaultTusChunkSize = 4 << 20
+
+// TusUpload drives the tus resumable upload protocol (https://tus.io/protocols/resumable-upload) for a single file.
+//
+// CreateURL names the server's creation endpoint.
+// Create posts there, and records the URL of the new upload resource in Location.
+// To resume an upload begun earlier, perhaps by another process, set Location instead and skip creation.
+//
+// Length gives the total size of the upload, in bytes.
+// Metadata, if provided, is sent as the Upload-Metadata header at creation time.
+//
+// ChunkSize bounds the size of each PATCH request; it defaults to DefaultTusChunkSize.
+//
+// Options provides the settings (client, authentication headers, and so on) common to every request made for the upload.
+//
+// Progress, if set, is invoked after each chunk is accepted with the server's new offset.
+type TusUpload struct {
+	CreateURL string
+	Location  string
+	Length    int64
+	Metadata  map[string]string
+	ChunkSize int64
+	Options   Options
+	Progress  func(offset, length int64)
+}
+
+// options returns a copy of the upload's Options with the given headers, plus Tus-Resumable, added.
+func (u *TusUpload) options(headers map[string]string) Options {
+	opts := u.Options
+	opts.MoreHeaders = make(map[string]string, len(u.Options.MoreHeaders)+len(headers)+1)
+	for k, v := range u.Options.MoreHeaders {
+		opts.MoreHeaders[k] = v
+	}
+	for k, v := range headers {
+		opts.MoreHeaders[k] = v
+	}
+	opts.MoreHeaders["Tus-Resumable"] = TusVersion
+	opts.ReqBody = nil
+	opts.Results = nil
+	return opts
+}
+
+// encodeTusMetadata renders metadata in the Upload-Metadata format: comma-separated keys with base64-encoded values.
+func encodeTusMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + " " + base64.StdEncoding.EncodeToString([]byte(metadata[k]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Create asks the server to create a new upload resource, recording its URL in Location.
+func (u *TusUpload) Create() error {
+	headers := map[string]string{"Upload-Length": strconv.FormatInt(u.Length, 10)}
+	if len(u.Metadata) > 0 {
+		headers["Upload-Metadata"] = encodeTusMetadata(u.Metadata)
+	}
+	opts := u.options(headers)
+	opts.OkCodes = []int{201}
+
+	resp, err := Request("POST", u.CreateURL, opts)
+	if err != nil {
+		return err
+	}
+	location := resp.HttpResponse.Header.Get("Location")
+	if location == "" {
+		return fmt.Errorf("tus server at %s created an upload without providing its Location", u.CreateURL)
+	}
+	base, err := url.Parse(u.CreateURL)
+	if err != nil {
+		return err
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	u.Location = base.ResolveReference(ref).String()
+	return nil
+}
+
+// Offset asks the server how many bytes of the upload it has already received.
+func (u *TusUpload) Offset() (int64, error) {
+	opts := u.options(nil)
+	opts.OkCodes = []int{200, 204}
+
+	resp, err := Request("HEAD", u.Location, opts)
+	if err != nil {
+		return 0, err
+	}
+	return parseTusOffset(resp)
+}
+
+func parseTusOffset(resp *Response) (int64, error) {
+	header := resp.HttpResponse.Header.Get("Upload-Offset")
+	offset, err := strconv.ParseInt(header, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("tus server returned an invalid Upload-Offset %q", header)
+	}
+	return offset, nil
+}
+
+// Upload sends the content of r to the server, creating the upload first if Location is unset.
+// The server is always asked for its current offset before sending, so if Upload fails partway through,
+// calling it again resumes from wherever the server left off rather than starting over.
+func (u *TusUpload) Upload(r io.ReaderAt) error {
+	if u.Location == "" {
+		err := u.Create()
+		if err != nil {
+			return err
+		}
+	}
+
+	offset, err := u.Offset()
+	if err != nil {
+		return err
+	}
+
+	chunkSize := u.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultTusChunkSize
+	}
+	buf := make([]byte, chunkSize)
+
+	for offset < u.Length {
+		n := chunkSize
+		if remaining := u.Length - offset; remaining < n {
+			n = remaining
+		}
+		read, err := r.ReadAt(buf[:n], offset)
+		if int64(read) < n {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+
+		opts := u.options(map[string]string{"Upload-Offset": strconv.FormatInt(offset, 10)})
+		opts.ReqBody = bytes.NewReader(buf[:n])
+		opts.ContentType = "application/offset+octet-stream"
+		opts.ContentLength = n
+		opts.OkCodes = []int{204}
+
+		resp, err := Request("PATCH", u.Location, opts)
+		if err != nil {
+			return err
+		}
+		next, err := parseTusOffset(resp)
+		if err != nil {
+			return err
+		}
+		if next <= offset {
+			return fmt.Errorf("tus server at %s made no progress past offset %d", u.Location, offset)
+		}
+		offset = next
+		if u.Progress != nil {
+			u.Progress(offset, u.Length)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package perigee
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tusServer implements just enough of the tus protocol to exercise TusUpload.
+type tusServer struct {
+	mu        sync.Mutex
+	data      []byte
+	length    int64
+	metadata  string
+	failAfter int // fail the PATCH following this many successful ones; 0 disables
+	patches   int
+}
+
+func (s *tusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Header.Get("Tus-Resumable") != TusVersion {
+		w.WriteHeader(412)
+		return
+	}
+	switch r.Method {
+	case "POST":
+		s.length, _ = strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		s.metadata = r.Header.Get("Upload-Metadata")
+		w.Header().Set("Location", "/files/1")
+		w.WriteHeader(201)
+	case "HEAD":
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(s.data)))
+		w.Header().Set("Upload-Length", strconv.FormatInt(s.length, 10))
+		w.WriteHeader(200)
+	case "PATCH":
+		if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+			w.WriteHeader(415)
+			return
+		}
+		if r.Header.Get("Upload-Offset") != strconv.Itoa(len(s.data)) {
+			w.WriteHeader(409)
+			return
+		}
+		if s.failAfter > 0 && s.patches == s.failAfter {
+			s.failAfter = 0
+			w.WriteHeader(500)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		s.data = append(s.data, body...)
+		s.patches++
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(s.data)))
+		w.WriteHeader(204)
+	}
+}
+
+func TestTusUpload(t *testing.T) {
+	server := &tusServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	content := []byte(strings.Repeat("0123456789", 10))
+	var progress []int64
+	upload := &TusUpload{
+		CreateURL: ts.URL + "/files",
+		Length:    int64(len(content)),
+		Metadata:  map[string]string{"filename": "numbers.txt"},
+		ChunkSize: 30,
+		Progress: func(offset, length int64) {
+			progress = append(progress, offset)
+		},
+	}
+
+	err := upload.Upload(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upload.Location != ts.URL+"/files/1" {
+		t.Fatalf("Expected the upload to be located at %s/files/1; got %s", ts.URL, upload.Location)
+	}
+	if !bytes.Equal(server.data, content) {
+		t.Fatalf("Server received %q", server.data)
+	}
+	if server.metadata != "filename bnVtYmVycy50eHQ=" {
+		t.Fatalf("Unexpected Upload-Metadata %q", server.metadata)
+	}
+	if len(progress) != 4 || progress[3] != 100 {
+		t.Fatalf("Expected progress reports at 30, 60, 90, 100; got %v", progress)
+	}
+}
+
+func TestTusUploadResumes(t *testing.T) {
+	server := &tusServer{failAfter: 2}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	content := []byte(strings.Repeat("abcdefghij", 10))
+	upload := &TusUpload{
+		CreateURL: ts.URL + "/files",
+		Length:    int64(len(content)),
+		ChunkSize: 25,
+	}
+
+	err := upload.Upload(bytes.NewReader(content))
+	if _, ok := err.(*UnexpectedResponseCodeError); !ok {
+		t.Fatalf("Expected the interrupted upload to fail with *UnexpectedResponseCodeError; got %#v", err)
+	}
+	if offset, _ := upload.Offset(); offset != 50 {
+		t.Fatalf("Expected the server to hold 50 bytes; has %d", offset)
+	}
+
+	// A second attempt, e.g. from a new process that only knows the upload's location, picks up where the first left off.
+	resumed := &TusUpload{Location: upload.Location, Length: upload.Length, ChunkSize: 25}
+	err = resumed.Upload(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(server.data, content) {
+		t.Fatalf("Server received %q", server.data)
+	}
+	if server.patches != 4 {
+		t.Fatalf("Expected 4 successful PATCH requests in total; got %d", server.patches)
+	}
+}
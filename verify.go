@@ -0,0 +1,134 @@
+package perigee
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrSignatureMissing is reported by the verifiers in this package when a response carries no signature.
+	ErrSignatureMissing = errors.New("perigee: response is not signed")
+
+	// ErrSignatureMismatch is reported by the verifiers in this package when a response's signature does not match its body.
+	ErrSignatureMismatch = errors.New("perigee: response signature does not match")
+)
+
+// A ResponseVerifier checks the signature a server computed over a response, given its body; see Options.Verifier.
+type ResponseVerifier interface {
+	VerifyResponse(resp *http.Response, body []byte) error
+}
+
+// The VerificationError structure is returned when a ResponseVerifier rejects a response.
+// Err holds the verifier's reason, such as ErrSignatureMismatch, and remains reachable through errors.Is.
+type VerificationError struct {
+	Url string
+	Err error
+}
+
+func (err *VerificationError) Error() string {
+	return fmt.Sprintf("Could not verify the response from URL(%s): %s", err.Url, err.Err)
+}
+
+func (err *VerificationError) Unwrap() error {
+	return err.Err
+}
+
+// HMACVerifier is a ResponseVerifier for signatures made with a secret shared with the server:
+// the HMAC of the body, keyed with Key, sent hex- or base64-encoded in the named Header (X-Signature if empty).
+// Hash selects the hash function, SHA-256 if nil.
+// Prefix, if set, is expected before the signature, as in GitHub's "sha256=".
+type HMACVerifier struct {
+	Key    []byte
+	Hash   func() hash.Hash
+	Header string
+	Prefix string
+}
+
+// VerifyResponse implements the ResponseVerifier interface.
+func (v *HMACVerifier) VerifyResponse(resp *http.Response, body []byte) error {
+	sig, err := signature(resp, v.Header, v.Prefix, true)
+	if err != nil {
+		return err
+	}
+	h := v.Hash
+	if h == nil {
+		h = sha256.New
+	}
+	mac := hmac.New(h, v.Key)
+	mac.Write(body)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// PublicKeyVerifier is a ResponseVerifier for signatures made with the server's private key,
+// sent base64-encoded in the named Header (X-Signature if empty).
+// Key may be an ed25519.PublicKey, verifying Ed25519 signatures of the body,
+// or an *rsa.PublicKey or *ecdsa.PublicKey, verifying PKCS #1 v1.5 or ASN.1 ECDSA signatures of its SHA-256 digest.
+type PublicKeyVerifier struct {
+	Key    crypto.PublicKey
+	Header string
+}
+
+// VerifyResponse implements the ResponseVerifier interface.
+func (v *PublicKeyVerifier) VerifyResponse(resp *http.Response, body []byte) error {
+	sig, err := signature(resp, v.Header, "", false)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(body)
+	var ok bool
+	switch key := v.Key.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, body, sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(key, digest[:], sig)
+	default:
+		return fmt.Errorf("perigee: unsupported public key type %T", v.Key)
+	}
+	if !ok {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// signature extracts and decodes a response's signature from the named header.
+// Hex is tried first if allowed, then base64 with either alphabet.
+func signature(resp *http.Response, header, prefix string, allowHex bool) ([]byte, error) {
+	if header == "" {
+		header = "X-Signature"
+	}
+	value := strings.TrimSpace(resp.Header.Get(header))
+	if value == "" {
+		return nil, ErrSignatureMissing
+	}
+	if !strings.HasPrefix(value, prefix) {
+		return nil, ErrSignatureMismatch
+	}
+	value = value[len(prefix):]
+	if allowHex {
+		if sig, err := hex.DecodeString(value); err == nil {
+			return sig, nil
+		}
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if sig, err := enc.DecodeString(value); err == nil {
+			return sig, nil
+		}
+	}
+	return nil, ErrSignatureMismatch
+}
@@ -0,0 +1,91 @@
+package perigee
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHMACVerifier(t *testing.T) {
+	body := `{"amount": 100}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(body))
+	good := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, tc := range []struct {
+		signature string
+		want      error
+	}{
+		{good, nil},
+		{"", ErrSignatureMissing},
+		{"sha256=" + hex.EncodeToString([]byte("forged")), ErrSignatureMismatch},
+		{hex.EncodeToString(mac.Sum(nil)), ErrSignatureMismatch},
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if tc.signature != "" {
+				w.Header().Set("X-Hub-Signature-256", tc.signature)
+			}
+			w.Write([]byte(body))
+		}))
+		var results map[string]int
+		_, err := Request("GET", ts.URL, Options{
+			Results:  &results,
+			Verifier: &HMACVerifier{Key: []byte("secret"), Header: "X-Hub-Signature-256", Prefix: "sha256="},
+		})
+		ts.Close()
+
+		if tc.want == nil {
+			if err != nil || results["amount"] != 100 {
+				t.Fatalf("Expected a verified response; got %v, %v", results, err)
+			}
+			continue
+		}
+		var verr *VerificationError
+		if !errors.As(err, &verr) || !errors.Is(err, tc.want) {
+			t.Fatalf("Expected a VerificationError for %q; got %v", tc.signature, err)
+		}
+		if results != nil {
+			t.Fatalf("Expected nothing to be decoded from an unverified response; got %v", results)
+		}
+	}
+}
+
+func TestPublicKeyVerifier(t *testing.T) {
+	body := []byte(`{"ok": true}`)
+	digest := sha256.Sum256(body)
+
+	edPublic, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaSig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecSig, _ := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+
+	for _, tc := range []struct {
+		key crypto.PublicKey
+		sig []byte
+	}{
+		{edPublic, ed25519.Sign(edPrivate, body)},
+		{&rsaKey.PublicKey, rsaSig},
+		{&ecKey.PublicKey, ecSig},
+	} {
+		resp := &http.Response{Header: http.Header{"X-Signature": {base64.StdEncoding.EncodeToString(tc.sig)}}}
+		v := &PublicKeyVerifier{Key: tc.key}
+		if err := v.VerifyResponse(resp, body); err != nil {
+			t.Fatalf("Expected a %T signature to verify; got %v", tc.key, err)
+		}
+		if err := v.VerifyResponse(resp, []byte(`{"ok": false}`)); err != ErrSignatureMismatch {
+			t.Fatalf("Expected a tampered body to fail %T verification; got %v", tc.key, err)
+		}
+	}
+}